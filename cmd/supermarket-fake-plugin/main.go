@@ -0,0 +1,25 @@
+// Command supermarket-fake-plugin serves the fake provider as a plugin, as an example of the
+// plugin SDK and to exercise the plugin support of the CLI:
+//
+//	go build -o /tmp/fake-plugin ./cmd/supermarket-fake-plugin
+//	supermarket --plugins="fakeplugin=/tmp/fake-plugin --fake_deals=20" --provider=fakeplugin
+//
+// The fake_* flags configure the fake provider, pass them after the path in --plugins.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/csobrinho/supermarket-api/pkg/plugin"
+	"github.com/csobrinho/supermarket-api/providers/fake"
+)
+
+func main() {
+	flag.Parse()
+	if err := plugin.Serve("fake", fake.Creator, fake.Capabilities...); err != nil {
+		fmt.Fprintf(os.Stderr, "supermarket-fake-plugin: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/clipper"
+	"github.com/csobrinho/supermarket-api/internal/logging"
+	"github.com/csobrinho/supermarket-api/internal/openapi"
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/internal/scheduler"
+)
+
+// Page sizes of the deals listed by the API.
+const (
+	apiDefaultPageSize = 100
+	apiMaxPageSize     = 1000
+)
+
+// dealPage is the response of the deals listing.
+type dealPage struct {
+	Deals     []promotion.ClipDeal `json:"deals"`
+	TotalSize int                  `json:"total_size"` // Deals matching the filters, in all pages.
+	// NextPageToken is the page_token of the next page, empty on the last page.
+	NextPageToken string `json:"next_page_token,omitempty"`
+}
+
+// clipResult is the response of a clip.
+type clipResult struct {
+	Deal           promotion.ClipDeal `json:"deal"`
+	AlreadyClipped bool               `json:"already_clipped"`
+	HTTPStatus     int                `json:"http_status,omitempty"` // Status of the provider response.
+}
+
+// accountRun is the state of the runs of an account.
+type accountRun struct {
+	Account   string    `json:"account"`
+	Running   bool      `json:"running"`
+	LastStart time.Time `json:"last_start,omitzero"`
+	LastEnd   time.Time `json:"last_end,omitzero"`
+	LastError string    `json:"last_error,omitempty"` // Empty if the last run succeeded.
+	NextRun   time.Time `json:"next_run,omitzero"`
+	Runs      int       `json:"runs"`
+	Failures  int       `json:"failures"` // Consecutive failed runs.
+}
+
+// runList is the response of the runs listing.
+type runList struct {
+	Runs []accountRun `json:"runs"`
+}
+
+// errorResponse is the body of the failed requests.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// api is the REST API of serve over the promotion services of its accounts.
+type api struct {
+	ctx      context.Context // Of serve, the runs started by the API stop with it.
+	sched    *scheduler.Scheduler
+	accounts map[string]*accountState
+	keys     []string
+}
+
+// apiRoute is an operation of the API. The routes of the mux and the OpenAPI document are both
+// generated from them.
+type apiRoute struct {
+	method, path string
+	id, summary  string
+	params       []openapi.Parameter
+	response     any   // Zero value of the body of the successful responses.
+	status       int   // Status code of the successful responses, 200 if zero.
+	errors       []int // Status codes of the failures, in addition to 401.
+	handler      http.HandlerFunc
+}
+
+var (
+	apiAccountParam = openapi.Parameter{Name: "account", In: "path", Required: true, Description: "Name of the account in the serve config.", Schema: &openapi.Schema{Type: "string"}}
+	apiDealParam    = openapi.Parameter{Name: "id", In: "path", Required: true, Description: "ID of the deal.", Schema: &openapi.Schema{Type: "string"}}
+)
+
+func (a *api) routes() []apiRoute {
+	minPage, maxPage := 1.0, float64(apiMaxPageSize)
+	return []apiRoute{
+		{
+			method: http.MethodGet, path: "/v1/accounts/{account}/deals",
+			id: "listDeals", summary: "List the deals of the account, sorted by id.",
+			params: []openapi.Parameter{
+				apiAccountParam,
+				{Name: "type", In: "query", Description: "Only list deals of this type, e.g. clip_deal or coupon.", Schema: &openapi.Schema{Type: "string"}},
+				{Name: "category", In: "query", Description: "Only list deals of this category.", Schema: &openapi.Schema{Type: "string"}},
+				{Name: "product_id", In: "query", Description: "Only list deals of this UPC.", Schema: &openapi.Schema{Type: "string"}},
+				{Name: "clipped_only", In: "query", Description: "If true, only list clipped deals.", Schema: &openapi.Schema{Type: "boolean"}},
+				{Name: "page_size", In: "query", Description: "Maximum number of deals of the page.", Schema: &openapi.Schema{Type: "integer", Default: apiDefaultPageSize, Minimum: &minPage, Maximum: &maxPage}},
+				{Name: "page_token", In: "query", Description: "next_page_token of the previous page.", Schema: &openapi.Schema{Type: "string"}},
+			},
+			response: dealPage{},
+			errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusBadGateway},
+			handler:  a.listDeals,
+		},
+		{
+			method: http.MethodPost, path: "/v1/accounts/{account}/deals/{id}/clip",
+			id: "clipDeal", summary: "Clip a deal of the account.",
+			params:   []openapi.Parameter{apiAccountParam, apiDealParam},
+			response: clipResult{},
+			errors:   []int{http.StatusNotFound, http.StatusConflict, http.StatusBadGateway},
+			handler:  a.clipDeal,
+		},
+		{
+			method: http.MethodPost, path: "/v1/accounts/{account}/deals/clip-all",
+			id: "clipAllDeals", summary: "Start a run of the account now, off schedule, clipping all its deals. Poll listRuns for its outcome.",
+			params:   []openapi.Parameter{apiAccountParam},
+			response: accountRun{},
+			status:   http.StatusAccepted,
+			errors:   []int{http.StatusNotFound, http.StatusConflict},
+			handler:  a.clipAll,
+		},
+		{
+			method: http.MethodGet, path: "/v1/runs",
+			id: "listRuns", summary: "List the state of the runs of the accounts.",
+			response: runList{},
+			handler:  a.listRuns,
+		},
+	}
+}
+
+// register adds the routes of the API and its OpenAPI document, on /v1/openapi.json, to the mux.
+func (a *api) register(mux *http.ServeMux) {
+	doc := openapi.New(openapi.Info{
+		Title:       "supermarket",
+		Description: "Lists and clips the deals of the accounts of supermarket serve.",
+		Version:     version,
+	})
+	doc.Components.SecuritySchemes = map[string]openapi.SecurityScheme{
+		"bearer": {Type: "http", Scheme: "bearer"},
+		"apiKey": {Type: "apiKey", In: "header", Name: "X-API-Key"},
+	}
+	doc.Security = []map[string][]string{{"bearer": {}}, {"apiKey": {}}}
+	for _, r := range a.routes() {
+		op := &openapi.Operation{
+			OperationID: r.id,
+			Summary:     r.summary,
+			Parameters:  r.params,
+			Responses: map[string]openapi.Response{
+				strconv.Itoa(cmp.Or(r.status, http.StatusOK)): {Description: http.StatusText(cmp.Or(r.status, http.StatusOK)), Content: doc.JSON(r.response)},
+			},
+		}
+		for _, code := range append([]int{http.StatusUnauthorized}, r.errors...) {
+			op.Responses[strconv.Itoa(code)] = openapi.Response{Description: http.StatusText(code), Content: doc.JSON(errorResponse{})}
+		}
+		doc.Add(r.method, r.path, op)
+		mux.Handle(r.method+" "+r.path, apiKeyAuth(r.handler, a.keys))
+	}
+	mux.Handle("GET /v1/openapi.json", doc.Handler())
+}
+
+// apiKeyAuth requires one of the keys, as a bearer token or in the X-API-Key header, on the
+// requests of h.
+func apiKeyAuth(h http.Handler, keys []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-API-Key")
+		if v, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			key = v
+		}
+		valid := key != "" && slices.ContainsFunc(keys, func(k string) bool {
+			return subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1
+		})
+		if !valid {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="supermarket"`)
+			writeAPIError(w, http.StatusUnauthorized, errors.New("missing or invalid API key"))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (a *api) listDeals(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts := promotion.PromotionSearchOptions{}
+	if v := q.Get("type"); v != "" {
+		t := promotion.PromotionType(v)
+		opts.Type = &t
+	}
+	if v := q.Get("category"); v != "" {
+		opts.Category = &v
+	}
+	if v := q.Get("product_id"); v != "" {
+		opts.ProductID = &v
+	}
+	if v := q.Get("clipped_only"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid clipped_only %q", v))
+			return
+		}
+		opts.ClippedOnly = &b
+	}
+	size := apiDefaultPageSize
+	if v := q.Get("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > apiMaxPageSize {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid page_size %q, expected 1 to %d", v, apiMaxPageSize))
+			return
+		}
+		size = n
+	}
+	offset, err := parsePageToken(q.Get("page_token"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var cds []promotion.ClipDeal
+	code, err := a.withAccount(r.Context(), r.PathValue("account"), func(ctx context.Context, c *accountClient) error {
+		var err error
+		cds, err = fetchDeals(ctx, c.cfg, c.ps, opts)
+		return err
+	})
+	if err != nil {
+		writeAPIError(w, code, err)
+		return
+	}
+	// Providers don't list the deals in a stable order, the pages need one.
+	slices.SortFunc(cds, func(a, b promotion.ClipDeal) int { return strings.Compare(a.ID, b.ID) })
+	resp := dealPage{Deals: []promotion.ClipDeal{}, TotalSize: len(cds)}
+	if offset < len(cds) {
+		end := min(offset+size, len(cds))
+		resp.Deals = cds[offset:end]
+		if end < len(cds) {
+			resp.NextPageToken = pageToken(end)
+		}
+	}
+	writeAPI(w, http.StatusOK, resp)
+}
+
+func (a *api) clipDeal(w http.ResponseWriter, r *http.Request) {
+	var resp clipResult
+	code, err := a.withAccount(r.Context(), r.PathValue("account"), func(ctx context.Context, c *accountClient) error {
+		cds, err := fetchDeals(ctx, c.cfg, c.ps, promotion.PromotionSearchOptions{})
+		if err != nil {
+			return err
+		}
+		found, err := findDeals(cds, []string{r.PathValue("id")})
+		if err != nil {
+			return &apiStatusError{http.StatusNotFound, err}
+		}
+		resp.Deal = found[0]
+		if resp.Deal.IsClipped {
+			resp.AlreadyClipped = true
+			return nil
+		}
+		var attempt clipper.Attempt
+		if _, err := clipDeals(ctx, c.cfg, c.ps, found, func(a clipper.Attempt) { attempt = a }); err != nil {
+			return err
+		}
+		resp.HTTPStatus = attempt.HTTPStatus
+		if attempt.Err != nil {
+			if errors.Is(attempt.Err, promotion.ErrClipLimitReached) {
+				return &apiStatusError{http.StatusConflict, attempt.Err}
+			}
+			return attempt.Err
+		}
+		resp.Deal.IsClipped = true
+		return nil
+	})
+	if err != nil {
+		writeAPIError(w, code, err)
+		return
+	}
+	writeAPI(w, http.StatusOK, resp)
+}
+
+func (a *api) clipAll(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("account")
+	if _, ok := a.accounts[name]; !ok {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("account %q not found", name))
+		return
+	}
+	// The run goes on if the client goes away, until serve shuts down. Its outcome is the one of the
+	// account in the runs listing.
+	err := a.sched.Start(withClipAll(a.ctx), name)
+	if errors.Is(err, scheduler.ErrRunning) {
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAPI(w, http.StatusAccepted, newAccountRun(name, a.sched.Jobs()[name]))
+}
+
+func (a *api) listRuns(w http.ResponseWriter, r *http.Request) {
+	jobs := a.sched.Jobs()
+	resp := runList{Runs: make([]accountRun, 0, len(jobs))}
+	for _, name := range slices.Sorted(maps.Keys(jobs)) {
+		resp.Runs = append(resp.Runs, newAccountRun(name, jobs[name]))
+	}
+	writeAPI(w, http.StatusOK, resp)
+}
+
+func newAccountRun(name string, st scheduler.JobState) accountRun {
+	return accountRun{
+		Account:   name,
+		Running:   st.Running,
+		LastStart: st.LastStart,
+		LastEnd:   st.LastEnd,
+		LastError: st.LastError,
+		NextRun:   st.NextRun,
+		Runs:      st.Runs,
+		Failures:  st.Failures,
+	}
+}
+
+// apiStatusError is an error with the status code of its response.
+type apiStatusError struct {
+	code int
+	err  error
+}
+
+func (e *apiStatusError) Error() string { return e.err.Error() }
+func (e *apiStatusError) Unwrap() error { return e.err }
+
+// withAccount calls f with the client of the account, under its lock. The client is created and
+// authenticated by the first request, and kept until it fails or a run of the account resets it. On
+// failure, it returns the status code of the response: 404 for unknown accounts, the one of an
+// apiStatusError, or 502 for the errors of the provider.
+func (a *api) withAccount(ctx context.Context, name string, f func(ctx context.Context, c *accountClient) error) (int, error) {
+	acc, ok := a.accounts[name]
+	if !ok {
+		return http.StatusNotFound, fmt.Errorf("account %q not found", name)
+	}
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+	if acc.client == nil {
+		c, err := a.newClient(acc)
+		if err != nil {
+			return http.StatusBadGateway, err
+		}
+		acc.client = c
+	}
+	err := f(logging.WithAttrs(ctx, logging.KeyProvider, acc.client.cfg.provider, logging.KeyAccount, acc.client.cfg.account), acc.client)
+	if se := (*apiStatusError)(nil); errors.As(err, &se) {
+		return se.code, err
+	}
+	if err != nil {
+		// The token may have expired or been revoked, the next request authenticates again.
+		acc.resetClient()
+		return http.StatusBadGateway, err
+	}
+	return http.StatusOK, nil
+}
+
+// newClient creates and authenticates a client of the account, and keeps its rotated refresh token.
+// The client outlives the request, it uses the context of serve.
+func (a *api) newClient(acc *accountState) (*accountClient, error) {
+	values, err := a.sched.Values(acc.Name)
+	if err != nil {
+		return nil, err
+	}
+	cfg, keep, err := accountConfig(acc.serveAccount, values)
+	if err != nil {
+		return nil, err
+	}
+	ctx := logging.WithAttrs(a.ctx, logging.KeyProvider, cfg.provider, logging.KeyAccount, cfg.account)
+	sm, close, err := newSupermarket(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	ps, err := authenticate(ctx, cfg, sm)
+	if err != nil {
+		close()
+		return nil, err
+	}
+	keep()
+	if err := a.sched.SetValues(acc.Name, values); err != nil {
+		log.ErrorContext(ctx, "failed to save the account values", logging.KeyError, err)
+	}
+	return &accountClient{cfg: cfg, ps: ps, close: close}, nil
+}
+
+// pageToken returns the opaque token of the page starting at offset.
+func pageToken(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func parsePageToken(token string) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, fmt.Errorf("invalid page_token %q", token)
+	}
+	offset, err := strconv.Atoi(string(b))
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("invalid page_token %q", token)
+	}
+	return offset, nil
+}
+
+func writeAPI(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, code int, err error) {
+	writeAPI(w, code, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/scheduler"
+)
+
+const testAPIKey = "secret"
+
+// newTestAPI serves the API over the accounts of the fake provider with the flags, sharing a
+// catalog of 5 deals, 1 clipped and 2 in the produce category.
+func newTestAPI(t *testing.T, flags map[string]map[string]string) (*api, *httptest.Server) {
+	t.Helper()
+	restoreFlags(t)
+	dir := t.TempDir()
+	catalog := filepath.Join(dir, "catalog.json")
+	deals := `[{"id":"5","is_clippable":true},{"id":"4","is_clippable":true,"categories":["Produce"]},{"id":"3","is_clippable":true,"is_clipped":true},` +
+		`{"id":"2","is_clippable":true,"categories":["Produce"]},{"id":"1","is_clippable":true}]`
+	if err := os.WriteFile(catalog, []byte(deals), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := scheduler.New(filepath.Join(dir, "serve.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &api{ctx: t.Context(), sched: s, accounts: map[string]*accountState{}, keys: []string{"other", testAPIKey}}
+	for name, f := range flags {
+		acc := &accountState{serveAccount: serveAccount{Name: name, Schedule: "@every 1h", Flags: map[string]string{
+			"provider":        "fake",
+			"fake_catalog":    catalog,
+			"fake_state_file": filepath.Join(dir, name+"-fake.json"),
+			"delay_ms":        "0",
+		}}}
+		for k, v := range f {
+			acc.Flags[k] = v
+		}
+		a.accounts[name] = acc
+		err := s.Add(scheduler.Job{Name: name, Schedule: acc.Schedule, Run: func(ctx context.Context, st *scheduler.JobState) error {
+			return runAccount(ctx, s, acc, st)
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		for _, acc := range a.accounts {
+			acc.mu.Lock()
+			acc.resetClient()
+			acc.mu.Unlock()
+		}
+	})
+	mux := http.NewServeMux()
+	a.register(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return a, srv
+}
+
+// call sends the request with the API key and decodes the JSON response into v, if not nil.
+func call(t *testing.T, srv *httptest.Server, method, path string, v any) int {
+	t.Helper()
+	req, err := http.NewRequestWithContext(t.Context(), method, srv.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testAPIKey)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s %s Content-Type = %q, want application/json", method, path, ct)
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("%s %s decoding the response failed: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func dealIDs(p dealPage) []string {
+	ids := make([]string, 0, len(p.Deals))
+	for _, cd := range p.Deals {
+		ids = append(ids, cd.ID)
+	}
+	return ids
+}
+
+func TestAPIAuth(t *testing.T) {
+	_, srv := newTestAPI(t, map[string]map[string]string{"home": nil})
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{name: "bearer", header: "Authorization", value: "Bearer " + testAPIKey, want: http.StatusOK},
+		{name: "second key", header: "Authorization", value: "Bearer other", want: http.StatusOK},
+		{name: "api key header", header: "X-API-Key", value: testAPIKey, want: http.StatusOK},
+		{name: "missing", want: http.StatusUnauthorized},
+		{name: "invalid bearer", header: "Authorization", value: "Bearer wrong", want: http.StatusUnauthorized},
+		{name: "basic", header: "Authorization", value: "Basic " + testAPIKey, want: http.StatusUnauthorized},
+		{name: "invalid api key header", header: "X-API-Key", value: "wrong", want: http.StatusUnauthorized},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, srv.URL+"/v1/runs", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.want {
+				t.Errorf("GET /v1/runs = %d, want %d", resp.StatusCode, tc.want)
+			}
+			got := errorResponse{}
+			if tc.want == http.StatusUnauthorized {
+				if err := json.NewDecoder(resp.Body).Decode(&got); err != nil || got.Error == "" {
+					t.Errorf("GET /v1/runs body = %+v, %v, want an error", got, err)
+				}
+				if h := resp.Header.Get("WWW-Authenticate"); !strings.HasPrefix(h, "Bearer ") {
+					t.Errorf("GET /v1/runs WWW-Authenticate = %q, want a bearer challenge", h)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIListDeals(t *testing.T) {
+	_, srv := newTestAPI(t, map[string]map[string]string{"home": nil})
+	tests := []struct {
+		query     string
+		want      int
+		wantIDs   []string
+		wantTotal int
+		wantNext  bool
+	}{
+		{query: "", want: http.StatusOK, wantIDs: []string{"1", "2", "3", "4", "5"}, wantTotal: 5},
+		{query: "?page_size=2", want: http.StatusOK, wantIDs: []string{"1", "2"}, wantTotal: 5, wantNext: true},
+		{query: "?page_size=1000", want: http.StatusOK, wantIDs: []string{"1", "2", "3", "4", "5"}, wantTotal: 5},
+		{query: "?page_size=0", want: http.StatusBadRequest},
+		{query: "?page_size=1001", want: http.StatusBadRequest},
+		{query: "?page_size=x", want: http.StatusBadRequest},
+		{query: "?page_token=" + pageToken(4), want: http.StatusOK, wantIDs: []string{"5"}, wantTotal: 5},
+		{query: "?page_token=" + pageToken(10), want: http.StatusOK, wantIDs: []string{}, wantTotal: 5},
+		{query: "?page_token=!", want: http.StatusBadRequest},
+		{query: "?page_token=" + pageToken(-1), want: http.StatusBadRequest},
+		{query: "?page_token=eA", want: http.StatusBadRequest}, // "x"
+		{query: "?category=produce", want: http.StatusOK, wantIDs: []string{"2", "4"}, wantTotal: 2},
+		{query: "?clipped_only=true", want: http.StatusOK, wantIDs: []string{"3"}, wantTotal: 1},
+		{query: "?clipped_only=false", want: http.StatusOK, wantIDs: []string{"1", "2", "3", "4", "5"}, wantTotal: 5},
+		{query: "?clipped_only=maybe", want: http.StatusBadRequest},
+		{query: "?category=produce&page_size=1", want: http.StatusOK, wantIDs: []string{"2"}, wantTotal: 2, wantNext: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			got := dealPage{}
+			if code := call(t, srv, http.MethodGet, "/v1/accounts/home/deals"+tc.query, &got); code != tc.want {
+				t.Fatalf("GET deals%s = %d, want %d", tc.query, code, tc.want)
+			}
+			if tc.want != http.StatusOK {
+				return
+			}
+			if !slices.Equal(dealIDs(got), tc.wantIDs) || got.TotalSize != tc.wantTotal || (got.NextPageToken != "") != tc.wantNext {
+				t.Errorf("GET deals%s = %v of %d, next %q, want %v of %d", tc.query, dealIDs(got), got.TotalSize, got.NextPageToken, tc.wantIDs, tc.wantTotal)
+			}
+		})
+	}
+}
+
+// The next_page_token of each page lists the next one, until all the deals were listed once.
+func TestAPIListDealsPages(t *testing.T) {
+	_, srv := newTestAPI(t, map[string]map[string]string{"home": nil})
+	var ids []string
+	token := ""
+	for range 5 {
+		got := dealPage{}
+		if code := call(t, srv, http.MethodGet, "/v1/accounts/home/deals?page_size=2&page_token="+token, &got); code != http.StatusOK {
+			t.Fatalf("GET deals page %q = %d, want 200", token, code)
+		}
+		ids = append(ids, dealIDs(got)...)
+		if token = got.NextPageToken; token == "" {
+			break
+		}
+	}
+	if want := []string{"1", "2", "3", "4", "5"}; !slices.Equal(ids, want) || token != "" {
+		t.Errorf("GET deals pages = %v, next %q, want %v", ids, token, want)
+	}
+}
+
+func TestAPIClipDeal(t *testing.T) {
+	a, srv := newTestAPI(t, map[string]map[string]string{"home": {"fake_clip_limit": "2"}, "work": {"where": "id == '9'"}})
+	tests := []struct {
+		path        string
+		want        int
+		wantAlready bool
+	}{
+		{path: "/v1/accounts/home/deals/1/clip", want: http.StatusOK},
+		{path: "/v1/accounts/home/deals/1/clip", want: http.StatusOK, wantAlready: true},
+		{path: "/v1/accounts/home/deals/3/clip", want: http.StatusOK, wantAlready: true},
+		// Deal 3 was clipped, the limit of 2 is reached.
+		{path: "/v1/accounts/home/deals/2/clip", want: http.StatusConflict},
+		{path: "/v1/accounts/home/deals/9/clip", want: http.StatusNotFound},
+		{path: "/v1/accounts/away/deals/1/clip", want: http.StatusNotFound},
+		// The where of the account filters its deals.
+		{path: "/v1/accounts/work/deals/1/clip", want: http.StatusNotFound},
+	}
+	for _, tc := range tests {
+		got := clipResult{}
+		code := call(t, srv, http.MethodPost, tc.path, &got)
+		if code != tc.want {
+			t.Errorf("POST %s = %d, want %d", tc.path, code, tc.want)
+			continue
+		}
+		if code == http.StatusOK && (!got.Deal.IsClipped || got.AlreadyClipped != tc.wantAlready) {
+			t.Errorf("POST %s = %+v, want clipped, already %v", tc.path, got, tc.wantAlready)
+		}
+	}
+	deals := dealPage{}
+	if code := call(t, srv, http.MethodGet, "/v1/accounts/home/deals?clipped_only=true", &deals); code != http.StatusOK || !slices.Equal(dealIDs(deals), []string{"1", "3"}) {
+		t.Errorf("GET clipped deals = %d %v, want 200 [1 3]", code, dealIDs(deals))
+	}
+	// The requests of the account share its client.
+	c := a.accounts["home"].client
+	if code := call(t, srv, http.MethodGet, "/v1/accounts/home/deals", nil); code != http.StatusOK || c == nil || a.accounts["home"].client != c {
+		t.Errorf("GET deals = %d, client %p then %p, want the client of the previous requests", code, c, a.accounts["home"].client)
+	}
+}
+
+func TestAPIUnknownAccount(t *testing.T) {
+	_, srv := newTestAPI(t, map[string]map[string]string{"home": nil})
+	for _, r := range []struct{ method, path string }{
+		{http.MethodGet, "/v1/accounts/away/deals"},
+		{http.MethodPost, "/v1/accounts/away/deals/1/clip"},
+		{http.MethodPost, "/v1/accounts/away/deals/clip-all"},
+	} {
+		got := errorResponse{}
+		if code := call(t, srv, r.method, r.path, &got); code != http.StatusNotFound || !strings.Contains(got.Error, `"away"`) {
+			t.Errorf("%s %s = %d %+v, want 404 for the account", r.method, r.path, code, got)
+		}
+	}
+}
+
+// A failing provider is a bad gateway, and the next request authenticates again.
+func TestAPIProviderError(t *testing.T) {
+	a, srv := newTestAPI(t, map[string]map[string]string{"home": {"fake_catalog": filepath.Join(t.TempDir(), "missing.json")}})
+	for range 2 {
+		got := errorResponse{}
+		if code := call(t, srv, http.MethodGet, "/v1/accounts/home/deals", &got); code != http.StatusBadGateway || got.Error == "" {
+			t.Errorf("GET deals = %d %+v, want 502 with the error", code, got)
+		}
+		if a.accounts["home"].client != nil {
+			t.Error("GET deals kept the client, want it reset after the failure")
+		}
+	}
+}
+
+// Clipping all deals starts a run of the account, whose outcome is polled from the runs.
+func TestAPIClipAll(t *testing.T) {
+	a, srv := newTestAPI(t, map[string]map[string]string{"home": nil, "work": {"fake_latency": "50ms"}})
+	got := accountRun{}
+	if code := call(t, srv, http.MethodPost, "/v1/accounts/home/deals/clip-all", &got); code != http.StatusAccepted || got.Account != "home" {
+		t.Fatalf("POST clip-all = %d %+v, want 202 for home", code, got)
+	}
+	// The client of the account is reset by its run.
+	if code := call(t, srv, http.MethodGet, "/v1/accounts/work/deals", nil); code != http.StatusOK {
+		t.Fatalf("GET work deals = %d, want 200", code)
+	}
+	if code := call(t, srv, http.MethodPost, "/v1/accounts/work/deals/clip-all", nil); code != http.StatusAccepted {
+		t.Fatalf("POST work clip-all = %d, want 202", code)
+	}
+	if code := call(t, srv, http.MethodPost, "/v1/accounts/work/deals/clip-all", &errorResponse{}); code != http.StatusConflict {
+		t.Errorf("POST work clip-all while running = %d, want 409", code)
+	}
+
+	runs := runList{}
+	done := func() bool {
+		runs = runList{}
+		if code := call(t, srv, http.MethodGet, "/v1/runs", &runs); code != http.StatusOK {
+			t.Fatalf("GET runs = %d, want 200", code)
+		}
+		return !slices.ContainsFunc(runs.Runs, func(r accountRun) bool { return r.Running || r.Runs == 0 })
+	}
+	for deadline := time.Now().Add(30 * time.Second); !done(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the runs, got %+v", runs)
+		}
+	}
+	for _, r := range runs.Runs {
+		if r.Runs != 1 || r.LastError != "" || r.NextRun.IsZero() {
+			t.Errorf("run %+v, want 1 successful run", r)
+		}
+	}
+	if a.accounts["work"].client != nil {
+		t.Error("work kept the client of the API after its run, want it reset")
+	}
+	deals := dealPage{}
+	if code := call(t, srv, http.MethodGet, "/v1/accounts/home/deals?clipped_only=true", &deals); code != http.StatusOK || deals.TotalSize != 5 {
+		t.Errorf("GET clipped deals = %d %d, want all 5 clipped by the run", code, deals.TotalSize)
+	}
+}
+
+var updateGolden = flag.Bool("update", false, "Update the golden files of the tests.")
+
+// The OpenAPI document of the API matches testdata/openapi.json, run with -update to update it.
+func TestAPIOpenAPI(t *testing.T) {
+	_, srv := newTestAPI(t, map[string]map[string]string{"home": nil})
+	resp, err := srv.Client().Get(srv.URL + "/v1/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	doc := map[string]any{}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /v1/openapi.json = %d, %v, want the document without a key", resp.StatusCode, err)
+	}
+	// The version of the binary changes with the builds.
+	doc["info"].(map[string]any)["version"] = "test"
+	got, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+	path := filepath.Join("testdata", "openapi.json")
+	if *updateGolden {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("GET /v1/openapi.json differs from %s, run go test -run %s -update to update it:\n%s", path, t.Name(), got)
+	}
+	paths := doc["paths"].(map[string]any)
+	clipAll := paths["/v1/accounts/{account}/deals/clip-all"].(map[string]any)["post"].(map[string]any)["responses"].(map[string]any)
+	if _, ok := clipAll[fmt.Sprint(http.StatusAccepted)]; !ok {
+		t.Errorf("clip-all responses = %v, want 202", clipAll)
+	}
+}
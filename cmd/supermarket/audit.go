@@ -0,0 +1,105 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/audit"
+	"github.com/csobrinho/supermarket-api/pkg/expr"
+)
+
+var auditQuery struct {
+	since, until, account, deal, outcome, where string
+}
+
+func setAuditQueryFlags(fs *flag.FlagSet) {
+	fs.StringVar(&auditQuery.since, "since", "", "Only include attempts at or after this time (YYYY-MM-DD or RFC 3339).")
+	fs.StringVar(&auditQuery.until, "until", "", "Only include attempts at or before this time (YYYY-MM-DD or RFC 3339).")
+	fs.StringVar(&auditQuery.account, "for_account", "", "Only include attempts of this account.")
+	fs.StringVar(&auditQuery.deal, "deal", "", "Only include attempts of this deal id.")
+	fs.StringVar(&auditQuery.outcome, "outcome", "", "Only include attempts with this outcome: success, error, limit or canceled.")
+	fs.StringVar(&auditQuery.where, "where", "", "Only include attempts matching this expression, e.g. 'http_status >= 500 || latency_ms > 2000'.")
+}
+
+var auditCommand = &command{
+	name:  "audit",
+	short: "Search and summarize the audit log of clip attempts.",
+	subcommands: []*command{
+		{name: "search", short: "List audited attempts.", setFlags: setAuditQueryFlags, run: runAuditSearch},
+		{name: "summary", short: "Summarize audited attempts.", setFlags: setAuditQueryFlags, run: runAuditSummary},
+	},
+}
+
+func searchAudit() ([]audit.Entry, error) {
+	if *auditPath == "" {
+		return nil, fmt.Errorf("missing required configuration: audit_log is required")
+	}
+	// The where of the command line filters deals, not attempts, and would be silently ignored.
+	if *where != "" {
+		return nil, fmt.Errorf("where before the command filters deals, use --where after audit search or summary to filter attempts")
+	}
+	q := audit.Query{Account: auditQuery.account, DealID: auditQuery.deal, Outcome: audit.Outcome(auditQuery.outcome)}
+	if q.Outcome != "" && !slices.Contains(audit.Outcomes, q.Outcome) {
+		return nil, fmt.Errorf("invalid outcome %q, expected one of %v", q.Outcome, audit.Outcomes)
+	}
+	var err error
+	if auditQuery.since != "" {
+		if q.Since, err = parseTime(auditQuery.since); err != nil {
+			return nil, err
+		}
+	}
+	if auditQuery.until != "" {
+		if q.Until, err = parseTime(auditQuery.until); err != nil {
+			return nil, err
+		}
+	}
+	if auditQuery.where != "" {
+		if q.Where, err = expr.Compile(auditQuery.where, expr.WithType(audit.Entry{})); err != nil {
+			return nil, err
+		}
+	}
+	return audit.Search(*auditPath, q)
+}
+
+func runAuditSearch(ctx context.Context, fs *flag.FlagSet) error {
+	entries, err := searchAudit()
+	if err != nil {
+		return err
+	}
+	return writeOutput(entries, "time", "account", "action", "provider", "deal_id", "offer_code", "rule", "http_status", "latency_ms", "outcome", "error")
+}
+
+func runAuditSummary(ctx context.Context, fs *flag.FlagSet) error {
+	entries, err := searchAudit()
+	if err != nil {
+		return err
+	}
+	s := audit.Summarize(entries)
+	if s.Total == 0 {
+		fmt.Println("No audited attempts.")
+		return nil
+	}
+	fmt.Printf("%d attempt(s) from %s to %s\n", s.Total, s.First.Format(time.RFC3339), s.Last.Format(time.RFC3339))
+	fmt.Printf("Latency: average %s, max %s\n", s.AverageLatency.Round(time.Millisecond), s.MaxLatency.Round(time.Millisecond))
+	printCounts("Outcomes", s.Outcomes)
+	printCounts("Actions", s.Actions)
+	printCounts("Accounts", s.Accounts)
+	printCounts("Rules", s.Rules)
+	printCounts("HTTP statuses", s.Statuses)
+	return nil
+}
+
+// printCounts prints the counts of a summary section, most frequent first.
+func printCounts[K cmp.Ordered](title string, counts map[K]int) {
+	fmt.Printf("%s:\n", title)
+	keys := slices.Sorted(maps.Keys(counts))
+	slices.SortStableFunc(keys, func(a, b K) int { return cmp.Compare(counts[b], counts[a]) })
+	for _, k := range keys {
+		fmt.Printf("  %-10v %d\n", k, counts[k])
+	}
+}
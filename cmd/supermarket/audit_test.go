@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/audit"
+)
+
+// newAuditLog records an attempt of every outcome and selects the log with --audit_log.
+func newAuditLog(t *testing.T) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := audit.Open(path, audit.RotateOptions{})
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer l.Close()
+	t0 := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, o := range audit.Outcomes {
+		e := audit.Entry{Time: t0.Add(time.Duration(i) * time.Minute), Account: "a", DealID: string(o), Outcome: o}
+		if err := l.Record(e); err != nil {
+			t.Fatalf("Record() failed: %v", err)
+		}
+	}
+	setFlag(t, "audit_log", path)
+}
+
+func TestAuditOutcome(t *testing.T) {
+	newAuditLog(t)
+	search := func(args ...string) func() error {
+		return func() error {
+			return auditCommand.execute(t.Context(), "supermarket", append([]string{"search"}, args...))
+		}
+	}
+	var got []audit.Entry
+	if err := json.Unmarshal([]byte(runOutput(t, "json", search("--outcome=limit"))), &got); err != nil {
+		t.Fatalf("decoding the output failed: %v", err)
+	}
+	if len(got) != 1 || got[0].Outcome != audit.OutcomeLimit {
+		t.Errorf("audit search --outcome=limit = %+v, want the attempt that reached the limit", got)
+	}
+	if err := search("--outcome=failed")(); err == nil || !strings.Contains(err.Error(), `invalid outcome "failed"`) {
+		t.Errorf("audit search --outcome=failed = %v, want an invalid outcome error", err)
+	}
+}
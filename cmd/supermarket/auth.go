@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+var authCommand = &command{
+	name:  "auth",
+	short: "Check and refresh the credentials of the account.",
+	subcommands: []*command{
+		{name: "refresh", short: "Refresh the access token, printing the new refresh token if it was rotated.", run: runAuthRefresh},
+		{name: "status", short: "Check the credentials can get an access token.", run: runAuthStatus},
+	},
+}
+
+// refreshAccessToken returns a fresh token of the account.
+func refreshAccessToken(ctx context.Context, cfg *runConfig) (*oauth2.Token, error) {
+	sm, close, err := newSupermarket(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer close()
+	a, err := sm.Authenticator()
+	if err != nil {
+		return nil, fmt.Errorf("creating authenticator, %w", err)
+	}
+	t, err := a.RefreshToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("refreshing token, %w", err)
+	}
+	return t, nil
+}
+
+func runAuthRefresh(ctx context.Context, fs *flag.FlagSet) error {
+	cfg := flagConfig()
+	t, err := refreshAccessToken(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("access token refreshed, %s\n", describeExpiry(t))
+	if t.RefreshToken != "" && t.RefreshToken != cfg.refreshToken {
+		// The previous refresh token may no longer be valid, it must be replaced.
+		fmt.Printf("refresh token rotated, update REFRESH_TOKEN to:\n%s\n", t.RefreshToken)
+	}
+	return nil
+}
+
+func runAuthStatus(ctx context.Context, fs *flag.FlagSet) error {
+	cfg := flagConfig()
+	t, err := refreshAccessToken(ctx, cfg)
+	if err != nil {
+		fmt.Printf("%s: not authenticated\n", cfg.provider)
+		return err
+	}
+	fmt.Printf("%s: authenticated, %s\n", cfg.provider, describeExpiry(t))
+	return nil
+}
+
+func describeExpiry(t *oauth2.Token) string {
+	if t.Expiry.IsZero() {
+		return "the access token doesn't expire"
+	}
+	return fmt.Sprintf("the access token expires at %s (in %s)", t.Expiry.Format(time.RFC3339), time.Until(t.Expiry).Round(time.Second))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/logging"
+	"github.com/csobrinho/supermarket-api/internal/metrics"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+)
+
+// newSupermarket creates the client of the provider of the configuration. Call close when done, it
+// stops plugins.
+func newSupermarket(ctx context.Context, cfg *runConfig) (sm supermarket.Supermarket, close func(), err error) {
+	recorder, err := newRecorder()
+	if err != nil {
+		return nil, nil, err
+	}
+	sm, err = newFactory().Create(ctx, cfg.provider,
+		supermarket.WithTransport(recorder),
+		supermarket.WithUserAgent(cfg.userAgent),
+		supermarket.WithAppVersion(cfg.appVersion),
+		supermarket.WithCredentials(cfg.clientID, cfg.refreshToken),
+		supermarket.WithClientSecret(cfg.clientSecret),
+		supermarket.WithLogin(cfg.loginUsername, cfg.loginPassword),
+		supermarket.WithLoyaltyCard(cfg.loyaltyCard),
+		supermarket.WithApiKey(cfg.apiKey),
+		supermarket.WithDebug(logging.Enabled("http", slog.LevelDebug)),
+		supermarket.WithStoreID(cfg.store),
+		supermarket.WithFlags(cfg.providerFlags),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating client, %w", err)
+	}
+	close = func() {
+		if c, ok := sm.(io.Closer); ok {
+			_ = c.Close()
+		}
+	}
+	return sm, close, nil
+}
+
+// authenticate refreshes the access token of the client and returns its promotion service. A
+// rotated refresh token replaces the one of the configuration, which serve keeps per account.
+func authenticate(ctx context.Context, cfg *runConfig, sm supermarket.Supermarket) (supermarket.PromotionService, error) {
+	a, err := sm.Authenticator()
+	if err != nil {
+		metrics.RecordError(metrics.ErrorCategoryConfigValidation)
+		return nil, fmt.Errorf("creating authenticator, %w", err)
+	}
+	log.InfoContext(ctx, "getting an access token")
+	start := time.Now()
+	t, err := a.RefreshToken(ctx)
+	if err != nil {
+		metrics.RecordError(metrics.ErrorCategoryTokenRefresh)
+		metrics.RecordToken(cfg.account, time.Time{}, err)
+		return nil, fmt.Errorf("refreshing token, %w", err)
+	}
+	metrics.RecordTokenRefreshDuration(time.Since(start))
+	metrics.RecordToken(cfg.account, t.Expiry, nil)
+	log.DebugContext(ctx, "got an access token", "expiry", t.Expiry, logging.KeyDuration, time.Since(start))
+	if t.RefreshToken != "" && t.RefreshToken != cfg.refreshToken {
+		// The previous refresh token may no longer be valid, the next clients of the account, e.g. the
+		// next runs of serve, must use the new one.
+		log.InfoContext(ctx, "refresh token rotated")
+		cfg.refreshToken = t.RefreshToken
+	}
+
+	ps, err := sm.Promotion()
+	if err != nil {
+		metrics.RecordError(metrics.ErrorCategoryPromotionsParse)
+		return nil, fmt.Errorf("creating promotion service, %w", err)
+	}
+	return ps, nil
+}
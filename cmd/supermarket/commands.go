@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+)
+
+// command is a CLI subcommand. A command either runs or dispatches to its subcommands.
+type command struct {
+	name        string
+	args        string // Synopsis of the positional arguments.
+	short       string
+	requires    supermarket.Capability // If set, the command is hidden and rejected for providers without it.
+	setFlags    func(fs *flag.FlagSet)
+	run         func(ctx context.Context, fs *flag.FlagSet) error
+	subcommands []*command
+}
+
+// commands are the subcommands available from the command line. Without any, the binary fetches
+// and optionally clips all deals.
+var commands = &command{
+	name:        "supermarket",
+	subcommands: []*command{dealsCommand, authCommand, storesCommand, historyCommand, auditCommand, providersCommand, configCommand, serveCommand, versionCommand},
+}
+
+// commandFlags are the flags of the command line that commands also accept after their name, e.g.
+// "deals list --output json", unless they have their own flag with the same name. The other flags
+// configure the process before the command runs, e.g. its logs, and only work before the name.
+var commandFlags = []string{"where", "output", "output_columns", "output_sort", "output_file", "db", "audit_log"}
+
+// execute runs the command, or the subcommand named by the first argument.
+func (c *command) execute(ctx context.Context, path string, args []string) error {
+	path = strings.TrimSpace(path + " " + c.name)
+	if len(c.subcommands) > 0 {
+		if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+			c.usage(path)
+			return nil
+		}
+		for _, sub := range c.subcommands {
+			if sub.name == args[0] {
+				if err := sub.supported(); err != nil {
+					return fmt.Errorf("%s %s, %w", path, sub.name, err)
+				}
+				return sub.execute(ctx, path, args[1:])
+			}
+		}
+		return fmt.Errorf("unknown command %q, run '%s help' for usage", strings.TrimSpace(path+" "+args[0]), path)
+	}
+
+	fs := flag.NewFlagSet(path, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags] %s\n\n%s\n\nFlags:\n", path, c.args, c.short)
+		fs.PrintDefaults()
+	}
+	if c.setFlags != nil {
+		c.setFlags(fs)
+	}
+	for _, name := range commandFlags {
+		if f := flag.Lookup(name); fs.Lookup(name) == nil {
+			fs.Var(f.Value, f.Name, f.Usage)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	return c.run(ctx, fs)
+}
+
+func (c *command) usage(path string) {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", path)
+	for _, sub := range c.subcommands {
+		if sub.supported() == nil {
+			fmt.Fprintf(os.Stderr, "  %-10s %s\n", sub.name, sub.short)
+		}
+	}
+}
+
+// supported returns an error if the provider selected with --provider lacks the capability the
+// command requires.
+func (c *command) supported() error {
+	if c.requires == "" {
+		return nil
+	}
+	info, err := newFactory().Lookup(*providerName)
+	if err != nil {
+		return err
+	}
+	return info.Capabilities.Require(info.Name, c.requires)
+}
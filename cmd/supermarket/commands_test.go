@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/csobrinho/supermarket-api/internal/audit"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"github.com/csobrinho/supermarket-api/providers/fake"
+)
+
+func TestSupported(t *testing.T) {
+	tests := []struct {
+		provider string
+		cmd      *command
+		want     bool
+	}{
+		{"fake", dealsUnclipCommand, true},
+		{"fake", dealsClipCommand, true},
+		{"fake", storesCommand.subcommands[0], false},
+		{"kroger", storesCommand.subcommands[0], true},
+		{"walgreens", dealsUnclipCommand, false},
+		// Commands without a requirement are supported by any provider.
+		{"walgreens", dealsCommand, true},
+	}
+	for _, tt := range tests {
+		setFlag(t, "provider", tt.provider)
+		err := tt.cmd.supported()
+		if tt.want && err != nil {
+			t.Errorf("%s supported() with %s = %v, want nil", tt.cmd.name, tt.provider, err)
+		}
+		if !tt.want && !errors.Is(err, supermarket.ErrUnsupported) {
+			t.Errorf("%s supported() with %s = %v, want %v", tt.cmd.name, tt.provider, err, supermarket.ErrUnsupported)
+		}
+	}
+
+	// The command is rejected before it runs, e.g. before its missing flags are reported.
+	setFlag(t, "provider", "fake")
+	if err := commands.execute(t.Context(), "", []string{"stores", "search"}); !errors.Is(err, supermarket.ErrUnsupported) {
+		t.Errorf("stores search with fake = %v, want %v", err, supermarket.ErrUnsupported)
+	}
+	setFlag(t, "provider", "missing")
+	if err := commands.execute(t.Context(), "", []string{"deals", "unclip", "1"}); err == nil {
+		t.Error("deals unclip with a missing provider succeeded, want an error")
+	}
+}
+
+func TestProviders(t *testing.T) {
+	run := func() error { return commands.execute(t.Context(), "", []string{"providers"}) }
+	var got []supermarket.ProviderInfo
+	if err := json.Unmarshal([]byte(runOutput(t, "json", run)), &got); err != nil {
+		t.Fatalf("decoding the output failed: %v", err)
+	}
+	names := make([]string, 0, len(got))
+	for _, info := range got {
+		names = append(names, info.Name)
+		if info.Name == "fake" && !slices.Equal(info.Capabilities, fake.Capabilities) {
+			t.Errorf("providers fake = %v, want the capabilities %v", info, fake.Capabilities)
+		}
+	}
+	if !slices.IsSorted(names) || !slices.Contains(names, "fake") || !slices.Contains(names, "safeway") {
+		t.Errorf("providers = %v, want every provider sorted by name", names)
+	}
+	if got, want := runOutput(t, "csv", run), "provider,capabilities\n"; !strings.HasPrefix(got, want) {
+		t.Errorf("providers csv = %q, want the header %q", got, want)
+	}
+}
+
+func TestCommandFlags(t *testing.T) {
+	restoreFlags(t)
+	newAuditLog(t)
+	path := filepath.Join(t.TempDir(), "out")
+	read := func(args ...string) (string, error) {
+		if err := commands.execute(t.Context(), "", args); err != nil {
+			return "", err
+		}
+		b, err := os.ReadFile(path)
+		return string(b), err
+	}
+
+	// The output flags of the command line work after the command.
+	got, err := read("providers", "--output", "csv", "--output_file", path)
+	if want := "provider,capabilities\n"; err != nil || !strings.HasPrefix(got, want) {
+		t.Errorf("providers --output csv = %q, %v, want the header %q", got, err, want)
+	}
+
+	// The where of audit filters attempts and leaves the one of the command line alone.
+	got, err = read("audit", "search", "--output=json", "--output_file="+path, `--where=outcome == "limit"`)
+	var entries []audit.Entry
+	if err != nil || json.Unmarshal([]byte(got), &entries) != nil || len(entries) != 1 || entries[0].Outcome != audit.OutcomeLimit {
+		t.Errorf("audit search --where = %q, %v, want the attempt that reached the limit", got, err)
+	}
+	if *where != "" {
+		t.Errorf("audit search --where set the where of the command line to %q, want it empty", *where)
+	}
+	setFlag(t, "where", `brand == "Lucerne"`)
+	if _, err := read("audit", "summary"); err == nil || !strings.Contains(err.Error(), "where before the command filters deals") {
+		t.Errorf("audit summary after --where = %v, want an error", err)
+	}
+
+	// The flags configuring the process only work before the command.
+	if _, err := read("providers", "--log_level=debug"); err == nil || !strings.Contains(err.Error(), "flag provided but not defined: -log_level") {
+		t.Errorf("providers --log_level = %v, want an undefined flag error", err)
+	}
+}
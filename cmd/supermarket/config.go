@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	ihttp "github.com/csobrinho/supermarket-api/internal/http"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+)
+
+var configCommand = &command{
+	name:  "config",
+	short: "Check the configuration.",
+	subcommands: []*command{
+		{name: "validate", short: "Check the flags and env, and that the client can be created, without sending any request.", run: runConfigValidate},
+	},
+}
+
+func runConfigValidate(ctx context.Context, fs *flag.FlagSet) error {
+	var errs []error
+	cfg := flagConfig()
+	info, lookupErr := newFactory().Lookup(cfg.provider)
+	if lookupErr != nil {
+		errs = append(errs, lookupErr)
+	} else if cfg.clipAll {
+		errs = append(errs, info.Capabilities.Require(info.Name, supermarket.CapabilityClip))
+	}
+	if cfg.where != "" {
+		if _, err := compileWhere(cfg); err != nil {
+			errs = append(errs, fmt.Errorf("invalid where expression, %w", err))
+		}
+	}
+	if err := checkResume(cfg); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := ihttp.ParseMatchers(*httpMatch); err != nil {
+		errs = append(errs, err)
+	}
+	// Creating the client checks the credentials each provider needs, and the http mode.
+	if lookupErr == nil {
+		sm, close, err := newSupermarket(ctx, cfg)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			close()
+			fmt.Printf("%s: capabilities %s\n", cfg.provider, supermarket.CapabilitiesOf(sm))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	fmt.Printf("%s: configuration is valid\n", cfg.provider)
+	return nil
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/audit"
+	"github.com/csobrinho/supermarket-api/internal/clipper"
+	ihttp "github.com/csobrinho/supermarket-api/internal/http"
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/internal/storage"
+	"github.com/csobrinho/supermarket-api/pkg/expr"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+)
+
+var dealsCommand = &command{
+	name:        "deals",
+	short:       "List, clip and inspect deals.",
+	subcommands: []*command{dealsListCommand, dealsShowCommand, dealsClipCommand, dealsUnclipCommand, dealsDiffCommand},
+}
+
+var (
+	listType        string
+	listCategory    string
+	listProductID   string
+	listClippedOnly bool
+	clipAllDeals    bool
+)
+
+var dealsListCommand = &command{
+	name:  "list",
+	short: "List the deals of the account, matching --where if provided.",
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&listType, "type", "", "Only list deals of this type, e.g. clip_deal or coupon.")
+		fs.StringVar(&listCategory, "category", "", "Only list deals of this category.")
+		fs.StringVar(&listProductID, "product_id", "", "Only list deals of this UPC.")
+		fs.BoolVar(&listClippedOnly, "clipped_only", false, "If true, only list clipped deals.")
+	},
+	run: runDealsList,
+}
+
+var dealsShowCommand = &command{
+	name:  "show",
+	args:  "<id>",
+	short: "Show the details of a deal.",
+	run:   runDealsShow,
+}
+
+var dealsClipCommand = &command{
+	name:     "clip",
+	args:     "[<id>...]",
+	short:    "Clip the deals with the ids, or all deals with --all.",
+	requires: supermarket.CapabilityClip,
+	setFlags: func(fs *flag.FlagSet) {
+		fs.BoolVar(&clipAllDeals, "all", false, "If true, clip all deals, like running without a command with --clip_all.")
+	},
+	run: runDealsClip,
+}
+
+var dealsUnclipCommand = &command{
+	name:     "unclip",
+	args:     "<id>...",
+	short:    "Remove clipped deals from the account.",
+	requires: supermarket.CapabilityUnclip,
+	run:      runDealsUnclip,
+}
+
+// getDeals fetches the deals of the account matching the search options and the where expression.
+// Call close when done with the promotion service.
+func getDeals(ctx context.Context, cfg *runConfig, opts promotion.PromotionSearchOptions) (ps promotion.Service, cds []promotion.ClipDeal, close func(), err error) {
+	sm, close, err := newSupermarket(ctx, cfg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if ps, err = authenticate(ctx, cfg, sm); err == nil {
+		cds, err = fetchDeals(ctx, cfg, ps, opts)
+	}
+	if err != nil {
+		close()
+		return nil, nil, nil, err
+	}
+	return ps, cds, close, nil
+}
+
+// fetchDeals fetches the deals of the promotion service matching the search options and the where
+// expression.
+func fetchDeals(ctx context.Context, cfg *runConfig, ps promotion.Service, opts promotion.PromotionSearchOptions) ([]promotion.ClipDeal, error) {
+	var filter *expr.Program
+	if cfg.where != "" {
+		var err error
+		if filter, err = compileWhere(cfg); err != nil {
+			return nil, fmt.Errorf("invalid where expression, %w", err)
+		}
+	}
+	cds, err := ps.GetClipDeals(ctx, opts)
+	if err != nil || filter == nil {
+		return cds, err
+	}
+	return expr.Filter(filter, cds)
+}
+
+// findDeals returns the deals with the ids, in order.
+func findDeals(cds []promotion.ClipDeal, ids []string) ([]promotion.ClipDeal, error) {
+	ret := make([]promotion.ClipDeal, 0, len(ids))
+	for _, id := range ids {
+		i := slices.IndexFunc(cds, func(cd promotion.ClipDeal) bool { return cd.ID == id })
+		if i < 0 {
+			return nil, fmt.Errorf("deal %q not found", id)
+		}
+		ret = append(ret, cds[i])
+	}
+	return ret, nil
+}
+
+func runDealsList(ctx context.Context, fs *flag.FlagSet) error {
+	opts := promotion.PromotionSearchOptions{}
+	if listType != "" {
+		t := promotion.PromotionType(listType)
+		opts.Type = &t
+	}
+	if listCategory != "" {
+		opts.Category = &listCategory
+	}
+	if listProductID != "" {
+		opts.ProductID = &listProductID
+	}
+	if listClippedOnly {
+		opts.ClippedOnly = &listClippedOnly
+	}
+	_, cds, close, err := getDeals(ctx, flagConfig(), opts)
+	if err != nil {
+		return err
+	}
+	defer close()
+
+	return writeOutput(cds, "id", "type", "brand", "description", "end_date", "is_clipped")
+}
+
+func runDealsShow(ctx context.Context, fs *flag.FlagSet) error {
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected 1 argument(s), got %d", fs.NArg())
+	}
+	_, cds, close, err := getDeals(ctx, flagConfig(), promotion.PromotionSearchOptions{})
+	if err != nil {
+		return err
+	}
+	defer close()
+	found, err := findDeals(cds, fs.Args())
+	if err != nil {
+		return err
+	}
+	printDeal(os.Stdout, found[0])
+	return nil
+}
+
+func runDealsClip(ctx context.Context, fs *flag.FlagSet) error {
+	cfg := flagConfig()
+	if clipAllDeals {
+		if fs.NArg() > 0 {
+			return fmt.Errorf("expected either ids or --all")
+		}
+		cfg.clipAll = true
+		return runAndReport(ctx, cfg)
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("expected at least 1 argument, got 0")
+	}
+	ps, cds, close, err := getDeals(ctx, cfg, promotion.PromotionSearchOptions{})
+	if err != nil {
+		return err
+	}
+	defer close()
+	found, err := findDeals(cds, fs.Args())
+	if err != nil {
+		return err
+	}
+	stats, err := clipDeals(ctx, cfg, ps, found, func(a clipper.Attempt) {
+		if a.Err == nil {
+			fmt.Printf("clipped %s\n", describeDeal(a.Deal))
+		} else {
+			fmt.Printf("failed to clip %s: %v\n", describeDeal(a.Deal), a.Err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if failed := len(found) - stats.Clipped; failed > 0 {
+		return fmt.Errorf("failed to clip %d of %d deal(s)", failed, len(found))
+	}
+	return nil
+}
+
+// clipDeals clips the deals picked by hand, records the attempts in the database and the audit
+// log, and calls onClip with the outcome of every attempt.
+func clipDeals(ctx context.Context, cfg *runConfig, ps promotion.Service, cds []promotion.ClipDeal, onClip func(a clipper.Attempt)) (*clipper.Stats, error) {
+	candidates := make([]clipper.Candidate, 0, len(cds))
+	for _, cd := range cds {
+		candidates = append(candidates, clipper.Candidate{Deal: cd, Rule: "manual"})
+	}
+
+	db := openDB(cfg)
+	if db != nil {
+		defer db.Close()
+	}
+	auditLog, err := openAuditLog(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if auditLog != nil {
+		defer auditLog.Close()
+	}
+	stats := &clipper.Stats{}
+	clipper.Execute(ctx, ps, candidates, stats, clipper.Options{
+		RateLimiter: supermarket.NewRateLimiter((time.Duration(cfg.delayMs))*time.Millisecond, 0.5),
+		OnClip: func(a clipper.Attempt) {
+			recordClip(cfg, db, auditLog, audit.ActionClip, a)
+			onClip(a)
+		},
+	})
+	if stats.Interrupted {
+		return stats, fmt.Errorf("clipping interrupted, %w", ctx.Err())
+	}
+	return stats, nil
+}
+
+func runDealsUnclip(ctx context.Context, fs *flag.FlagSet) error {
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("expected at least 1 argument, got 0")
+	}
+	cfg := flagConfig()
+	ps, cds, close, err := getDeals(ctx, cfg, promotion.PromotionSearchOptions{})
+	if err != nil {
+		return err
+	}
+	defer close()
+	found, err := findDeals(cds, fs.Args())
+	if err != nil {
+		return err
+	}
+	u, ok := ps.(promotion.Unclipper)
+	if !ok {
+		return fmt.Errorf("%q doesn't support %s, %w", cfg.provider, supermarket.CapabilityUnclip, supermarket.ErrUnsupported)
+	}
+
+	auditLog, err := openAuditLog(cfg)
+	if err != nil {
+		return err
+	}
+	if auditLog != nil {
+		defer auditLog.Close()
+	}
+	failed := 0
+	for _, cd := range found {
+		start := time.Now()
+		cctx, rec := ihttp.WithStatusRecorder(ctx)
+		err := u.UnclipDeal(cctx, cd)
+		recordClip(cfg, nil, auditLog, audit.ActionUnclip, clipper.Attempt{
+			Candidate:  clipper.Candidate{Deal: cd, Rule: "manual"},
+			Err:        err,
+			Latency:    time.Since(start),
+			HTTPStatus: rec.Status(),
+		})
+		if err != nil {
+			failed++
+			fmt.Printf("failed to unclip %s: %v\n", describeDeal(cd), err)
+			continue
+		}
+		fmt.Printf("unclipped %s\n", describeDeal(cd))
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to unclip %d of %d deal(s)", failed, len(found))
+	}
+	return nil
+}
+
+// printDeal prints every field of the deal, one per line.
+func printDeal(w io.Writer, cd promotion.ClipDeal) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	field := func(name string, v any) { fmt.Fprintf(tw, "%s:\t%v\n", name, v) }
+	field("ID", cd.ID)
+	field("Type", cd.Type)
+	field("Brand", cd.Brand)
+	field("Description", cd.Description)
+	if cd.Disclaimer != "" {
+		field("Disclaimer", cd.Disclaimer)
+	}
+	field("Categories", strings.Join(cd.Categories, ", "))
+	field("UPCs", strings.Join(cd.Upcs, ", "))
+	if cd.Discount != nil {
+		field("Discount", formatDiscount(cd.Discount))
+	}
+	if cd.Price != nil {
+		field("Price", fmt.Sprintf("%.2f", *cd.Price))
+	}
+	if cd.PromoCode != nil {
+		field("Promo code", *cd.PromoCode)
+	}
+	field("Starts", formatDate(cd.StartDate))
+	field("Ends", formatDate(cd.EndDate))
+	field("Clippable", cd.IsClippable)
+	field("Clipped", cd.IsClipped)
+	if cd.ClippedAt != nil {
+		field("Clipped at", cd.ClippedAt.Format(time.RFC3339))
+	}
+	_ = tw.Flush()
+}
+
+func formatDiscount(d *promotion.Discount) string {
+	var s []string
+	if d.Amount > 0 {
+		s = append(s, fmt.Sprintf("$%.2f", d.Amount))
+	}
+	if d.Percent > 0 {
+		s = append(s, fmt.Sprintf("%.0f%%", d.Percent))
+	}
+	return strings.Join(s, ", ")
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.DateOnly)
+}
+
+var (
+	diffFrom string
+	diffTo   string
+)
+
+var dealsDiffCommand = &command{
+	name:  "diff",
+	short: "List new, removed, changed and expired deals between two snapshots.",
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&diffFrom, "from", "", "Compare from the latest snapshot taken at or before this time (YYYY-MM-DD or RFC 3339).")
+		fs.StringVar(&diffTo, "to", "", "Compare to the latest snapshot taken at or before this time (YYYY-MM-DD or RFC 3339).")
+	},
+	run: runDealsDiff,
+}
+
+func runDealsDiff(ctx context.Context, fs *flag.FlagSet) error {
+	cfg := flagConfig()
+	if cfg.db == "" || cfg.store == "" {
+		return fmt.Errorf("missing required configuration: db and store_id are required")
+	}
+	db, err := storage.Open(cfg.db)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	src := snapshotSource(cfg)
+	var cur, prev *storage.Snapshot
+	if diffTo == "" {
+		cur, err = db.LatestSnapshot(src)
+	} else {
+		cur, err = snapshotAt(db, src, diffTo)
+	}
+	if err != nil {
+		return fmt.Errorf("loading snapshot of %s, %w", src, err)
+	}
+	if diffFrom == "" {
+		prev, err = db.PreviousSnapshot(src, cur.Time)
+	} else {
+		prev, err = snapshotAt(db, src, diffFrom)
+	}
+	if err != nil {
+		return fmt.Errorf("loading previous snapshot of %s, %w", src, err)
+	}
+	printDiff(os.Stdout, src, storage.DiffSnapshots(prev, cur))
+	return nil
+}
+
+// snapshotSource identifies the snapshots of the account and store of the configuration.
+func snapshotSource(cfg *runConfig) storage.Source {
+	return storage.Source{Provider: cfg.provider, Account: cfg.account, Store: cfg.store}
+}
+
+func snapshotAt(db *storage.DB, src storage.Source, s string) (*storage.Snapshot, error) {
+	t, err := parseTime(s)
+	if err != nil {
+		return nil, err
+	}
+	return db.SnapshotAt(src, t)
+}
+
+// parseTime parses a date or an RFC 3339 time. Dates refer to the end of the day.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected YYYY-MM-DD or RFC 3339", s)
+	}
+	return t.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+}
+
+func printDiff(w io.Writer, src storage.Source, d *storage.Diff) {
+	fmt.Fprintf(w, "Deals of %s from %s to %s:\n", src, d.From.Format(time.RFC3339), d.To.Format(time.RFC3339))
+	if d.Empty() {
+		fmt.Fprintln(w, "  no changes")
+		return
+	}
+	section := func(title, mark string, cds []promotion.ClipDeal) {
+		if len(cds) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "%s (%d):\n", title, len(cds))
+		for _, cd := range cds {
+			fmt.Fprintf(w, "  %s %s\n", mark, describeDeal(cd))
+		}
+	}
+	section("New", "+", d.New)
+	section("Removed", "-", d.Removed)
+	section("Expired", "x", d.Expired)
+	if len(d.Changed) > 0 {
+		fmt.Fprintf(w, "Changed (%d):\n", len(d.Changed))
+		for _, dc := range d.Changed {
+			fmt.Fprintf(w, "  ~ %s\n", describeDeal(dc.Deal))
+			for _, c := range dc.Changes {
+				fmt.Fprintf(w, "      %s: %v -> %v\n", c.Field, formatValue(c.Old), formatValue(c.New))
+			}
+		}
+	}
+}
+
+func describeDeal(cd promotion.ClipDeal) string {
+	s := fmt.Sprintf("%s %q %q", cd.ID, cd.Brand, cd.Description)
+	if !cd.EndDate.IsZero() {
+		s += ", ends " + cd.EndDate.Format(time.DateOnly)
+	}
+	return s
+}
+
+func formatValue(v any) any {
+	if t, ok := v.(time.Time); ok {
+		return t.Format(time.DateOnly)
+	}
+	return v
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/storage"
+	"github.com/csobrinho/supermarket-api/pkg/expr"
+)
+
+var historyCommand = &command{
+	name:  "history",
+	short: "Query the history of deals stored with --db, offline.",
+	subcommands: []*command{
+		{name: "brand", args: "<brand>", short: "When a brand was last on a deal, and all its deals.", run: runHistoryBrand},
+		{name: "upc", args: "<upc>", short: "How often a product gets a deal, and all its deals.", run: runHistoryUPC},
+		{name: "categories", short: "Number of deals and average discounts, in dollars and percent, per category.", run: runHistoryCategories},
+		{name: "clips", short: "Clip attempts.", setFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&historySince, "since", "", "Only list clips at or after this time (YYYY-MM-DD or RFC 3339).")
+		}, run: runHistoryClips},
+		{name: "query", args: "<expression>", short: "Deals matching an expression, e.g. 'discount >= 2 && last_seen > now() - 30d'.", run: runHistoryQuery},
+	},
+}
+
+var historySince string
+
+// openHistory opens the database for a history command, checking the expected arguments.
+func openHistory(fs *flag.FlagSet, nargs int) (*storage.DB, error) {
+	if *dbPath == "" {
+		return nil, fmt.Errorf("missing required configuration: db is required")
+	}
+	if fs.NArg() != nargs {
+		fs.Usage()
+		return nil, fmt.Errorf("expected %d argument(s), got %d", nargs, fs.NArg())
+	}
+	return storage.Open(*dbPath)
+}
+
+func runHistoryBrand(ctx context.Context, fs *flag.FlagSet) error {
+	db, err := openHistory(fs, 1)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	brand := fs.Arg(0)
+	rs, err := db.BrandHistory(brand)
+	if err != nil {
+		return err
+	}
+	if tabularOutput() {
+		if len(rs) == 0 {
+			fmt.Printf("%q was never on a deal\n", brand)
+			return nil
+		}
+		fmt.Printf("%q was last on a deal on %s, %d deal(s):\n", brand, rs[0].LastSeen.Format(time.DateOnly), len(rs))
+	}
+	return printDealRecords(rs)
+}
+
+func runHistoryUPC(ctx context.Context, fs *flag.FlagSet) error {
+	db, err := openHistory(fs, 1)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	u, rs, err := db.UPCHistory(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("upc %s, %w", fs.Arg(0), err)
+	}
+	if tabularOutput() {
+		fmt.Printf("UPC %s had %d deal(s) between %s and %s:\n", u.UPC, len(rs), u.FirstSeen.Format(time.DateOnly), u.LastSeen.Format(time.DateOnly))
+	}
+	return printDealRecords(rs)
+}
+
+func runHistoryCategories(ctx context.Context, fs *flag.FlagSet) error {
+	db, err := openHistory(fs, 0)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	stats, err := db.CategoryStats()
+	if err != nil {
+		return err
+	}
+	return writeOutput(stats, "category", "deals", "average_discount", "average_percent")
+}
+
+// clipRow is a clip attempt of the history, with the outcome and latency named as in the audit log.
+type clipRow struct {
+	Time      time.Time `json:"time"`
+	Account   string    `json:"account"`
+	Provider  string    `json:"provider"`
+	DealID    string    `json:"deal_id"`
+	Brand     string    `json:"brand"`
+	Outcome   string    `json:"outcome"` // Either clipped or error.
+	Error     string    `json:"error,omitempty"`
+	LatencyMs int64     `json:"latency_ms"`
+}
+
+func runHistoryClips(ctx context.Context, fs *flag.FlagSet) error {
+	db, err := openHistory(fs, 0)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var since time.Time
+	if historySince != "" {
+		if since, err = parseTime(historySince); err != nil {
+			return err
+		}
+	}
+	evs, err := db.ClipEvents(since)
+	if err != nil {
+		return err
+	}
+	rows := make([]clipRow, 0, len(evs))
+	for _, ev := range evs {
+		row := clipRow{Time: ev.Time, Account: ev.Account, Provider: ev.Provider, DealID: ev.DealID, Brand: ev.Brand, Outcome: "clipped", LatencyMs: ev.Latency.Milliseconds()}
+		if !ev.Success {
+			row.Outcome, row.Error = "error", ev.Error
+		}
+		rows = append(rows, row)
+	}
+	return writeOutput(rows, "time", "account", "provider", "deal_id", "brand", "outcome", "error", "latency_ms")
+}
+
+func runHistoryQuery(ctx context.Context, fs *flag.FlagSet) error {
+	if fs.NArg() > 1 {
+		// Allow unquoted expressions.
+		fs = joinArgs(fs)
+	}
+	db, err := openHistory(fs, 1)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	p, err := expr.Compile(fs.Arg(0), expr.WithType(storage.DealRecord{}))
+	if err != nil {
+		return err
+	}
+	rs, err := db.QueryDeals(p)
+	if err != nil {
+		return err
+	}
+	if tabularOutput() {
+		fmt.Printf("%d deal(s) match %q:\n", len(rs), p)
+	}
+	return printDealRecords(rs)
+}
+
+// joinArgs returns a flag set whose only argument is all the arguments of fs joined by spaces.
+func joinArgs(fs *flag.FlagSet) *flag.FlagSet {
+	joined := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	joined.Usage = fs.Usage
+	_ = joined.Parse([]string{"--", strings.Join(fs.Args(), " ")})
+	return joined
+}
+
+func printDealRecords(rs []storage.DealRecord) error {
+	return writeOutput(rs, "provider", "id", "brand", "description", "discount", "first_seen", "last_seen", "sightings", "clipped")
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/internal/storage"
+)
+
+// newHistory creates a database with deals of two categories, including a percentage off, and two
+// clip attempts, and selects it with --db.
+func newHistory(t *testing.T) time.Time {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "deals.db")
+	db, err := storage.Open(path)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer db.Close()
+	t0 := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	deal := func(id, category string, d promotion.Discount) promotion.ClipDeal {
+		return promotion.ClipDeal{Promotion: promotion.Promotion{ID: id, Categories: []string{category}, Discount: &d}}
+	}
+	s := &storage.Snapshot{
+		Source: storage.Source{Provider: "fake", Account: "a"},
+		Time:   t0,
+		Deals: []promotion.ClipDeal{
+			deal("1", "Dairy", promotion.Discount{Amount: 1}),
+			deal("2", "Dairy", promotion.Discount{Amount: 2}),
+			deal("3", "Produce", promotion.Discount{Amount: 0.5}),
+			deal("4", "Dairy", promotion.Discount{Percent: 20}),
+		},
+	}
+	if err := db.SaveSnapshot(s); err != nil {
+		t.Fatalf("SaveSnapshot() failed: %v", err)
+	}
+	for _, ev := range []storage.ClipEvent{
+		{Time: t0, Provider: "fake", Account: "a", DealID: "1", Brand: "Lucerne", Success: true, Latency: 1500 * time.Millisecond},
+		{Time: t0.Add(time.Hour), Provider: "fake", Account: "a", DealID: "2", Success: false, Error: "clip limit reached", Latency: 20 * time.Millisecond},
+	} {
+		if err := db.RecordClip(ev); err != nil {
+			t.Fatalf("RecordClip() failed: %v", err)
+		}
+	}
+	setFlag(t, "db", path)
+	return t0
+}
+
+// runOutput runs the command with --output and returns what it wrote to --output_file.
+func runOutput(t *testing.T, format string, run func() error) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "out")
+	setFlag(t, "output", format)
+	setFlag(t, "output_file", path)
+	if err := run(); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestHistoryCategories(t *testing.T) {
+	newHistory(t)
+	run := func() error {
+		return runHistoryCategories(t.Context(), flag.NewFlagSet("categories", flag.ContinueOnError))
+	}
+	var got []storage.CategoryStats
+	if err := json.Unmarshal([]byte(runOutput(t, "json", run)), &got); err != nil {
+		t.Fatalf("decoding the output failed: %v", err)
+	}
+	if len(got) != 2 || got[0].Category != "Dairy" || got[0].Deals != 3 || got[1].Category != "Produce" || got[1].Deals != 1 {
+		t.Errorf("history categories = %+v, want 3 Dairy and 1 Produce deals", got)
+	}
+	// The percentage off doesn't pull down the average savings in dollars.
+	if got, want := runOutput(t, "csv", run), "category,deals,average_discount,average_percent\nDairy,3,1.5,20\nProduce,1,0.5,0\n"; got != want {
+		t.Errorf("history categories csv = %q, want %q", got, want)
+	}
+}
+
+func TestHistoryClips(t *testing.T) {
+	t0 := newHistory(t)
+	run := func() error { return runHistoryClips(t.Context(), flag.NewFlagSet("clips", flag.ContinueOnError)) }
+	var got []clipRow
+	if err := json.Unmarshal([]byte(runOutput(t, "json", run)), &got); err != nil {
+		t.Fatalf("decoding the output failed: %v", err)
+	}
+	want := []clipRow{
+		{Time: t0, Account: "a", Provider: "fake", DealID: "1", Brand: "Lucerne", Outcome: "clipped", LatencyMs: 1500},
+		{Time: t0.Add(time.Hour), Account: "a", Provider: "fake", DealID: "2", Outcome: "error", Error: "clip limit reached", LatencyMs: 20},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("history clips = %+v, want %+v", got, want)
+	}
+
+	historySince = "2025-05-01T12:30:00Z"
+	t.Cleanup(func() { historySince = "" })
+	lines := strings.Split(strings.TrimSpace(runOutput(t, "jsonl", run)), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], `"deal_id":"2"`) {
+		t.Errorf("history clips --since = %q, want only the clip of deal 2", lines)
+	}
+}
@@ -2,157 +2,550 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/csobrinho/supermarket-api/internal/audit"
+	"github.com/csobrinho/supermarket-api/internal/clipper"
+	ihttp "github.com/csobrinho/supermarket-api/internal/http"
+	"github.com/csobrinho/supermarket-api/internal/logging"
 	"github.com/csobrinho/supermarket-api/internal/metrics"
 	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/internal/storage"
+	"github.com/csobrinho/supermarket-api/pkg/expr"
 	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"github.com/csobrinho/supermarket-api/providers/cvs"
+	"github.com/csobrinho/supermarket-api/providers/fake"
+	"github.com/csobrinho/supermarket-api/providers/kroger"
 	"github.com/csobrinho/supermarket-api/providers/safeway"
-	"github.com/google/logger"
+	"github.com/csobrinho/supermarket-api/providers/target"
+	"github.com/csobrinho/supermarket-api/providers/walgreens"
 )
 
 var (
 	// version is set at build time via -ldflags.
 	version = "dev"
 
+	providerName       = flag.String("provider", supermarket.LookupEnv("PROVIDER", "safeway"), "Supermarket provider, e.g. safeway, vons, kroger, target, walgreens or cvs. Can also be provided via 'PROVIDER' env.")
 	refreshToken       = flag.String("refresh_token", supermarket.LookupEnv("REFRESH_TOKEN", ""), "Refresh token for authentication. Can also be provided via 'REFRESH_TOKEN' env.")
 	clientId           = flag.String("client_id_token", supermarket.LookupEnv("CLIENT_ID", ""), "Client ID for authentication. Can also be provided via 'CLIENT_ID' env.")
+	clientSecret       = flag.String("client_secret", supermarket.LookupEnv("CLIENT_SECRET", ""), "Client secret for providers using OAuth2 client credentials, e.g. kroger. Can also be provided via 'CLIENT_SECRET' env.")
+	loginUsername      = flag.String("login_username", supermarket.LookupEnv("LOGIN_USERNAME", ""), "Username for providers that log in with a password, e.g. walgreens or cvs. Can also be provided via 'LOGIN_USERNAME' env.")
+	loginPassword      = flag.String("login_password", supermarket.LookupEnv("LOGIN_PASSWORD", ""), "Password for providers that log in with a password. Can also be provided via 'LOGIN_PASSWORD' env.")
+	loyaltyCard        = flag.String("loyalty_card", supermarket.LookupEnv("LOYALTY_CARD", ""), "If provided, loyalty card number, e.g. the CVS ExtraCare card. Can also be provided via 'LOYALTY_CARD' env.")
 	userAgent          = flag.String("user_agent", supermarket.LookupEnv("USER_AGENT", "okhttp/4.12.0"), "User agent for authentication. Can also be provided via 'USER_AGENT' env.")
 	apiKey             = flag.String("api_key", supermarket.LookupEnv("API_KEY", ""), "API key for authentication. Can also be provided via 'API_KEY' env.")
 	store              = flag.String("store_id", supermarket.LookupEnv("STORE_ID", ""), "Store ID to search for promotions. Can also be provided via 'STORE_ID' env.")
 	appVersion         = flag.String("app_version", supermarket.LookupEnv("APP_VERSION", ""), "App version to emulate. Can also be provided via 'APP_VERSION' env.")
+	account            = flag.String("account", supermarket.LookupEnv("ACCOUNT", "default"), "Account name used to key stored snapshots. Can also be provided via 'ACCOUNT' env.")
+	dbPath             = flag.String("db", supermarket.LookupEnv("DB", ""), "If provided, path of the local database where every deals snapshot is stored. Can also be provided via 'DB' env.")
+	auditPath          = flag.String("audit_log", supermarket.LookupEnv("AUDIT_LOG", ""), "If provided, path of the JSON Lines file where every clip attempt is recorded. Can also be provided via 'AUDIT_LOG' env.")
+	auditMaxSizeMB     = flag.Int("audit_max_size_mb", supermarket.LookupEnvInt("AUDIT_MAX_SIZE_MB", 10), "Size in megabytes after which the audit log is rotated. It is also rotated daily. Can also be provided via 'AUDIT_MAX_SIZE_MB' env.")
+	reportFile         = flag.String("report_file", supermarket.LookupEnv("REPORT_FILE", ""), "If provided, path of the JSON file where the summary of the run is written: metadata, durations, counters, the outcome of every clip attempt and the errors. Can also be provided via 'REPORT_FILE' env.")
+	checkpointFile     = flag.String("checkpoint_file", supermarket.LookupEnv("CHECKPOINT_FILE", ""), "If provided, path of the file where the clip plan and its progress are saved so that an interrupted run can be resumed. Can also be provided via 'CHECKPOINT_FILE' env.")
+	resume             = flag.Bool("resume", supermarket.LookupEnvBool("RESUME", false), "If true, continue the run saved in checkpoint_file instead of fetching all deals again. Can also be provided via 'RESUME' env.")
 	clipAll            = flag.Bool("clip_all", supermarket.LookupEnvBool("CLIP_ALL", false), "If true, also clip all coupons. Can also be provided via 'CLIP_ALL' env.")
 	delayMs            = flag.Int("delay_ms", supermarket.LookupEnvInt("DELAY_MS", 1000), "If provided, delay in milliseconds between requests. This value will be randomized +/-50%. Can also be provided via 'DELAY_MS' env.")
-	verbose            = flag.Int("verbose", supermarket.LookupEnvInt("VERBOSE", 0), "Log verbosity level [0-4]. Can also be provided via 'VERBOSE' env.")
+	clipLimit          = flag.Int("clip_limit", supermarket.LookupEnvInt("CLIP_LIMIT", 0), "If provided, maximum number of active clipped offers allowed by the account. Deals are clipped in priority order until the limit is reached. Can also be provided via 'CLIP_LIMIT' env.")
+	preferBrands       = flag.String("prefer_brands", supermarket.LookupEnv("PREFER_BRANDS", ""), "Comma separated brands to clip first. Can also be provided via 'PREFER_BRANDS' env.")
+	preferCategories   = flag.String("prefer_categories", supermarket.LookupEnv("PREFER_CATEGORIES", ""), "Comma separated categories to clip first. Can also be provided via 'PREFER_CATEGORIES' env.")
+	where              = flag.String("where", supermarket.LookupEnv("WHERE", ""), "If provided, only consider deals matching this expression, e.g. 'brand == \"Lucerne\" && end_date < now() + 3d'. Can also be provided via 'WHERE' env.")
+	verbose            = flag.Int("verbose", supermarket.LookupEnvInt("VERBOSE", 0), "If greater than 0, log at debug level, including the HTTP requests, as with --log_level=debug. Can also be provided via 'VERBOSE' env.")
+	logFormat          = flag.String("log_format", supermarket.LookupEnv("LOG_FORMAT", "text"), "Format of the logs written to stderr: text or json. Can also be provided via 'LOG_FORMAT' env.")
+	logLevel           = flag.String("log_level", supermarket.LookupEnv("LOG_LEVEL", ""), "Log level, debug, info, warn or error, followed by comma separated subsystem=level overrides, e.g. 'warn,clipper=info,http=debug'. The subsystems are main, clipper, http, storage, supermarket, plugin, scheduler and the providers. Defaults to info. Can also be provided via 'LOG_LEVEL' env.")
+	logRedact          = flag.String("log_redact", supermarket.LookupEnv("LOG_REDACT", ""), "Comma separated secrets masked in the HTTP logs, in addition to the authorization, cookie and API key headers and the token, password and card number fields: header:<name>, field:<name> for form, query and JSON fields, and path:<json path> such as 'path:data.*.token'. Can also be provided via 'LOG_REDACT' env.")
+	logBodyLimit       = flag.Int("log_body_limit", supermarket.LookupEnvInt("LOG_BODY_LIMIT", 4096), "Maximum number of bytes of the request and response bodies in the HTTP logs, after redaction, 0 to not log them. Can also be provided via 'LOG_BODY_LIMIT' env.")
 	prometheusEndpoint = flag.String("prometheus_endpoint", supermarket.LookupEnv("PROMETHEUS_ENDPOINT", ""), "Prometheus Pushgateway endpoint (e.g., http://localhost:9091). Can also be provided via 'PROMETHEUS_ENDPOINT' env.")
+	plugins            = pluginsVar("plugins", supermarket.LookupEnv("PLUGINS", ""), "Provider plugin, as name=path followed by space separated arguments, e.g. 'acme=/usr/local/bin/acme-plugin --region=us'. Repeat the flag to register several plugins. Can also be provided via 'PLUGINS' env, one plugin per line.")
+	httpMode           = flag.String("http_mode", supermarket.LookupEnv("HTTP_MODE", "live"), "HTTP mode: live, record (also write the requests to cassette_file) or replay (serve the requests from cassette_file). Can also be provided via 'HTTP_MODE' env.")
+	cassetteFile       = flag.String("cassette_file", supermarket.LookupEnv("CASSETTE_FILE", ""), "Path of the cassette file of the record and replay HTTP modes. Secrets are scrubbed from it. Can also be provided via 'CASSETTE_FILE' env.")
+	httpMatch          = flag.String("http_match", supermarket.LookupEnv("HTTP_MATCH", ""), "Comma separated rules to match requests to recorded ones in replay mode: method, host, path, query, body and header:<name>. Defaults to method,path,query. Can also be provided via 'HTTP_MATCH' env.")
+	harFile            = flag.String("har_file", supermarket.LookupEnv("HAR_FILE", ""), "If provided, path of a HAR 1.2 file where every request and response of the provider is written, with timings and redacted secrets, to open in the browser devtools or diff against another capture. Can also be provided via 'HAR_FILE' env.")
+	outputFlag         = flag.String("output", supermarket.LookupEnv("OUTPUT", "table"), "Output format of the listing commands: table, json, jsonl, csv, yaml or markdown. Can also be provided via 'OUTPUT' env.")
+	outputColumns      = flag.String("output_columns", supermarket.LookupEnv("OUTPUT_COLUMNS", ""), "Comma separated fields to output, named after the JSON fields, e.g. 'id,brand,end_date'. Defaults to a summary for the table, csv and markdown formats and to all fields for the others. Can also be provided via 'OUTPUT_COLUMNS' env.")
+	outputSort         = flag.String("output_sort", supermarket.LookupEnv("OUTPUT_SORT", ""), "Comma separated fields to sort the output by, prefixed with '-' for descending order, e.g. 'end_date,-brand'. Can also be provided via 'OUTPUT_SORT' env.")
+	outputFile         = flag.String("output_file", supermarket.LookupEnv("OUTPUT_FILE", ""), "If provided, file where the listing commands write their output instead of stdout. Can also be provided via 'OUTPUT_FILE' env.")
+	listenAddr         = flag.String("listen_addr", supermarket.LookupEnv("LISTEN_ADDR", ""), "If provided, address, e.g. ':9090', where /metrics, /healthz and /readyz are served while the binary runs, with or without a command. Can also be provided via 'LISTEN_ADDR' env.")
+	metricsUsername    = flag.String("metrics_username", supermarket.LookupEnv("METRICS_USERNAME", ""), "If provided, username of the basic authentication of /metrics. Can also be provided via 'METRICS_USERNAME' env.")
+	metricsPassword    = flag.String("metrics_password", supermarket.LookupEnv("METRICS_PASSWORD", ""), "Password of the basic authentication of /metrics. Can also be provided via 'METRICS_PASSWORD' env.")
+	tlsCertFile        = flag.String("tls_cert_file", supermarket.LookupEnv("TLS_CERT_FILE", ""), "If provided, PEM certificate file of listen_addr, which then serves HTTPS. Can also be provided via 'TLS_CERT_FILE' env.")
+	tlsKeyFile         = flag.String("tls_key_file", supermarket.LookupEnv("TLS_KEY_FILE", ""), "PEM key file of tls_cert_file. Can also be provided via 'TLS_KEY_FILE' env.")
 	prometheusJob      = flag.String("prometheus_job", supermarket.LookupEnv("PROMETHEUS_JOB", "supermarket"), "Prometheus job name for pushing metrics. Can also be provided via 'PROMETHEUS_JOB' env.")
 )
 
-func run(ctx context.Context) error {
-	logger.SetLevel(logger.Level(*verbose))
+var log = logging.For("main")
 
+func run(ctx context.Context, cfg *runConfig, rep *clipper.Report) error {
 	// Validate configuration.
-	if *refreshToken == "" || *clientId == "" || *apiKey == "" || *store == "" {
-		metrics.RecordError(metrics.ErrorCategoryConfigValidation)
-		return fmt.Errorf("missing required configuration: refresh_token, client_id, api_key, and store_id are required")
+	// The credentials each provider needs are validated when creating its client.
+	var filter *expr.Program
+	if cfg.where != "" {
+		var err error
+		if filter, err = compileWhere(cfg); err != nil {
+			metrics.RecordError(metrics.ErrorCategoryConfigValidation)
+			return fmt.Errorf("invalid where expression, %w", err)
+		}
 	}
 
-	factory := supermarket.NewFactory()
-	factory.Register("safeway", safeway.Creator)
-
-	rateLimiter := supermarket.NewRateLimiter((time.Duration(*delayMs))*time.Millisecond, 0.5)
-	sm, err := factory.Create(ctx, "safeway",
-		supermarket.WithUserAgent(*userAgent),
-		supermarket.WithAppVersion(*appVersion),
-		supermarket.WithCredentials(*clientId, *refreshToken),
-		supermarket.WithApiKey(*apiKey),
-		supermarket.WithDebug(*verbose > 0),
-		supermarket.WithStoreID(*store),
-	)
+	factory := newFactory()
+	info, err := factory.Lookup(cfg.provider)
 	if err != nil {
 		metrics.RecordError(metrics.ErrorCategoryConfigValidation)
-		return fmt.Errorf("creating client, %w", err)
+		return err
 	}
-	a, err := sm.Authenticator()
-	if err != nil {
+	if cfg.clipAll {
+		if err := info.Capabilities.Require(info.Name, supermarket.CapabilityClip); err != nil {
+			metrics.RecordError(metrics.ErrorCategoryConfigValidation)
+			return err
+		}
+	}
+	if err := checkResume(cfg); err != nil {
 		metrics.RecordError(metrics.ErrorCategoryConfigValidation)
-		return fmt.Errorf("creating authenticator, %w", err)
+		return err
 	}
 
-	logger.Info("main: getting an access token...")
+	rateLimiter := supermarket.NewRateLimiter((time.Duration(cfg.delayMs))*time.Millisecond, 0.5)
+	sm, closeClient, err := newSupermarket(ctx, cfg)
+	if err != nil {
+		metrics.RecordError(metrics.ErrorCategoryConfigValidation)
+		return err
+	}
+	defer closeClient()
 	start := time.Now()
-	t, err := a.RefreshToken(ctx)
+	ps, err := authenticate(ctx, cfg, sm)
 	if err != nil {
-		metrics.RecordError(metrics.ErrorCategoryTokenRefresh)
-		return fmt.Errorf("refreshing token, %w", err)
+		return err
+	}
+	rep.Durations.TokenRefresh = clipper.Milliseconds(time.Since(start))
+	// Failing to store the snapshot shouldn't prevent clipping.
+	db := openDB(cfg)
+	if db != nil {
+		defer db.Close()
+	}
+	opts := clipper.Options{
+		Policy: clipper.NewPolicy(clipper.Preferences{
+			Brands:     splitList(cfg.preferBrands),
+			Categories: splitList(cfg.preferCategories),
+		}),
+		Filter:      filter,
+		RateLimiter: rateLimiter,
+		Limit:       cfg.clipLimit,
+		// On SIGTERM, e.g. from Kubernetes, the clip in flight completes and is recorded.
+		FinishInFlight: true,
+	}
+
+	var (
+		cp         *clipper.Checkpoint
+		stats      *clipper.Stats
+		candidates []clipper.Candidate
+	)
+	if cfg.resume {
+		if cp, err = resumeCheckpoint(cfg); err != nil {
+			metrics.RecordError(metrics.ErrorCategoryConfigValidation)
+			return fmt.Errorf("resuming run, %w", err)
+		}
+		if cp != nil {
+			rep.Resumed = true
+			stats, candidates = cp.Resume()
+			log.InfoContext(ctx, "resuming run", "created", cp.Created, "left", len(candidates), "planned", len(cp.Plan))
+		}
+	}
+	if cp == nil {
+		log.InfoContext(ctx, "getting all promotions")
+		start := time.Now()
+		cds, err := ps.GetClipDeals(ctx, promotion.PromotionSearchOptions{})
+		if err != nil {
+			metrics.RecordError(metrics.ErrorCategoryPromotionsFetch)
+			return fmt.Errorf("getting promotions, %w", err)
+		}
+		metrics.RecordPromotionsFetchDuration(time.Since(start))
+		rep.Durations.Fetch = clipper.Milliseconds(time.Since(start))
+		rep.Counters.Deals = len(cds)
+		metrics.RecordPromotionsCount(len(cds))
+		if db != nil {
+			if err := saveSnapshot(db, snapshotSource(cfg), start, cds); err != nil {
+				log.WarnContext(ctx, "failed to save snapshot", logging.KeyError, err)
+			}
+		}
+		if !cfg.clipAll {
+			log.InfoContext(ctx, "not clipping any promotions")
+			return nil
+		}
+		if stats, candidates, err = clipper.Plan(cds, opts); err != nil {
+			metrics.RecordError(metrics.ErrorCategoryPromotionsParse)
+			return fmt.Errorf("filtering promotions, %w", err)
+		}
+		if cfg.checkpointFile != "" {
+			cp = clipper.NewCheckpoint(cfg.checkpointFile, cfg.provider, cfg.account, cfg.store, candidates, stats)
+			if err := cp.Save(); err != nil {
+				log.WarnContext(ctx, "failed to save checkpoint", logging.KeyError, err)
+			}
+		}
 	}
-	metrics.RecordTokenRefreshDuration(time.Since(start))
-	logger.V(1).Infof("main: access token: %+v", t.AccessToken)
 
-	logger.Infof("main: getting all promotions...")
-	ps, err := sm.Promotion()
+	auditLog, err := openAuditLog(cfg)
 	if err != nil {
-		metrics.RecordError(metrics.ErrorCategoryPromotionsParse)
-		return fmt.Errorf("creating promotion service, %w", err)
+		metrics.RecordError(metrics.ErrorCategoryConfigValidation)
+		return err
+	}
+	if auditLog != nil {
+		defer auditLog.Close()
+	}
+
+	// Report the stats even if the run is interrupted or panics halfway through.
+	defer logStats(stats)
+	defer rep.SetStats(stats)
+	opts.OnClip = func(a clipper.Attempt) {
+		recordClip(cfg, db, auditLog, audit.ActionClip, a)
+		rep.Record(a)
+		if cp != nil {
+			cp.Record(a)
+			if err := cp.Save(); err != nil {
+				log.WarnContext(ctx, "failed to save checkpoint", logging.KeyError, err)
+			}
+		}
 	}
 	start = time.Now()
-	cds, err := ps.GetClipDeals(ctx, promotion.PromotionSearchOptions{})
+	clipper.Execute(ctx, ps, candidates, stats, opts)
+	rep.Durations.Clip = clipper.Milliseconds(time.Since(start))
+	if stats.Interrupted {
+		if cp != nil {
+			log.InfoContext(ctx, "progress saved, run again with --resume to continue", "path", cfg.checkpointFile)
+		}
+		return fmt.Errorf("clipping interrupted, %w", ctx.Err())
+	}
+	if cp != nil {
+		if err := cp.Remove(); err != nil {
+			log.WarnContext(ctx, "failed to remove checkpoint", logging.KeyError, err)
+		}
+	}
+	return nil
+}
+
+// checkResume returns an error if resume is set without a run it could resume.
+func checkResume(cfg *runConfig) error {
+	if cfg.resume && (cfg.checkpointFile == "" || !cfg.clipAll) {
+		return fmt.Errorf("resume requires checkpoint_file and clip_all")
+	}
+	return nil
+}
+
+// resumeCheckpoint loads the checkpoint to resume. It returns nil if there is none or if it
+// belongs to another account or store.
+func resumeCheckpoint(cfg *runConfig) (*clipper.Checkpoint, error) {
+	cp, err := clipper.LoadCheckpoint(cfg.checkpointFile)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Info("no checkpoint to resume, starting a new run")
+		return nil, nil
+	}
 	if err != nil {
-		metrics.RecordError(metrics.ErrorCategoryPromotionsFetch)
-		return fmt.Errorf("getting promotions, %w", err)
+		return nil, err
+	}
+	if !cp.Matches(cfg.provider, cfg.account, cfg.store) {
+		log.Warn("ignoring checkpoint of another run, starting a new run", logging.KeyProvider, cp.Provider, logging.KeyAccount, cp.Account, "store", cp.Store)
+		return nil, nil
+	}
+	return cp, nil
+}
+
+// logStats logs the clip stats and records them in the metrics.
+func logStats(stats *clipper.Stats) {
+	log.Info("clip stats", "already", stats.Already, "newly", stats.Clipped, "deleted", stats.Deleted, "ignored", stats.Ignored,
+		"filtered", stats.Filtered, "errors", stats.Errors, "unclipped", len(stats.Unclipped), "pending", stats.Pending)
+	stats.LogUnclipped()
+	// Set clip stats metrics.
+	metrics.RecordClipStats(stats.Already, stats.Clipped, stats.Deleted, stats.Ignored, stats.Errors, len(stats.Unclipped))
+}
+
+// openDB opens the database of the db flag. It returns nil if there is none or it fails to open,
+// which only costs the history.
+func openDB(cfg *runConfig) *storage.DB {
+	if cfg.db == "" {
+		return nil
 	}
-	metrics.RecordPromotionsFetchDuration(time.Since(start))
-	metrics.RecordPromotionsCount(len(cds))
-	if !*clipAll {
-		logger.Infof("main: not clipping any promotions...")
+	db, err := storage.Open(cfg.db)
+	if err != nil {
+		log.Warn("failed to open database", "path", cfg.db, logging.KeyError, err)
 		return nil
 	}
+	return db
+}
 
-	stats := struct {
-		prev         int
-		new          int
-		deleted      int
-		notclippable int
-		err          int
-		log          bool
-	}{}
-	defer func() {
-		logger.Infof(`main: clip stats:
-    - already: %d
-    - newly:   %d
-    - deleted: %d
-    - ignored: %d
-    - errors:  %d`, stats.prev, stats.new, stats.deleted, stats.notclippable, stats.err)
-		// Set clip stats metrics.
-		metrics.RecordClipStats(stats.prev, stats.new, stats.deleted, stats.notclippable, stats.err)
-	}()
+// openAuditLog opens the audit log of the audit_log flag. It returns nil if there is none.
+func openAuditLog(cfg *runConfig) (*audit.Log, error) {
+	if cfg.auditLog == "" {
+		return nil, nil
+	}
+	al, err := audit.Open(cfg.auditLog, audit.RotateOptions{MaxSize: int64(cfg.auditMaxSizeMB) << 20, Daily: true})
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log, %w", err)
+	}
+	return al, nil
+}
 
-	for _, cd := range cds {
-		if cd.IsClipped {
-			stats.prev++
-			continue
+// recordClip records a clip or unclip attempt in the audit log and, for clips, in the history, when
+// enabled.
+func recordClip(cfg *runConfig, db *storage.DB, al *audit.Log, action audit.Action, a clipper.Attempt) {
+	now := time.Now()
+	errStr := ""
+	if a.Err != nil {
+		errStr = a.Err.Error()
+	}
+	if db != nil && action == audit.ActionClip {
+		ev := storage.ClipEvent{Time: now, Provider: cfg.provider, Account: cfg.account, DealID: a.Deal.ID, Brand: a.Deal.Brand, Success: a.Err == nil, Error: errStr, Latency: a.Latency}
+		if err := db.RecordClip(ev); err != nil {
+			log.Warn("failed to record clip", logging.KeyDealID, a.Deal.ID, logging.KeyError, err)
 		}
-		if !cd.IsClippable {
-			stats.notclippable++
-			continue
+	}
+	if al != nil {
+		e := audit.Entry{
+			Time:       now,
+			Provider:   cfg.provider,
+			Account:    cfg.account,
+			Action:     action,
+			DealID:     a.Deal.ID,
+			Rule:       a.Rule,
+			Score:      a.Score,
+			HTTPStatus: a.HTTPStatus,
+			Latency:    a.Latency,
+			Outcome:    audit.OutcomeOf(a.Err),
+			Error:      errStr,
 		}
-		if cd.IsDeleted {
-			stats.deleted++
-			continue
+		if a.Deal.PromoCode != nil {
+			e.OfferCode = *a.Deal.PromoCode
 		}
-		if stats.log {
-			logger.Infof("main: clipping all promotions...")
-			stats.log = false
+		if err := al.Record(e); err != nil {
+			log.Warn("failed to audit", "action", action, logging.KeyDealID, a.Deal.ID, logging.KeyError, err)
 		}
-		start := time.Now()
-		if err := ps.ClipDeal(ctx, cd); err != nil {
-			metrics.RecordError(metrics.ErrorCategoryClipDeal)
-			stats.err++
-			logger.Errorf("main: error clipping deal %v, %v", cd, err)
+	}
+}
+
+// saveSnapshot stores the deals in the local database and logs what changed since the previous run.
+func saveSnapshot(db *storage.DB, src storage.Source, t time.Time, cds []promotion.ClipDeal) error {
+	cur := &storage.Snapshot{Source: src, Time: t, Deals: cds}
+	if err := db.SaveSnapshot(cur); err != nil {
+		return err
+	}
+	prev, err := db.PreviousSnapshot(cur.Source, cur.Time)
+	if errors.Is(err, storage.ErrNotFound) {
+		log.Info("saved first snapshot", "source", cur.Source)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	d := storage.DiffSnapshots(prev, cur)
+	log.Info("saved snapshot", "source", cur.Source, "since", prev.Time, "new", len(d.New), "removed", len(d.Removed),
+		"changed", len(d.Changed), "expired", len(d.Expired))
+	return nil
+}
+
+// compileWhere compiles the where expression, type checking the item fields against the item of the
+// provider if it is known.
+func compileWhere(cfg *runConfig) (*expr.Program, error) {
+	var opts []expr.Option
+	if item := itemType(cfg.provider); item != nil {
+		opts = append(opts, expr.WithFieldType("item", item))
+	}
+	return expr.Compile(cfg.where, opts...)
+}
+
+// itemType returns a sample of the original item of the deals of the provider, to type check the
+// item fields of --where expressions, or nil for plugins, whose items are unknown.
+func itemType(provider string) any {
+	if plugins.has(provider) {
+		return nil
+	}
+	switch provider {
+	case "kroger":
+		return kroger.Coupon{}
+	case "target":
+		return target.Offer{}
+	case "walgreens":
+		return walgreens.Coupon{}
+	case "cvs":
+		return cvs.Coupon{}
+	case "fake":
+		return fake.Item{}
+	}
+	if _, err := safeway.LookupBanner(provider); err == nil {
+		return safeway.Promotion{}
+	}
+	return nil
+}
+
+// newFactory returns a factory with all the providers and plugins registered. Plugins are only
+// started when their provider is created or looked up.
+var newFactory = sync.OnceValue(func() supermarket.Factory {
+	factory := supermarket.NewFactory()
+	safeway.Register(factory)
+	factory.Register("kroger", kroger.Creator, kroger.Capabilities...)
+	factory.Register("target", target.Creator)
+	factory.Register("walgreens", walgreens.Creator)
+	factory.Register("cvs", cvs.Creator)
+	factory.Register("fake", fake.Creator, fake.Capabilities...)
+	for _, p := range plugins.specs {
+		name, args, err := parsePlugin(p)
+		if err != nil {
+			log.Error("invalid plugin", "plugin", p, logging.KeyError, err)
 			continue
 		}
-		metrics.RecordClipDealDuration(time.Since(start))
-		stats.new++
-		rateLimiter.Wait()
+		if err := factory.RegisterPlugin(name, args[0], args[1:]...); err != nil {
+			log.Error("failed to register plugin", "plugin", name, logging.KeyError, err)
+		}
 	}
+	return factory
+})
+
+// pluginsFlag is the repeatable --plugins flag. Its default comes from the environment, one plugin
+// per line, and is replaced by the plugins of the command line.
+type pluginsFlag struct {
+	specs []string
+	set   bool
+}
+
+// pluginsVar defines the repeatable flag, with the plugins of value, one per line.
+func pluginsVar(name, value, usage string) *pluginsFlag {
+	p := newPluginsFlag(value)
+	flag.Var(p, name, usage)
+	return p
+}
+
+// newPluginsFlag returns the flag with the plugins of value, one per line.
+func newPluginsFlag(value string) *pluginsFlag {
+	p := &pluginsFlag{}
+	for _, spec := range strings.Split(value, "\n") {
+		if spec = strings.TrimSpace(spec); spec != "" {
+			p.specs = append(p.specs, spec)
+		}
+	}
+	return p
+}
+
+func (p *pluginsFlag) String() string { return strings.Join(p.specs, "\n") }
+
+func (p *pluginsFlag) Set(spec string) error {
+	if _, _, err := parsePlugin(spec); err != nil {
+		return err
+	}
+	if !p.set {
+		p.specs, p.set = nil, true
+	}
+	p.specs = append(p.specs, spec)
 	return nil
 }
 
+// has returns whether a plugin has the name.
+func (p *pluginsFlag) has(name string) bool {
+	for _, spec := range p.specs {
+		if n, _, err := parsePlugin(spec); err == nil && n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePlugin parses name=path followed by space separated arguments.
+func parsePlugin(spec string) (name string, args []string, err error) {
+	name, cmd, ok := strings.Cut(spec, "=")
+	args = strings.Fields(cmd)
+	if name = strings.TrimSpace(name); !ok || name == "" || len(args) == 0 {
+		return "", nil, fmt.Errorf("invalid plugin %q, expected name=path", spec)
+	}
+	return name, args, nil
+}
+
+// cassette is the transport of the record and replay modes, once newRecorder built it. main closes
+// it to write the cassette.
+var cassette atomic.Pointer[ihttp.Recorder]
+
+// newRecorder returns the transport of the http mode and of --har_file, or nil in live mode
+// without a HAR file. It is built once, so all the clients of the process, e.g. of serve, share the
+// cassette and the HAR file instead of overwriting them.
+var newRecorder = sync.OnceValues(func() (http.RoundTripper, error) {
+	mode, err := ihttp.ParseMode(*httpMode)
+	if err != nil || (mode == ihttp.ModeLive && *harFile == "") {
+		return nil, err
+	}
+	var rt http.RoundTripper
+	if rt, err = ihttp.NewTransport(true); err != nil {
+		return nil, err
+	}
+	if mode != ihttp.ModeLive {
+		rec, err := ihttp.NewRecorder(mode, *cassetteFile, rt)
+		if err != nil {
+			return nil, err
+		}
+		if rec.Matchers, err = ihttp.ParseMatchers(*httpMatch); err != nil {
+			return nil, err
+		}
+		log.Info("http mode", "mode", mode, "cassette", *cassetteFile)
+		cassette.Store(rec)
+		rt = rec
+	}
+	if *harFile != "" {
+		hw, err := ihttp.NewHARWriter(*harFile, "supermarket", version, rt)
+		if err != nil {
+			return nil, err
+		}
+		hw.Redactor = ihttp.LogRedactor
+		log.Info("writing HAR", "path", *harFile)
+		rt = hw
+	}
+	return rt, nil
+})
+
+// splitList splits a comma separated flag value, ignoring empty entries.
+func splitList(s string) []string {
+	var ret []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// initLogging configures the logs of --log_format and --log_level. They are written to stderr, which
+// leaves stdout to the output of the commands, e.g. to pipe it into jq.
+func initLogging() error {
+	format, err := logging.ParseFormat(*logFormat)
+	if err != nil {
+		return err
+	}
+	logging.SetHandler(logging.NewHandler(format, os.Stderr))
+	if ihttp.LogRedactor, err = ihttp.ParseRedactor(*logRedact); err != nil {
+		return err
+	}
+	ihttp.LogBodyLimit = *logBodyLimit
+	if *verbose > 0 {
+		logging.SetLevel("", slog.LevelDebug)
+	}
+	return logging.ParseLevels(*logLevel)
+}
+
 func main() {
-	logger.Init("supermarket", true, false, io.Discard)
 	flag.Parse()
+	if err := initLogging(); err != nil {
+		fmt.Fprintf(os.Stderr, "supermarket: %v\n", err)
+		os.Exit(2)
+	}
 
 	// Set build info.
 	metrics.SetBuildInfo(version, runtime.Version())
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(logging.WithAttrs(context.Background(), logging.KeyProvider, *providerName, logging.KeyAccount, *account))
 	defer cancel()
 
 	// Handle OS signals for graceful shutdown.
@@ -160,33 +553,66 @@ func main() {
 	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		sig := <-ch
-		logger.Infof("main: received signal %v, shutting down...", sig)
+		log.InfoContext(ctx, "received signal, shutting down", "signal", sig.String())
 		cancel()
 	}()
 
+	serverMux = newServeMux()
+	stopServer, err := startServer(ctx, serverMux)
+	if err != nil {
+		log.ErrorContext(ctx, "error", logging.KeyError, err)
+		os.Exit(1)
+	}
+	if flag.NArg() > 0 {
+		err = commands.execute(ctx, "", flag.Args())
+	} else {
+		err = runAndReport(ctx, flagConfig())
+	}
+	stopServer()
+	if rec := cassette.Load(); rec != nil {
+		if err := rec.Close(); err != nil {
+			log.ErrorContext(ctx, "failed to save cassette", logging.KeyError, err)
+		}
+	}
+	if err != nil {
+		log.ErrorContext(ctx, "error", logging.KeyError, err)
+		os.Exit(1)
+	}
+}
+
+// runAndReport runs the job of the binary without a command, fetching and optionally clipping all
+// deals, and records and pushes its metrics.
+func runAndReport(ctx context.Context, cfg *runConfig) error {
 	metrics.RecordRunStart()
 	start := time.Now()
-	err := run(ctx)
+	rep := clipper.NewReport(version, runtime.Version(), cfg.provider, cfg.account, cfg.store)
+	err := run(ctx, cfg, rep)
 	metrics.RecordExecutionDuration(time.Since(start))
+	if cfg.reportFile != "" {
+		rep.Finish(err)
+		if err := rep.Save(cfg.reportFile); err != nil {
+			log.ErrorContext(ctx, "failed to write report", logging.KeyError, err)
+		}
+	}
 
 	// Record success or failure.
+	metrics.RecordRun(cfg.account, time.Now(), err)
 	if err != nil {
-		logger.Errorf("main: error, %v", err)
 		metrics.RecordFailure()
 	} else {
-		logger.Infof("main: all done ✅")
+		log.InfoContext(ctx, "all done ✅", logging.KeyDuration, time.Since(start))
 		metrics.RecordSuccess()
 	}
 
 	// Push metrics to Prometheus Pushgateway if configured.
-	if *prometheusEndpoint != "" {
-		logger.Infof("main: pushing metrics to %s...", *prometheusEndpoint)
-		if pushErr := metrics.PushMetrics(ctx, *prometheusEndpoint, *prometheusJob); pushErr != nil {
-			logger.Errorf("main: failed to push metrics: %v", pushErr)
+	if cfg.prometheusEndpoint != "" {
+		log.InfoContext(ctx, "pushing metrics", "endpoint", cfg.prometheusEndpoint)
+		// The run context is canceled on SIGTERM, the partial metrics are still worth pushing.
+		pushCtx, pushCancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer pushCancel()
+		if pushErr := metrics.PushMetrics(pushCtx, cfg.prometheusEndpoint, cfg.prometheusJob); pushErr != nil {
+			log.ErrorContext(ctx, "failed to push metrics", logging.KeyError, pushErr)
 		}
 	}
-
-	if err != nil {
-		os.Exit(1)
-	}
+	return err
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/csobrinho/supermarket-api/internal/clipper"
+	"github.com/csobrinho/supermarket-api/providers/fake"
+	"github.com/csobrinho/supermarket-api/providers/safeway"
+)
+
+// setFlag sets the flag of the CLI for the test, and restores it when the test ends.
+func setFlag(t *testing.T, name, value string) {
+	t.Helper()
+	f := flag.Lookup(name)
+	old := f.Value.String()
+	if err := f.Value.Set(value); err != nil {
+		t.Fatalf("flag %s: Set(%q) failed: %v", name, value, err)
+	}
+	t.Cleanup(func() { _ = f.Value.Set(old) })
+}
+
+// restoreFlags restores all the flags of the CLI when the test ends, e.g. after the runs of serve.
+func restoreFlags(t *testing.T) map[string]string {
+	t.Helper()
+	base := map[string]string{}
+	flag.VisitAll(func(f *flag.Flag) { base[f.Name] = f.Value.String() })
+	t.Cleanup(func() {
+		for name, v := range base {
+			if flag.Lookup(name).Value.String() != v {
+				_ = flag.Set(name, v)
+			}
+		}
+	})
+	return base
+}
+
+func TestResume(t *testing.T) {
+	setFlag(t, "provider", "fake")
+	setFlag(t, "resume", "true")
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint.json")
+	tests := []struct {
+		clipAll, checkpointFile string
+	}{
+		{"false", checkpoint},
+		{"true", ""},
+		{"false", ""},
+	}
+	for _, tt := range tests {
+		setFlag(t, "clip_all", tt.clipAll)
+		setFlag(t, "checkpoint_file", tt.checkpointFile)
+		err := run(t.Context(), flagConfig(), clipper.NewReport("test", "go", "fake", "", ""))
+		if err == nil || !strings.Contains(err.Error(), "resume requires checkpoint_file and clip_all") {
+			t.Errorf("run() with --resume --clip_all=%s --checkpoint_file=%q = %v, want a configuration error", tt.clipAll, tt.checkpointFile, err)
+		}
+	}
+}
+
+func TestPluginsFlag(t *testing.T) {
+	p := newPluginsFlag("a=/bin/a --x=1,2\n\n b=/bin/b \n")
+	if want := []string{"a=/bin/a --x=1,2", "b=/bin/b"}; !slices.Equal(p.specs, want) {
+		t.Errorf("newPluginsFlag() = %q, want %q", p.specs, want)
+	}
+	// The flags replace the plugins of the environment.
+	for _, spec := range []string{"c=/bin/c --list=x,y", "d=/bin/d"} {
+		if err := p.Set(spec); err != nil {
+			t.Fatalf("Set(%q) failed: %v", spec, err)
+		}
+	}
+	if want := []string{"c=/bin/c --list=x,y", "d=/bin/d"}; !slices.Equal(p.specs, want) {
+		t.Errorf("Set() = %q, want %q", p.specs, want)
+	}
+	if !p.has("c") || p.has("a") {
+		t.Errorf("has() = %t, %t, want c and not a", p.has("c"), p.has("a"))
+	}
+	for _, spec := range []string{"", "c", "=/bin/c", "c="} {
+		if err := p.Set(spec); err == nil {
+			t.Errorf("Set(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestParsePlugin(t *testing.T) {
+	name, args, err := parsePlugin(" acme = /usr/local/bin/acme-plugin --region=us,eu ")
+	if want := []string{"/usr/local/bin/acme-plugin", "--region=us,eu"}; err != nil || name != "acme" || !slices.Equal(args, want) {
+		t.Errorf("parsePlugin() = %q, %q, %v, want acme, %q", name, args, err, want)
+	}
+}
+
+func TestItemType(t *testing.T) {
+	old := plugins.specs
+	plugins.specs = []string{"acme=/bin/acme", "kroger=/bin/kroger-plugin"}
+	t.Cleanup(func() { plugins.specs = old })
+	tests := []struct {
+		provider string
+		want     any
+	}{
+		{"safeway", safeway.Promotion{}},
+		{"vons", safeway.Promotion{}},
+		{"fake", fake.Item{}},
+		{"acme", nil},
+		{"kroger", nil}, // A plugin replacing a provider.
+		{"unknown", nil},
+	}
+	for _, tt := range tests {
+		if got := itemType(tt.provider); reflect.TypeOf(got) != reflect.TypeOf(tt.want) {
+			t.Errorf("itemType(%q) = %T, want %T", tt.provider, got, tt.want)
+		}
+	}
+}
+
+// The accounts of serve share the plugins of the process.
+func TestServePlugins(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "serve.yaml")
+	config := "accounts:\n  - name: a\n    schedule: '@daily'\n    flags:\n      plugins: b=/bin/b\n"
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadServeFile(path); err == nil || !strings.Contains(err.Error(), `flag "plugins" can only be set for the process`) {
+		t.Errorf("loadServeFile() with plugins = %v, want an error", err)
+	}
+}
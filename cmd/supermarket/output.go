@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/csobrinho/supermarket-api/internal/output"
+)
+
+// outputFormat returns the format of --output.
+func outputFormat() (output.Format, error) {
+	return output.ParseFormat(*outputFlag)
+}
+
+// writeOutput writes the rows of a listing command to --output_file, or stdout, in the format of
+// --output. The table, csv and markdown formats show the default columns unless --output_columns
+// is provided.
+func writeOutput[T any](rows []T, defaults ...string) error {
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+	opts := output.Options{Format: format, Columns: splitList(*outputColumns), Default: defaults, Sort: splitList(*outputSort)}
+	if *outputFile == "" {
+		return output.Write(os.Stdout, rows, opts)
+	}
+	f, err := os.Create(*outputFile)
+	if err != nil {
+		return fmt.Errorf("creating output file, %w", err)
+	}
+	if err := output.Write(f, rows, opts); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing output file, %w", err)
+	}
+	log.Info("wrote output", "rows", len(rows), "path", *outputFile)
+	return nil
+}
+
+// tabularOutput reports whether the listing is read by people, who can be told more than the rows.
+func tabularOutput() bool {
+	format, err := outputFormat()
+	return err == nil && format.Tabular() && *outputFile == ""
+}
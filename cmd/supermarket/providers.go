@@ -0,0 +1,16 @@
+package main
+
+import (
+	"context"
+	"flag"
+)
+
+var providersCommand = &command{
+	name:  "providers",
+	short: "List the providers and their capabilities.",
+	run:   runProviders,
+}
+
+func runProviders(ctx context.Context, fs *flag.FlagSet) error {
+	return writeOutput(newFactory().Available())
+}
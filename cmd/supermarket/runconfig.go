@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+)
+
+// runConfig is the configuration of a run and of the clients of the commands. The flags of the
+// command line are its defaults, which serve overrides with the flags of each account, so that
+// several accounts can run in the same process without changing the flags.
+type runConfig struct {
+	provider, account, store             string
+	refreshToken, clientID, clientSecret string
+	loginUsername, loginPassword         string
+	loyaltyCard, apiKey                  string
+	userAgent, appVersion                string
+	db, auditLog                         string
+	auditMaxSizeMB                       int
+	reportFile, checkpointFile           string
+	resume, clipAll                      bool
+	delayMs, clipLimit                   int
+	preferBrands, preferCategories       string
+	where                                string
+	prometheusEndpoint, prometheusJob    string
+	// providerFlags are the flags of the providers set for the account, e.g. fake_catalog, see
+	// supermarket.Config.Flags.
+	providerFlags map[string]string
+
+	fs *flag.FlagSet // The flags of the fields, to set them by name.
+}
+
+// flagConfig returns the configuration of the flags of the command line.
+func flagConfig() *runConfig {
+	c := &runConfig{providerFlags: map[string]string{}}
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.StringVar(&c.provider, "provider", *providerName, "")
+	fs.StringVar(&c.account, "account", *account, "")
+	fs.StringVar(&c.store, "store_id", *store, "")
+	fs.StringVar(&c.refreshToken, "refresh_token", *refreshToken, "")
+	fs.StringVar(&c.clientID, "client_id_token", *clientId, "")
+	fs.StringVar(&c.clientSecret, "client_secret", *clientSecret, "")
+	fs.StringVar(&c.loginUsername, "login_username", *loginUsername, "")
+	fs.StringVar(&c.loginPassword, "login_password", *loginPassword, "")
+	fs.StringVar(&c.loyaltyCard, "loyalty_card", *loyaltyCard, "")
+	fs.StringVar(&c.apiKey, "api_key", *apiKey, "")
+	fs.StringVar(&c.userAgent, "user_agent", *userAgent, "")
+	fs.StringVar(&c.appVersion, "app_version", *appVersion, "")
+	fs.StringVar(&c.db, "db", *dbPath, "")
+	fs.StringVar(&c.auditLog, "audit_log", *auditPath, "")
+	fs.IntVar(&c.auditMaxSizeMB, "audit_max_size_mb", *auditMaxSizeMB, "")
+	fs.StringVar(&c.reportFile, "report_file", *reportFile, "")
+	fs.StringVar(&c.checkpointFile, "checkpoint_file", *checkpointFile, "")
+	fs.BoolVar(&c.resume, "resume", *resume, "")
+	fs.BoolVar(&c.clipAll, "clip_all", *clipAll, "")
+	fs.IntVar(&c.delayMs, "delay_ms", *delayMs, "")
+	fs.IntVar(&c.clipLimit, "clip_limit", *clipLimit, "")
+	fs.StringVar(&c.preferBrands, "prefer_brands", *preferBrands, "")
+	fs.StringVar(&c.preferCategories, "prefer_categories", *preferCategories, "")
+	fs.StringVar(&c.where, "where", *where, "")
+	fs.StringVar(&c.prometheusEndpoint, "prometheus_endpoint", *prometheusEndpoint, "")
+	fs.StringVar(&c.prometheusJob, "prometheus_job", *prometheusJob, "")
+	c.fs = fs
+	return c
+}
+
+// set overrides a flag of the configuration. The flags of the providers, prefixed with their name,
+// e.g. fake_catalog, are passed to their clients. The other flags of the command line configure
+// the process, e.g. its logs, and can't be set.
+func (c *runConfig) set(name, value string) error {
+	if f := c.fs.Lookup(name); f != nil {
+		if err := f.Value.Set(value); err != nil {
+			return fmt.Errorf("invalid flag %s, %w", name, err)
+		}
+		return nil
+	}
+	if flag.Lookup(name) == nil {
+		return fmt.Errorf("unknown flag %q", name)
+	}
+	if !isProviderFlag(name) {
+		return fmt.Errorf("flag %q can only be set for the process", name)
+	}
+	c.providerFlags[name] = value
+	return nil
+}
+
+// isProviderFlag reports whether the flag belongs to a provider, i.e. is prefixed with its name.
+func isProviderFlag(name string) bool {
+	return slices.ContainsFunc(newFactory().Available(), func(info supermarket.ProviderInfo) bool {
+		return strings.HasPrefix(name, info.Name+"_")
+	})
+}
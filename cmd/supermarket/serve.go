@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/logging"
+	"github.com/csobrinho/supermarket-api/internal/metrics"
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/internal/scheduler"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	serveConfig    string
+	serveStateFile string
+	serveAPIKeys   string
+)
+
+var serveCommand = &command{
+	name:  "serve",
+	short: "Run as a daemon, clipping the accounts of a config file on their schedules.",
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&serveConfig, "config", supermarket.LookupEnv("SERVE_CONFIG", ""), "Path of the YAML file of the accounts to clip and their schedules. Can also be provided via 'SERVE_CONFIG' env.")
+		fs.StringVar(&serveAPIKeys, "api_keys", supermarket.LookupEnv("SERVE_API_KEYS", ""), "If provided, comma separated keys of the REST API served on listen_addr, which is disabled otherwise. Can also be provided via 'SERVE_API_KEYS' env.")
+		fs.StringVar(&serveStateFile, "state_file", supermarket.LookupEnv("SERVE_STATE_FILE", "supermarket-serve.json"), "Path of the file where the last and next runs of the accounts and their rotated refresh tokens are kept across restarts. Can also be provided via 'SERVE_STATE_FILE' env.")
+	},
+	run: runServe,
+}
+
+// serveFile is the config file of serve:
+//
+//	accounts:
+//	  - name: home
+//	    schedule: "0 6 * * *"
+//	    jitter: 30m
+//	    flags:
+//	      provider: safeway
+//	      refresh_token: ${HOME_REFRESH_TOKEN}
+//	      clip_all: true
+type serveFile struct {
+	Accounts []serveAccount `yaml:"accounts"`
+}
+
+// serveAccount is an account clipped by serve. Its runs are the job of the binary without a
+// command, with the flags of the command line overridden by the ones of the account.
+type serveAccount struct {
+	Name     string        `yaml:"name"` // The --account of the runs, unless set in the flags.
+	Schedule string        `yaml:"schedule"`
+	Jitter   time.Duration `yaml:"jitter"`
+	// Flags are flag names and values. Values can refer to env variables as $NAME or ${NAME}.
+	Flags map[string]string `yaml:"flags"`
+}
+
+// Keys of the values kept in the state of the accounts.
+const (
+	stateRefreshToken = "refresh_token"
+	// stateRefreshTokenSeed is a hash of the configured refresh token the kept one was rotated
+	// from. Configuring a new token, e.g. after logging in again, discards the kept one.
+	stateRefreshTokenSeed = "refresh_token_seed"
+)
+
+func runServe(ctx context.Context, fs *flag.FlagSet) error {
+	if serveConfig == "" {
+		fs.Usage()
+		return fmt.Errorf("missing required flag: config")
+	}
+	cfg, err := loadServeFile(serveConfig)
+	if err != nil {
+		return err
+	}
+	s, err := scheduler.New(serveStateFile)
+	if err != nil {
+		return err
+	}
+	// The metrics of a run, e.g. its clip stats pushed to the Pushgateway, are the ones of the
+	// process. One run at a time keeps them apart and the other runs queued in order.
+	s.Concurrency = 1
+	accounts := make(map[string]*accountState, len(cfg.Accounts))
+	for _, a := range cfg.Accounts {
+		acc := &accountState{serveAccount: a}
+		accounts[a.Name] = acc
+		err := s.Add(scheduler.Job{
+			Name:     a.Name,
+			Schedule: a.Schedule,
+			Jitter:   a.Jitter,
+			Run: func(ctx context.Context, st *scheduler.JobState) error {
+				return runAccount(ctx, s, acc, st)
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	defer func() {
+		for _, acc := range accounts {
+			acc.mu.Lock()
+			acc.resetClient()
+			acc.mu.Unlock()
+		}
+	}()
+	if keys := splitList(serveAPIKeys); len(keys) > 0 {
+		if *listenAddr == "" {
+			return fmt.Errorf("api_keys requires listen_addr")
+		}
+		a := &api{ctx: ctx, sched: s, accounts: accounts, keys: keys}
+		a.register(serverMux)
+	}
+	// /readyz reflects the runs before a restart until the accounts run again.
+	jobs := s.Jobs()
+	for _, a := range cfg.Accounts {
+		if st := jobs[a.Name]; st.Runs > 0 {
+			var err error
+			if st.LastError != "" {
+				err = errors.New(st.LastError)
+			}
+			metrics.RecordRun(cmp.Or(a.Flags["account"], a.Name), st.LastEnd, err)
+		}
+	}
+	log.Info("serving", "accounts", len(cfg.Accounts), "state", serveStateFile)
+	if err := s.Run(ctx); err != nil {
+		return err
+	}
+	log.Info("shut down")
+	return nil
+}
+
+// loadServeFile reads and validates the config file of serve.
+func loadServeFile(path string) (*serveFile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading serve config, %w", err)
+	}
+	cfg := &serveFile{}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("decoding serve config %q, %w", path, err)
+	}
+	if len(cfg.Accounts) == 0 {
+		return nil, fmt.Errorf("serve config %q has no accounts", path)
+	}
+	var errs []error
+	names := map[string]bool{}
+	for i, a := range cfg.Accounts {
+		if a.Name == "" {
+			errs = append(errs, fmt.Errorf("account %d has no name", i+1))
+		} else if names[a.Name] {
+			errs = append(errs, fmt.Errorf("account %q is duplicated", a.Name))
+		}
+		names[a.Name] = true
+		if _, err := scheduler.ParseSchedule(a.Schedule); err != nil {
+			errs = append(errs, fmt.Errorf("account %q, %w", a.Name, err))
+		}
+		for name, v := range a.Flags {
+			a.Flags[name] = os.ExpandEnv(v)
+		}
+		if _, _, err := accountConfig(a, nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid serve config %q, %w", path, err)
+	}
+	return cfg, nil
+}
+
+// accountState is an account of serve, shared by its runs and the requests of the API.
+type accountState struct {
+	serveAccount
+	// mu serializes the runs and the requests of the account, which rotate the same refresh token.
+	mu sync.Mutex
+	// client is the client of the requests of the API, created by the first one, see
+	// api.withAccount. The runs reset it, they may rotate its refresh token.
+	client *accountClient
+}
+
+// accountClient is an authenticated client of an account.
+type accountClient struct {
+	cfg   *runConfig
+	ps    promotion.Service
+	close func()
+}
+
+// resetClient closes the client of the API, the next request creates a new one. It must be called
+// with mu held.
+func (a *accountState) resetClient() {
+	if a.client != nil {
+		a.client.close()
+		a.client = nil
+	}
+}
+
+// runAccount runs the job of the binary for the account, with its configuration and the refresh
+// token kept from its previous runs.
+func runAccount(ctx context.Context, s *scheduler.Scheduler, a *accountState, st *scheduler.JobState) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// A request of the API may have rotated the refresh token while the run waited for the lock.
+	if values, err := s.Values(a.Name); err == nil {
+		st.Values = values
+	}
+	a.resetClient()
+	cfg, keep, err := accountConfig(a.serveAccount, st.Values)
+	if err != nil {
+		return err
+	}
+	defer keep()
+	if ctx.Value(clipAllKey{}) != nil {
+		cfg.clipAll = true
+	}
+	return runAndReport(logging.WithAttrs(ctx, logging.KeyProvider, cfg.provider, logging.KeyAccount, cfg.account), cfg)
+}
+
+type clipAllKey struct{}
+
+// withClipAll returns a context whose runs of runAccount clip all deals, as with --clip_all.
+func withClipAll(ctx context.Context) context.Context {
+	return context.WithValue(ctx, clipAllKey{}, true)
+}
+
+// accountConfig returns the configuration of the account: the flags of the command line overridden
+// by the ones of the account, with the refresh token kept in its values. keep updates the values
+// with the refresh token once the configuration was used.
+func accountConfig(a serveAccount, values map[string]string) (cfg *runConfig, keep func(), err error) {
+	cfg = flagConfig()
+	cfg.account = a.Name
+	for name, v := range a.Flags {
+		if err := cfg.set(name, v); err != nil {
+			return nil, nil, fmt.Errorf("account %q, %w", a.Name, err)
+		}
+	}
+	configured := cfg.refreshToken
+	seed := tokenSeed(configured)
+	if t := values[stateRefreshToken]; t != "" && values[stateRefreshTokenSeed] == seed {
+		cfg.refreshToken = t
+	}
+	return cfg, func() {
+		// Only a rotated refresh token is kept, the configured one is never copied to the state.
+		if cfg.refreshToken != configured {
+			values[stateRefreshToken] = cfg.refreshToken
+			values[stateRefreshTokenSeed] = seed
+		} else {
+			delete(values, stateRefreshToken)
+			delete(values, stateRefreshTokenSeed)
+		}
+	}, nil
+}
+
+func tokenSeed(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:8])
+}
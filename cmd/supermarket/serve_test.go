@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/clipper"
+	"github.com/csobrinho/supermarket-api/internal/scheduler"
+)
+
+// readJSON decodes the JSON file into v, and reports whether it could.
+func readJSON(path string, v any) bool {
+	b, err := os.ReadFile(path)
+	return err == nil && json.Unmarshal(b, v) == nil
+}
+
+// Two accounts of the fake provider, with their own catalog, clip limit and state, are clipped by
+// the runs they missed while serve was down, without their flags leaking into each other.
+func TestServe(t *testing.T) {
+	restoreFlags(t)
+	dir := t.TempDir()
+	catalog := filepath.Join(dir, "catalog.json")
+	if err := os.WriteFile(catalog, []byte(`[{"id":"1","is_clippable":true},{"id":"2","is_clippable":true},{"id":"3","is_clippable":true}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(dir, "serve.yaml")
+	account := func(name, extra string) string {
+		return fmt.Sprintf(`
+  - name: %[1]s
+    schedule: "@every 1h"
+    flags:
+      provider: fake
+      fake_catalog: %[2]s
+      fake_state_file: %[3]s
+      report_file: %[4]s
+      clip_all: "true"
+      delay_ms: "0"%[5]s`, name, catalog, filepath.Join(dir, name+"-fake.json"), filepath.Join(dir, name+"-report.json"), extra)
+	}
+	yaml := "accounts:" + account("home", "\n      fake_clip_limit: \"1\"") + account("work", "")
+	if err := os.WriteFile(config, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Both accounts missed a run.
+	state := filepath.Join(dir, "serve.json")
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	if err := os.WriteFile(state, fmt.Appendf(nil, `{"version":1,"jobs":{"home":{"next_run":%q},"work":{"next_run":%q}}}`, past, past), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	oldConfig, oldState := serveConfig, serveStateFile
+	serveConfig, serveStateFile = config, state
+	t.Cleanup(func() { serveConfig, serveStateFile = oldConfig, oldState })
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() { done <- runServe(ctx, nil) }()
+	ran := func() bool {
+		st := struct{ Jobs map[string]scheduler.JobState }{}
+		return readJSON(state, &st) && st.Jobs["home"].Runs == 1 && st.Jobs["work"].Runs == 1
+	}
+	for deadline := time.Now().Add(30 * time.Second); !ran(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatalf("timed out waiting for the runs of both accounts, serve returned %v", <-done)
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("runServe() failed: %v", err)
+	}
+
+	for name, want := range map[string]int{"home": 1, "work": 3} {
+		fst := struct{ Clipped map[string]time.Time }{}
+		if !readJSON(filepath.Join(dir, name+"-fake.json"), &fst) || len(fst.Clipped) != want {
+			t.Errorf("account %s clipped %v, want %d deal(s)", name, fst.Clipped, want)
+		}
+		rep := &clipper.Report{}
+		if !readJSON(filepath.Join(dir, name+"-report.json"), rep) || rep.Account != name || rep.Provider != "fake" {
+			t.Errorf("account %s report of %s/%s, want the report of its run", name, rep.Provider, rep.Account)
+		}
+	}
+	st := struct{ Jobs map[string]scheduler.JobState }{}
+	if !readJSON(state, &st) {
+		t.Fatal("reading the serve state failed")
+	}
+	for name, js := range st.Jobs {
+		if js.LastError != "" || time.Until(js.NextRun) < 59*time.Minute {
+			t.Errorf("account %s state = %+v, want a successful run and the next one in an hour", name, js)
+		}
+	}
+}
+
+// The flags of an account override the ones of the command line in its configuration only.
+func TestAccountConfig(t *testing.T) {
+	a := serveAccount{Name: "home", Flags: map[string]string{"provider": "fake", "delay_ms": "0", "clip_all": "true", "fake_clip_limit": "1"}}
+	cfg, _, err := accountConfig(a, nil)
+	if err != nil {
+		t.Fatalf("accountConfig() failed: %v", err)
+	}
+	if cfg.provider != "fake" || cfg.account != "home" || cfg.delayMs != 0 || !cfg.clipAll || !maps.Equal(cfg.providerFlags, map[string]string{"fake_clip_limit": "1"}) {
+		t.Errorf("accountConfig() = %+v, want the flags of the account", cfg)
+	}
+	for _, name := range []string{"provider", "delay_ms", "clip_all", "fake_clip_limit", "account"} {
+		if f := flag.Lookup(name); f.Value.String() != f.DefValue {
+			t.Errorf("accountConfig() set the flag %s of the process to %s", name, f.Value)
+		}
+	}
+	if cfg, _, _ := accountConfig(serveAccount{Name: "work", Flags: map[string]string{"account": "office"}}, nil); cfg.account != "office" {
+		t.Errorf("accountConfig() with the account flag = %q, want office", cfg.account)
+	}
+
+	tests := []struct {
+		name, value, want string
+	}{
+		{"log_level", "debug", `account "home", flag "log_level" can only be set for the process`},
+		{"plugins", "b=/bin/b", `account "home", flag "plugins" can only be set for the process`},
+		{"missing", "1", `account "home", unknown flag "missing"`},
+		{"delay_ms", "soon", `account "home", invalid flag delay_ms`},
+	}
+	for _, tt := range tests {
+		a := serveAccount{Name: "home", Flags: map[string]string{tt.name: tt.value}}
+		if _, _, err := accountConfig(a, nil); err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("accountConfig() with %s=%s = %v, want %q", tt.name, tt.value, err, tt.want)
+		}
+	}
+}
+
+// The refresh tokens rotated by authenticate are kept per account, and dropped once the configured
+// one changes.
+func TestAccountConfigRefreshToken(t *testing.T) {
+	home := serveAccount{Name: "home", Flags: map[string]string{"refresh_token": "rt-home"}}
+	work := serveAccount{Name: "work", Flags: map[string]string{"refresh_token": "rt-work"}}
+	homeValues, workValues := map[string]string{}, map[string]string{}
+	use := func(a serveAccount, values map[string]string, rotated string) string {
+		t.Helper()
+		cfg, keep, err := accountConfig(a, values)
+		if err != nil {
+			t.Fatalf("accountConfig(%s) failed: %v", a.Name, err)
+		}
+		used := cfg.refreshToken
+		if rotated != "" {
+			cfg.refreshToken = rotated // As authenticate does.
+		}
+		keep()
+		return used
+	}
+
+	if got := use(home, homeValues, "rt-home-2"); got != "rt-home" {
+		t.Errorf("home first run used %q, want the configured rt-home", got)
+	}
+	if got := use(work, workValues, ""); got != "rt-work" {
+		t.Errorf("work run used %q, want its own rt-work", got)
+	}
+	if _, ok := workValues[stateRefreshToken]; ok {
+		t.Errorf("work values = %v, want the configured token left out", workValues)
+	}
+	if got := use(home, homeValues, ""); got != "rt-home-2" {
+		t.Errorf("home second run used %q, want the rotated rt-home-2", got)
+	}
+	if homeValues[stateRefreshToken] != "rt-home-2" {
+		t.Errorf("home values = %v, want the rotated token kept", homeValues)
+	}
+	// Logging in again configures a new token, which replaces the rotated one.
+	home.Flags["refresh_token"] = "rt-home-new"
+	if got := use(home, homeValues, ""); got != "rt-home-new" {
+		t.Errorf("home run after a new login used %q, want rt-home-new", got)
+	}
+}
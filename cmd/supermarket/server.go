@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/logging"
+	"github.com/csobrinho/supermarket-api/internal/metrics"
+)
+
+// serverShutdownTimeout bounds the wait for the requests in flight when the server stops.
+const serverShutdownTimeout = 5 * time.Second
+
+// serverMux holds the handlers served on --listen_addr, commands such as serve can add theirs.
+var serverMux *http.ServeMux
+
+// newServeMux returns the handlers served on --listen_addr.
+func newServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", basicAuth(metrics.Handler(), *metricsUsername, *metricsPassword))
+	// The probes of Kubernetes don't authenticate.
+	mux.Handle("GET /healthz", metrics.HealthzHandler())
+	mux.Handle("GET /readyz", metrics.ReadyzHandler())
+	return mux
+}
+
+// startServer serves h on --listen_addr, with TLS if --tls_cert_file is set, until stop is called.
+// It returns a no-op stop when --listen_addr is empty.
+func startServer(ctx context.Context, h http.Handler) (stop func(), err error) {
+	if *listenAddr == "" {
+		return func() {}, nil
+	}
+	if (*tlsCertFile == "") != (*tlsKeyFile == "") {
+		return nil, fmt.Errorf("tls_cert_file and tls_key_file must be provided together")
+	}
+	if (*metricsUsername == "") != (*metricsPassword == "") {
+		return nil, fmt.Errorf("metrics_username and metrics_password must be provided together")
+	}
+	// Listening first reports a port in use before the run starts.
+	l, err := net.Listen("tcp", *listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("listening on %s, %w", *listenAddr, err)
+	}
+	srv := &http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: 10 * time.Second,
+		// The requests outlive the signals, the server is stopped after the run.
+		BaseContext: func(net.Listener) context.Context { return context.WithoutCancel(ctx) },
+	}
+	log.InfoContext(ctx, "serving http", "addr", l.Addr().String(), "tls", *tlsCertFile != "")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var err error
+		if *tlsCertFile != "" {
+			err = srv.ServeTLS(l, *tlsCertFile, *tlsKeyFile)
+		} else {
+			err = srv.Serve(l)
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.ErrorContext(ctx, "http server failed", "addr", l.Addr().String(), logging.KeyError, err)
+		}
+	}()
+	return func() {
+		sctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(sctx); err != nil {
+			log.ErrorContext(ctx, "failed to shut down the http server", logging.KeyError, err)
+		}
+		<-done
+	}, nil
+}
+
+// basicAuth requires the username and password on the requests of h, unless they are empty.
+func basicAuth(h http.Handler, username, password string) http.Handler {
+	if username == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(u), []byte(username)) != 1 || subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="supermarket", charset="UTF-8"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
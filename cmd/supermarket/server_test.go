@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeMux(t *testing.T) {
+	setFlag(t, "metrics_username", "prometheus")
+	setFlag(t, "metrics_password", "s3cr3t")
+	mux := newServeMux()
+	tests := []struct {
+		path, username, password string
+		want                     int
+	}{
+		{"/metrics", "", "", http.StatusUnauthorized},
+		{"/metrics", "prometheus", "wrong", http.StatusUnauthorized},
+		{"/metrics", "other", "s3cr3t", http.StatusUnauthorized},
+		{"/metrics", "prometheus", "s3cr3t", http.StatusOK},
+		// The probes don't authenticate.
+		{"/healthz", "", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.username != "" {
+			req.SetBasicAuth(tt.username, tt.password)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("GET %s as %q:%q = %d, want %d", tt.path, tt.username, tt.password, w.Code, tt.want)
+		}
+		if w.Code == http.StatusUnauthorized && !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Basic ") {
+			t.Errorf("GET %s as %q:%q didn't ask for basic authentication", tt.path, tt.username, tt.password)
+		}
+	}
+
+	// Without a username /metrics is public.
+	setFlag(t, "metrics_username", "")
+	w := httptest.NewRecorder()
+	newServeMux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /metrics without authentication = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestStartServer(t *testing.T) {
+	stop, err := startServer(t.Context(), http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("startServer() without listen_addr failed: %v", err)
+	}
+	stop()
+
+	setFlag(t, "listen_addr", "127.0.0.1:0")
+	tests := []struct {
+		flag, value, want string
+	}{
+		{"tls_cert_file", "cert.pem", "tls_cert_file and tls_key_file must be provided together"},
+		{"tls_key_file", "key.pem", "tls_cert_file and tls_key_file must be provided together"},
+		{"metrics_username", "prometheus", "metrics_username and metrics_password must be provided together"},
+		{"metrics_password", "s3cr3t", "metrics_username and metrics_password must be provided together"},
+	}
+	for _, tt := range tests {
+		setFlag(t, tt.flag, tt.value)
+		if _, err := startServer(t.Context(), http.NotFoundHandler()); err == nil || err.Error() != tt.want {
+			t.Errorf("startServer() with only %s = %v, want %q", tt.flag, err, tt.want)
+		}
+		setFlag(t, tt.flag, "")
+	}
+
+	// The listener is opened before startServer returns.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	setFlag(t, "listen_addr", addr)
+	if _, err := startServer(t.Context(), http.NotFoundHandler()); err == nil {
+		t.Errorf("startServer() on the address in use %s succeeded, want an error", addr)
+	}
+	l.Close()
+	stop, err = startServer(t.Context(), newServeMux())
+	if err != nil {
+		t.Fatalf("startServer() failed: %v", err)
+	}
+	defer stop()
+	res, err := http.Get("http://" + addr + "/healthz")
+	if err != nil {
+		t.Fatalf("GET /healthz failed: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("GET /healthz = %d, want %d", res.StatusCode, http.StatusOK)
+	}
+}
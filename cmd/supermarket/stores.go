@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+)
+
+var (
+	storesZipCode string
+	storesLimit   int
+)
+
+var storesCommand = &command{
+	name:  "stores",
+	short: "Find the stores of the provider.",
+	subcommands: []*command{{
+		name:     "search",
+		short:    "Search for stores near a zip code, whose ids can be used with --store_id.",
+		requires: supermarket.CapabilityStoreLookup,
+		setFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&storesZipCode, "zip_code", "", "Zip code to search stores near of.")
+			fs.IntVar(&storesLimit, "limit", 10, "Maximum number of stores to list.")
+		},
+		run: runStoresSearch,
+	}},
+}
+
+func runStoresSearch(ctx context.Context, fs *flag.FlagSet) error {
+	if storesZipCode == "" {
+		fs.Usage()
+		return fmt.Errorf("missing required flag: zip_code")
+	}
+	cfg := flagConfig()
+	sm, close, err := newSupermarket(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer close()
+	sl, ok := sm.(supermarket.StoreLocator)
+	if !ok {
+		return fmt.Errorf("%q doesn't support %s, %w", cfg.provider, supermarket.CapabilityStoreLookup, supermarket.ErrUnsupported)
+	}
+	stores, err := sl.SearchStores(ctx, supermarket.StoreSearchOptions{ZipCode: storesZipCode, Limit: storesLimit})
+	if err != nil {
+		return err
+	}
+	return writeOutput(stores, "id", "name", "address", "city", "state", "zip_code")
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"runtime"
+)
+
+var versionCommand = &command{
+	name:  "version",
+	short: "Print the version.",
+	run: func(ctx context.Context, fs *flag.FlagSet) error {
+		fmt.Printf("supermarket %s (%s %s/%s)\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+		return nil
+	},
+}
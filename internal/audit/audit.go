@@ -0,0 +1,228 @@
+// Package audit records every clip attempt in an append-only JSON Lines file.
+package audit
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+)
+
+// Action is the operation that was attempted.
+type Action string
+
+const (
+	ActionClip   Action = "clip"
+	ActionUnclip Action = "unclip"
+)
+
+// Outcome is the result of an attempt.
+type Outcome string
+
+const (
+	OutcomeSuccess  Outcome = "success"
+	OutcomeError    Outcome = "error"
+	OutcomeLimit    Outcome = "limit" // The account clip limit was reached.
+	OutcomeCanceled Outcome = "canceled"
+)
+
+// Outcomes lists the valid outcomes.
+var Outcomes = []Outcome{OutcomeSuccess, OutcomeError, OutcomeLimit, OutcomeCanceled}
+
+// OutcomeOf classifies the error returned by an attempt.
+func OutcomeOf(err error) Outcome {
+	switch {
+	case err == nil:
+		return OutcomeSuccess
+	case errors.Is(err, promotion.ErrClipLimitReached):
+		return OutcomeLimit
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return OutcomeCanceled
+	}
+	return OutcomeError
+}
+
+// Entry is a single audited attempt.
+type Entry struct {
+	Time       time.Time     `json:"time"`
+	Provider   string        `json:"provider"`
+	Account    string        `json:"account"`
+	Action     Action        `json:"action"`
+	DealID     string        `json:"deal_id"`
+	OfferCode  string        `json:"offer_code,omitempty"`
+	Rule       string        `json:"rule,omitempty"` // Rule that selected the deal.
+	Score      float64       `json:"score,omitempty"`
+	HTTPStatus int           `json:"http_status,omitempty"`
+	Latency    time.Duration `json:"-"`
+	LatencyMS  float64       `json:"latency_ms"`
+	Outcome    Outcome       `json:"outcome"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// rotateLayout is the layout of the time of rotation in the names of the rotated files.
+const rotateLayout = "20060102T150405"
+
+// RotateOptions control when the log file is rotated.
+type RotateOptions struct {
+	MaxSize int64 // Rotate when the file would exceed this size in bytes. Zero disables it.
+	Daily   bool  // Rotate when the local date changes.
+}
+
+// Log is an append-only audit log. Rotated files are renamed with the time of rotation, e.g.
+// audit.jsonl becomes audit-20250515T134355.jsonl.
+type Log struct {
+	mu   sync.Mutex
+	path string
+	opts RotateOptions
+	f    *os.File
+	size int64
+	day  string
+}
+
+// Open opens or creates the audit log at path.
+func Open(path string, opts RotateOptions) (*Log, error) {
+	l := &Log{path: path, opts: opts}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("audit: open %q, error %w", l.path, err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("audit: stat %q, error %w", l.path, err)
+	}
+	l.f, l.size, l.day = f, st.Size(), day(st.ModTime())
+	return nil
+}
+
+// Record appends an entry to the log, rotating it first if needed.
+func (l *Log) Record(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.LatencyMS = float64(e.Latency.Microseconds()) / 1000
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("audit: encode entry, error %w", err)
+	}
+	b = append(b, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return fmt.Errorf("audit: log %q is closed", l.path)
+	}
+	if l.size > 0 && (l.opts.MaxSize > 0 && l.size+int64(len(b)) > l.opts.MaxSize || l.opts.Daily && day(e.Time) != l.day) {
+		if err := l.rotate(e.Time); err != nil {
+			return err
+		}
+	}
+	n, err := l.f.Write(b)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("audit: write %q, error %w", l.path, err)
+	}
+	l.day = day(e.Time)
+	return l.f.Sync()
+}
+
+func (l *Log) rotate(t time.Time) error {
+	if err := l.f.Close(); err != nil {
+		return fmt.Errorf("audit: close %q, error %w", l.path, err)
+	}
+	l.f = nil
+	ext := filepath.Ext(l.path)
+	rotated := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(l.path, ext), t.Format(rotateLayout), ext)
+	for i := 1; fileExists(rotated); i++ {
+		rotated = fmt.Sprintf("%s-%s.%d%s", strings.TrimSuffix(l.path, ext), t.Format(rotateLayout), i, ext)
+	}
+	if err := os.Rename(l.path, rotated); err != nil {
+		return fmt.Errorf("audit: rotate %q, error %w", l.path, err)
+	}
+	return l.open()
+}
+
+// Close closes the log.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// Files returns the rotated files of the log at path followed by the current one, oldest first.
+// Rotated files are ordered by their time of rotation, then by their numeric suffix, e.g.
+// audit-20250515T134355.jsonl comes before audit-20250515T134355.1.jsonl.
+func Files(path string) ([]string, error) {
+	ext := filepath.Ext(path)
+	prefix := strings.TrimSuffix(path, ext) + "-"
+	matches, err := filepath.Glob(globEscape(prefix) + "*" + globEscape(ext))
+	if err != nil {
+		return nil, fmt.Errorf("audit: list %q, error %w", path, err)
+	}
+	type rotatedFile struct {
+		path string
+		t    time.Time
+		n    int
+	}
+	var rotated []rotatedFile
+	for _, m := range matches {
+		name := strings.TrimSuffix(strings.TrimPrefix(m, prefix), ext)
+		ts, suffix, found := strings.Cut(name, ".")
+		t, err := time.Parse(rotateLayout, ts)
+		if err != nil {
+			continue // Not a rotated file of the log.
+		}
+		n := 0
+		if found {
+			if n, err = strconv.Atoi(suffix); err != nil || n < 1 {
+				continue
+			}
+		}
+		rotated = append(rotated, rotatedFile{path: m, t: t, n: n})
+	}
+	slices.SortFunc(rotated, func(a, b rotatedFile) int {
+		return cmp.Or(a.t.Compare(b.t), cmp.Compare(a.n, b.n))
+	})
+	ret := make([]string, 0, len(rotated)+1)
+	for _, r := range rotated {
+		ret = append(ret, r.path)
+	}
+	if fileExists(path) {
+		ret = append(ret, path)
+	}
+	return ret, nil
+}
+
+func day(t time.Time) string { return t.Local().Format(time.DateOnly) }
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func globEscape(s string) string {
+	r := strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`, `\`, `\\`)
+	return r.Replace(s)
+}
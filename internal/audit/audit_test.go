@@ -0,0 +1,221 @@
+package audit_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/audit"
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/pkg/expr"
+)
+
+var t0 = time.Date(2025, 5, 15, 13, 43, 55, 0, time.Local)
+
+func open(t *testing.T, path string, opts audit.RotateOptions) *audit.Log {
+	t.Helper()
+	l, err := audit.Open(path, opts)
+	if err != nil {
+		t.Fatalf("Open(%q) failed: %v", path, err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func record(t *testing.T, l *audit.Log, entries ...audit.Entry) {
+	t.Helper()
+	for _, e := range entries {
+		if err := l.Record(e); err != nil {
+			t.Fatalf("Record(%s) failed: %v", e.DealID, err)
+		}
+	}
+}
+
+func search(t *testing.T, path string, q audit.Query) []string {
+	t.Helper()
+	entries, err := audit.Search(path, q)
+	if err != nil {
+		t.Fatalf("Search() failed: %v", err)
+	}
+	var ret []string
+	for _, e := range entries {
+		ret = append(ret, e.DealID)
+	}
+	return ret
+}
+
+func files(t *testing.T, path string) []string {
+	t.Helper()
+	got, err := audit.Files(path)
+	if err != nil {
+		t.Fatalf("Files() failed: %v", err)
+	}
+	for i := range got {
+		got[i] = filepath.Base(got[i])
+	}
+	return got
+}
+
+// Rotating more than once within a second adds a numeric suffix, which orders the files
+// numerically after the one without a suffix.
+func TestRotateSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l := open(t, path, audit.RotateOptions{MaxSize: 1})
+	var want []string
+	for i := range 12 {
+		record(t, l, audit.Entry{Time: t0, DealID: fmt.Sprint(i), Outcome: audit.OutcomeSuccess})
+		want = append(want, fmt.Sprint(i))
+	}
+
+	wantFiles := []string{"audit-20250515T134355.jsonl"}
+	for i := 1; i <= 10; i++ {
+		wantFiles = append(wantFiles, fmt.Sprintf("audit-20250515T134355.%d.jsonl", i))
+	}
+	wantFiles = append(wantFiles, "audit.jsonl")
+	if got := files(t, path); !slices.Equal(got, wantFiles) {
+		t.Errorf("Files() = %v, want %v", got, wantFiles)
+	}
+	if got := search(t, path, audit.Query{}); !slices.Equal(got, want) {
+		t.Errorf("Search() = %v, want %v", got, want)
+	}
+}
+
+func TestRotateDaily(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l := open(t, path, audit.RotateOptions{Daily: true})
+	day2, day3 := t0.AddDate(0, 0, 1), t0.AddDate(0, 0, 2)
+	record(t, l,
+		audit.Entry{Time: t0, DealID: "a"},
+		audit.Entry{Time: t0.Add(time.Hour), DealID: "b"},
+		audit.Entry{Time: day2, DealID: "c"},
+		audit.Entry{Time: day3, DealID: "d"},
+	)
+	want := []string{"audit-20250516T134355.jsonl", "audit-20250517T134355.jsonl", "audit.jsonl"}
+	if got := files(t, path); !slices.Equal(got, want) {
+		t.Errorf("Files() = %v, want %v", got, want)
+	}
+	if got := search(t, path, audit.Query{}); !slices.Equal(got, []string{"a", "b", "c", "d"}) {
+		t.Errorf("Search() = %v, want a, b, c, d", got)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.jsonl")
+	for _, name := range []string{
+		"audit-20250516T000000.jsonl",
+		"audit-20250515T000000.2.jsonl",
+		"audit-20250515T000000.jsonl",
+		"audit-20250515T000000.10.jsonl",
+		"audit-20250515T000000.1.jsonl",
+		"audit-notes.jsonl",              // Not rotated by the log.
+		"audit-20250515T000000.x.jsonl",  // Not rotated by the log.
+		"audit-20250515T000000.1.jsonl~", // Other extension.
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		"audit-20250515T000000.jsonl",
+		"audit-20250515T000000.1.jsonl",
+		"audit-20250515T000000.2.jsonl",
+		"audit-20250515T000000.10.jsonl",
+		"audit-20250516T000000.jsonl",
+	}
+	// The current file doesn't exist yet.
+	if got := files(t, path); !slices.Equal(got, want) {
+		t.Errorf("Files() = %v, want %v", got, want)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l := open(t, path, audit.RotateOptions{MaxSize: 300})
+	record(t, l,
+		audit.Entry{Time: t0, Account: "me", DealID: "1", Outcome: audit.OutcomeSuccess, HTTPStatus: 200, Latency: 120 * time.Millisecond},
+		audit.Entry{Time: t0.Add(time.Minute), Account: "me", DealID: "2", Outcome: audit.OutcomeError, HTTPStatus: 500},
+		audit.Entry{Time: t0.Add(2 * time.Minute), Account: "you", DealID: "3", Outcome: audit.OutcomeLimit, HTTPStatus: 400},
+		audit.Entry{Time: t0.Add(3 * time.Minute), Account: "you", DealID: "1", Outcome: audit.OutcomeSuccess, HTTPStatus: 200},
+	)
+	if got := files(t, path); len(got) < 2 {
+		t.Fatalf("Files() = %v, want the log to be rotated", got)
+	}
+	tests := []struct {
+		name string
+		q    audit.Query
+		want []string
+	}{
+		{"all", audit.Query{}, []string{"1", "2", "3", "1"}},
+		{"account", audit.Query{Account: "you"}, []string{"3", "1"}},
+		{"deal", audit.Query{DealID: "1"}, []string{"1", "1"}},
+		{"outcome", audit.Query{Outcome: audit.OutcomeError}, []string{"2"}},
+		{"since", audit.Query{Since: t0.Add(time.Minute)}, []string{"2", "3", "1"}},
+		{"until", audit.Query{Until: t0.Add(time.Minute)}, []string{"1", "2"}},
+		{"where", audit.Query{Where: expr.MustCompile(`http_status >= 400 && account == "you"`, expr.WithType(audit.Entry{}))}, []string{"3"}},
+		{"where latency", audit.Query{Where: expr.MustCompile(`latency_ms > 100`, expr.WithType(audit.Entry{}))}, []string{"1"}},
+	}
+	for _, tt := range tests {
+		if got := search(t, path, tt.q); !slices.Equal(got, tt.want) {
+			t.Errorf("Search(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSearchMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	if err := os.WriteFile(path, []byte("{\"deal_id\":\"1\"}\n\n{\"deal_id\":\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := audit.Search(path, audit.Query{}); err == nil {
+		t.Error("Search() succeeded, want an error for line 3")
+	}
+}
+
+func TestRecordClosed(t *testing.T) {
+	l := open(t, filepath.Join(t.TempDir(), "audit.jsonl"), audit.RotateOptions{})
+	l.Close()
+	if err := l.Record(audit.Entry{DealID: "1"}); err == nil {
+		t.Error("Record() after Close() succeeded, want an error")
+	}
+}
+
+func TestOutcomeOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want audit.Outcome
+	}{
+		{nil, audit.OutcomeSuccess},
+		{fmt.Errorf("clip, error %w", promotion.ErrClipLimitReached), audit.OutcomeLimit},
+		{fmt.Errorf("clip, error %w", context.Canceled), audit.OutcomeCanceled},
+		{context.DeadlineExceeded, audit.OutcomeCanceled},
+		{errors.New("boom"), audit.OutcomeError},
+	}
+	for _, tt := range tests {
+		if got := audit.OutcomeOf(tt.err); got != tt.want {
+			t.Errorf("OutcomeOf(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	s := audit.Summarize([]audit.Entry{
+		{Time: t0.Add(time.Minute), Account: "me", Action: audit.ActionClip, Outcome: audit.OutcomeSuccess, Latency: 100 * time.Millisecond},
+		{Time: t0, Account: "me", Action: audit.ActionClip, Outcome: audit.OutcomeError, Latency: 300 * time.Millisecond},
+		{Time: t0.Add(2 * time.Minute), Account: "you", Action: audit.ActionUnclip, Outcome: audit.OutcomeSuccess},
+	})
+	if s.Total != 3 || !s.First.Equal(t0) || !s.Last.Equal(t0.Add(2*time.Minute)) {
+		t.Errorf("Summarize() = %d entries from %v to %v, want 3 from %v", s.Total, s.First, s.Last, t0)
+	}
+	if s.Outcomes[audit.OutcomeSuccess] != 2 || s.Accounts["me"] != 2 || s.Actions[audit.ActionUnclip] != 1 {
+		t.Errorf("Summarize() = %+v, want 2 successes, 2 entries of me and 1 unclip", s)
+	}
+	if s.AverageLatency != 400*time.Millisecond/3 || s.MaxLatency != 300*time.Millisecond {
+		t.Errorf("Summarize() latency = %v average and %v max, want %v and 300ms", s.AverageLatency, s.MaxLatency, 400*time.Millisecond/3)
+	}
+}
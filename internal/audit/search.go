@@ -0,0 +1,131 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/pkg/expr"
+)
+
+// Query selects audit entries. Zero fields match everything.
+type Query struct {
+	Since   time.Time
+	Until   time.Time
+	Account string
+	DealID  string
+	Outcome Outcome
+	Where   *expr.Program // Compiled with expr.WithType(Entry{}).
+}
+
+func (q *Query) match(e *Entry) (bool, error) {
+	switch {
+	case !q.Since.IsZero() && e.Time.Before(q.Since),
+		!q.Until.IsZero() && e.Time.After(q.Until),
+		q.Account != "" && e.Account != q.Account,
+		q.DealID != "" && e.DealID != q.DealID,
+		q.Outcome != "" && e.Outcome != q.Outcome:
+		return false, nil
+	}
+	if q.Where == nil {
+		return true, nil
+	}
+	return q.Where.Match(e)
+}
+
+// Search returns the entries of the log at path, including rotated files, that match the query,
+// oldest first.
+func Search(path string, q Query) ([]Entry, error) {
+	files, err := Files(path)
+	if err != nil {
+		return nil, err
+	}
+	var ret []Entry
+	for _, file := range files {
+		if err := scan(file, func(e *Entry) error {
+			ok, err := q.match(e)
+			if ok {
+				ret = append(ret, *e)
+			}
+			return err
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+func scan(path string, fn func(*Entry) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("audit: open %q, error %w", path, err)
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64<<10), 1<<20)
+	for line := 1; s.Scan(); line++ {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		e := &Entry{}
+		if err := json.Unmarshal(s.Bytes(), e); err != nil {
+			return fmt.Errorf("audit: %s:%d, error %w", path, line, err)
+		}
+		e.Latency = time.Duration(e.LatencyMS * float64(time.Millisecond))
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("audit: read %q, error %w", path, err)
+	}
+	return nil
+}
+
+// Summary aggregates audit entries.
+type Summary struct {
+	Total          int
+	First, Last    time.Time
+	Outcomes       map[Outcome]int
+	Actions        map[Action]int
+	Accounts       map[string]int
+	Rules          map[string]int
+	Statuses       map[int]int
+	AverageLatency time.Duration
+	MaxLatency     time.Duration
+}
+
+// Summarize aggregates the entries.
+func Summarize(entries []Entry) *Summary {
+	s := &Summary{
+		Outcomes: map[Outcome]int{},
+		Actions:  map[Action]int{},
+		Accounts: map[string]int{},
+		Rules:    map[string]int{},
+		Statuses: map[int]int{},
+	}
+	var total time.Duration
+	for _, e := range entries {
+		if s.Total == 0 || e.Time.Before(s.First) {
+			s.First = e.Time
+		}
+		if e.Time.After(s.Last) {
+			s.Last = e.Time
+		}
+		s.Total++
+		s.Outcomes[e.Outcome]++
+		s.Actions[e.Action]++
+		s.Accounts[e.Account]++
+		s.Rules[e.Rule]++
+		s.Statuses[e.HTTPStatus]++
+		total += e.Latency
+		s.MaxLatency = max(s.MaxLatency, e.Latency)
+	}
+	if s.Total > 0 {
+		s.AverageLatency = total / time.Duration(s.Total)
+	}
+	return s
+}
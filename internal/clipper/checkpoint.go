@@ -0,0 +1,140 @@
+package clipper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/fileutil"
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+)
+
+// checkpointVersion is bumped whenever the checkpoint format changes incompatibly.
+const checkpointVersion = 1
+
+// Checkpoint is the clip plan of a run and its progress, persisted so that an interrupted run can
+// be resumed without fetching and ranking the deals again.
+type Checkpoint struct {
+	Version  int       `json:"version"`
+	Provider string    `json:"provider"`
+	Account  string    `json:"account"`
+	Store    string    `json:"store"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+	// Plan are the candidates to clip in priority order.
+	Plan []Candidate `json:"plan"`
+	// Done are the ids of the deals clipped successfully.
+	Done []string `json:"done"`
+	// Failed maps the ids of the deals that failed to clip to their error.
+	Failed map[string]string `json:"failed"`
+	// Planned are the stats of the deals left out of the plan.
+	Planned Stats `json:"planned"`
+
+	mu   sync.Mutex
+	path string
+}
+
+// NewCheckpoint returns a checkpoint of the plan that is saved to path.
+func NewCheckpoint(path, provider, account, store string, plan []Candidate, stats *Stats) *Checkpoint {
+	now := time.Now()
+	return &Checkpoint{
+		Version:  checkpointVersion,
+		Provider: provider,
+		Account:  account,
+		Store:    store,
+		Created:  now,
+		Updated:  now,
+		Plan:     plan,
+		Failed:   map[string]string{},
+		Planned:  *stats,
+		path:     path,
+	}
+}
+
+// LoadCheckpoint reads the checkpoint at path. It returns an error wrapping os.ErrNotExist when
+// there is none.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("clipper: read checkpoint %q, error %w", path, err)
+	}
+	c := &Checkpoint{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("clipper: decode checkpoint %q, error %w", path, err)
+	}
+	if c.Version != checkpointVersion {
+		return nil, fmt.Errorf("clipper: checkpoint %q has version %d, expected %d", path, c.Version, checkpointVersion)
+	}
+	if c.Failed == nil {
+		c.Failed = map[string]string{}
+	}
+	c.path = path
+	return c, nil
+}
+
+// Matches reports whether the checkpoint was created for the provider, account and store.
+func (c *Checkpoint) Matches(provider, account, store string) bool {
+	return c.Provider == provider && c.Account == account && c.Store == store
+}
+
+// Resume returns the stats of the run so far and the candidates of the plan that were neither
+// done nor failed, in order.
+func (c *Checkpoint) Resume() (*Stats, []Candidate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seen := make(map[string]bool, len(c.Done)+len(c.Failed))
+	for _, id := range c.Done {
+		seen[id] = true
+	}
+	for id := range c.Failed {
+		seen[id] = true
+	}
+	var ret []Candidate
+	for _, cand := range c.Plan {
+		if !seen[cand.Deal.ID] {
+			ret = append(ret, cand)
+		}
+	}
+	stats := c.Planned
+	stats.Clipped += len(c.Done)
+	stats.Errors += len(c.Failed)
+	return &stats, ret
+}
+
+// Record marks the attempt as done or failed. Attempts that hit the clip limit are left pending.
+func (c *Checkpoint) Record(a Attempt) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case a.Err == nil:
+		c.Done = append(c.Done, a.Deal.ID)
+	case !errors.Is(a.Err, promotion.ErrClipLimitReached):
+		c.Failed[a.Deal.ID] = a.Err.Error()
+	}
+}
+
+// Save atomically writes the checkpoint to its file.
+func (c *Checkpoint) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Updated = time.Now()
+	b, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("clipper: encode checkpoint, error %w", err)
+	}
+	if err := fileutil.WriteAtomic(c.path, b); err != nil {
+		return fmt.Errorf("clipper: save checkpoint, error %w", err)
+	}
+	return nil
+}
+
+// Remove deletes the checkpoint file once the run has completed.
+func (c *Checkpoint) Remove() error {
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("clipper: remove checkpoint %q, error %w", c.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+// Package clipper clips deals in priority order until done or the account clip limit is reached.
+package clipper
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	ihttp "github.com/csobrinho/supermarket-api/internal/http"
+	"github.com/csobrinho/supermarket-api/internal/logging"
+	"github.com/csobrinho/supermarket-api/internal/metrics"
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/pkg/expr"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+)
+
+var log = logging.For("clipper")
+
+// Options configures a clipping run.
+type Options struct {
+	Policy      *Policy
+	Filter      *expr.Program // If set, only deals matching it are clipped.
+	RateLimiter *supermarket.RateLimiter
+	// Limit is the maximum number of active clipped offers allowed by the account, including the
+	// ones already clipped. Zero means unknown, in which case the limit is detected from errors.
+	Limit int
+	// OnClip, if set, is called after every clip attempt with its outcome.
+	OnClip func(a Attempt)
+	// FinishInFlight, if set, lets the clip in flight when ctx is done complete instead of aborting
+	// its request, e.g. to shut down gracefully. The run stops right after it.
+	FinishInFlight bool
+}
+
+// Attempt is the outcome of clipping a candidate.
+type Attempt struct {
+	Candidate
+	Err        error
+	Latency    time.Duration
+	HTTPStatus int // Status code of the last response, 0 if none was received.
+}
+
+// Stats summarizes a clipping run.
+type Stats struct {
+	Already      int // Deals that were already clipped.
+	Clipped      int // Deals clipped in this run.
+	Deleted      int
+	Ignored      int // Deals that are not clippable.
+	Filtered     int // Deals that don't match the filter.
+	Errors       int
+	LimitReached bool
+	Unclipped    []Candidate // Deals left unclipped because of the clip limit, in priority order.
+	Interrupted  bool        // The run was canceled before all candidates were attempted.
+	Pending      int         // Candidates not attempted because the run was interrupted.
+}
+
+// Run clips all clippable deals in priority order. It stops gracefully when the clip limit is
+// reached, reporting the remaining deals in Stats.Unclipped, or when ctx is done.
+func Run(ctx context.Context, ps promotion.Service, cds []promotion.ClipDeal, opts Options) (*Stats, error) {
+	stats, candidates, err := Plan(cds, opts)
+	if err != nil {
+		return nil, err
+	}
+	Execute(ctx, ps, candidates, stats, opts)
+	return stats, nil
+}
+
+// Plan classifies the deals and returns the candidates to clip in priority order, along with the
+// stats of the deals that won't be attempted.
+func Plan(cds []promotion.ClipDeal, opts Options) (*Stats, []Candidate, error) {
+	stats := &Stats{}
+	var pending []promotion.ClipDeal
+	for _, cd := range cds {
+		switch {
+		case cd.IsClipped:
+			stats.Already++
+		case !cd.IsClippable:
+			stats.Ignored++
+		case cd.IsDeleted:
+			stats.Deleted++
+		default:
+			pending = append(pending, cd)
+		}
+	}
+	if opts.Filter != nil {
+		matched, err := expr.Filter(opts.Filter, pending)
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Info("filtered promotions", "matched", len(matched), "clippable", len(pending), "where", opts.Filter.String())
+		stats.Filtered = len(pending) - len(matched)
+		pending = matched
+	}
+	policy := opts.Policy
+	if policy == nil {
+		policy = NewPolicy(Preferences{})
+	}
+	candidates := policy.Rank(pending)
+	rule := "all"
+	if opts.Filter != nil {
+		rule = "where " + opts.Filter.String()
+	}
+	for i := range candidates {
+		candidates[i].Rule = rule
+	}
+	if opts.Limit > 0 {
+		budget := max(opts.Limit-stats.Already, 0)
+		if budget < len(candidates) {
+			log.Info("clip limit restricts the deals to clip", "limit", opts.Limit, "allowed", budget, "candidates", len(candidates))
+			stats.LimitReached = true
+			stats.Unclipped = candidates[budget:]
+			candidates = candidates[:budget]
+		}
+	}
+	return stats, candidates, nil
+}
+
+// Execute clips the candidates in order, updating stats. It stops when the clip limit is reached
+// or when ctx is done, in which case the candidates not attempted are counted in Stats.Pending.
+func Execute(ctx context.Context, ps promotion.Service, candidates []Candidate, stats *Stats, opts Options) {
+	if len(candidates) > 0 {
+		log.InfoContext(ctx, "clipping promotions", "count", len(candidates))
+	}
+	for i, c := range candidates {
+		if ctx.Err() != nil {
+			stats.Interrupted = true
+			stats.Pending = len(candidates) - i
+			log.WarnContext(ctx, "interrupted", "clipped", stats.Clipped, "pending", stats.Pending)
+			return
+		}
+		log.DebugContext(ctx, "clipping deal", logging.KeyDealID, c.Deal.ID, "score", c.Score, "reason", c.Reason)
+		start := time.Now()
+		cctx := ctx
+		if opts.FinishInFlight {
+			cctx = context.WithoutCancel(ctx)
+		}
+		cctx, rec := ihttp.WithStatusRecorder(cctx)
+		err := ps.ClipDeal(cctx, c.Deal)
+		if err != nil && ctx.Err() != nil && !opts.FinishInFlight {
+			// The attempt was cut short by the cancellation, it will be retried when resuming.
+			stats.Interrupted = true
+			stats.Pending = len(candidates) - i
+			log.WarnContext(ctx, "interrupted", "clipped", stats.Clipped, "pending", stats.Pending)
+			return
+		}
+		if opts.OnClip != nil {
+			opts.OnClip(Attempt{Candidate: c, Err: err, Latency: time.Since(start), HTTPStatus: rec.Status()})
+		}
+		if errors.Is(err, promotion.ErrClipLimitReached) {
+			metrics.RecordError(metrics.ErrorCategoryClipLimit)
+			log.WarnContext(ctx, "clip limit reached", "clipped", stats.Clipped, logging.KeyError, err)
+			stats.LimitReached = true
+			stats.Unclipped = slices.Concat(candidates[i:], stats.Unclipped)
+			return
+		}
+		if err != nil {
+			metrics.RecordError(metrics.ErrorCategoryClipDeal)
+			stats.Errors++
+			log.ErrorContext(ctx, "error clipping deal", logging.KeyDealID, c.Deal.ID, logging.KeyHTTPStatus, rec.Status(),
+				logging.KeyDuration, time.Since(start), logging.KeyError, err)
+			continue
+		}
+		metrics.RecordClipDealDuration(time.Since(start))
+		stats.Clipped++
+		if opts.RateLimiter != nil {
+			// A canceled wait is picked up at the start of the next iteration.
+			_ = opts.RateLimiter.WaitContext(ctx)
+		}
+	}
+}
+
+// LogUnclipped reports the deals that were left unclipped.
+func (s *Stats) LogUnclipped() {
+	if len(s.Unclipped) == 0 {
+		return
+	}
+	log.Warn("deals left unclipped because of the clip limit", "count", len(s.Unclipped))
+	for _, c := range s.Unclipped {
+		log.Warn("unclipped deal", logging.KeyDealID, c.Deal.ID, "brand", c.Deal.Brand, "description", c.Deal.Description,
+			"score", c.Score, "reason", c.Reason)
+	}
+}
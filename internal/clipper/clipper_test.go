@@ -0,0 +1,300 @@
+package clipper_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/clipper"
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/pkg/expr"
+	"github.com/csobrinho/supermarket-api/providers/fake"
+)
+
+var now = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func deal(id string, amount float64) promotion.ClipDeal {
+	return promotion.ClipDeal{Promotion: promotion.Promotion{
+		ID:          id,
+		Brand:       "Brand " + id,
+		Type:        promotion.PromotionTypeClipDeal,
+		EndDate:     now.AddDate(0, 0, 30),
+		IsClippable: true,
+		Discount:    &promotion.Discount{Amount: amount},
+	}}
+}
+
+// catalog returns deals worth d1 > d2 > ... > dn, so that their priority is their order.
+func catalog(n int) []promotion.ClipDeal {
+	ret := make([]promotion.ClipDeal, 0, n)
+	for i := range n {
+		ret = append(ret, deal(string(rune('1'+i)), float64(n-i)))
+	}
+	return ret
+}
+
+func newFake(t *testing.T, cds []promotion.ClipDeal, opts fake.Options) promotion.Service {
+	t.Helper()
+	opts.Catalog = cds
+	opts.Now = func() time.Time { return now }
+	f, err := fake.New(opts)
+	if err != nil {
+		t.Fatalf("fake.New() failed: %v", err)
+	}
+	ps, err := f.Promotion()
+	if err != nil {
+		t.Fatalf("Promotion() failed: %v", err)
+	}
+	return ps
+}
+
+func policy(prefs clipper.Preferences) *clipper.Policy {
+	p := clipper.NewPolicy(prefs)
+	p.Now = func() time.Time { return now }
+	return p
+}
+
+func ids(cs []clipper.Candidate) []string {
+	ret := make([]string, 0, len(cs))
+	for _, c := range cs {
+		ret = append(ret, c.Deal.ID)
+	}
+	return ret
+}
+
+func clipped(t *testing.T, ps promotion.Service) []string {
+	t.Helper()
+	cds, err := ps.GetClipDeals(t.Context(), promotion.PromotionSearchOptions{})
+	if err != nil {
+		t.Fatalf("GetClipDeals() failed: %v", err)
+	}
+	var ret []string
+	for _, cd := range cds {
+		if cd.IsClipped {
+			ret = append(ret, cd.ID)
+		}
+	}
+	return ret
+}
+
+func TestPlan(t *testing.T) {
+	cds := catalog(3)
+	already, ignored, deleted := deal("a", 9), deal("i", 9), deal("d", 9)
+	already.IsClipped = true
+	ignored.IsClippable = false
+	deleted.IsDeleted = true
+	cds = append(cds, already, ignored, deleted)
+
+	stats, got, err := clipper.Plan(cds, clipper.Options{Policy: policy(clipper.Preferences{})})
+	if err != nil {
+		t.Fatalf("Plan() failed: %v", err)
+	}
+	if want := []string{"1", "2", "3"}; !slices.Equal(ids(got), want) {
+		t.Errorf("Plan() = %v, want %v", ids(got), want)
+	}
+	if stats.Already != 1 || stats.Ignored != 1 || stats.Deleted != 1 || stats.LimitReached {
+		t.Errorf("Plan() stats = %+v, want 1 already, 1 ignored and 1 deleted", stats)
+	}
+	for _, c := range got {
+		if c.Rule != "all" || c.Reason == "" {
+			t.Errorf("Plan() candidate %s has rule %q and reason %q, want all and a reason", c.Deal.ID, c.Rule, c.Reason)
+		}
+	}
+}
+
+func TestPlanPolicy(t *testing.T) {
+	cds := catalog(4)
+	// Worth $4, $3, $2 and $1, the cheaper deals are boosted by the other signals.
+	cds[3].Brand = "Lucerne"                // A preferred brand adds 5.
+	cds[2].PreviouslyPurchased = true       // Purchase history adds 3.
+	cds[1].EndDate = now.Add(2 * time.Hour) // Expiring soon adds almost 2.
+
+	_, got, err := clipper.Plan(cds, clipper.Options{Policy: policy(clipper.Preferences{Brands: []string{"lucerne"}})})
+	if err != nil {
+		t.Fatalf("Plan() failed: %v", err)
+	}
+	if want := []string{"4", "3", "2", "1"}; !slices.Equal(ids(got), want) {
+		t.Errorf("Plan() = %v, want %v", ids(got), want)
+	}
+}
+
+func TestPlanFilterAndLimit(t *testing.T) {
+	cds := catalog(5)
+	cds[4].IsClipped = true
+	opts := clipper.Options{
+		Policy: policy(clipper.Preferences{}),
+		Filter: expr.MustCompile(`discount.amount >= 3`),
+		Limit:  3,
+	}
+	stats, got, err := clipper.Plan(cds, opts)
+	if err != nil {
+		t.Fatalf("Plan() failed: %v", err)
+	}
+	// The limit of 3 leaves room for 2 deals besides the one already clipped.
+	if want := []string{"1", "2"}; !slices.Equal(ids(got), want) {
+		t.Errorf("Plan() = %v, want %v", ids(got), want)
+	}
+	if want := []string{"3"}; !stats.LimitReached || !slices.Equal(ids(stats.Unclipped), want) {
+		t.Errorf("Plan() unclipped = %v (limit reached %v), want %v", ids(stats.Unclipped), stats.LimitReached, want)
+	}
+	if stats.Filtered != 1 {
+		t.Errorf("Plan() filtered = %d, want 1", stats.Filtered)
+	}
+	if got[0].Rule != "where discount.amount >= 3" {
+		t.Errorf("Plan() rule = %q, want the filter", got[0].Rule)
+	}
+}
+
+func TestRun(t *testing.T) {
+	ps := newFake(t, catalog(3), fake.Options{})
+	var attempts []string
+	opts := clipper.Options{
+		Policy: policy(clipper.Preferences{}),
+		OnClip: func(a clipper.Attempt) { attempts = append(attempts, a.Deal.ID) },
+	}
+	stats, err := clipper.Run(t.Context(), ps, catalog(3), opts)
+	if err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+	if stats.Clipped != 3 || stats.Errors != 0 || stats.Interrupted {
+		t.Errorf("Run() stats = %+v, want 3 clipped", stats)
+	}
+	if want := []string{"1", "2", "3"}; !slices.Equal(attempts, want) {
+		t.Errorf("Run() attempts = %v, want %v", attempts, want)
+	}
+}
+
+// The provider reports the clip limit, which stops the run and leaves the rest unclipped in order.
+func TestRunClipLimit(t *testing.T) {
+	cds := catalog(5)
+	ps := newFake(t, cds, fake.Options{ClipLimit: 2})
+	var errs []error
+	opts := clipper.Options{
+		Policy: policy(clipper.Preferences{}),
+		OnClip: func(a clipper.Attempt) { errs = append(errs, a.Err) },
+	}
+	stats, err := clipper.Run(t.Context(), ps, cds, opts)
+	if err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+	if stats.Clipped != 2 || !stats.LimitReached || stats.Errors != 0 {
+		t.Errorf("Run() stats = %+v, want 2 clipped and the limit reached", stats)
+	}
+	if want := []string{"3", "4", "5"}; !slices.Equal(ids(stats.Unclipped), want) {
+		t.Errorf("Run() unclipped = %v, want %v", ids(stats.Unclipped), want)
+	}
+	if len(errs) != 3 || !errors.Is(errs[2], promotion.ErrClipLimitReached) {
+		t.Errorf("Run() attempts = %v, want the third to fail with the clip limit", errs)
+	}
+	if want := []string{"1", "2"}; !slices.Equal(clipped(t, ps), want) {
+		t.Errorf("clipped deals = %v, want %v", clipped(t, ps), want)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	cds := catalog(3)
+	ps := newFake(t, cds[:2], fake.Options{}) // The provider doesn't know the third deal.
+	stats, err := clipper.Run(t.Context(), ps, cds, clipper.Options{Policy: policy(clipper.Preferences{})})
+	if err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+	if stats.Clipped != 2 || stats.Errors != 1 || stats.LimitReached {
+		t.Errorf("Run() stats = %+v, want 2 clipped and 1 error", stats)
+	}
+}
+
+func TestRunInterrupted(t *testing.T) {
+	for _, finish := range []bool{false, true} {
+		cds := catalog(3)
+		ps := newFake(t, cds, fake.Options{Latency: 200 * time.Millisecond})
+		ctx, cancel := context.WithCancel(t.Context())
+		// Canceled while the first clip is in flight.
+		timer := time.AfterFunc(50*time.Millisecond, cancel)
+		stats, err := clipper.Run(ctx, ps, cds, clipper.Options{Policy: policy(clipper.Preferences{}), FinishInFlight: finish})
+		timer.Stop()
+		cancel()
+		if err != nil {
+			t.Fatalf("Run(FinishInFlight=%v) failed: %v", finish, err)
+		}
+		want, pending := 0, 3
+		if finish {
+			want, pending = 1, 2
+		}
+		if stats.Clipped != want || !stats.Interrupted || stats.Pending != pending || stats.Errors != 0 {
+			t.Errorf("Run(FinishInFlight=%v) stats = %+v, want %d clipped and %d pending", finish, stats, want, pending)
+		}
+		if got := clipped(t, ps); len(got) != want {
+			t.Errorf("Run(FinishInFlight=%v) clipped %v, want %d deals", finish, got, want)
+		}
+	}
+}
+
+func TestCheckpointResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	cds := catalog(4)
+	ps := newFake(t, cds[1:], fake.Options{}) // The first deal fails to clip.
+
+	stats, plan, err := clipper.Plan(cds, clipper.Options{Policy: policy(clipper.Preferences{})})
+	if err != nil {
+		t.Fatalf("Plan() failed: %v", err)
+	}
+	cp := clipper.NewCheckpoint(path, "fake", "me", "1", plan, stats)
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	opts := clipper.Options{OnClip: func(a clipper.Attempt) {
+		cp.Record(a)
+		if a.Deal.ID == "2" {
+			cancel() // Interrupted after two attempts.
+		}
+	}}
+	clipper.Execute(ctx, ps, plan, stats, opts)
+	if !stats.Interrupted || stats.Pending != 2 {
+		t.Fatalf("Execute() stats = %+v, want 2 pending", stats)
+	}
+	if err := cp.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	cp, err = clipper.LoadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint() failed: %v", err)
+	}
+	if !cp.Matches("fake", "me", "1") || cp.Matches("fake", "other", "1") {
+		t.Errorf("Matches() doesn't match the provider, account and store of the checkpoint")
+	}
+	stats, rest := cp.Resume()
+	if want := []string{"3", "4"}; !slices.Equal(ids(rest), want) {
+		t.Errorf("Resume() = %v, want %v", ids(rest), want)
+	}
+	if stats.Clipped != 1 || stats.Errors != 1 {
+		t.Errorf("Resume() stats = %+v, want 1 clipped and 1 error", stats)
+	}
+	clipper.Execute(t.Context(), ps, rest, stats, clipper.Options{OnClip: cp.Record})
+	if stats.Clipped != 3 || stats.Interrupted {
+		t.Errorf("Execute() after resume stats = %+v, want 3 clipped", stats)
+	}
+	if want := []string{"2", "3", "4"}; !slices.Equal(clipped(t, ps), want) {
+		t.Errorf("clipped deals = %v, want %v", clipped(t, ps), want)
+	}
+
+	if err := cp.Remove(); err != nil {
+		t.Fatalf("Remove() failed: %v", err)
+	}
+	if _, err := clipper.LoadCheckpoint(path); err == nil {
+		t.Error("LoadCheckpoint() after Remove() succeeded, want an error")
+	}
+}
+
+// Attempts that hit the clip limit stay pending so that they are retried when resuming.
+func TestCheckpointRecordClipLimit(t *testing.T) {
+	cds := catalog(2)
+	stats, plan, _ := clipper.Plan(cds, clipper.Options{Policy: policy(clipper.Preferences{})})
+	cp := clipper.NewCheckpoint(filepath.Join(t.TempDir(), "checkpoint.json"), "fake", "me", "1", plan, stats)
+	cp.Record(clipper.Attempt{Candidate: plan[0], Err: promotion.ErrClipLimitReached})
+	if _, rest := cp.Resume(); len(rest) != 2 {
+		t.Errorf("Resume() = %v, want both deals pending", ids(rest))
+	}
+}
@@ -0,0 +1,110 @@
+package clipper
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+)
+
+// Preferences are the brands and categories the user wants clipped first.
+type Preferences struct {
+	Brands     []string
+	Categories []string
+}
+
+// Weights control how much each signal contributes to the score of a deal.
+type Weights struct {
+	Value      float64 // Per dollar of estimated savings.
+	Expiry     float64 // For deals about to expire, decays with the days left.
+	History    float64 // For deals matching the purchase history.
+	Preference float64 // Per matching preferred brand or category.
+}
+
+// DefaultWeights favor preferences and purchase history over raw value.
+var DefaultWeights = Weights{Value: 1, Expiry: 2, History: 3, Preference: 5}
+
+// Policy orders candidate deals by priority.
+type Policy struct {
+	Weights     Weights
+	Preferences Preferences
+	Now         func() time.Time
+}
+
+// Candidate is a deal with its priority score.
+type Candidate struct {
+	Deal   promotion.ClipDeal
+	Rule   string // Rule that selected the deal, "all" or the filter expression.
+	Score  float64
+	Reason string // Breakdown of the score.
+}
+
+// NewPolicy returns a policy with the default weights.
+func NewPolicy(prefs Preferences) *Policy {
+	return &Policy{Weights: DefaultWeights, Preferences: prefs, Now: time.Now}
+}
+
+// Rank scores the deals and sorts them by descending score. Ties keep their original order.
+func (p *Policy) Rank(cds []promotion.ClipDeal) []Candidate {
+	now := p.Now()
+	ret := make([]Candidate, 0, len(cds))
+	for _, cd := range cds {
+		ret = append(ret, p.score(cd, now))
+	}
+	slices.SortStableFunc(ret, func(a, b Candidate) int { return cmp.Compare(b.Score, a.Score) })
+	return ret
+}
+
+func (p *Policy) score(cd promotion.ClipDeal, now time.Time) Candidate {
+	value := EstimatedValue(cd)
+
+	expiry := 0.0
+	if !cd.EndDate.IsZero() {
+		days := max(cd.EndDate.Sub(now).Hours()/24, 0)
+		expiry = 1 / (1 + days)
+	}
+
+	history := 0.0
+	if cd.PreviouslyPurchased {
+		history = 1
+	}
+	if cd.PurchaseRank != nil && *cd.PurchaseRank > 0 {
+		history += 1 / float64(*cd.PurchaseRank)
+	}
+
+	preference := 0.0
+	if containsFold(p.Preferences.Brands, cd.Brand) {
+		preference++
+	}
+	for _, c := range cd.Categories {
+		if containsFold(p.Preferences.Categories, c) {
+			preference++
+			break
+		}
+	}
+
+	w := p.Weights
+	return Candidate{
+		Deal:   cd,
+		Score:  w.Value*value + w.Expiry*expiry + w.History*history + w.Preference*preference,
+		Reason: fmt.Sprintf("value=%.2f expiry=%.2f history=%.2f preference=%.0f", value, expiry, history, preference),
+	}
+}
+
+// EstimatedValue returns the estimated savings of a deal in dollars.
+func EstimatedValue(cd promotion.ClipDeal) float64 {
+	switch {
+	case cd.Discount != nil && cd.Discount.Amount > 0:
+		return cd.Discount.Amount
+	case cd.Discount != nil && cd.Discount.Percent > 0 && cd.Price != nil:
+		return *cd.Price * cd.Discount.Percent / 100
+	}
+	return 0
+}
+
+func containsFold(list []string, s string) bool {
+	return slices.ContainsFunc(list, func(v string) bool { return strings.EqualFold(v, s) })
+}
@@ -0,0 +1,163 @@
+package clipper
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/audit"
+	"github.com/csobrinho/supermarket-api/internal/fileutil"
+)
+
+// reportVersion is bumped whenever the report format changes incompatibly.
+const reportVersion = 1
+
+// Report is the summary of a run, written as JSON for dashboards to ingest.
+type Report struct {
+	ReportVersion int       `json:"report_version"`
+	Version       string    `json:"version"` // Of the binary.
+	GoVersion     string    `json:"go_version"`
+	Provider      string    `json:"provider"`
+	Account       string    `json:"account"`
+	Store         string    `json:"store"`
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	Success       bool      `json:"success"`
+	Resumed       bool      `json:"resumed"` // The run continued a checkpoint.
+	// Durations of the phases of the run, in milliseconds. Phases that didn't run are zero.
+	Durations Durations `json:"durations_ms"`
+	Counters  Counters  `json:"counters"`
+	// Deals are the clip attempts of the run, in order.
+	Deals []DealOutcome `json:"deals"`
+	// Unclipped are the ids of the deals left unclipped because of the clip limit.
+	Unclipped []string `json:"unclipped"`
+	// Errors are the error of the run, if it failed, and the errors of the failed attempts.
+	Errors []string `json:"errors"`
+
+	mu sync.Mutex
+}
+
+// Durations are the durations of the phases of a run, in milliseconds.
+type Durations struct {
+	Total        float64 `json:"total"`
+	TokenRefresh float64 `json:"token_refresh"`
+	Fetch        float64 `json:"fetch"`
+	Clip         float64 `json:"clip"`
+}
+
+// Counters are the stats of a run.
+type Counters struct {
+	Deals        int  `json:"deals"` // Deals fetched, zero when resuming a checkpoint.
+	Already      int  `json:"already"`
+	Clipped      int  `json:"clipped"`
+	Deleted      int  `json:"deleted"`
+	Ignored      int  `json:"ignored"`
+	Filtered     int  `json:"filtered"`
+	Errors       int  `json:"errors"`
+	Unclipped    int  `json:"unclipped"`
+	Pending      int  `json:"pending"`
+	LimitReached bool `json:"limit_reached"`
+	Interrupted  bool `json:"interrupted"`
+}
+
+// DealOutcome is a clip attempt.
+type DealOutcome struct {
+	Time        time.Time     `json:"time"`
+	ID          string        `json:"id"`
+	Brand       string        `json:"brand"`
+	Description string        `json:"description"`
+	Rule        string        `json:"rule,omitempty"`
+	Score       float64       `json:"score,omitempty"`
+	Outcome     audit.Outcome `json:"outcome"`
+	Error       string        `json:"error,omitempty"`
+	HTTPStatus  int           `json:"http_status,omitempty"`
+	LatencyMS   float64       `json:"latency_ms"`
+}
+
+// NewReport returns the report of a run starting now.
+func NewReport(version, goVersion, provider, account, store string) *Report {
+	return &Report{
+		ReportVersion: reportVersion,
+		Version:       version,
+		GoVersion:     goVersion,
+		Provider:      provider,
+		Account:       account,
+		Store:         store,
+		Start:         time.Now(),
+		Deals:         []DealOutcome{},
+		Unclipped:     []string{},
+		Errors:        []string{},
+	}
+}
+
+// Record adds a clip attempt. It is safe for concurrent use.
+func (r *Report) Record(a Attempt) {
+	o := DealOutcome{
+		Time:        time.Now(),
+		ID:          a.Deal.ID,
+		Brand:       a.Deal.Brand,
+		Description: a.Deal.Description,
+		Rule:        a.Rule,
+		Score:       a.Score,
+		Outcome:     audit.OutcomeOf(a.Err),
+		HTTPStatus:  a.HTTPStatus,
+		LatencyMS:   Milliseconds(a.Latency),
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if a.Err != nil {
+		o.Error = a.Err.Error()
+		r.Errors = append(r.Errors, o.Error)
+	}
+	r.Deals = append(r.Deals, o)
+}
+
+// SetStats sets the counters from the stats of the run.
+func (r *Report) SetStats(s *Stats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Counters.Already = s.Already
+	r.Counters.Clipped = s.Clipped
+	r.Counters.Deleted = s.Deleted
+	r.Counters.Ignored = s.Ignored
+	r.Counters.Filtered = s.Filtered
+	r.Counters.Errors = s.Errors
+	r.Counters.Unclipped = len(s.Unclipped)
+	r.Counters.Pending = s.Pending
+	r.Counters.LimitReached = s.LimitReached
+	r.Counters.Interrupted = s.Interrupted
+	r.Unclipped = r.Unclipped[:0]
+	for _, c := range s.Unclipped {
+		r.Unclipped = append(r.Unclipped, c.Deal.ID)
+	}
+}
+
+// Finish ends the report with the error of the run.
+func (r *Report) Finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.End = time.Now()
+	r.Durations.Total = Milliseconds(r.End.Sub(r.Start))
+	r.Success = err == nil
+	if err != nil {
+		r.Errors = append([]string{err.Error()}, r.Errors...)
+	}
+}
+
+// Save writes the report to the path, atomically.
+func (r *Report) Save(path string) error {
+	r.mu.Lock()
+	b, err := json.MarshalIndent(r, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("clipper: encode report, error %w", err)
+	}
+	if err := fileutil.WriteAtomic(path, append(b, '\n')); err != nil {
+		return fmt.Errorf("clipper: save report, error %w", err)
+	}
+	return nil
+}
+
+// Milliseconds returns the duration in milliseconds, with microsecond precision.
+func Milliseconds(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
@@ -0,0 +1,109 @@
+package clipper_test
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/csobrinho/supermarket-api/internal/audit"
+	"github.com/csobrinho/supermarket-api/internal/clipper"
+	"github.com/csobrinho/supermarket-api/providers/fake"
+)
+
+// saveReport saves the report and decodes it as generic JSON, to check the names of its fields.
+func saveReport(t *testing.T, rep *clipper.Report) map[string]any {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := rep.Save(path); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]any{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("decoding the report failed: %v", err)
+	}
+	return got
+}
+
+func keys(m any) []string {
+	return slices.Sorted(maps.Keys(m.(map[string]any)))
+}
+
+func TestReport(t *testing.T) {
+	cds := catalog(4)
+	// The provider doesn't know the first deal and only allows 2 clips.
+	ps := newFake(t, cds[1:], fake.Options{ClipLimit: 2})
+	rep := clipper.NewReport("v1.2.3", "go1.26", "fake", "me", "42")
+	stats, err := clipper.Run(t.Context(), ps, cds, clipper.Options{Policy: policy(clipper.Preferences{}), OnClip: rep.Record})
+	if err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+	rep.SetStats(stats)
+	rep.Durations.Fetch = 1.5
+	rep.Finish(nil)
+	got := saveReport(t, rep)
+
+	if want := []string{"account", "counters", "deals", "durations_ms", "end", "errors", "go_version", "provider", "report_version", "resumed", "start", "store", "success", "unclipped", "version"}; !slices.Equal(keys(got), want) {
+		t.Errorf("report fields = %v, want %v", keys(got), want)
+	}
+	if got["report_version"] != 1.0 || got["version"] != "v1.2.3" || got["provider"] != "fake" || got["account"] != "me" || got["store"] != "42" || got["success"] != true {
+		t.Errorf("report = %v, want the successful run of fake", got)
+	}
+	counters := got["counters"].(map[string]any)
+	wantCounters := map[string]any{
+		"deals": 0.0, "already": 0.0, "clipped": 2.0, "deleted": 0.0, "ignored": 0.0, "filtered": 0.0, "errors": 1.0,
+		"unclipped": 1.0, "pending": 0.0, "limit_reached": true, "interrupted": false,
+	}
+	if !maps.Equal(counters, wantCounters) {
+		t.Errorf("report counters = %v, want %v", counters, wantCounters)
+	}
+	durations := got["durations_ms"].(map[string]any)
+	if want := []string{"clip", "fetch", "token_refresh", "total"}; !slices.Equal(keys(durations), want) || durations["fetch"] != 1.5 || durations["total"].(float64) <= 0 {
+		t.Errorf("report durations = %v, want %v with the fetch and the total", durations, want)
+	}
+
+	deals := got["deals"].([]any)
+	wantOutcomes := []audit.Outcome{audit.OutcomeError, audit.OutcomeSuccess, audit.OutcomeSuccess, audit.OutcomeLimit}
+	if len(deals) != len(wantOutcomes) {
+		t.Fatalf("report deals = %v, want %d attempts", deals, len(wantOutcomes))
+	}
+	for i, d := range deals {
+		d := d.(map[string]any)
+		if d["id"] != cds[i].ID || d["brand"] != cds[i].Brand || d["outcome"] != string(wantOutcomes[i]) || d["rule"] != "all" {
+			t.Errorf("report deal %d = %v, want %s with outcome %s", i, d, cds[i].ID, wantOutcomes[i])
+		}
+		if _, ok := d["latency_ms"].(float64); !ok {
+			t.Errorf("report deal %d = %v, want its latency", i, d)
+		}
+		if _, ok := d["error"]; ok != (wantOutcomes[i] != audit.OutcomeSuccess) {
+			t.Errorf("report deal %d = %v, want an error only for the failed attempts", i, d)
+		}
+	}
+	if unclipped := got["unclipped"].([]any); len(unclipped) != 1 || unclipped[0] != "4" {
+		t.Errorf("report unclipped = %v, want [4]", unclipped)
+	}
+	if errs := got["errors"].([]any); len(errs) != 2 {
+		t.Errorf("report errors = %v, want the errors of the 2 failed attempts", errs)
+	}
+}
+
+func TestReportFinishError(t *testing.T) {
+	rep := clipper.NewReport("v1", "go1.26", "fake", "", "")
+	rep.Record(clipper.Attempt{Candidate: clipper.Candidate{Deal: deal("1", 1)}, Err: errors.New("boom")})
+	rep.Finish(errors.New("provider down"))
+	if rep.Success || !slices.Equal(rep.Errors, []string{"provider down", "boom"}) || rep.End.Before(rep.Start) {
+		t.Errorf("Finish() = success %v, errors %v, want the error of the run first", rep.Success, rep.Errors)
+	}
+	got := saveReport(t, rep)
+	// A run failing before it clips still has empty lists, not nulls.
+	if got["success"] != false || got["unclipped"] == nil || got["counters"].(map[string]any)["clipped"] != 0.0 {
+		t.Errorf("report = %v, want a failed run without clips", got)
+	}
+}
@@ -0,0 +1,34 @@
+// Package fileutil provides file helpers shared by the packages that persist state.
+package fileutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WriteAtomic writes the data to a temporary file next to path and renames it over path, so
+// readers never see a partial file. The file is private to the user, as it can hold secrets such
+// as refresh tokens.
+func WriteAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("fileutil: create %q, error %w", path, err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("fileutil: write %q, error %w", path, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("fileutil: sync %q, error %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("fileutil: close %q, error %w", path, err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("fileutil: rename %q, error %w", path, err)
+	}
+	return nil
+}
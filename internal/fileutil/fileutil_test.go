@@ -0,0 +1,36 @@
+package fileutil_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/csobrinho/supermarket-api/internal/fileutil"
+)
+
+func TestWriteAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	for _, data := range []string{`{"runs":1}`, `{}`} {
+		if err := fileutil.WriteAtomic(path, []byte(data)); err != nil {
+			t.Fatalf("WriteAtomic(%q) failed: %v", data, err)
+		}
+		if b, err := os.ReadFile(path); err != nil || string(b) != data {
+			t.Errorf("file = %q, %v, want %q", b, err, data)
+		}
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("file = %v, %v, want it private", fi, err)
+	}
+	// The temporary file is renamed, nothing else is left behind.
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 1 {
+		t.Errorf("directory = %v, %v, want only the file", entries, err)
+	}
+}
+
+func TestWriteAtomicError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "state.json")
+	if err := fileutil.WriteAtomic(path, []byte("{}")); err == nil {
+		t.Errorf("WriteAtomic(%q) succeeded, want an error", path)
+	}
+}
@@ -0,0 +1,330 @@
+package ihttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/fileutil"
+)
+
+var _ http.RoundTripper = (*Recorder)(nil)
+
+// ErrNoInteraction is returned in replay mode when no recorded interaction matches a request.
+var ErrNoInteraction = errors.New("ihttp: no matching interaction in cassette")
+
+// Mode selects how a Recorder handles requests.
+type Mode string
+
+const (
+	ModeLive   Mode = "live"   // Sends the requests, without recording them.
+	ModeRecord Mode = "record" // Sends the requests and records them to the cassette.
+	ModeReplay Mode = "replay" // Serves the requests from the cassette, without network access.
+)
+
+// ParseMode parses a mode, where an empty string is ModeLive.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(strings.ToLower(s)); m {
+	case "":
+		return ModeLive, nil
+	case ModeLive, ModeRecord, ModeReplay:
+		return m, nil
+	}
+	return "", fmt.Errorf("ihttp: unknown http mode %q, expected live, record or replay", s)
+}
+
+// Redacted replaces the secrets scrubbed from the cassettes.
+const Redacted = "REDACTED"
+
+var (
+	// ScrubHeaders are the headers whose values are never written to a cassette.
+	ScrubHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "x-swy_api_key", "x-api-key"}
+	// ScrubFields are the form, query and JSON fields whose values are never written to a cassette,
+	// compared case insensitively.
+	ScrubFields = []string{"access_token", "refresh_token", "id_token", "client_secret", "password", "accessToken", "refreshToken", "apiKey", "api_key"}
+)
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+	Recorded time.Time        `json:"recorded"`
+}
+
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Status     string      `json:"status"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Cassette is the file holding the recorded interactions.
+type Cassette struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Matcher reports whether a request, with its scrubbed body, matches a recorded request.
+type Matcher func(r *http.Request, body string, rec RecordedRequest) bool
+
+// MatchMethod matches the HTTP method.
+func MatchMethod(r *http.Request, _ string, rec RecordedRequest) bool { return r.Method == rec.Method }
+
+// MatchHost matches the scheme and host, which change with the port of a fake server.
+func MatchHost(r *http.Request, _ string, rec RecordedRequest) bool {
+	u, err := url.Parse(rec.URL)
+	return err == nil && u.Scheme == r.URL.Scheme && u.Host == r.URL.Host
+}
+
+// MatchPath matches the path of the URL.
+func MatchPath(r *http.Request, _ string, rec RecordedRequest) bool {
+	u, err := url.Parse(rec.URL)
+	return err == nil && u.Path == r.URL.Path
+}
+
+// MatchQuery matches the scrubbed query of the URL, regardless of the order of the parameters.
+func MatchQuery(r *http.Request, _ string, rec RecordedRequest) bool {
+	u, err := url.Parse(rec.URL)
+	return err == nil && scrubber().Query(r.URL.Query()).Encode() == u.Query().Encode()
+}
+
+// MatchBody matches the scrubbed body.
+func MatchBody(_ *http.Request, body string, rec RecordedRequest) bool { return body == rec.Body }
+
+// MatchHeader returns a matcher of the scrubbed values of the headers.
+func MatchHeader(names ...string) Matcher {
+	return func(r *http.Request, _ string, rec RecordedRequest) bool {
+		h := scrubber().Header(r.Header)
+		for _, name := range names {
+			if !slices.Equal(h.Values(name), rec.Header.Values(name)) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// DefaultMatchers match the method, path and query, so cassettes replay against any host.
+var DefaultMatchers = []Matcher{MatchMethod, MatchPath, MatchQuery}
+
+// ParseMatchers parses a comma separated list of matchers: method, host, path, query, body and
+// header:<name>. An empty string returns DefaultMatchers.
+func ParseMatchers(s string) ([]Matcher, error) {
+	if strings.TrimSpace(s) == "" {
+		return DefaultMatchers, nil
+	}
+	var ret []Matcher
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "method":
+			ret = append(ret, MatchMethod)
+		case name == "host":
+			ret = append(ret, MatchHost)
+		case name == "path":
+			ret = append(ret, MatchPath)
+		case name == "query":
+			ret = append(ret, MatchQuery)
+		case name == "body":
+			ret = append(ret, MatchBody)
+		case strings.HasPrefix(name, "header:") && len(name) > len("header:"):
+			ret = append(ret, MatchHeader(strings.TrimPrefix(name, "header:")))
+		default:
+			return nil, fmt.Errorf("ihttp: unknown matcher %q", name)
+		}
+	}
+	return ret, nil
+}
+
+// Recorder is a transport that records interactions to a cassette file, or replays them from it.
+// Secrets are scrubbed before they are written, so cassettes can be committed.
+//
+// In replay mode every recorded interaction is served once, in order, and requests match the
+// first unused interaction accepted by all the Matchers.
+type Recorder struct {
+	Mode     Mode
+	Next     http.RoundTripper // Sends the requests in live and record modes.
+	Matchers []Matcher
+
+	mu       sync.Mutex
+	path     string
+	cassette Cassette
+	used     []bool
+}
+
+// NewRecorder creates a recorder of the cassette file. Replay mode loads the cassette, record mode
+// starts a new one that Close writes to the file.
+func NewRecorder(mode Mode, path string, next http.RoundTripper) (*Recorder, error) {
+	r := &Recorder{Mode: mode, Next: next, Matchers: DefaultMatchers, path: path, cassette: Cassette{Version: 1}}
+	if mode == ModeLive {
+		return r, nil
+	}
+	if path == "" {
+		return nil, fmt.Errorf("ihttp: %s mode requires a cassette file", mode)
+	}
+	if mode == ModeReplay {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("ihttp: read cassette %q, error %w", path, err)
+		}
+		if err := json.Unmarshal(b, &r.cassette); err != nil {
+			return nil, fmt.Errorf("ihttp: decode cassette %q, error %w", path, err)
+		}
+		r.used = make([]bool, len(r.cassette.Interactions))
+	}
+	return r, nil
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch r.Mode {
+	case ModeRecord:
+		return r.record(req)
+	case ModeReplay:
+		return r.replay(req)
+	default:
+		return r.Next.RoundTrip(req)
+	}
+}
+
+func (r *Recorder) record(req *http.Request) (*http.Response, error) {
+	// The body is read from a clone, a transport must not modify the request of the caller.
+	req = req.Clone(req.Context())
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ihttp: read request body, error %w", err)
+	}
+	res, err := r.Next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := readBody(&res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ihttp: read response body, error %w", err)
+	}
+
+	it := Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    scrubber().URL(req.URL),
+			Header: scrubber().Header(req.Header),
+			Body:   scrubber().Body(req.Header.Get("Content-Type"), body),
+		},
+		Response: RecordedResponse{
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+			Header:     scrubber().Header(res.Header),
+			Body:       scrubber().Body(res.Header.Get("Content-Type"), resBody),
+		},
+		Recorded: time.Now().UTC(),
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, it)
+	return res, nil
+}
+
+func (r *Recorder) replay(req *http.Request) (*http.Response, error) {
+	body, err := readBody(&req.Clone(req.Context()).Body)
+	if err != nil {
+		return nil, fmt.Errorf("ihttp: read request body, error %w", err)
+	}
+	body = scrubber().Body(req.Header.Get("Content-Type"), body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, it := range r.cassette.Interactions {
+		if r.used[i] || !r.matches(req, body, it.Request) {
+			continue
+		}
+		r.used[i] = true
+		rec := it.Response
+		header := rec.Header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		header.Set("Content-Length", strconv.Itoa(len(rec.Body)))
+		return &http.Response{
+			Status:        rec.Status,
+			StatusCode:    rec.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(rec.Body)),
+			ContentLength: int64(len(rec.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, scrubber().URL(req.URL))
+}
+
+func (r *Recorder) matches(req *http.Request, body string, rec RecordedRequest) bool {
+	for _, m := range r.Matchers {
+		if !m(req, body, rec) {
+			return false
+		}
+	}
+	return true
+}
+
+// Unused returns the number of recorded interactions that weren't replayed.
+func (r *Recorder) Unused() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, u := range r.used {
+		if !u {
+			n++
+		}
+	}
+	return n
+}
+
+// Close writes the recorded interactions to the cassette file in record mode.
+func (r *Recorder) Close() error {
+	if r.Mode != ModeRecord {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ihttp: encode cassette, error %w", err)
+	}
+	if err := fileutil.WriteAtomic(r.path, b); err != nil {
+		return fmt.Errorf("ihttp: save cassette, error %w", err)
+	}
+	return nil
+}
+
+// readBody reads and restores a body, so it can still be sent or returned.
+func readBody(body *io.ReadCloser) (string, error) {
+	if *body == nil || *body == http.NoBody {
+		return "", nil
+	}
+	b, err := io.ReadAll(*body)
+	(*body).Close()
+	*body = io.NopCloser(bytes.NewReader(b))
+	return string(b), err
+}
+
+// scrubber redacts the ScrubHeaders and ScrubFields from the cassettes.
+func scrubber() *Redactor { return &Redactor{Headers: ScrubHeaders, Fields: ScrubFields} }
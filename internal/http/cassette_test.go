@@ -0,0 +1,292 @@
+package ihttp_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ihttp "github.com/csobrinho/supermarket-api/internal/http"
+)
+
+// Secrets sent and returned by newServer, which must never be written to a cassette.
+const (
+	accessToken  = "at-0123456789"
+	refreshToken = "rt-0123456789"
+	apiKey       = "key-0123456789"
+)
+
+// newServer starts a server with a token endpoint and a deals endpoint.
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("refresh_token") != refreshToken {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=s3cr3t")
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": accessToken, "refresh_token": refreshToken, "expires_in": 1800})
+	})
+	mux.HandleFunc("GET /deals", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+accessToken || r.Header.Get("x-swy_api_key") != apiKey {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"deals":[{"id":"`+r.URL.Query().Get("store")+`"}]}`)
+	})
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newRecorder(t *testing.T, mode ihttp.Mode, path string, next http.RoundTripper) *ihttp.Recorder {
+	t.Helper()
+	r, err := ihttp.NewRecorder(mode, path, next)
+	if err != nil {
+		t.Fatalf("NewRecorder(%s) failed: %v", mode, err)
+	}
+	return r
+}
+
+func tokenRequest(t *testing.T, base string) *http.Request {
+	t.Helper()
+	form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}}
+	req, err := http.NewRequest(http.MethodPost, base+"/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func dealsRequest(t *testing.T, base, store string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, base+"/deals?store="+store+"&api_key="+apiKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("x-swy_api_key", apiKey)
+	return req
+}
+
+// do sends the request and returns the status and body of the response.
+func do(t *testing.T, c *http.Client, req *http.Request) (int, string) {
+	t.Helper()
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", req.Method, req.URL.Path, err)
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, string(b)
+}
+
+func TestRecordReplay(t *testing.T) {
+	s := newServer(t)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	rec := newRecorder(t, ihttp.ModeRecord, path, http.DefaultTransport)
+	c := &http.Client{Transport: rec}
+	req := tokenRequest(t, s.URL)
+	reqBody := req.Body
+	if status, body := do(t, c, req); status != http.StatusOK || !strings.Contains(body, accessToken) {
+		t.Fatalf("recording the token = %d %s, want the live response", status, body)
+	}
+	if req.Body != reqBody {
+		t.Error("recording replaced the body of the request, want the request untouched")
+	}
+	for _, store := range []string{"1", "2"} {
+		if status, _ := do(t, c, dealsRequest(t, s.URL, store)); status != http.StatusOK {
+			t.Fatalf("recording the deals of store %s = %d, want 200", store, status)
+		}
+	}
+	// The cassette is only written once the recorder is closed.
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("cassette before Close() = %v, want %v", err, os.ErrNotExist)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading the cassette failed: %v", err)
+	}
+	for _, secret := range []string{accessToken, refreshToken, apiKey, "s3cr3t"} {
+		if strings.Contains(string(b), secret) {
+			t.Errorf("cassette contains the secret %q:\n%s", secret, b)
+		}
+	}
+	cassette := ihttp.Cassette{}
+	if err := json.Unmarshal(b, &cassette); err != nil {
+		t.Fatalf("decoding the cassette failed: %v", err)
+	}
+	if len(cassette.Interactions) != 3 {
+		t.Fatalf("cassette has %d interactions, want 3", len(cassette.Interactions))
+	}
+	token, deals := cassette.Interactions[0], cassette.Interactions[1]
+	if got, want := token.Request.Body, "grant_type=refresh_token&refresh_token="+ihttp.Redacted; got != want {
+		t.Errorf("token request body = %q, want %q", got, want)
+	}
+	if !strings.Contains(token.Response.Body, `"access_token":"`+ihttp.Redacted+`"`) || !strings.Contains(token.Response.Body, `"expires_in":1800`) {
+		t.Errorf("token response body = %s, want the tokens redacted and the rest kept", token.Response.Body)
+	}
+	if got := token.Response.Header.Get("Set-Cookie"); got != ihttp.Redacted {
+		t.Errorf("token response Set-Cookie = %q, want %q", got, ihttp.Redacted)
+	}
+	for _, name := range []string{"Authorization", "x-swy_api_key"} {
+		if got := deals.Request.Header.Get(name); got != ihttp.Redacted {
+			t.Errorf("deals request header %s = %q, want %q", name, got, ihttp.Redacted)
+		}
+	}
+	if !strings.Contains(deals.Request.URL, "api_key="+ihttp.Redacted) || !strings.Contains(deals.Request.URL, "store=1") {
+		t.Errorf("deals request URL = %s, want the api key redacted", deals.Request.URL)
+	}
+
+	// The replay doesn't need the server, nor the same host or query order.
+	s.Close()
+	r := newRecorder(t, ihttp.ModeReplay, path, nil)
+	c = &http.Client{Transport: r}
+	const other = "http://replay.invalid"
+	req = tokenRequest(t, other)
+	reqBody = req.Body
+	if status, body := do(t, c, req); status != http.StatusOK || !strings.Contains(body, ihttp.Redacted) {
+		t.Errorf("replaying the token = %d %s, want the recorded response", status, body)
+	}
+	if req.Body != reqBody {
+		t.Error("replaying replaced the body of the request, want the request untouched")
+	}
+	req = dealsRequest(t, other, "2")
+	req.URL.RawQuery = "api_key=other&store=2"
+	if status, body := do(t, c, req); status != http.StatusOK || body != `{"deals":[{"id":"2"}]}` {
+		t.Errorf("replaying the deals of store 2 = %d %s, want the recorded response", status, body)
+	}
+	if got := r.Unused(); got != 1 {
+		t.Errorf("Unused() = %d, want 1", got)
+	}
+	// Every interaction is replayed once.
+	if _, err := c.Do(dealsRequest(t, other, "2")); !errors.Is(err, ihttp.ErrNoInteraction) {
+		t.Errorf("replaying the deals of store 2 again = %v, want %v", err, ihttp.ErrNoInteraction)
+	}
+	if _, err := c.Do(dealsRequest(t, other, "3")); !errors.Is(err, ihttp.ErrNoInteraction) {
+		t.Errorf("replaying the deals of store 3 = %v, want %v", err, ihttp.ErrNoInteraction)
+	}
+}
+
+func TestNewRecorderErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := ihttp.NewRecorder(ihttp.ModeRecord, "", nil); err == nil {
+		t.Error("NewRecorder(record) without a cassette succeeded, want an error")
+	}
+	if _, err := ihttp.NewRecorder(ihttp.ModeReplay, filepath.Join(dir, "missing.json"), nil); err == nil {
+		t.Error("NewRecorder(replay) of a missing cassette succeeded, want an error")
+	}
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ihttp.NewRecorder(ihttp.ModeReplay, bad, nil); err == nil {
+		t.Error("NewRecorder(replay) of a malformed cassette succeeded, want an error")
+	}
+	// Live mode sends the requests without a cassette.
+	s := newServer(t)
+	c := &http.Client{Transport: newRecorder(t, ihttp.ModeLive, "", http.DefaultTransport)}
+	if status, _ := do(t, c, tokenRequest(t, s.URL)); status != http.StatusOK {
+		t.Errorf("live request = %d, want 200", status)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    ihttp.Mode
+		wantErr bool
+	}{
+		{"", ihttp.ModeLive, false},
+		{"live", ihttp.ModeLive, false},
+		{"Record", ihttp.ModeRecord, false},
+		{"REPLAY", ihttp.ModeReplay, false},
+		{"playback", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ihttp.ParseMode(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseMode(%q) = %q, %v, want %q, error %t", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestMatchers(t *testing.T) {
+	rec := ihttp.RecordedRequest{
+		Method: http.MethodPost,
+		URL:    "https://www.safeway.com/clip?storeId=1&api_key=" + ihttp.Redacted,
+		Header: http.Header{"X-Swy_banner": {"safeway"}, "Authorization": {ihttp.Redacted}},
+		Body:   `{"id":"1"}`,
+	}
+	req := func(method, u string, header http.Header) *http.Request {
+		r, err := http.NewRequest(method, u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		return r
+	}
+	same := req(http.MethodPost, "https://www.safeway.com/clip?api_key=secret&storeId=1", http.Header{"X-Swy_banner": {"safeway"}, "Authorization": {"Bearer x"}})
+	// Each matcher accepts same, and rejects the other request.
+	tests := []struct {
+		name  string
+		m     ihttp.Matcher
+		other *http.Request
+	}{
+		{"method", ihttp.MatchMethod, req(http.MethodGet, rec.URL, nil)},
+		{"host", ihttp.MatchHost, req(http.MethodPost, "http://www.safeway.com/clip", nil)},
+		{"path", ihttp.MatchPath, req(http.MethodPost, "https://www.safeway.com/unclip", nil)},
+		{"query", ihttp.MatchQuery, req(http.MethodPost, "https://www.safeway.com/clip?storeId=2&api_key=secret", nil)},
+		{"header", ihttp.MatchHeader("x-swy_banner", "Authorization"), req(http.MethodPost, rec.URL, http.Header{"X-Swy_banner": {"vons"}, "Authorization": {"Bearer x"}})},
+	}
+	for _, tt := range tests {
+		if !tt.m(same, "", rec) {
+			t.Errorf("Match %s of %s %s = false, want true", tt.name, same.Method, same.URL)
+		}
+		if tt.m(tt.other, "", rec) {
+			t.Errorf("Match %s of %s %s = true, want false", tt.name, tt.other.Method, tt.other.URL)
+		}
+	}
+	if !ihttp.MatchBody(same, `{"id":"1"}`, rec) || ihttp.MatchBody(same, `{"id":"2"}`, rec) {
+		t.Error("MatchBody() doesn't compare the bodies")
+	}
+}
+
+func TestParseMatchers(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{"", len(ihttp.DefaultMatchers), false},
+		{"method,host,path,query,body", 5, false},
+		{" method , header:x-swy_banner ", 2, false},
+		{"header:", 0, true},
+		{"method,url", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ihttp.ParseMatchers(tt.in)
+		if len(got) != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseMatchers(%q) = %d matchers, %v, want %d, error %t", tt.in, len(got), err, tt.want, tt.wantErr)
+		}
+	}
+}
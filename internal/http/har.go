@@ -0,0 +1,332 @@
+package ihttp
+
+import (
+	"cmp"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/csobrinho/supermarket-api/internal/fileutil"
+	"github.com/csobrinho/supermarket-api/internal/logging"
+)
+
+var _ http.RoundTripper = (*HARWriter)(nil)
+
+// HAR is an HTTP Archive 1.2 file, see http://www.softwareishard.com/blog/har-12-spec/. Only the
+// fields written by HARWriter are modeled.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"` // Total, in milliseconds.
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+	Error           string      `json:"_error,omitempty"` // Why there is no response.
+}
+
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARTimings are the phases of a request in milliseconds, -1 when they don't apply, e.g. dns and
+// connect when a connection is reused.
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"` // Includes ssl.
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// HARWriter is a transport that writes every request and response, with their timings, to a HAR
+// file that can be opened in the browser devtools or diffed against other captures. Secrets are
+// redacted, and the file is overwritten after every request so it survives crashes.
+type HARWriter struct {
+	Next     http.RoundTripper
+	Redactor *Redactor // If nil, the DefaultRedactor.
+
+	mu   sync.Mutex
+	path string
+	har  HAR
+}
+
+// NewHARWriter creates the HAR file, overwriting it, and returns a transport writing to it. The
+// creator and version describe the application in the file.
+func NewHARWriter(path, creator, version string, next http.RoundTripper) (*HARWriter, error) {
+	if path == "" {
+		return nil, fmt.Errorf("ihttp: HAR writer requires a file")
+	}
+	w := &HARWriter{
+		Next: next,
+		path: path,
+		har:  HAR{Log: HARLog{Version: "1.2", Creator: HARCreator{Name: creator, Version: version}, Entries: []HAREntry{}}},
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.save(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (w *HARWriter) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := w.Redactor
+	if r == nil {
+		r = DefaultRedactor()
+	}
+	req = req.Clone(req.Context()) // Keeps the body of the caller's request unread.
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ihttp: read request body, error %w", err)
+	}
+	t := &harTrace{start: time.Now()}
+	res, err := w.Next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), t.clientTrace())))
+	var resBody string
+	if err == nil {
+		t.set(func() { t.firstByte = cmp.Or(t.firstByte, time.Now()) })
+		if resBody, err = readBody(&res.Body); err != nil {
+			err = fmt.Errorf("ihttp: read response body, error %w", err)
+			res = nil
+		}
+	}
+	t.end = time.Now()
+
+	e := HAREntry{
+		StartedDateTime: t.start,
+		Time:            milliseconds(t.end.Sub(t.start)),
+		Request: HARRequest{
+			Method:      req.Method,
+			URL:         r.URL(req.URL),
+			HTTPVersion: req.Proto,
+			Cookies:     []HARNameValue{},
+			Headers:     harHeaders(r.Header(req.Header)),
+			QueryString: harValues(r.Query(req.URL.Query())),
+			HeadersSize: -1,
+			BodySize:    len(body),
+		},
+		Timings:         t.timings(),
+		ServerIPAddress: t.serverIP,
+	}
+	if body != "" {
+		text, comment := harBody(r, req.Header, body)
+		e.Request.PostData = &HARPostData{MimeType: req.Header.Get("Content-Type"), Text: text, Comment: comment}
+	}
+	if res != nil {
+		e.Request.HTTPVersion = res.Proto
+		text, comment := harBody(r, res.Header, resBody)
+		e.Response = HARResponse{
+			Status:      res.StatusCode,
+			StatusText:  strings.TrimSpace(strings.TrimPrefix(res.Status, fmt.Sprint(res.StatusCode))),
+			HTTPVersion: res.Proto,
+			Cookies:     []HARNameValue{},
+			Headers:     harHeaders(r.Header(res.Header)),
+			Content:     HARContent{Size: len(resBody), MimeType: res.Header.Get("Content-Type"), Text: text, Comment: comment},
+			RedirectURL: res.Header.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    len(resBody),
+		}
+	} else {
+		e.Response = HARResponse{HTTPVersion: req.Proto, Cookies: []HARNameValue{}, Headers: []HARNameValue{}, HeadersSize: -1, BodySize: -1}
+		e.Error = err.Error()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.har.Log.Entries = append(w.har.Log.Entries, e)
+	if serr := w.save(); serr != nil {
+		log.WarnContext(req.Context(), "failed to save HAR", "path", w.path, logging.KeyError, serr)
+	}
+	return res, err
+}
+
+// save atomically writes the HAR file. It must be called with the lock held.
+func (w *HARWriter) save() error {
+	b, err := json.MarshalIndent(w.har, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ihttp: encode HAR, error %w", err)
+	}
+	if err := fileutil.WriteAtomic(w.path, b); err != nil {
+		return fmt.Errorf("ihttp: save HAR, error %w", err)
+	}
+	return nil
+}
+
+// harBody returns the redacted text of a body, or a comment explaining why it was left out.
+// Encoded and binary bodies can't be redacted.
+func harBody(r *Redactor, h http.Header, body string) (text, comment string) {
+	switch {
+	case body == "":
+		return "", ""
+	case h.Get("Content-Encoding") != "":
+		return "", fmt.Sprintf("%s encoded body left out, it can't be redacted", h.Get("Content-Encoding"))
+	case !utf8.ValidString(body):
+		return "", "binary body left out, it can't be redacted"
+	}
+	return r.Body(h.Get("Content-Type"), body), ""
+}
+
+func harHeaders(h http.Header) []HARNameValue {
+	ret := []HARNameValue{}
+	for _, name := range sortedKeys(h) {
+		for _, v := range h[name] {
+			ret = append(ret, HARNameValue{Name: name, Value: v})
+		}
+	}
+	return ret
+}
+
+func harValues(q map[string][]string) []HARNameValue {
+	ret := []HARNameValue{}
+	for _, name := range sortedKeys(q) {
+		for _, v := range q[name] {
+			ret = append(ret, HARNameValue{Name: name, Value: v})
+		}
+	}
+	return ret
+}
+
+func sortedKeys[M ~map[string][]string](m M) []string { return slices.Sorted(maps.Keys(m)) }
+
+// harTrace records the phases of a request.
+type harTrace struct {
+	mu                                     sync.Mutex
+	start, end                             time.Time
+	dnsStart, dnsDone, connStart, connDone time.Time
+	tlsStart, tlsDone, gotConn, wrote      time.Time
+	firstByte                              time.Time
+	serverIP                               string
+}
+
+func (t *harTrace) set(f func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f()
+}
+
+func (t *harTrace) clientTrace() *httptrace.ClientTrace {
+	now := time.Now
+	return &httptrace.ClientTrace{
+		DNSStart:     func(httptrace.DNSStartInfo) { t.set(func() { t.dnsStart = now() }) },
+		DNSDone:      func(httptrace.DNSDoneInfo) { t.set(func() { t.dnsDone = now() }) },
+		ConnectStart: func(string, string) { t.set(func() { t.connStart = cmp.Or(t.connStart, now()) }) },
+		ConnectDone:  func(string, string, error) { t.set(func() { t.connDone = now() }) },
+		TLSHandshakeStart: func() {
+			t.set(func() { t.tlsStart = now() })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) { t.set(func() { t.tlsDone = now() }) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.set(func() {
+				t.gotConn = now()
+				if info.Conn != nil {
+					t.serverIP, _, _ = net.SplitHostPort(info.Conn.RemoteAddr().String())
+				}
+			})
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.set(func() { t.wrote = now() }) },
+		GotFirstResponseByte: func() { t.set(func() { t.firstByte = now() }) },
+	}
+}
+
+// timings converts the trace to HAR timings. Phases that weren't traced, e.g. when Next doesn't
+// use the network, are folded into wait.
+func (t *harTrace) timings() HARTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := func(from, to time.Time) float64 {
+		if from.IsZero() || to.IsZero() || to.Before(from) {
+			return -1
+		}
+		return milliseconds(to.Sub(from))
+	}
+	ret := HARTimings{
+		DNS:     span(t.dnsStart, t.dnsDone),
+		Connect: span(t.connStart, cmp.Or(t.tlsDone, t.connDone)),
+		SSL:     span(t.tlsStart, t.tlsDone),
+		Blocked: -1,
+		Send:    0,
+		Receive: max(span(t.firstByte, t.end), 0),
+	}
+	sent := t.start
+	if !t.gotConn.IsZero() {
+		// The time to get a connection not spent resolving or connecting was spent waiting for one.
+		if b := t.gotConn.Sub(t.start) - dur(ret.DNS) - dur(ret.Connect); b > 0 {
+			ret.Blocked = milliseconds(b)
+		}
+		sent = cmp.Or(t.wrote, t.gotConn)
+		ret.Send = max(span(t.gotConn, sent), 0)
+	}
+	ret.Wait = max(span(sent, t.firstByte), 0)
+	return ret
+}
+
+// dur converts a HAR timing back to a duration, zero if it doesn't apply.
+func dur(ms float64) time.Duration { return time.Duration(max(ms, 0) * float64(time.Millisecond)) }
+
+// milliseconds returns the duration in milliseconds, with microsecond precision.
+func milliseconds(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
@@ -0,0 +1,129 @@
+package ihttp_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ihttp "github.com/csobrinho/supermarket-api/internal/http"
+)
+
+func readHAR(t *testing.T, path string) ihttp.HAR {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading the HAR failed: %v", err)
+	}
+	har := ihttp.HAR{}
+	if err := json.Unmarshal(b, &har); err != nil {
+		t.Fatalf("decoding the HAR failed: %v", err)
+	}
+	return har
+}
+
+func TestHARWriter(t *testing.T) {
+	s := newServer(t)
+	path := filepath.Join(t.TempDir(), "session.har")
+	w, err := ihttp.NewHARWriter(path, "supermarket", "v1.2.3", http.DefaultTransport)
+	if err != nil {
+		t.Fatalf("NewHARWriter() failed: %v", err)
+	}
+	// The file is written before the first request.
+	if har := readHAR(t, path); har.Log.Version != "1.2" || har.Log.Creator.Name != "supermarket" || har.Log.Creator.Version != "v1.2.3" || len(har.Log.Entries) != 0 {
+		t.Errorf("NewHARWriter() wrote %+v, want an empty 1.2 log of supermarket v1.2.3", har.Log)
+	}
+
+	c := &http.Client{Transport: w}
+	req := tokenRequest(t, s.URL)
+	reqBody := req.Body
+	do(t, c, req)
+	if req.Body != reqBody {
+		t.Error("HARWriter replaced the body of the request, want the request untouched")
+	}
+	do(t, c, dealsRequest(t, s.URL, "1"))
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{accessToken, refreshToken, apiKey, "s3cr3t"} {
+		if strings.Contains(string(b), secret) {
+			t.Errorf("HAR contains the secret %q:\n%s", secret, b)
+		}
+	}
+
+	har := readHAR(t, path)
+	if len(har.Log.Entries) != 2 {
+		t.Fatalf("HAR has %d entries, want 2", len(har.Log.Entries))
+	}
+	token, deals := har.Log.Entries[0], har.Log.Entries[1]
+	if token.Request.Method != http.MethodPost || token.Request.URL != s.URL+"/token" || token.Request.PostData == nil {
+		t.Fatalf("token entry request = %+v, want POST %s/token with a body", token.Request, s.URL)
+	}
+	if got, want := token.Request.PostData.Text, "grant_type=refresh_token&refresh_token="+ihttp.Redacted; got != want {
+		t.Errorf("token entry post data = %q, want %q", got, want)
+	}
+	if r := token.Response; r.Status != http.StatusOK || r.StatusText != "OK" || r.Content.MimeType != "application/json" || !strings.Contains(r.Content.Text, `"refresh_token":"`+ihttp.Redacted+`"`) {
+		t.Errorf("token entry response = %+v, want 200 OK with the tokens redacted", r)
+	}
+	if token.ServerIPAddress != "127.0.0.1" || token.Time <= 0 || token.Timings.Wait < 0 || token.Timings.Receive < 0 {
+		t.Errorf("token entry = server %q, time %v, timings %+v, want the timings of 127.0.0.1", token.ServerIPAddress, token.Time, token.Timings)
+	}
+
+	headers := map[string]string{}
+	for _, h := range deals.Request.Headers {
+		headers[h.Name] = h.Value
+	}
+	if headers["Authorization"] != ihttp.Redacted || headers["X-Swy_api_key"] != ihttp.Redacted {
+		t.Errorf("deals entry headers = %v, want the secrets redacted", deals.Request.Headers)
+	}
+	query := map[string]string{}
+	for _, q := range deals.Request.QueryString {
+		query[q.Name] = q.Value
+	}
+	if query["store"] != "1" || query["api_key"] != ihttp.Redacted || strings.Contains(deals.Request.URL, apiKey) {
+		t.Errorf("deals entry = %s with query %v, want the api key redacted", deals.Request.URL, deals.Request.QueryString)
+	}
+	if deals.Request.PostData != nil || deals.Response.Content.Text != `{"deals":[{"id":"1"}]}` {
+		t.Errorf("deals entry = post data %v, content %q, want only the response", deals.Request.PostData, deals.Response.Content.Text)
+	}
+}
+
+func TestHARWriterErrors(t *testing.T) {
+	if _, err := ihttp.NewHARWriter("", "supermarket", "v1", nil); err == nil {
+		t.Error("NewHARWriter() without a file succeeded, want an error")
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = io.WriteString(w, "\x1f\x8b not really gzip")
+	}))
+	path := filepath.Join(t.TempDir(), "session.har")
+	w, err := ihttp.NewHARWriter(path, "supermarket", "v1", http.DefaultTransport)
+	if err != nil {
+		t.Fatalf("NewHARWriter() failed: %v", err)
+	}
+	c := &http.Client{Transport: w}
+	req, _ := http.NewRequest(http.MethodGet, s.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip") // Keep the body encoded.
+	do(t, c, req)
+	s.Close()
+	if _, err := c.Get(s.URL); err == nil {
+		t.Fatal("Get() of a closed server succeeded")
+	}
+
+	har := readHAR(t, path)
+	if len(har.Log.Entries) != 2 {
+		t.Fatalf("HAR has %d entries, want 2", len(har.Log.Entries))
+	}
+	if c := har.Log.Entries[0].Response.Content; c.Text != "" || !strings.Contains(c.Comment, "gzip encoded body left out") {
+		t.Errorf("encoded entry content = %+v, want the body left out", c)
+	}
+	if e := har.Log.Entries[1]; e.Error == "" || e.Response.Status != 0 || e.Response.BodySize != -1 {
+		t.Errorf("failed entry = error %q, response %+v, want the error without a response", e.Error, e.Response)
+	}
+}
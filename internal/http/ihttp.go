@@ -2,13 +2,16 @@ package ihttp
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httputil"
+	"strings"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
-	"github.com/google/logger"
+	"github.com/csobrinho/supermarket-api/internal/logging"
 	"golang.org/x/net/http2"
 	"golang.org/x/oauth2"
 )
@@ -16,6 +19,8 @@ import (
 var _ http.RoundTripper = (*CustomTransport)(nil)
 var _ http.RoundTripper = (*LoggingTransport)(nil)
 
+var log = logging.For("http")
+
 // Custom transport to add headers to all requests.
 type CustomTransport struct {
 	Next         http.RoundTripper
@@ -46,40 +51,135 @@ func (t *CustomTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 		req.Header.Set(key, value)
 	}
 	// Use the base transport to perform the actual request.
-	return t.Next.RoundTrip(req)
+	res, err := t.Next.RoundTrip(req)
+	if rec, ok := req.Context().Value(statusRecorderKey{}).(*StatusRecorder); ok && res != nil {
+		rec.status.Store(int32(res.StatusCode))
+	}
+	return res, err
+}
+
+type statusRecorderKey struct{}
+
+// StatusRecorder captures the HTTP status code of the last response of requests made with its context.
+type StatusRecorder struct {
+	status atomic.Int32
+}
+
+// WithStatusRecorder returns a context that records the status code of responses handled by
+// CustomTransport, so callers can learn it even when the API only returns an error.
+func WithStatusRecorder(ctx context.Context) (context.Context, *StatusRecorder) {
+	rec := &StatusRecorder{}
+	return context.WithValue(ctx, statusRecorderKey{}, rec), rec
 }
 
-// Logs all requests.
+// Status returns the last recorded status code, or 0 if no response was received.
+func (r *StatusRecorder) Status() int { return int(r.status.Load()) }
+
+var (
+	// LogRedactor masks the secrets of the requests and responses logged by the clients of New.
+	LogRedactor = DefaultRedactor()
+	// LogBodyLimit is the maximum number of bytes of the bodies logged by the clients of New.
+	LogBodyLimit = 4096
+)
+
+// LoggingTransport logs every request and response, with their headers and bodies, at debug level.
+// Secrets are redacted before they are logged.
 type LoggingTransport struct {
-	Next http.RoundTripper
-	i    atomic.Int32
+	Next     http.RoundTripper
+	Redactor *Redactor // If nil, the DefaultRedactor.
+	// MaxBodySize is the maximum number of bytes of a body logged, after redaction. Bodies are not
+	// logged if it is zero.
+	MaxBodySize int
+	i           atomic.Int32
 }
 
 func (t *LoggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
 	i := t.i.Add(1) - 1
-	b, err := httputil.DumpRequestOut(req, true)
+	r := t.Redactor
+	if r == nil {
+		r = DefaultRedactor()
+	}
+	// The body is read from a clone, to leave the caller's request untouched.
+	req = req.Clone(ctx)
+	body, err := readBody(&req.Body)
 	if err != nil {
-		logger.Warningf("http[%d]: request error, %v", i, err)
+		log.WarnContext(ctx, "request error", "request", i, logging.KeyError, err)
 		return nil, err
 	}
-	logger.Infof("http[%d]: request\n%s", i, string(prefix(b, "  ")))
+	// Dump a redacted copy, without the user info of the URL, which would be dumped as a header.
+	out := req.Clone(ctx)
+	out.Header = r.Header(req.Header)
+	u := *req.URL
+	u.User = nil
+	if u.RawQuery != "" {
+		u.RawQuery = r.Query(u.Query()).Encode()
+	}
+	out.URL = &u
+	b, err := httputil.DumpRequestOut(out, false)
+	if err != nil {
+		log.WarnContext(ctx, "request error", "request", i, logging.KeyError, err)
+		return nil, err
+	}
+	log.DebugContext(ctx, "request", "request", i, "method", req.Method, "url", u.String(), "dump", string(prefix(b, "  ")),
+		"body", t.body(r, req.Header, body))
 
+	start := time.Now()
 	res, err := t.Next.RoundTrip(req)
 	if err != nil {
-		logger.Warningf("http[%d]: response error, %v", i, err)
+		log.WarnContext(ctx, "response error", "request", i, logging.KeyDuration, time.Since(start), logging.KeyError, err)
 		return res, err
 	}
+	attrs := []any{"request", i, logging.KeyHTTPStatus, res.StatusCode, logging.KeyDuration, time.Since(start)}
 
+	if t.MaxBodySize > 0 {
+		// The whole body is read, a truncated one couldn't be redacted.
+		if body, err = readBody(&res.Body); err != nil {
+			log.WarnContext(ctx, "response error", append(attrs, logging.KeyError, err)...)
+			return nil, err
+		}
+	}
+	h := res.Header
+	res.Header = r.Header(h)
 	b, err = httputil.DumpResponse(res, false)
+	res.Header = h
 	if err != nil {
-		logger.Warningf("http[%d]: response error, %v", i, err)
+		log.WarnContext(ctx, "response error", append(attrs, logging.KeyError, err)...)
 		return res, err
 	}
-	logger.Infof("http[%d]: response\n%s", i, string(prefix(b, "  ")))
+	log.DebugContext(ctx, "response", append(attrs, "dump", string(prefix(b, "  ")), "body", t.body(r, res.Header, body))...)
 
 	return res, err
 }
 
+// body returns the body to log, redacted and truncated to MaxBodySize.
+func (t *LoggingTransport) body(r *Redactor, h http.Header, body string) string {
+	switch {
+	case t.MaxBodySize <= 0 || body == "":
+		return ""
+	case h.Get("Content-Encoding") != "":
+		return fmt.Sprintf("[%d bytes, %s encoded]", len(body), h.Get("Content-Encoding"))
+	case !utf8.ValidString(body):
+		return fmt.Sprintf("[%d bytes, binary]", len(body))
+	}
+	s := r.Body(h.Get("Content-Type"), body)
+	if len(s) > t.MaxBodySize {
+		s = fmt.Sprintf("%s... [%d bytes truncated]", strings.ToValidUTF8(s[:t.MaxBodySize], ""), len(s)-t.MaxBodySize)
+	}
+	return s
+}
+
+// NewTransport returns a clone of the default transport, optionally configured for HTTP/2.
+func NewTransport(h2 bool) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if h2 {
+		if err := http2.ConfigureTransport(t); err != nil {
+			return nil, fmt.Errorf("ihttp: failed to configure HTTP/2 transport: %w", err)
+		}
+	}
+	return t, nil
+}
+
 func prefix(data []byte, prefix string) []byte {
 	data = bytes.TrimRight(data, "\r\n")
 	if len(data) == 0 {
@@ -91,17 +191,20 @@ func prefix(data []byte, prefix string) []byte {
 	return append([]byte(prefix), ndata...)
 }
 
-func New(h2 bool, log bool, userAgent string, extraHeaders map[string]string, timeout time.Duration, ts oauth2.TokenSource) (*http.Client, error) {
-	t := http.DefaultTransport.(*http.Transport).Clone()
-	if h2 {
-		if err := http2.ConfigureTransport(t); err != nil {
-			return nil, fmt.Errorf("ihttp: failed to configure HTTP/2 transport: %w", err)
+// New creates a client that adds the user agent, extra headers and token to every request. If base
+// is nil, requests are sent with a clone of the default transport, otherwise with base, e.g. a
+// Recorder.
+func New(h2 bool, log bool, userAgent string, extraHeaders map[string]string, timeout time.Duration, ts oauth2.TokenSource, base http.RoundTripper) (*http.Client, error) {
+	rt := base
+	if rt == nil {
+		t, err := NewTransport(h2)
+		if err != nil {
+			return nil, err
 		}
+		rt = t
 	}
-	var rt http.RoundTripper
-	rt = t
 	if log {
-		rt = &LoggingTransport{Next: t}
+		rt = &LoggingTransport{Next: rt, Redactor: LogRedactor, MaxBodySize: LogBodyLimit}
 	}
 	rt = &CustomTransport{
 		Next:         rt,
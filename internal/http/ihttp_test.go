@@ -0,0 +1,127 @@
+package ihttp_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	ihttp "github.com/csobrinho/supermarket-api/internal/http"
+	"github.com/csobrinho/supermarket-api/internal/logging"
+)
+
+// captureLogs sends the debug logs of the http subsystem to the returned buffer until the test ends.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	level := logging.Level("http")
+	logging.SetHandler(logging.NewHandler(logging.FormatJSON, buf))
+	logging.SetLevel("http", slog.LevelDebug)
+	t.Cleanup(func() {
+		logging.SetHandler(nil)
+		logging.SetLevel("http", level)
+	})
+	return buf
+}
+
+// logged returns the body attribute of the logged messages, in order.
+func logged(t *testing.T, buf *bytes.Buffer, msg string) []string {
+	t.Helper()
+	var ret []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec struct {
+			Msg  string `json:"msg"`
+			Body string `json:"body"`
+		}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("decoding the log %q failed: %v", line, err)
+		}
+		if rec.Msg == msg {
+			ret = append(ret, rec.Body)
+		}
+	}
+	return ret
+}
+
+func TestLoggingTransport(t *testing.T) {
+	buf := captureLogs(t)
+	s := newServer(t)
+	c := &http.Client{Transport: &ihttp.LoggingTransport{Next: http.DefaultTransport, MaxBodySize: 4096}}
+	req := tokenRequest(t, s.URL)
+	reqBody := req.Body
+	if status, body := do(t, c, req); status != http.StatusOK || !strings.Contains(body, accessToken) {
+		t.Fatalf("token = %d %s, want the response of the server", status, body)
+	}
+	if req.Body != reqBody {
+		t.Error("LoggingTransport replaced the body of the request, want the request untouched")
+	}
+	if status, body := do(t, c, dealsRequest(t, s.URL, "1")); status != http.StatusOK || body != `{"deals":[{"id":"1"}]}` {
+		t.Fatalf("deals = %d %s, want the response of the server", status, body)
+	}
+
+	for _, secret := range []string{accessToken, refreshToken, apiKey, "s3cr3t"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Errorf("debug logs contain the secret %q:\n%s", secret, buf)
+		}
+	}
+	if got, want := logged(t, buf, "request"), []string{"grant_type=refresh_token&refresh_token=REDACTED", ""}; !slices.Equal(got, want) {
+		t.Errorf("logged request bodies = %q, want %q", got, want)
+	}
+	res := logged(t, buf, "response")
+	if len(res) != 2 || !strings.Contains(res[0], `"access_token":"REDACTED"`) || res[1] != `{"deals":[{"id":"1"}]}` {
+		t.Errorf("logged response bodies = %q, want the tokens redacted and the deals", res)
+	}
+	if !strings.Contains(buf.String(), "Authorization: REDACTED") {
+		t.Errorf("debug logs = %s, want the redacted authorization header dumped", buf)
+	}
+}
+
+func TestLoggingTransportBodies(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/large":
+			_, _ = w.Write([]byte(strings.Repeat("é", 20)))
+		case "/gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write([]byte("not really gzip"))
+		case "/binary":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = w.Write([]byte{0xff, 0xfe, 0x00})
+		}
+	}))
+	t.Cleanup(s.Close)
+	tests := []struct {
+		path    string
+		maxSize int
+		want    string
+	}{
+		// The truncated body is cut at the last full rune.
+		{"/large", 5, "éé... [35 bytes truncated]"},
+		{"/large", 40, strings.Repeat("é", 20)},
+		{"/gzip", 40, "[15 bytes, gzip encoded]"},
+		{"/binary", 40, "[3 bytes, binary]"},
+		// Bodies aren't logged without a maximum size.
+		{"/large", 0, ""},
+	}
+	for _, tt := range tests {
+		buf := captureLogs(t)
+		c := &http.Client{Transport: &ihttp.LoggingTransport{Next: http.DefaultTransport, MaxBodySize: tt.maxSize}}
+		req, err := http.NewRequest(http.MethodGet, s.URL+tt.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Asking for gzip keeps the transport from decoding the response.
+		req.Header.Set("Accept-Encoding", "gzip")
+		status, body := do(t, c, req)
+		if status != http.StatusOK || body == "" {
+			t.Errorf("GET %s = %d %q, want the whole body", tt.path, status, body)
+		}
+		if got := logged(t, buf, "response"); len(got) != 1 || got[0] != tt.want {
+			t.Errorf("logged body of %s with MaxBodySize %d = %q, want %q", tt.path, tt.maxSize, got, tt.want)
+		}
+	}
+}
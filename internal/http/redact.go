@@ -0,0 +1,148 @@
+package ihttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Redactor masks secrets with Redacted: the values of headers, of form, query and JSON fields, and
+// of JSON paths.
+type Redactor struct {
+	Headers []string // Header names.
+	// Fields are the names of the form and query parameters and of the JSON fields at any depth,
+	// whatever the type of their values, compared case insensitively.
+	Fields []string
+	// Paths are JSON paths of values of any type, dot separated from the root, where * matches any
+	// field or index, e.g. "data.token" or "cards.*.number".
+	Paths []string
+}
+
+// DefaultRedactor returns the redactor of the logs: the ScrubHeaders and ScrubFields of the
+// cassettes, and the loyalty card numbers.
+func DefaultRedactor() *Redactor {
+	return &Redactor{
+		Headers: slices.Clone(ScrubHeaders),
+		Fields:  slices.Concat(ScrubFields, []string{"cardNumber", "extracareCardNumber", "loyaltyCard"}),
+	}
+}
+
+// ParseRedactor returns the DefaultRedactor extended with a comma separated list of header:<name>,
+// field:<name> and path:<json path>.
+func ParseRedactor(s string) (*Redactor, error) {
+	r := DefaultRedactor()
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		kind, name, _ := strings.Cut(v, ":")
+		if name == "" {
+			return nil, fmt.Errorf("ihttp: invalid redaction %q, expected header:<name>, field:<name> or path:<json path>", v)
+		}
+		switch kind {
+		case "header":
+			r.Headers = append(r.Headers, name)
+		case "field":
+			r.Fields = append(r.Fields, name)
+		case "path":
+			r.Paths = append(r.Paths, strings.TrimPrefix(name, "$."))
+		default:
+			return nil, fmt.Errorf("ihttp: invalid redaction %q, expected header:<name>, field:<name> or path:<json path>", v)
+		}
+	}
+	return r, nil
+}
+
+// Header returns a copy of the header with the values of the Headers redacted.
+func (r *Redactor) Header(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range r.Headers {
+		if len(h.Values(name)) > 0 {
+			h.Set(name, Redacted)
+		}
+	}
+	return h
+}
+
+// Query redacts the Fields of the query, in place, and returns it.
+func (r *Redactor) Query(q url.Values) url.Values {
+	for k := range q {
+		if r.isField(k) {
+			q.Set(k, Redacted)
+		}
+	}
+	return q
+}
+
+// URL returns the URL without its user info and with the Fields of its query redacted.
+func (r *Redactor) URL(u *url.URL) string {
+	c := *u
+	c.User = nil
+	if c.RawQuery != "" {
+		c.RawQuery = r.Query(c.Query()).Encode()
+	}
+	return c.String()
+}
+
+// Body redacts the Fields of form bodies and the Fields and Paths of JSON bodies. Other bodies are
+// returned as is.
+func (r *Redactor) Body(contentType, body string) string {
+	if body == "" {
+		return body
+	}
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if q, err := url.ParseQuery(body); err == nil {
+			return r.Query(q).Encode()
+		}
+		return body
+	}
+	var v any
+	d := json.NewDecoder(strings.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return body
+	}
+	b, err := json.Marshal(r.json(v, nil))
+	if err != nil {
+		return body
+	}
+	return string(b)
+}
+
+func (r *Redactor) json(v any, path []string) any {
+	if r.isPath(path) {
+		return Redacted
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if r.isField(k) {
+				v[k] = Redacted
+				continue
+			}
+			v[k] = r.json(e, append(path, k))
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = r.json(e, append(path, strconv.Itoa(i)))
+		}
+	}
+	return v
+}
+
+func (r *Redactor) isField(name string) bool {
+	return slices.ContainsFunc(r.Fields, func(f string) bool { return strings.EqualFold(f, name) })
+}
+
+func (r *Redactor) isPath(path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+	return slices.ContainsFunc(r.Paths, func(p string) bool {
+		return slices.EqualFunc(strings.Split(p, "."), path, func(a, b string) bool { return a == "*" || a == b })
+	})
+}
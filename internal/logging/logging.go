@@ -0,0 +1,210 @@
+// Package logging is the structured logging of the module, built on log/slog. Every subsystem, e.g.
+// "clipper" or "http", logs with its own logger whose level can be set separately, and all of them
+// write to a single handler that can be replaced at any time, e.g. by library users.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Attribute keys shared by the subsystems, so that logs can be filtered the same way everywhere.
+const (
+	KeySubsystem  = "subsystem"
+	KeyProvider   = "provider"
+	KeyAccount    = "account"
+	KeyDealID     = "deal_id"
+	KeyHTTPStatus = "http_status"
+	KeyDuration   = "duration"
+	KeyError      = "error"
+)
+
+// Format is the format of the handlers of NewHandler.
+type Format string
+
+const (
+	FormatText Format = "text" // key=value pairs, see slog.TextHandler.
+	FormatJSON Format = "json" // One object per line, see slog.JSONHandler.
+)
+
+// ParseFormat parses a format name.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(s))); f {
+	case FormatText, FormatJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("logging: invalid format %q, expected text or json", s)
+}
+
+// levelAll lets the handlers of NewHandler write every record, the levels are enforced by the
+// subsystem loggers.
+const levelAll = slog.Level(math.MinInt)
+
+// NewHandler returns a handler writing every record to w in the format.
+func NewHandler(format Format, w io.Writer) slog.Handler {
+	opts := &slog.HandlerOptions{Level: levelAll}
+	if format == FormatJSON {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+var (
+	mu      sync.RWMutex
+	handler = NewHandler(FormatText, os.Stderr)
+	level   = slog.LevelInfo
+	levels  = map[string]slog.Level{}
+)
+
+// SetHandler sends the logs of every subsystem to the handler, including the loggers that were
+// already created. A nil handler restores the default, text to stderr.
+func SetHandler(h slog.Handler) {
+	if h == nil {
+		h = NewHandler(FormatText, os.Stderr)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	handler = h
+}
+
+// Handler returns the current handler.
+func Handler() slog.Handler {
+	mu.RLock()
+	defer mu.RUnlock()
+	return handler
+}
+
+// SetLevel sets the minimum level of the subsystem, or of the subsystems without their own level
+// when the subsystem is empty.
+func SetLevel(subsystem string, l slog.Level) {
+	mu.Lock()
+	defer mu.Unlock()
+	if subsystem == "" {
+		level = l
+		return
+	}
+	levels[subsystem] = l
+}
+
+// Level returns the minimum level of the subsystem.
+func Level(subsystem string) slog.Level {
+	mu.RLock()
+	defer mu.RUnlock()
+	if l, ok := levels[subsystem]; ok {
+		return l
+	}
+	return level
+}
+
+// Enabled reports whether the subsystem logs at the level, e.g. to skip expensive work.
+func Enabled(subsystem string, l slog.Level) bool {
+	return l >= Level(subsystem)
+}
+
+// ParseLevels sets the levels of a comma separated list of a default level and subsystem=level
+// overrides, e.g. "warn,http=debug,clipper=info". Levels are names as in slog.Level, e.g. debug,
+// info, warn or error, optionally with an offset such as "debug-4".
+func ParseLevels(s string) error {
+	type override struct {
+		subsystem string
+		level     slog.Level
+	}
+	var all []override
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		subsystem, name, ok := strings.Cut(v, "=")
+		if !ok {
+			subsystem, name = "", v
+		}
+		var l slog.Level
+		if err := l.UnmarshalText([]byte(strings.TrimSpace(name))); err != nil {
+			return fmt.Errorf("logging: invalid level %q, error %w", v, err)
+		}
+		all = append(all, override{strings.TrimSpace(subsystem), l})
+	}
+	for _, o := range all {
+		SetLevel(o.subsystem, o.level)
+	}
+	return nil
+}
+
+// For returns the logger of the subsystem. Its records have the subsystem attribute and the
+// attributes of the context, see WithAttrs, and are dropped below the level of the subsystem.
+func For(subsystem string) *slog.Logger {
+	return slog.New(&subsystemHandler{name: subsystem}).With(KeySubsystem, subsystem)
+}
+
+type attrsKey struct{}
+
+// WithAttrs returns a context whose records have the attributes, in addition to the ones of ctx
+// with other keys, e.g. the provider and account of a run. The arguments are key-value pairs or
+// slog.Attr, as in slog.Logger.With.
+func WithAttrs(ctx context.Context, args ...any) context.Context {
+	attrs := slices.Clone(attrsFrom(ctx))
+	r := slog.Record{}
+	r.Add(args...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = slices.DeleteFunc(attrs, func(o slog.Attr) bool { return o.Key == a.Key })
+		attrs = append(attrs, a)
+		return true
+	})
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+func attrsFrom(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+// subsystemHandler enforces the level of its subsystem and writes to the current handler, to which
+// it applies the attributes and groups of the logger.
+type subsystemHandler struct {
+	name string
+	with []func(slog.Handler) slog.Handler // WithAttrs and WithGroup calls, in order.
+}
+
+func (h *subsystemHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return Enabled(h.name, l) && Handler().Enabled(ctx, l)
+}
+
+func (h *subsystemHandler) Handle(ctx context.Context, r slog.Record) error {
+	next := Handler()
+	for _, w := range h.with {
+		next = w(next)
+	}
+	if attrs := attrsFrom(ctx); len(attrs) > 0 {
+		// The attributes of the context describe the record, they go before the ones of the call.
+		nr := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+		nr.AddAttrs(attrs...)
+		r.Attrs(func(a slog.Attr) bool {
+			nr.AddAttrs(a)
+			return true
+		})
+		r = nr
+	}
+	return next.Handle(ctx, r)
+}
+
+func (h *subsystemHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.chain(func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+}
+
+func (h *subsystemHandler) WithGroup(name string) slog.Handler {
+	return h.chain(func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+}
+
+func (h *subsystemHandler) chain(w func(slog.Handler) slog.Handler) slog.Handler {
+	return &subsystemHandler{name: h.name, with: append(slices.Clip(h.with), w)}
+}
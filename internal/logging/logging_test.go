@@ -0,0 +1,112 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/csobrinho/supermarket-api/internal/logging"
+)
+
+// capture sends the logs to the returned buffer, in the format, and restores the handler and the
+// default level when the test ends. Tests use their own subsystems, whose levels aren't restored.
+func capture(t *testing.T, format logging.Format) *bytes.Buffer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	level := logging.Level("")
+	logging.SetHandler(logging.NewHandler(format, buf))
+	t.Cleanup(func() {
+		logging.SetHandler(nil)
+		logging.SetLevel("", level)
+	})
+	return buf
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, s := range []string{"text", " JSON "} {
+		if _, err := logging.ParseFormat(s); err != nil {
+			t.Errorf("ParseFormat(%q) failed: %v", s, err)
+		}
+	}
+	if _, err := logging.ParseFormat("xml"); err == nil {
+		t.Error("ParseFormat(xml) succeeded, want an error")
+	}
+}
+
+func TestNewHandler(t *testing.T) {
+	tests := []struct {
+		format logging.Format
+		want   string
+	}{
+		{logging.FormatText, `level=INFO msg=hello subsystem=test-handler deal_id=1`},
+		{logging.FormatJSON, `"level":"INFO","msg":"hello","subsystem":"test-handler","deal_id":"1"}`},
+	}
+	for _, tt := range tests {
+		buf := capture(t, tt.format)
+		logging.For("test-handler").Info("hello", logging.KeyDealID, "1")
+		if got := buf.String(); !strings.Contains(got, tt.want) {
+			t.Errorf("NewHandler(%s) wrote %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestParseLevels(t *testing.T) {
+	capture(t, logging.FormatText)
+	if err := logging.ParseLevels("warn, test-plugin=debug,test-http = error+2,"); err != nil {
+		t.Fatalf("ParseLevels() failed: %v", err)
+	}
+	tests := []struct {
+		subsystem string
+		want      slog.Level
+	}{
+		{"", slog.LevelWarn},
+		{"test-other", slog.LevelWarn},
+		{"test-plugin", slog.LevelDebug},
+		{"test-http", slog.LevelError + 2},
+	}
+	for _, tt := range tests {
+		if got := logging.Level(tt.subsystem); got != tt.want {
+			t.Errorf("Level(%q) = %v, want %v", tt.subsystem, got, tt.want)
+		}
+	}
+	if !logging.Enabled("test-plugin", slog.LevelDebug) || logging.Enabled("test-other", slog.LevelInfo) {
+		t.Error("Enabled() doesn't follow the levels of the subsystems")
+	}
+
+	// Invalid levels are rejected before any level is set.
+	for _, s := range []string{"info,test-plugin=loud", "test-plugin=info,verbose"} {
+		if err := logging.ParseLevels(s); err == nil {
+			t.Errorf("ParseLevels(%q) succeeded, want an error", s)
+		}
+	}
+	if got := logging.Level("test-plugin"); got != slog.LevelDebug {
+		t.Errorf("Level(test-plugin) = %v after invalid levels, want %v", got, slog.LevelDebug)
+	}
+}
+
+func TestFor(t *testing.T) {
+	buf := capture(t, logging.FormatJSON)
+	logging.SetLevel("test-for", slog.LevelInfo)
+	log := logging.For("test-for")
+	log.Debug("dropped")
+	if buf.Len() != 0 {
+		t.Errorf("Debug() below the level of the subsystem wrote %q, want nothing", buf)
+	}
+
+	ctx := logging.WithAttrs(context.Background(), logging.KeyProvider, "fake", logging.KeyAccount, "a")
+	// Later attributes replace the ones of the parent context with the same key.
+	child := logging.WithAttrs(ctx, slog.String(logging.KeyAccount, "b"))
+	log.With("k", "v").WithGroup("g").InfoContext(child, "clip", logging.KeyDealID, "1")
+	want := `"msg":"clip","subsystem":"test-for","k":"v","g":{"provider":"fake","account":"b","deal_id":"1"}}`
+	if got := buf.String(); !strings.Contains(got, want) {
+		t.Errorf("InfoContext() wrote %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	log.InfoContext(ctx, "parent")
+	if got := buf.String(); !strings.Contains(got, `"account":"a"}`) {
+		t.Errorf("InfoContext() of the parent context wrote %q, want its own account", got)
+	}
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AccountHealth is the health of an account: the outcome of its last token refresh and run.
+type AccountHealth struct {
+	TokenValid   bool      `json:"token_valid"`
+	TokenExpiry  time.Time `json:"token_expiry,omitzero"`
+	TokenError   string    `json:"token_error,omitempty"`
+	LastRun      time.Time `json:"last_run,omitzero"`
+	LastRunOK    bool      `json:"last_run_ok"`
+	LastRunError string    `json:"last_run_error,omitempty"`
+}
+
+// ready reports whether neither the last token refresh nor the last run of the account failed.
+// An account that didn't refresh its token or run yet is ready.
+func (h AccountHealth) ready() bool {
+	return h.TokenError == "" && h.LastRunError == ""
+}
+
+var (
+	healthMu sync.Mutex
+	health   = map[string]*AccountHealth{}
+)
+
+func accountHealth(account string) *AccountHealth {
+	h, ok := health[account]
+	if !ok {
+		h = &AccountHealth{}
+		health[account] = h
+	}
+	return h
+}
+
+// RecordToken records the outcome of a token refresh of the account.
+func RecordToken(account string, expiry time.Time, err error) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	h := accountHealth(account)
+	h.TokenValid, h.TokenExpiry, h.TokenError = err == nil, expiry, ""
+	if err != nil {
+		h.TokenExpiry, h.TokenError = time.Time{}, err.Error()
+	}
+}
+
+// RecordRun records the outcome of a run of the account that ended at t.
+func RecordRun(account string, t time.Time, err error) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	h := accountHealth(account)
+	h.LastRun, h.LastRunOK, h.LastRunError = t, err == nil, ""
+	if err != nil {
+		h.LastRunError = err.Error()
+	}
+}
+
+// Health returns the health of the accounts, by name.
+func Health() map[string]AccountHealth {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	ret := make(map[string]AccountHealth, len(health))
+	for name, h := range health {
+		ret[name] = *h
+	}
+	return ret
+}
+
+// healthResponse is the body of /healthz and /readyz.
+type healthResponse struct {
+	Status   string                   `json:"status"`
+	Accounts map[string]AccountHealth `json:"accounts,omitempty"`
+}
+
+// HealthzHandler returns the handler of /healthz, which always succeeds while the process serves.
+func HealthzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+	})
+}
+
+// ReadyzHandler returns the handler of /readyz, which fails with 503 while the last token refresh
+// or the last run of any account failed. It lists the health of the accounts.
+func ReadyzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accounts := Health()
+		resp, code := healthResponse{Status: "ok", Accounts: accounts}, http.StatusOK
+		for _, h := range accounts {
+			if !h.ready() {
+				resp.Status, code = "unavailable", http.StatusServiceUnavailable
+				break
+			}
+		}
+		writeHealth(w, code, resp)
+	})
+}
+
+func writeHealth(w http.ResponseWriter, code int, resp healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,74 @@
+package metrics_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/metrics"
+)
+
+type health struct {
+	Status   string                           `json:"status"`
+	Accounts map[string]metrics.AccountHealth `json:"accounts"`
+}
+
+func get(t *testing.T, h http.Handler) (int, health) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	var ret health
+	if err := json.Unmarshal(w.Body.Bytes(), &ret); err != nil {
+		t.Fatalf("decoding %q failed: %v", w.Body, err)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	return w.Code, ret
+}
+
+func TestHealthz(t *testing.T) {
+	metrics.RecordRun("healthz", time.Now(), errors.New("boom"))
+	t.Cleanup(func() { metrics.RecordRun("healthz", time.Now(), nil) })
+	if code, got := get(t, metrics.HealthzHandler()); code != http.StatusOK || got.Status != "ok" || got.Accounts != nil {
+		t.Errorf("/healthz = %d %+v, want 200 ok even with a failed run", code, got)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	expiry := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	end := expiry.Add(-time.Hour)
+	steps := []struct {
+		name   string
+		record func()
+		want   int
+		check  func(metrics.AccountHealth) bool
+	}{
+		{"token refreshed", func() { metrics.RecordToken("ready", expiry, nil) }, http.StatusOK, func(h metrics.AccountHealth) bool {
+			return h.TokenValid && h.TokenExpiry.Equal(expiry)
+		}},
+		{"token failed", func() { metrics.RecordToken("ready", expiry, errors.New("revoked")) }, http.StatusServiceUnavailable, func(h metrics.AccountHealth) bool {
+			return !h.TokenValid && h.TokenExpiry.IsZero() && h.TokenError == "revoked"
+		}},
+		{"token recovered", func() { metrics.RecordToken("ready", expiry, nil) }, http.StatusOK, func(h metrics.AccountHealth) bool {
+			return h.TokenValid && h.TokenError == ""
+		}},
+		{"run failed", func() { metrics.RecordRun("ready", end, errors.New("limit")) }, http.StatusServiceUnavailable, func(h metrics.AccountHealth) bool {
+			return !h.LastRunOK && h.LastRun.Equal(end) && h.LastRunError == "limit"
+		}},
+		{"run recovered", func() { metrics.RecordRun("ready", end, nil) }, http.StatusOK, func(h metrics.AccountHealth) bool {
+			return h.LastRunOK && h.LastRunError == "" && h.TokenValid
+		}},
+	}
+	for _, s := range steps {
+		s.record()
+		code, got := get(t, metrics.ReadyzHandler())
+		wantStatus := map[int]string{http.StatusOK: "ok", http.StatusServiceUnavailable: "unavailable"}[s.want]
+		if code != s.want || got.Status != wantStatus || !s.check(got.Accounts["ready"]) {
+			t.Errorf("/readyz after %s = %d %+v, want %d %s", s.name, code, got, s.want, wantStatus)
+		}
+	}
+}
@@ -3,9 +3,11 @@ package metrics
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/client_golang/prometheus/push"
 )
 
@@ -130,6 +132,11 @@ var (
 		Help: "Number of errors encountered while clipping",
 	})
 
+	clipStatsUnclipped = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "supermarket_clip_stats_unclipped",
+		Help: "Number of promotions left unclipped because of the account clip limit",
+	})
+
 	metricsRegistry = prometheus.NewRegistry()
 )
 
@@ -155,6 +162,7 @@ func init() {
 	metricsRegistry.MustRegister(clipStatsDeleted)
 	metricsRegistry.MustRegister(clipStatsIgnored)
 	metricsRegistry.MustRegister(clipStatsErrors)
+	metricsRegistry.MustRegister(clipStatsUnclipped)
 }
 
 // errorCategory represents an error category for metrics.
@@ -167,6 +175,7 @@ const (
 	ErrorCategoryPromotionsFetch  errorCategory = "promotions_fetch"
 	ErrorCategoryPromotionsParse  errorCategory = "promotions_parse"
 	ErrorCategoryClipDeal         errorCategory = "clip_deal"
+	ErrorCategoryClipLimit        errorCategory = "clip_limit"
 	ErrorCategoryMetricsPush      errorCategory = "metrics_push"
 )
 
@@ -232,12 +241,13 @@ func RecordPromotionsCount(count int) {
 }
 
 // RecordClipStats sets the clip statistics gauges.
-func RecordClipStats(alreadyClipped, newlyClipped, deleted, ignored, errors int) {
+func RecordClipStats(alreadyClipped, newlyClipped, deleted, ignored, errors, unclipped int) {
 	clipStatsAlreadyClipped.Set(float64(alreadyClipped))
 	clipStatsNewlyClipped.Set(float64(newlyClipped))
 	clipStatsDeleted.Set(float64(deleted))
 	clipStatsIgnored.Set(float64(ignored))
 	clipStatsErrors.Set(float64(errors))
+	clipStatsUnclipped.Set(float64(unclipped))
 }
 
 // PushMetrics pushes all metrics to the Prometheus Pushgateway.
@@ -253,3 +263,8 @@ func PushMetrics(ctx context.Context, endpoint string, job string) error {
 	}
 	return nil
 }
+
+// Handler returns the handler of /metrics, serving all metrics to Prometheus scrapes.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{Registry: metricsRegistry})
+}
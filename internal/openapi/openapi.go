@@ -0,0 +1,240 @@
+// Package openapi builds OpenAPI 3.1 documents, with the JSON schemas of the request and response
+// bodies generated from their Go types, so that the document of an API can't drift from its
+// handlers.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Version is the OpenAPI version of the documents.
+const Version = "3.1.0"
+
+// Document is an OpenAPI document.
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Paths      map[string]PathItem   `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []map[string][]string `json:"security,omitempty"`
+
+	types map[string]reflect.Type // Types of the schemas of the components, by name.
+}
+
+// Info describes the API.
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// PathItem are the operations of a path, by lower case method.
+type PathItem map[string]*Operation
+
+// Operation is an operation of the API.
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+	// Security overrides the one of the document, an empty list makes the operation public.
+	Security *[]map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter is a path or query parameter.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"` // path or query.
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is the body of the requests of an operation.
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response is a response of an operation.
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType is the schema of a body.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components are the schemas and security schemes referred to by the document.
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme is a way to authenticate, e.g. an API key in a header.
+type SecurityScheme struct {
+	Type   string `json:"type"`             // apiKey or http.
+	Name   string `json:"name,omitempty"`   // Header of apiKey.
+	In     string `json:"in,omitempty"`     // header for apiKey.
+	Scheme string `json:"scheme,omitempty"` // bearer or basic for http.
+}
+
+// Schema is a JSON schema.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Default              any                `json:"default,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// New returns an empty document.
+func New(info Info) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]PathItem{},
+		types:   map[string]reflect.Type{},
+	}
+}
+
+// Add adds an operation on the path, e.g. "/v1/items/{id}".
+func (d *Document) Add(method, path string, op *Operation) {
+	item, ok := d.Paths[path]
+	if !ok {
+		item = PathItem{}
+		d.Paths[path] = item
+	}
+	item[strings.ToLower(method)] = op
+}
+
+// JSON returns the media types of a JSON body of the type of v, e.g. of a Response.
+func (d *Document) JSON(v any) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: d.Schema(reflect.TypeOf(v))}}
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// Schema returns the schema of the JSON encoding of t. The schemas of named structs are added to
+// the components and referred to.
+func (d *Document) Schema(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{} // An interface, any value.
+	}
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return d.Schema(t.Elem())
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.Schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.Schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.object(t)
+		}
+		name := d.name(t)
+		if _, ok := d.types[name]; !ok {
+			d.types[name] = t
+			if d.Components.Schemas == nil {
+				d.Components.Schemas = map[string]*Schema{}
+			}
+			// Registered before its fields, for recursive types.
+			d.Components.Schemas[name] = &Schema{}
+			*d.Components.Schemas[name] = *d.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	return &Schema{}
+}
+
+// name returns the name of the component of the struct, capitalized and qualified with its package
+// if another struct has the same name.
+func (d *Document) name(t reflect.Type) string {
+	name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+	if o, ok := d.types[name]; ok && o != t {
+		pkg := t.PkgPath()
+		name = pkg[strings.LastIndex(pkg, "/")+1:] + "." + name
+	}
+	return name
+}
+
+// object returns the schema of the fields of the struct, following the rules of encoding/json.
+func (d *Document) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	depths := map[string]int{}
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			continue // Its fields are visible fields too.
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if depth, ok := depths[name]; ok && depth <= len(f.Index) {
+			continue // Shadowed by a field of a shallower struct.
+		}
+		depths[name] = len(f.Index)
+		s.Properties[name] = d.Schema(f.Type)
+		s.Required = slices.DeleteFunc(s.Required, func(r string) bool { return r == name })
+		optional := strings.Contains(opts, "omitempty") || strings.Contains(opts, "omitzero") || f.Type.Kind() == reflect.Pointer
+		if !optional {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
+
+// Handler returns the handler serving the document as JSON.
+func (d *Document) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("openapi: encode document, error %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(b)
+	})
+}
@@ -0,0 +1,123 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/openapi"
+)
+
+type base struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type item struct {
+	base
+	Name     int             `json:"name,omitempty"` // Shadows the name of base.
+	Price    *float64        `json:"price"`
+	Tags     []string        `json:"tags"`
+	Data     []byte          `json:"data,omitempty"`
+	Attrs    map[string]bool `json:"attrs,omitzero"`
+	Created  time.Time       `json:"created"`
+	Parent   *item           `json:"parent,omitempty"`
+	Any      any             `json:"any"`
+	Ignored  string          `json:"-"`
+	NoTag    uint8
+	internal string
+	Inline   struct{ X int }  `json:"inline"`
+	Extra    map[string]*base `json:"extra,omitempty"`
+}
+
+func schemaJSON(t *testing.T, s any) string {
+	t.Helper()
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestSchema(t *testing.T) {
+	d := openapi.New(openapi.Info{Title: "test", Version: "v1"})
+	if got, want := schemaJSON(t, d.Schema(reflect.TypeFor[item]())), `{"$ref":"#/components/schemas/Item"}`; got != want {
+		t.Errorf("Schema(item) = %s, want %s", got, want)
+	}
+	got := schemaJSON(t, d.Components.Schemas["Item"])
+	want := `{"type":"object","properties":{` +
+		`"NoTag":{"type":"integer"},` +
+		`"any":{},` +
+		`"attrs":{"type":"object","additionalProperties":{"type":"boolean"}},` +
+		`"created":{"type":"string","format":"date-time"},` +
+		`"data":{"type":"string","format":"byte"},` +
+		`"extra":{"type":"object","additionalProperties":{"$ref":"#/components/schemas/Base"}},` +
+		`"id":{"type":"string"},` +
+		`"inline":{"type":"object","properties":{"X":{"type":"integer"}},"required":["X"]},` +
+		`"name":{"type":"integer"},` +
+		`"parent":{"$ref":"#/components/schemas/Item"},` +
+		`"price":{"type":"number"},` +
+		`"tags":{"type":"array","items":{"type":"string"}}},` +
+		`"required":["id","tags","created","any","NoTag","inline"]}`
+	if got != want {
+		t.Errorf("Schema(item) component =\n%s\nwant\n%s", got, want)
+	}
+	if _, ok := d.Components.Schemas["Base"]; !ok {
+		t.Errorf("Schema(item) components = %v, want Base for the values of extra", d.Components.Schemas)
+	}
+}
+
+// Structs of different packages with the same name have their own component.
+func TestSchemaNames(t *testing.T) {
+	d := openapi.New(openapi.Info{})
+	type Info struct {
+		Name string `json:"name"`
+	}
+	for _, tc := range []struct {
+		t    reflect.Type
+		want string
+	}{
+		{reflect.TypeFor[openapi.Info](), "#/components/schemas/Info"},
+		{reflect.TypeFor[Info](), "#/components/schemas/openapi_test.Info"},
+		{reflect.TypeFor[*openapi.Info](), "#/components/schemas/Info"},
+	} {
+		if got := d.Schema(tc.t).Ref; got != tc.want {
+			t.Errorf("Schema(%v) = %q, want %q", tc.t, got, tc.want)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	d := openapi.New(openapi.Info{Title: "test", Version: "v1"})
+	d.Add(http.MethodGet, "/v1/items/{id}", &openapi.Operation{
+		OperationID: "getItem",
+		Parameters:  []openapi.Parameter{{Name: "id", In: "path", Required: true, Schema: &openapi.Schema{Type: "string"}}},
+		Responses:   map[string]openapi.Response{"200": {Description: "OK", Content: d.JSON(base{})}},
+	})
+	d.Add(http.MethodDelete, "/v1/items/{id}", &openapi.Operation{OperationID: "deleteItem", Responses: map[string]openapi.Response{"204": {Description: "No Content"}}})
+
+	rec := httptest.NewRecorder()
+	d.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("GET = %d %q, want 200 application/json", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	got := struct {
+		OpenAPI    string
+		Info       openapi.Info
+		Paths      map[string]map[string]openapi.Operation
+		Components openapi.Components
+	}{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decoding the document failed: %v", err)
+	}
+	item := got.Paths["/v1/items/{id}"]
+	if got.OpenAPI != openapi.Version || got.Info.Title != "test" || item["get"].OperationID != "getItem" || item["delete"].OperationID != "deleteItem" {
+		t.Errorf("GET = %+v, want the operations of the items", got)
+	}
+	if ref := item["get"].Responses["200"].Content["application/json"].Schema.Ref; ref != "#/components/schemas/Base" || got.Components.Schemas["Base"] == nil {
+		t.Errorf("GET getItem response = %q, components %v, want the schema of base", ref, got.Components.Schemas)
+	}
+}
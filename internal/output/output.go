@@ -0,0 +1,316 @@
+// Package output writes listings as a table or in machine readable formats. Rows are structs whose
+// fields are named after their json tags, so the names are the same in every format and stable
+// across releases.
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format is an output format.
+type Format string
+
+const (
+	FormatTable    Format = "table"
+	FormatJSON     Format = "json"  // An indented array of objects.
+	FormatJSONL    Format = "jsonl" // One object per line.
+	FormatCSV      Format = "csv"
+	FormatYAML     Format = "yaml"
+	FormatMarkdown Format = "markdown"
+)
+
+// Formats are the supported formats.
+var Formats = []Format{FormatTable, FormatJSON, FormatJSONL, FormatCSV, FormatYAML, FormatMarkdown}
+
+// ParseFormat parses a format name.
+func ParseFormat(s string) (Format, error) {
+	if f := Format(strings.ToLower(strings.TrimSpace(s))); slices.Contains(Formats, f) {
+		return f, nil
+	}
+	return "", fmt.Errorf("output: invalid format %q, expected one of %v", s, Formats)
+}
+
+// Tabular reports whether the format is meant to be read by people, i.e. a table or markdown.
+func (f Format) Tabular() bool { return f == FormatTable || f == FormatMarkdown }
+
+// Options configures Write.
+type Options struct {
+	Format  Format
+	Columns []string // Fields to write, in order. See Default.
+	// Default are the fields of the table, csv and markdown formats when Columns is empty. The other
+	// formats write every field.
+	Default []string
+	Sort    []string // Fields to sort by, prefixed with "-" for descending order.
+}
+
+// Fields returns the field names of the struct type of the sample, which can also be a pointer or
+// a slice: the json tags of its exported fields and of its embedded structs, in order. Fields
+// without a tag are skipped.
+func Fields(sample any) []string {
+	t := reflect.TypeOf(sample)
+	for t != nil && (t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	return fields(t)
+}
+
+func fields(t reflect.Type) []string {
+	var ret []string
+	for f := range t.Fields() {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		// As with encoding/json, the fields of embedded structs are promoted, even unexported ones.
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			ret = append(ret, fields(f.Type)...)
+			continue
+		}
+		if !f.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		ret = append(ret, name)
+	}
+	return ret
+}
+
+// record is a row as its fields, in the JSON representation of the values.
+type record map[string]any
+
+// Write writes the rows in the format of the options.
+func Write[T any](w io.Writer, rows []T, opts Options) error {
+	all := Fields(rows)
+	columns := opts.Columns
+	if len(columns) == 0 {
+		columns = all
+		if opts.Format.Tabular() || opts.Format == FormatCSV {
+			columns = cmpOr(opts.Default, all)
+		}
+	}
+	for _, c := range slices.Concat(columns, opts.Sort) {
+		if c = strings.TrimPrefix(c, "-"); !slices.Contains(all, c) {
+			return fmt.Errorf("output: unknown field %q, expected one of %s", c, strings.Join(all, ", "))
+		}
+	}
+
+	recs := make([]record, 0, len(rows))
+	for _, r := range rows {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("output: encode row, error %w", err)
+		}
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		rec := record{}
+		if err := dec.Decode(&rec); err != nil {
+			return fmt.Errorf("output: decode row, error %w", err)
+		}
+		recs = append(recs, rec)
+	}
+	sortRecords(recs, opts.Sort)
+
+	switch opts.Format {
+	case FormatJSON:
+		return writeJSON(w, recs, columns)
+	case FormatJSONL:
+		return writeJSONL(w, recs, columns)
+	case FormatCSV:
+		return writeCSV(w, recs, columns)
+	case FormatYAML:
+		return writeYAML(w, recs, columns)
+	case FormatMarkdown:
+		return writeMarkdown(w, recs, columns)
+	case FormatTable, "":
+		return writeTable(w, recs, columns)
+	}
+	return fmt.Errorf("output: invalid format %q", opts.Format)
+}
+
+func cmpOr(a, b []string) []string {
+	if len(a) > 0 {
+		return a
+	}
+	return b
+}
+
+// ordered is a record with its fields in the order of the columns.
+type ordered struct {
+	rec     record
+	columns []string
+}
+
+func (o ordered) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, c := range o.columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(c)
+		v, err := json.Marshal(o.rec[c])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func writeJSON(w io.Writer, recs []record, columns []string) error {
+	all := make([]ordered, 0, len(recs))
+	for _, rec := range recs {
+		all = append(all, ordered{rec, columns})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(all)
+}
+
+func writeJSONL(w io.Writer, recs []record, columns []string) error {
+	enc := json.NewEncoder(w)
+	for _, rec := range recs {
+		if err := enc.Encode(ordered{rec, columns}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeYAML(w io.Writer, recs []record, columns []string) error {
+	doc := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, rec := range recs {
+		m := &yaml.Node{Kind: yaml.MappingNode}
+		for _, c := range columns {
+			v := &yaml.Node{}
+			if err := v.Encode(yamlValue(rec[c])); err != nil {
+				return fmt.Errorf("output: encode %s, error %w", c, err)
+			}
+			m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: c}, v)
+		}
+		doc.Content = append(doc.Content, m)
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// yamlValue converts the JSON numbers, which yaml would quote as strings.
+func yamlValue(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []any:
+		ret := make([]any, 0, len(v))
+		for _, e := range v {
+			ret = append(ret, yamlValue(e))
+		}
+		return ret
+	case map[string]any:
+		ret := make(map[string]any, len(v))
+		for k, e := range v {
+			ret[k] = yamlValue(e)
+		}
+		return ret
+	}
+	return v
+}
+
+func writeCSV(w io.Writer, recs []record, columns []string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	for _, rec := range recs {
+		row := make([]string, 0, len(columns))
+		for _, c := range columns {
+			row = append(row, cell(rec[c]))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeTable(w io.Writer, recs []record, columns []string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := make([]string, 0, len(columns))
+	for _, c := range columns {
+		header = append(header, strings.ToUpper(c))
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, rec := range recs {
+		row := make([]string, 0, len(columns))
+		for _, c := range columns {
+			// Tabs and newlines would break the alignment.
+			row = append(row, strings.Join(strings.Fields(cell(rec[c])), " "))
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func writeMarkdown(w io.Writer, recs []record, columns []string) error {
+	line := func(cells []string) {
+		fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+	}
+	line(columns)
+	sep := make([]string, len(columns))
+	for i := range sep {
+		sep[i] = "---"
+	}
+	line(sep)
+	r := strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>")
+	for _, rec := range recs {
+		row := make([]string, 0, len(columns))
+		for _, c := range columns {
+			row = append(row, r.Replace(cell(rec[c])))
+		}
+		line(row)
+	}
+	return nil
+}
+
+// cell formats a value for the table, csv and markdown formats. Lists are joined with commas and
+// objects are written as JSON.
+func cell(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return fmt.Sprint(v)
+	case []any:
+		s := make([]string, 0, len(v))
+		for _, e := range v {
+			s = append(s, cell(e))
+		}
+		return strings.Join(s, ", ")
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
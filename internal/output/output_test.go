@@ -0,0 +1,206 @@
+package output_test
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/csobrinho/supermarket-api/internal/output"
+)
+
+type base struct {
+	ID string `json:"id"`
+}
+
+type detail struct {
+	Size string `json:"size"`
+}
+
+type row struct {
+	base
+	Name    string   `json:"name"`
+	Price   *float64 `json:"price,omitempty"`
+	Tags    []string `json:"tags"`
+	Detail  *detail  `json:"detail,omitempty"`
+	Skipped string
+	hidden  string
+}
+
+func ptr[T any](v T) *T { return &v }
+
+var rows = []row{
+	{base: base{ID: "1"}, Name: "Milk", Price: ptr(3.5), Tags: []string{"dairy", "organic"}, Detail: &detail{Size: "1 gal"}},
+	{base: base{ID: "2"}, Name: "Eggs | large", Price: ptr(10.25)},
+	{base: base{ID: "3"}, Name: "Bread\nwhite", Tags: []string{}},
+}
+
+func TestFields(t *testing.T) {
+	want := []string{"id", "name", "price", "tags", "detail"}
+	for _, sample := range []any{row{}, &row{}, []row{}, []*row{}} {
+		if got := output.Fields(sample); !slices.Equal(got, want) {
+			t.Errorf("Fields(%T) = %v, want %v", sample, got, want)
+		}
+	}
+	if got := output.Fields(42); got != nil {
+		t.Errorf("Fields(int) = %v, want nil", got)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name string
+		opts output.Options
+		want string
+	}{
+		{
+			name: "table",
+			opts: output.Options{Format: output.FormatTable, Default: []string{"id", "name", "tags"}},
+			want: "ID  NAME          TAGS\n" +
+				"1   Milk          dairy, organic\n" +
+				"2   Eggs | large  \n" +
+				"3   Bread white   \n",
+		},
+		{
+			name: "table columns sorted descending",
+			opts: output.Options{Format: output.FormatTable, Columns: []string{"price", "id"}, Sort: []string{"-price"}},
+			want: "PRICE  ID\n" +
+				"10.25  2\n" +
+				"3.5    1\n" +
+				"       3\n",
+		},
+		{
+			name: "csv",
+			opts: output.Options{Format: output.FormatCSV, Columns: []string{"id", "detail", "name"}},
+			want: "id,detail,name\n" +
+				"1,\"{\"\"size\"\":\"\"1 gal\"\"}\",Milk\n" +
+				"2,,Eggs | large\n" +
+				"3,,\"Bread\nwhite\"\n",
+		},
+		{
+			name: "csv sorted ascending, missing first",
+			opts: output.Options{Format: output.FormatCSV, Default: []string{"id", "price"}, Sort: []string{"price"}},
+			want: "id,price\n3,\n1,3.5\n2,10.25\n",
+		},
+		{
+			name: "markdown",
+			opts: output.Options{Format: output.FormatMarkdown, Columns: []string{"id", "name"}},
+			want: "| id | name |\n" +
+				"| --- | --- |\n" +
+				"| 1 | Milk |\n" +
+				"| 2 | Eggs \\| large |\n" +
+				"| 3 | Bread<br>white |\n",
+		},
+		{
+			// The machine readable formats write every field, not only the defaults.
+			name: "json",
+			opts: output.Options{Format: output.FormatJSON, Default: []string{"id"}, Sort: []string{"-id"}},
+			want: `[
+  {
+    "id": "3",
+    "name": "Bread\nwhite",
+    "price": null,
+    "tags": [],
+    "detail": null
+  },
+  {
+    "id": "2",
+    "name": "Eggs | large",
+    "price": 10.25,
+    "tags": null,
+    "detail": null
+  },
+  {
+    "id": "1",
+    "name": "Milk",
+    "price": 3.5,
+    "tags": [
+      "dairy",
+      "organic"
+    ],
+    "detail": {
+      "size": "1 gal"
+    }
+  }
+]
+`,
+		},
+		{
+			name: "jsonl",
+			opts: output.Options{Format: output.FormatJSONL, Columns: []string{"name", "price"}},
+			want: `{"name":"Milk","price":3.5}` + "\n" +
+				`{"name":"Eggs | large","price":10.25}` + "\n" +
+				`{"name":"Bread\nwhite","price":null}` + "\n",
+		},
+		{
+			name: "yaml",
+			opts: output.Options{Format: output.FormatYAML, Columns: []string{"id", "price", "tags", "detail"}},
+			want: `- id: "1"
+  price: 3.5
+  tags:
+    - dairy
+    - organic
+  detail:
+    size: 1 gal
+- id: "2"
+  price: 10.25
+  tags: null
+  detail: null
+- id: "3"
+  price: null
+  tags: []
+  detail: null
+`,
+		},
+	}
+	for _, tt := range tests {
+		buf := &bytes.Buffer{}
+		if err := output.Write(buf, rows, tt.opts); err != nil {
+			t.Errorf("Write(%s) failed: %v", tt.name, err)
+			continue
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("Write(%s) =\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWritePointers(t *testing.T) {
+	ptrs := []*row{&rows[1], &rows[0]}
+	buf := &bytes.Buffer{}
+	if err := output.Write(buf, ptrs, output.Options{Format: output.FormatCSV, Columns: []string{"id", "name"}, Sort: []string{"id"}}); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	if got, want := buf.String(), "id,name\n1,Milk\n2,Eggs | large\n"; got != want {
+		t.Errorf("Write() = %q, want %q", got, want)
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts output.Options
+		want string
+	}{
+		{"unknown column", output.Options{Format: output.FormatJSON, Columns: []string{"id", "Skipped"}}, `unknown field "Skipped", expected one of id, name, price, tags, detail`},
+		{"unknown default", output.Options{Format: output.FormatTable, Default: []string{"hidden"}}, `unknown field "hidden"`},
+		{"unknown sort", output.Options{Format: output.FormatCSV, Sort: []string{"-cost"}}, `unknown field "cost"`},
+		{"invalid format", output.Options{Format: "xml"}, `invalid format "xml"`},
+	}
+	for _, tt := range tests {
+		if err := output.Write(&bytes.Buffer{}, rows, tt.opts); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Write(%s) = %v, want an error containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, f := range output.Formats {
+		if got, err := output.ParseFormat(" " + strings.ToUpper(string(f))); err != nil || got != f {
+			t.Errorf("ParseFormat(%q) = %q, %v, want %q", f, got, err, f)
+		}
+	}
+	if _, err := output.ParseFormat("xml"); err == nil {
+		t.Error("ParseFormat(xml) succeeded, want an error")
+	}
+}
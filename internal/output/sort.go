@@ -0,0 +1,49 @@
+package output
+
+import (
+	"cmp"
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+// sortRecords sorts the records by the fields, prefixed with "-" for descending order. Missing
+// values sort first, numbers numerically and everything else by its cell text.
+func sortRecords(recs []record, by []string) {
+	if len(by) == 0 {
+		return
+	}
+	slices.SortStableFunc(recs, func(a, b record) int {
+		for _, f := range by {
+			desc := strings.HasPrefix(f, "-")
+			f = strings.TrimPrefix(f, "-")
+			c := compare(a[f], b[f])
+			if desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+}
+
+func compare(a, b any) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	an, aok := a.(json.Number)
+	bn, bok := b.(json.Number)
+	if aok && bok {
+		af, _ := an.Float64()
+		bf, _ := bn.Float64()
+		return cmp.Compare(af, bf)
+	}
+	return strings.Compare(cell(a), cell(b))
+}
@@ -0,0 +1,189 @@
+// Package pluginrpc defines the protocol between the CLI and provider plugins: JSON-RPC 2.0
+// messages, one per line, over the stdin and stdout of the plugin process.
+//
+// The host starts with a handshake, which fails unless both sides speak the same Version, and
+// configures the provider before calling the methods that mirror auth.Service and
+// promotion.Service. Requests are answered in any order, and the host may cancel a pending request
+// with a $/cancel notification.
+package pluginrpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"golang.org/x/oauth2"
+)
+
+// Version is the version of the protocol.
+const Version = 1
+
+const (
+	MethodHandshake             = "handshake"
+	MethodConfigure             = "configure"
+	MethodShutdown              = "shutdown"
+	MethodCancel                = "$/cancel" // Notification, without a response.
+	MethodAuthToken             = "auth.token"
+	MethodAuthRefreshToken      = "auth.refreshToken"
+	MethodAuthIsAuthenticated   = "auth.isAuthenticated"
+	MethodPromotionGetClipDeals = "promotion.getClipDeals"
+	MethodPromotionClipDeal     = "promotion.clipDeal"
+	MethodPromotionUnclipDeal   = "promotion.unclipDeal"
+)
+
+// Error codes, the JSON-RPC 2.0 ones and the ones of the protocol.
+const (
+	CodeParseError       = -32700
+	CodeInvalidRequest   = -32600
+	CodeMethodNotFound   = -32601
+	CodeInvalidParams    = -32602
+	CodeInternalError    = -32603
+	CodeClipLimitReached = -32001 // The account can't hold more clipped offers.
+	CodeCanceled         = -32002 // The request was canceled or timed out.
+	CodeUnsupported      = -32003 // The provider lacks the capability.
+	CodeNotConfigured    = -32004 // The method was called before configure.
+)
+
+// Message is a request, notification or response. Requests have an id and a method,
+// notifications only a method, and responses an id and either a result or an error.
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is the error of a response.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("%s (code %d)", e.Message, e.Code) }
+
+type HandshakeParams struct {
+	ProtocolVersion int `json:"protocolVersion"`
+}
+
+type HandshakeResult struct {
+	ProtocolVersion int      `json:"protocolVersion"`
+	Name            string   `json:"name"`         // Name of the provider, for logs.
+	Capabilities    []string `json:"capabilities"` // See supermarket.Capability.
+}
+
+// Config mirrors supermarket.Config, without the fields that can't cross the process boundary.
+type Config struct {
+	UserAgent    string        `json:"userAgent,omitempty"`
+	AppVersion   string        `json:"appVersion,omitempty"`
+	RefreshToken string        `json:"refreshToken,omitempty"`
+	ClientID     string        `json:"clientId,omitempty"`
+	ClientSecret string        `json:"clientSecret,omitempty"`
+	RedirectURL  string        `json:"redirectUrl,omitempty"`
+	Username     string        `json:"username,omitempty"`
+	Password     string        `json:"password,omitempty"`
+	LoyaltyCard  string        `json:"loyaltyCard,omitempty"`
+	ApiKey       string        `json:"apiKey,omitempty"`
+	Timeout      time.Duration `json:"timeout,omitempty"` // Nanoseconds.
+	Debug        bool          `json:"debug,omitempty"`
+	StoreID      string        `json:"storeId,omitempty"`
+	Banner       string        `json:"banner,omitempty"`
+	BaseURL      string        `json:"baseUrl,omitempty"`
+}
+
+type ConfigureParams struct {
+	Config Config `json:"config"`
+}
+
+type CancelParams struct {
+	ID int64 `json:"id"`
+}
+
+type TokenResult struct {
+	Token *oauth2.Token `json:"token"`
+}
+
+type IsAuthenticatedResult struct {
+	Authenticated bool `json:"authenticated"`
+}
+
+type GetClipDealsParams struct {
+	Options promotion.PromotionSearchOptions `json:"options"`
+}
+
+type GetClipDealsResult struct {
+	Deals []promotion.ClipDeal `json:"deals"`
+}
+
+type ClipDealParams struct {
+	Deal promotion.ClipDeal `json:"deal"`
+}
+
+// Conn reads and writes messages, one JSON document per line. Writes are safe for concurrent use,
+// reads are not.
+type Conn struct {
+	mu  sync.Mutex
+	w   io.Writer
+	dec *json.Decoder
+}
+
+// NewConn returns a connection reading from r and writing to w.
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	return &Conn{w: w, dec: json.NewDecoder(bufio.NewReader(r))}
+}
+
+// Read reads the next message. It returns io.EOF when the peer closes the connection.
+func (c *Conn) Read() (*Message, error) {
+	m := &Message{}
+	if err := c.dec.Decode(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Write writes a message, followed by a newline.
+func (c *Conn) Write(m *Message) error {
+	m.JSONRPC = "2.0"
+	b, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("pluginrpc: encode message, error %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.w.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("pluginrpc: write message, error %w", err)
+	}
+	return nil
+}
+
+// Request returns a request, or a notification if id is nil.
+func Request(id *int64, method string, params any) (*Message, error) {
+	m := &Message{ID: id, Method: method}
+	if params != nil {
+		b, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("pluginrpc: encode %s params, error %w", method, err)
+		}
+		m.Params = b
+	}
+	return m, nil
+}
+
+// Response returns the response to the request with the id, with the result or the error.
+func Response(id *int64, result any, rerr *Error) *Message {
+	m := &Message{ID: id, Error: rerr}
+	if rerr == nil {
+		b, err := json.Marshal(result)
+		if err != nil {
+			m.Error = &Error{Code: CodeInternalError, Message: fmt.Sprintf("encode result, error %v", err)}
+		} else {
+			m.Result = b
+		}
+	}
+	return m
+}
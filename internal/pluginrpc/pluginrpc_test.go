@@ -0,0 +1,244 @@
+package pluginrpc_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/pluginrpc"
+	"github.com/csobrinho/supermarket-api/internal/pluginrpc/pluginrpctest"
+	"github.com/csobrinho/supermarket-api/providers/fake"
+)
+
+// plugin is a fake plugin process, talked to directly with the protocol.
+type plugin struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr strings.Builder
+	conn   *pluginrpc.Conn
+	msgs   chan *pluginrpc.Message
+	err    chan error // The error of the last read, once stdout is closed.
+}
+
+func startPlugin(t *testing.T, path string, args ...string) *plugin {
+	t.Helper()
+	p := &plugin{cmd: exec.Command(path, args...), msgs: make(chan *pluginrpc.Message, 10), err: make(chan error, 1)}
+	p.cmd.Stderr = &p.stderr
+	stdin, err := p.cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := p.cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.cmd.Start(); err != nil {
+		t.Fatalf("starting the plugin failed: %v", err)
+	}
+	p.stdin, p.conn = stdin, pluginrpc.NewConn(stdout, stdin)
+	go func() {
+		for {
+			m, err := p.conn.Read()
+			if err != nil {
+				p.err <- err
+				close(p.msgs)
+				return
+			}
+			p.msgs <- m
+		}
+	}()
+	t.Cleanup(func() {
+		_ = p.stdin.Close()
+		_ = p.cmd.Process.Kill()
+		_ = p.cmd.Wait()
+	})
+	return p
+}
+
+// send writes the request, or the notification if id is 0.
+func (p *plugin) send(t *testing.T, id int64, method string, params any) {
+	t.Helper()
+	var pid *int64
+	if id != 0 {
+		pid = &id
+	}
+	m, err := pluginrpc.Request(pid, method, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.conn.Write(m); err != nil {
+		t.Fatalf("writing %s failed: %v", method, err)
+	}
+}
+
+// next returns the next message of the plugin, or nil once it closed its stdout.
+func (p *plugin) next(t *testing.T) *pluginrpc.Message {
+	t.Helper()
+	select {
+	case m := <-p.msgs:
+		return m
+	case <-time.After(10 * time.Second):
+		t.Fatal("the plugin didn't answer in time")
+		return nil
+	}
+}
+
+// call sends the request and returns its response, which must not be an error.
+func (p *plugin) call(t *testing.T, id int64, method string, params, result any) {
+	t.Helper()
+	p.send(t, id, method, params)
+	m := p.next(t)
+	if m == nil || m.ID == nil || *m.ID != id || m.Error != nil {
+		t.Fatalf("%s = %+v, want the response of request %d", method, m, id)
+	}
+	if result != nil {
+		if err := json.Unmarshal(m.Result, result); err != nil {
+			t.Fatalf("decoding the %s result failed: %v", method, err)
+		}
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	p := startPlugin(t, pluginrpctest.FakePlugin(t))
+	hs := pluginrpc.HandshakeResult{}
+	p.call(t, 1, pluginrpc.MethodHandshake, pluginrpc.HandshakeParams{ProtocolVersion: pluginrpc.Version}, &hs)
+	var want []string
+	for _, c := range fake.Capabilities {
+		want = append(want, string(c))
+	}
+	if hs.ProtocolVersion != pluginrpc.Version || hs.Name != "fake" || !slices.Equal(hs.Capabilities, want) {
+		t.Errorf("handshake = %+v, want v%d of fake with %v", hs, pluginrpc.Version, want)
+	}
+
+	// The provider can't be used before it is configured.
+	p.send(t, 2, pluginrpc.MethodPromotionGetClipDeals, pluginrpc.GetClipDealsParams{})
+	if m := p.next(t); m.Error == nil || m.Error.Code != pluginrpc.CodeNotConfigured {
+		t.Errorf("getClipDeals before configure = %+v, want code %d", m, pluginrpc.CodeNotConfigured)
+	}
+	p.call(t, 3, pluginrpc.MethodConfigure, pluginrpc.ConfigureParams{}, nil)
+	res := pluginrpc.GetClipDealsResult{}
+	p.call(t, 4, pluginrpc.MethodPromotionGetClipDeals, pluginrpc.GetClipDealsParams{}, &res)
+	if len(res.Deals) == 0 {
+		t.Error("getClipDeals returned no deals")
+	}
+	p.send(t, 5, "promotion.unknown", nil)
+	if m := p.next(t); m.Error == nil || m.Error.Code != pluginrpc.CodeMethodNotFound {
+		t.Errorf("unknown method = %+v, want code %d", m, pluginrpc.CodeMethodNotFound)
+	}
+
+	// Shutdown is answered before the plugin exits.
+	p.call(t, 6, pluginrpc.MethodShutdown, nil, nil)
+	if m := p.next(t); m != nil {
+		t.Errorf("message after shutdown = %+v, want none", m)
+	}
+	if err := <-p.err; !errors.Is(err, io.EOF) {
+		t.Errorf("read after shutdown = %v, want %v", err, io.EOF)
+	}
+	if err := p.cmd.Wait(); err != nil {
+		t.Errorf("plugin exited with %v, want exit status 0", err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	p := startPlugin(t, pluginrpctest.FakePlugin(t), "--fake_latency=1m")
+	p.call(t, 1, pluginrpc.MethodHandshake, pluginrpc.HandshakeParams{ProtocolVersion: pluginrpc.Version}, nil)
+	p.call(t, 2, pluginrpc.MethodConfigure, pluginrpc.ConfigureParams{}, nil)
+
+	start := time.Now()
+	p.send(t, 3, pluginrpc.MethodPromotionGetClipDeals, pluginrpc.GetClipDealsParams{})
+	p.send(t, 4, pluginrpc.MethodPromotionGetClipDeals, pluginrpc.GetClipDealsParams{})
+	// Canceling an unknown request is ignored.
+	p.send(t, 0, pluginrpc.MethodCancel, pluginrpc.CancelParams{ID: 42})
+	p.send(t, 0, pluginrpc.MethodCancel, pluginrpc.CancelParams{ID: 4})
+	m := p.next(t)
+	if m.ID == nil || *m.ID != 4 || m.Error == nil || m.Error.Code != pluginrpc.CodeCanceled {
+		t.Fatalf("canceled request = %+v, want the code %d of request 4", m, pluginrpc.CodeCanceled)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("canceled request took %v, want it answered right away", d)
+	}
+	// Request 3 is still pending until it is canceled too.
+	select {
+	case m := <-p.msgs:
+		t.Fatalf("unexpected message %+v, want request 3 still pending", m)
+	case <-time.After(100 * time.Millisecond):
+	}
+	p.send(t, 0, pluginrpc.MethodCancel, pluginrpc.CancelParams{ID: 3})
+	if m := p.next(t); m.ID == nil || *m.ID != 3 || m.Error == nil || m.Error.Code != pluginrpc.CodeCanceled {
+		t.Errorf("canceled request = %+v, want the code %d of request 3", m, pluginrpc.CodeCanceled)
+	}
+}
+
+func TestCrash(t *testing.T) {
+	path := pluginrpctest.FakePlugin(t)
+
+	t.Run("bad flag", func(t *testing.T) {
+		p := startPlugin(t, path, "--no_such_flag")
+		if m := p.next(t); m != nil {
+			t.Fatalf("message of a plugin failing to start = %+v, want none", m)
+		}
+		if err := <-p.err; !errors.Is(err, io.EOF) {
+			t.Errorf("read = %v, want %v", err, io.EOF)
+		}
+		if err := p.cmd.Wait(); err == nil || !strings.Contains(p.stderr.String(), "no_such_flag") {
+			t.Errorf("plugin exited with %v and stderr %q, want a failure about the flag", err, p.stderr.String())
+		}
+	})
+
+	t.Run("killed", func(t *testing.T) {
+		p := startPlugin(t, path, "--fake_latency=1m")
+		p.call(t, 1, pluginrpc.MethodHandshake, pluginrpc.HandshakeParams{ProtocolVersion: pluginrpc.Version}, nil)
+		p.call(t, 2, pluginrpc.MethodConfigure, pluginrpc.ConfigureParams{}, nil)
+		p.send(t, 3, pluginrpc.MethodPromotionGetClipDeals, pluginrpc.GetClipDealsParams{})
+		if err := p.cmd.Process.Kill(); err != nil {
+			t.Fatal(err)
+		}
+		// The pending request is never answered, the host sees stdout closed instead.
+		if m := p.next(t); m != nil {
+			t.Fatalf("message of a killed plugin = %+v, want none", m)
+		}
+		if err := <-p.err; !errors.Is(err, io.EOF) {
+			t.Errorf("read = %v, want %v", err, io.EOF)
+		}
+	})
+
+	t.Run("protocol error", func(t *testing.T) {
+		p := startPlugin(t, path)
+		if _, err := io.WriteString(p.stdin, "not json\n"); err != nil {
+			t.Fatal(err)
+		}
+		if m := p.next(t); m != nil {
+			t.Fatalf("message after a protocol error = %+v, want none", m)
+		}
+		if err := p.cmd.Wait(); err == nil || !strings.Contains(p.stderr.String(), "read message") {
+			t.Errorf("plugin exited with %v and stderr %q, want a failure reading the message", err, p.stderr.String())
+		}
+	})
+}
+
+func TestConn(t *testing.T) {
+	r, w := io.Pipe()
+	c := pluginrpc.NewConn(r, w)
+	id := int64(7)
+	go func() {
+		_ = c.Write(pluginrpc.Response(&id, pluginrpc.IsAuthenticatedResult{Authenticated: true}, nil))
+		_ = c.Write(pluginrpc.Response(&id, nil, &pluginrpc.Error{Code: pluginrpc.CodeClipLimitReached, Message: "limit"}))
+		_ = w.Close()
+	}()
+	m, err := c.Read()
+	if err != nil || m.JSONRPC != "2.0" || m.ID == nil || *m.ID != id || string(m.Result) != `{"authenticated":true}` {
+		t.Errorf("Read() = %+v, %v, want the result of request %d", m, err, id)
+	}
+	m, err = c.Read()
+	if err != nil || m.Result != nil || m.Error == nil || m.Error.Code != pluginrpc.CodeClipLimitReached {
+		t.Errorf("Read() = %+v, %v, want the error of request %d", m, err, id)
+	}
+	if _, err := c.Read(); !errors.Is(err, io.EOF) {
+		t.Errorf("Read() of a closed connection = %v, want %v", err, io.EOF)
+	}
+}
@@ -0,0 +1,25 @@
+// Package pluginrpctest builds the fake plugin, to test both sides of the plugin protocol against a
+// real process.
+package pluginrpctest
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// FakePlugin builds cmd/supermarket-fake-plugin into a temporary directory of the test and returns
+// the path of the executable. The test is skipped without a go command.
+func FakePlugin(t testing.TB) string {
+	t.Helper()
+	gocmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skipf("building the fake plugin needs the go command: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "fake-plugin")
+	out, err := exec.Command(gocmd, "build", "-o", path, "github.com/csobrinho/supermarket-api/cmd/supermarket-fake-plugin").CombinedOutput()
+	if err != nil {
+		t.Fatalf("building the fake plugin failed: %v\n%s", err, out)
+	}
+	return path
+}
@@ -0,0 +1,29 @@
+package promotion
+
+import (
+	"slices"
+	"strings"
+)
+
+// Matches reports whether the deal passes the search options. Categories are compared case
+// insensitively and the product id must be one of the UPCs of the deal.
+func (o PromotionSearchOptions) Matches(cd ClipDeal) bool {
+	if o.Type != nil && cd.Type != *o.Type {
+		return false
+	}
+	if o.Category != nil && !slices.ContainsFunc(cd.Categories, func(c string) bool { return strings.EqualFold(c, *o.Category) }) {
+		return false
+	}
+	if o.ProductID != nil && !slices.Contains(cd.Upcs, *o.ProductID) {
+		return false
+	}
+	if o.ClippedOnly != nil && *o.ClippedOnly && !cd.IsClipped {
+		return false
+	}
+	return true
+}
+
+// Filter returns the deals that pass the search options, for providers whose APIs can't filter.
+func Filter(cds []ClipDeal, opts PromotionSearchOptions) []ClipDeal {
+	return slices.DeleteFunc(cds, func(cd ClipDeal) bool { return !opts.Matches(cd) })
+}
@@ -2,9 +2,13 @@ package promotion
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
+// ErrClipLimitReached is returned when the account can't hold more clipped offers.
+var ErrClipLimitReached = errors.New("promotion: clip limit reached")
+
 // PromotionType represents the type of promotion.
 type PromotionType string
 
@@ -31,6 +35,7 @@ type Promotion struct {
 	MinPurchaseQuantity *float64      `json:"min_purchase_quantity,omitempty"`
 	MaxPurchaseQuantity *float64      `json:"max_purchase_quantity,omitempty"`
 	Price               *float64      `json:"price,omitempty"`
+	Discount            *Discount     `json:"discount,omitempty"`
 	PromoCode           *string       `json:"promo_code,omitempty"`
 	PromoType           *string       `json:"promo_type,omitempty"`
 	ProgramType         *string       `json:"program_type,omitempty"`
@@ -38,6 +43,8 @@ type Promotion struct {
 	UsageType           string        `json:"usage_type"`
 	StartDate           time.Time     `json:"start_date"`
 	EndDate             time.Time     `json:"end_date"`
+	PurchaseRank        *int          `json:"purchase_rank,omitempty"` // Rank in the purchase history, 1 is the most bought.
+	PreviouslyPurchased bool          `json:"previously_purchased"`    // Matches the purchase history.
 	IsDeleted           bool          `json:"is_deleted"`
 	IsClippable         bool          `json:"is_clippable"`   // For clip deals
 	IsDisplayable       bool          `json:"is_displayable"` // For clip deals
@@ -45,6 +52,12 @@ type Promotion struct {
 	Item                any           // Original item from provider.
 }
 
+// Discount represents the savings offered by a promotion.
+type Discount struct {
+	Amount  float64 `json:"amount,omitempty"`  // Savings in dollars.
+	Percent float64 `json:"percent,omitempty"` // Savings as a percentage of the regular price.
+}
+
 // ClipDeal represents a clippable coupon or deal.
 type ClipDeal struct {
 	Promotion
@@ -68,3 +81,9 @@ type Service interface {
 	// ClipDeal clips a deal for the current user.
 	ClipDeal(ctx context.Context, clipDeal ClipDeal) error
 }
+
+// Unclipper is implemented by services that can remove a clipped deal from the account.
+type Unclipper interface {
+	// UnclipDeal removes a clipped deal for the current user.
+	UnclipDeal(ctx context.Context, clipDeal ClipDeal) error
+}
@@ -0,0 +1,409 @@
+// Package scheduler runs jobs on cron schedules with jitter. A job never overlaps with itself: its
+// next run is scheduled when the previous one ends. The state of the jobs is persisted, so a run
+// missed while the process was down happens as soon as it starts again.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/fileutil"
+	"github.com/csobrinho/supermarket-api/internal/logging"
+	"github.com/robfig/cron/v3"
+)
+
+var log = logging.For("scheduler")
+
+var (
+	// ErrUnknownJob is returned for the names of jobs that weren't added.
+	ErrUnknownJob = errors.New("scheduler: unknown job")
+	// ErrRunning is returned by RunNow when the job is already running or waiting for its turn.
+	ErrRunning = errors.New("scheduler: job is running")
+)
+
+// stateVersion is bumped whenever the state format changes incompatibly.
+const stateVersion = 1
+
+// Job is a function run on a schedule.
+type Job struct {
+	Name string
+	// Schedule is a standard cron expression, e.g. "0 6 * * *", or a descriptor such as "@daily" or
+	// "@every 6h". It is in local time unless prefixed with CRON_TZ=<zone>.
+	Schedule string
+	// Jitter is the maximum random delay added to every run, so that runs don't hit the provider at
+	// the same time every day.
+	Jitter time.Duration
+	// Run runs the job. It can keep values across runs in the Values of the state.
+	Run func(ctx context.Context, st *JobState) error
+}
+
+// JobState is the persisted state of a job.
+type JobState struct {
+	LastStart time.Time `json:"last_start,omitzero"`
+	LastEnd   time.Time `json:"last_end,omitzero"`
+	LastError string    `json:"last_error,omitempty"` // Empty if the last run succeeded.
+	NextRun   time.Time `json:"next_run,omitzero"`
+	Runs      int       `json:"runs"`
+	Failures  int       `json:"failures"` // Consecutive failed runs.
+	Running   bool      `json:"-"`
+	// Values are kept across runs and restarts for the job, e.g. a rotated refresh token.
+	Values map[string]string `json:"values,omitempty"`
+}
+
+// state is the persisted state of the scheduler.
+type state struct {
+	Version int                  `json:"version"`
+	Jobs    map[string]*JobState `json:"jobs"`
+}
+
+// Scheduler runs jobs on their schedules.
+type Scheduler struct {
+	// Concurrency is the maximum number of jobs running at once, zero means unlimited. Due jobs wait
+	// for their turn.
+	Concurrency int
+
+	mu      sync.Mutex
+	path    string
+	state   state
+	jobs    []*job
+	sem     chan struct{}  // Turns of the runs, see Concurrency, once Run is called.
+	started sync.WaitGroup // Runs of Start.
+}
+
+type job struct {
+	Job
+	schedule cron.Schedule
+	running  sync.Mutex // Held while the job runs or waits for its turn.
+}
+
+// New returns a scheduler persisting its state to path, loading the state already there.
+func New(path string) (*Scheduler, error) {
+	s := &Scheduler{path: path, state: state{Version: stateVersion, Jobs: map[string]*JobState{}}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scheduler: read state %q, error %w", path, err)
+	}
+	if err := json.Unmarshal(b, &s.state); err != nil {
+		return nil, fmt.Errorf("scheduler: decode state %q, error %w", path, err)
+	}
+	if s.state.Version != stateVersion {
+		return nil, fmt.Errorf("scheduler: state %q has version %d, expected %d", path, s.state.Version, stateVersion)
+	}
+	if s.state.Jobs == nil {
+		s.state.Jobs = map[string]*JobState{}
+	}
+	return s, nil
+}
+
+// ParseSchedule parses a schedule, see Job.Schedule.
+func ParseSchedule(spec string) (cron.Schedule, error) {
+	sched, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("scheduler: invalid schedule %q, error %w", spec, err)
+	}
+	return sched, nil
+}
+
+// Add adds a job. It must be called before Run.
+func (s *Scheduler) Add(j Job) error {
+	if j.Name == "" || j.Run == nil {
+		return fmt.Errorf("scheduler: job %q needs a name and a function", j.Name)
+	}
+	if j.Jitter < 0 {
+		return fmt.Errorf("scheduler: job %q has a negative jitter %s", j.Name, j.Jitter)
+	}
+	sched, err := ParseSchedule(j.Schedule)
+	if err != nil {
+		return fmt.Errorf("scheduler: job %q, %w", j.Name, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, o := range s.jobs {
+		if o.Name == j.Name {
+			return fmt.Errorf("scheduler: duplicated job %q", j.Name)
+		}
+	}
+	s.jobs = append(s.jobs, &job{Job: j, schedule: sched})
+	st, ok := s.state.Jobs[j.Name]
+	if !ok {
+		st = &JobState{}
+		s.state.Jobs[j.Name] = st
+	}
+	// A run missed while the process was down is kept, so it happens right away. A run further
+	// away than the schedule allows comes from an older schedule.
+	next := s.jobs[len(s.jobs)-1].next(time.Now())
+	if st.NextRun.IsZero() || st.NextRun.After(next) {
+		st.NextRun = next
+	}
+	return nil
+}
+
+// Jobs returns a copy of the state of the jobs, by name.
+func (s *Scheduler) Jobs() map[string]JobState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := make(map[string]JobState, len(s.jobs))
+	for _, j := range s.jobs {
+		st := *s.state.Jobs[j.Name]
+		st.Values = nil
+		ret[j.Name] = st
+	}
+	return ret
+}
+
+// Values returns a copy of the values of the job, see JobState.Values.
+func (s *Scheduler) Values(name string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.state.Jobs[name]
+	if !ok || s.job(name) == nil {
+		return nil, fmt.Errorf("%w %q", ErrUnknownJob, name)
+	}
+	ret := maps.Clone(st.Values)
+	if ret == nil {
+		ret = map[string]string{}
+	}
+	return ret, nil
+}
+
+// SetValues replaces the values of the job, e.g. changed by a use of the job off schedule, and
+// saves the state.
+func (s *Scheduler) SetValues(name string, values map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.state.Jobs[name]
+	if !ok || s.job(name) == nil {
+		return fmt.Errorf("%w %q", ErrUnknownJob, name)
+	}
+	st.Values = maps.Clone(values)
+	return s.save()
+}
+
+// RunNow runs the job right away, off schedule, and returns its error. The run is recorded as the
+// scheduled ones and the next run is scheduled after it.
+func (s *Scheduler) RunNow(ctx context.Context, name string) error {
+	j, err := s.lockJob(name)
+	if err != nil {
+		return err
+	}
+	defer j.running.Unlock()
+	return s.run(ctx, j)
+}
+
+// Start starts a run of the job off schedule, as RunNow, and returns once the job is running or
+// waiting for its turn, see Concurrency. The outcome of the run is logged and recorded in the
+// state, and Run waits for it to end.
+func (s *Scheduler) Start(ctx context.Context, name string) error {
+	j, err := s.lockJob(name)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	cur := s.state.Jobs[name]
+	cur.Running = true
+	sem := s.sem
+	s.mu.Unlock()
+	s.started.Go(func() {
+		defer j.running.Unlock()
+		if !acquire(ctx, sem) {
+			s.mu.Lock()
+			cur.Running = false
+			s.mu.Unlock()
+			return
+		}
+		defer release(sem)
+		_ = s.run(ctx, j)
+	})
+	return nil
+}
+
+// lockJob returns the job with the name, with its running lock held.
+func (s *Scheduler) lockJob(name string) (*job, error) {
+	s.mu.Lock()
+	j := s.job(name)
+	s.mu.Unlock()
+	if j == nil {
+		return nil, fmt.Errorf("%w %q", ErrUnknownJob, name)
+	}
+	if !j.running.TryLock() {
+		return nil, fmt.Errorf("%w %q", ErrRunning, name)
+	}
+	return j, nil
+}
+
+// job returns the job with the name, or nil. It must be called with the lock held.
+func (s *Scheduler) job(name string) *job {
+	for _, j := range s.jobs {
+		if j.Name == name {
+			return j
+		}
+	}
+	return nil
+}
+
+// Run runs the jobs on their schedules until ctx is done, then waits for the running jobs, whose
+// context is done too, to return.
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.mu.Lock()
+	err := s.save()
+	if s.Concurrency > 0 {
+		s.sem = make(chan struct{}, s.Concurrency)
+	}
+	sem := s.sem
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	wg := sync.WaitGroup{}
+	for _, j := range s.jobs {
+		wg.Go(func() { s.loop(ctx, j, sem) })
+	}
+	wg.Wait()
+	s.started.Wait()
+	return nil
+}
+
+func (s *Scheduler) loop(ctx context.Context, j *job, sem chan struct{}) {
+	for {
+		s.mu.Lock()
+		next := s.state.Jobs[j.Name].NextRun
+		s.mu.Unlock()
+		log.Info("next run", "job", j.Name, "at", next)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if !s.runScheduled(ctx, j, next, sem) {
+			return
+		}
+	}
+}
+
+// runScheduled runs the job due at next once it is its turn, unless it ran off schedule in the
+// meantime. It returns false if ctx is done.
+func (s *Scheduler) runScheduled(ctx context.Context, j *job, next time.Time, sem chan struct{}) bool {
+	j.running.Lock()
+	defer j.running.Unlock()
+	s.mu.Lock()
+	rescheduled := s.state.Jobs[j.Name].NextRun.After(next)
+	s.mu.Unlock()
+	if rescheduled {
+		return true
+	}
+	if !acquire(ctx, sem) {
+		return false
+	}
+	defer release(sem)
+	// The outcome is logged and recorded in the state.
+	_ = s.run(ctx, j)
+	return ctx.Err() == nil
+}
+
+// acquire waits for a turn of sem, if not nil. It returns false if ctx is done first.
+func acquire(ctx context.Context, sem chan struct{}) bool {
+	if sem == nil {
+		return true
+	}
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release releases a turn of sem taken by acquire.
+func release(sem chan struct{}) {
+	if sem != nil {
+		<-sem
+	}
+}
+
+// run runs the job once and schedules its next run. It must be called with j.running held.
+func (s *Scheduler) run(ctx context.Context, j *job) error {
+	s.mu.Lock()
+	cur := s.state.Jobs[j.Name]
+	cur.Running = true
+	st := *cur
+	st.Values = maps.Clone(cur.Values)
+	if st.Values == nil {
+		st.Values = map[string]string{}
+	}
+	s.mu.Unlock()
+
+	start := time.Now()
+	log.Info("running job", "job", j.Name)
+	err := runSafely(ctx, j, &st)
+	end := time.Now()
+	if err != nil {
+		log.Error("job failed", "job", j.Name, logging.KeyDuration, end.Sub(start), logging.KeyError, err)
+	} else {
+		log.Info("job done", "job", j.Name, logging.KeyDuration, end.Sub(start))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur.Running = false
+	cur.Values = st.Values
+	cur.LastStart, cur.LastEnd = start, end
+	cur.Runs++
+	cur.LastError = ""
+	cur.Failures = 0
+	if err != nil {
+		cur.LastError = err.Error()
+		cur.Failures = st.Failures + 1
+	}
+	// Scheduling from the end of the run skips the runs it overlapped with.
+	if missed := j.schedule.Next(start); missed.Before(end) {
+		log.Warn("job overran its schedule, skipping the runs it overlapped", "job", j.Name, "missed", missed)
+	}
+	cur.NextRun = j.next(end)
+	if err := s.save(); err != nil {
+		log.Error("failed to save state", "path", s.path, logging.KeyError, err)
+	}
+	return err
+}
+
+// runSafely runs the job, turning a panic into an error so that the other jobs keep running.
+func runSafely(ctx context.Context, j *job, st *JobState) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("scheduler: job %q panicked, %v", j.Name, r)
+		}
+	}()
+	return j.Run(ctx, st)
+}
+
+// next returns the time of the first run after t, with jitter.
+func (j *job) next(t time.Time) time.Time {
+	next := j.schedule.Next(t)
+	if j.Jitter > 0 {
+		next = next.Add(rand.N(j.Jitter))
+	}
+	return next
+}
+
+// save atomically writes the state. It must be called with the lock held.
+func (s *Scheduler) save() error {
+	b, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("scheduler: encode state, error %w", err)
+	}
+	if err := fileutil.WriteAtomic(s.path, b); err != nil {
+		return fmt.Errorf("scheduler: save state, error %w", err)
+	}
+	return nil
+}
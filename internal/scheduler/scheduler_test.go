@@ -0,0 +1,282 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/scheduler"
+)
+
+// writeState writes the state of a job due at next.
+func writeState(t *testing.T, path, name string, next time.Time) {
+	t.Helper()
+	b := fmt.Appendf(nil, `{"version":1,"jobs":{%q:{"next_run":%q,"runs":3}}}`, name, next.Format(time.RFC3339Nano))
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newScheduler(t *testing.T, path string, jobs ...scheduler.Job) *scheduler.Scheduler {
+	t.Helper()
+	s, err := scheduler.New(path)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	for _, j := range jobs {
+		if err := s.Add(j); err != nil {
+			t.Fatalf("Add(%s) failed: %v", j.Name, err)
+		}
+	}
+	return s
+}
+
+// start runs the scheduler until the test ends, or the returned function is called.
+func start(t *testing.T, s *scheduler.Scheduler) (stop func()) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	stop = sync.OnceFunc(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run() failed: %v", err)
+		}
+	})
+	t.Cleanup(stop)
+	return stop
+}
+
+// wait waits for the condition, checked every few milliseconds.
+func wait(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestMissedRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	writeState(t, path, "clip", time.Now().Add(-time.Hour))
+	runs := atomic.Int32{}
+	s := newScheduler(t, path, scheduler.Job{Name: "clip", Schedule: "@every 1h", Run: func(ctx context.Context, st *scheduler.JobState) error {
+		runs.Add(1)
+		return nil
+	}})
+	stop := start(t, s)
+	// The run missed while the process was down happens right away.
+	wait(t, "the missed run", func() bool { return s.Jobs()["clip"].Runs == 4 })
+	stop()
+	st := s.Jobs()["clip"]
+	if runs.Load() != 1 || st.LastError != "" || st.Running {
+		t.Errorf("state = %+v after %d run(s), want a single successful run", st, runs.Load())
+	}
+	if d := time.Until(st.NextRun); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("next run in %v, want in an hour", d)
+	}
+}
+
+func TestOlderSchedule(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	// The state comes from a weekly schedule, the next run moves to the one of the daily schedule.
+	writeState(t, path, "clip", time.Now().Add(6*24*time.Hour))
+	s := newScheduler(t, path, scheduler.Job{Name: "clip", Schedule: "@daily", Run: func(context.Context, *scheduler.JobState) error { return nil }})
+	if d := time.Until(s.Jobs()["clip"].NextRun); d > 24*time.Hour {
+		t.Errorf("next run in %v, want within a day", d)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	const jitter = 10 * time.Minute
+	s, err := scheduler.New(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	now := time.Now()
+	for i := range 20 {
+		name := fmt.Sprintf("job%d", i)
+		if err := s.Add(scheduler.Job{Name: name, Schedule: "@every 1h", Jitter: jitter, Run: func(context.Context, *scheduler.JobState) error { return nil }}); err != nil {
+			t.Fatalf("Add(%s) failed: %v", name, err)
+		}
+	}
+	seen := map[time.Time]bool{}
+	for name, st := range s.Jobs() {
+		if min, max := now.Add(time.Hour), time.Now().Add(time.Hour+jitter); st.NextRun.Before(min) || st.NextRun.After(max) {
+			t.Errorf("%s next run = %v, want between %v and %v", name, st.NextRun, min, max)
+		}
+		seen[st.NextRun] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("next runs = %v, want them spread by the jitter", seen)
+	}
+	if err := s.Add(scheduler.Job{Name: "negative", Schedule: "@daily", Jitter: -time.Minute, Run: func(context.Context, *scheduler.JobState) error { return nil }}); err == nil {
+		t.Error("Add() with a negative jitter succeeded, want an error")
+	}
+}
+
+func TestRunNow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	writeState(t, path, "clip", time.Now().Add(-time.Minute))
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	runs := atomic.Int32{}
+	s := newScheduler(t, path, scheduler.Job{Name: "clip", Schedule: "@every 1h", Run: func(ctx context.Context, st *scheduler.JobState) error {
+		runs.Add(1)
+		started <- struct{}{}
+		<-release
+		return nil
+	}})
+	if err := s.RunNow(t.Context(), "missing"); !errors.Is(err, scheduler.ErrUnknownJob) {
+		t.Errorf("RunNow(missing) = %v, want %v", err, scheduler.ErrUnknownJob)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.RunNow(t.Context(), "clip") }()
+	<-started
+	if !s.Jobs()["clip"].Running {
+		t.Error("Jobs() while running = not running, want running")
+	}
+	if err := s.RunNow(t.Context(), "clip"); !errors.Is(err, scheduler.ErrRunning) {
+		t.Errorf("RunNow() while running = %v, want %v", err, scheduler.ErrRunning)
+	}
+	// The scheduled run, already due, waits for the run off schedule and is then skipped.
+	stop := start(t, s)
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("RunNow() failed: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	stop()
+	st := s.Jobs()["clip"]
+	if runs.Load() != 1 || st.Runs != 4 || st.Running {
+		t.Errorf("state = %+v after %d run(s), want a single run", st, runs.Load())
+	}
+	if d := time.Until(st.NextRun); d < 59*time.Minute {
+		t.Errorf("next run in %v, want in an hour", d)
+	}
+}
+
+func TestStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	job := func(name string) scheduler.Job {
+		return scheduler.Job{Name: name, Schedule: "@every 1h", Run: func(ctx context.Context, st *scheduler.JobState) error {
+			started <- struct{}{}
+			<-release
+			return ctx.Err()
+		}}
+	}
+	s := newScheduler(t, path, job("a"), job("b"))
+	s.Concurrency = 1
+	if err := s.Start(t.Context(), "missing"); !errors.Is(err, scheduler.ErrUnknownJob) {
+		t.Errorf("Start(missing) = %v, want %v", err, scheduler.ErrUnknownJob)
+	}
+	stop := start(t, s)
+	// The turns of the runs exist once Run saved the state.
+	wait(t, "the state to be saved", func() bool { _, err := os.Stat(path); return err == nil })
+
+	// Start returns while the job runs, and is recorded as running right away.
+	if err := s.Start(t.Context(), "a"); err != nil {
+		t.Fatalf("Start(a) failed: %v", err)
+	}
+	if !s.Jobs()["a"].Running {
+		t.Error("Jobs() after Start() = not running, want running")
+	}
+	if err := s.Start(t.Context(), "a"); !errors.Is(err, scheduler.ErrRunning) {
+		t.Errorf("Start() while running = %v, want %v", err, scheduler.ErrRunning)
+	}
+	<-started
+	// The other job waits for its turn.
+	if err := s.Start(t.Context(), "b"); err != nil || !s.Jobs()["b"].Running {
+		t.Errorf("Start(b) = %v, running %v, want it waiting for its turn", err, s.Jobs()["b"].Running)
+	}
+	select {
+	case <-started:
+		t.Error("Start(b) ran while a was running, want it to wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-started
+	wait(t, "both runs", func() bool {
+		jobs := s.Jobs()
+		return jobs["a"].Runs == 1 && jobs["b"].Runs == 1 && !jobs["a"].Running && !jobs["b"].Running
+	})
+	stop()
+}
+
+func TestSaveReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	job := scheduler.Job{Name: "clip", Schedule: "@daily", Run: func(ctx context.Context, st *scheduler.JobState) error {
+		st.Values["refresh_token"] = fmt.Sprintf("rt-%d", st.Runs)
+		if st.Runs == 1 {
+			panic("boom")
+		}
+		return errors.New("provider down")
+	}}
+	s := newScheduler(t, path, job)
+	for range 2 {
+		if err := s.RunNow(t.Context(), "clip"); err == nil {
+			t.Fatal("RunNow() succeeded, want the error of the job")
+		}
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("state file = %v, %v, want it private", fi, err)
+	}
+
+	s = newScheduler(t, path, job)
+	st := s.Jobs()["clip"]
+	if st.Runs != 2 || st.Failures != 2 || st.LastError != `scheduler: job "clip" panicked, boom` || st.LastStart.IsZero() || st.LastEnd.Before(st.LastStart) {
+		t.Errorf("reloaded state = %+v, want 2 failed runs, the last one panicking", st)
+	}
+	values, err := s.Values("clip")
+	if err != nil || values["refresh_token"] != "rt-1" {
+		t.Errorf("Values() = %v, %v, want the refresh token of the last run", values, err)
+	}
+	if err := s.SetValues("clip", map[string]string{"refresh_token": "rt-api"}); err != nil {
+		t.Fatalf("SetValues() failed: %v", err)
+	}
+	if values, err := newScheduler(t, path, job).Values("clip"); err != nil || values["refresh_token"] != "rt-api" {
+		t.Errorf("Values() after SetValues() = %v, %v, want rt-api", values, err)
+	}
+	if _, err := s.Values("missing"); !errors.Is(err, scheduler.ErrUnknownJob) {
+		t.Errorf("Values(missing) = %v, want %v", err, scheduler.ErrUnknownJob)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"malformed": "{", "newer": `{"version":2,"jobs":{}}`} {
+		path := filepath.Join(dir, name+".json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := scheduler.New(path); err == nil {
+			t.Errorf("New() of a %s state succeeded, want an error", name)
+		}
+	}
+	s := newScheduler(t, filepath.Join(dir, "state.json"))
+	noop := func(context.Context, *scheduler.JobState) error { return nil }
+	for _, j := range []scheduler.Job{
+		{Name: "", Schedule: "@daily", Run: noop},
+		{Name: "nil", Schedule: "@daily"},
+		{Name: "invalid", Schedule: "every day", Run: noop},
+	} {
+		if err := s.Add(j); err == nil {
+			t.Errorf("Add(%q, %q) succeeded, want an error", j.Name, j.Schedule)
+		}
+	}
+	if err := s.Add(scheduler.Job{Name: "clip", Schedule: "@daily", Run: noop}); err != nil {
+		t.Fatalf("Add() failed: %v", err)
+	}
+	if err := s.Add(scheduler.Job{Name: "clip", Schedule: "@hourly", Run: noop}); err == nil {
+		t.Error("Add() of a duplicated job succeeded, want an error")
+	}
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+)
+
+// Change is a field that changed between two snapshots.
+type Change struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+// DealChange is a deal present in both snapshots with different values.
+type DealChange struct {
+	Deal    promotion.ClipDeal `json:"deal"`
+	Changes []Change           `json:"changes"`
+}
+
+// Diff lists the differences between two snapshots of the same source.
+type Diff struct {
+	From    time.Time            `json:"from"`
+	To      time.Time            `json:"to"`
+	New     []promotion.ClipDeal `json:"new"`
+	Removed []promotion.ClipDeal `json:"removed"`
+	Changed []DealChange         `json:"changed"`
+	Expired []promotion.ClipDeal `json:"expired"` // Deals whose end date passed between the snapshots.
+}
+
+// Empty reports whether the snapshots have no differences.
+func (d *Diff) Empty() bool {
+	return len(d.New) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 && len(d.Expired) == 0
+}
+
+// DiffSnapshots compares two snapshots. Deals are matched by ID and each list is sorted by ID.
+func DiffSnapshots(prev, cur *Snapshot) *Diff {
+	d := &Diff{From: prev.Time, To: cur.Time}
+	old := make(map[string]promotion.ClipDeal, len(prev.Deals))
+	for _, cd := range prev.Deals {
+		old[cd.ID] = cd
+	}
+	expired := func(cd promotion.ClipDeal) bool {
+		return !cd.EndDate.IsZero() && cd.EndDate.After(prev.Time) && !cd.EndDate.After(cur.Time)
+	}
+
+	seen := make(map[string]bool, len(cur.Deals))
+	for _, cd := range cur.Deals {
+		seen[cd.ID] = true
+		o, ok := old[cd.ID]
+		switch {
+		case !ok:
+			d.New = append(d.New, cd)
+		case expired(cd):
+			d.Expired = append(d.Expired, cd)
+		default:
+			if changes := compareDeals(o, cd); len(changes) > 0 {
+				d.Changed = append(d.Changed, DealChange{Deal: cd, Changes: changes})
+			}
+		}
+	}
+	for _, cd := range prev.Deals {
+		if seen[cd.ID] {
+			continue
+		}
+		if expired(cd) {
+			d.Expired = append(d.Expired, cd)
+		} else {
+			d.Removed = append(d.Removed, cd)
+		}
+	}
+
+	byID := func(a, b promotion.ClipDeal) int { return cmp.Compare(a.ID, b.ID) }
+	slices.SortFunc(d.New, byID)
+	slices.SortFunc(d.Removed, byID)
+	slices.SortFunc(d.Expired, byID)
+	slices.SortFunc(d.Changed, func(a, b DealChange) int { return byID(a.Deal, b.Deal) })
+	return d
+}
+
+// compareDeals returns the tracked fields that differ between two versions of a deal.
+func compareDeals(a, b promotion.ClipDeal) []Change {
+	var changes []Change
+	add := func(field string, o, n any) {
+		if o != n {
+			changes = append(changes, Change{Field: field, Old: o, New: n})
+		}
+	}
+	addTime := func(field string, o, n time.Time) {
+		if !o.Equal(n) {
+			changes = append(changes, Change{Field: field, Old: o, New: n})
+		}
+	}
+	add("price", deref(a.Price), deref(b.Price))
+	add("discount", discountAmount(a.Discount), discountAmount(b.Discount))
+	add("description", a.Description, b.Description)
+	add("status", a.Status, b.Status)
+	add("is_clipped", a.IsClipped, b.IsClipped)
+	add("is_clippable", a.IsClippable, b.IsClippable)
+	add("is_deleted", a.IsDeleted, b.IsDeleted)
+	addTime("start_date", a.StartDate, b.StartDate)
+	addTime("end_date", a.EndDate, b.EndDate)
+	return changes
+}
+
+func deref(f *float64) float64 {
+	if f == nil {
+		return 0
+	}
+	return *f
+}
+
+func discountAmount(d *promotion.Discount) float64 {
+	if d == nil {
+		return 0
+	}
+	return d.Amount
+}
+
+func discountPercent(d *promotion.Discount) float64 {
+	if d == nil {
+		return 0
+	}
+	return d.Percent
+}
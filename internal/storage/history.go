@@ -0,0 +1,321 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/pkg/expr"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	dealsBucket      = []byte("deals")
+	upcsBucket       = []byte("upcs")
+	categoriesBucket = []byte("categories")
+	clipsBucket      = []byte("clips")
+)
+
+// DealRecord is the history of a deal across all snapshots.
+type DealRecord struct {
+	Provider    string    `json:"provider"`
+	ID          string    `json:"id"`
+	Brand       string    `json:"brand"`
+	Description string    `json:"description"`
+	Categories  []string  `json:"categories"`
+	Upcs        []string  `json:"upcs"`
+	Price       float64   `json:"price"`
+	Discount    float64   `json:"discount"` // Savings in dollars.
+	Percent     float64   `json:"percent"`  // Savings as a percentage of the regular price.
+	StartDate   time.Time `json:"start_date"`
+	EndDate     time.Time `json:"end_date"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	Sightings   int       `json:"sightings"` // Number of snapshots that included the deal.
+	Clipped     bool      `json:"clipped"`
+}
+
+// UPCRecord lists the deals that included a product.
+type UPCRecord struct {
+	UPC       string    `json:"upc"`
+	Deals     []string  `json:"deals"` // Deal keys, provider/id.
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// CategoryStats aggregates the deals of a category.
+type CategoryStats struct {
+	Category        string  `json:"category"`
+	Deals           int     `json:"deals"`
+	AverageDiscount float64 `json:"average_discount"` // Of the deals with savings in dollars.
+	AveragePercent  float64 `json:"average_percent"`  // Of the deals with savings as a percentage.
+}
+
+// categoryRecord keeps the discount of every deal of a category, so re-indexing a deal doesn't
+// count it twice.
+type categoryRecord struct {
+	Discounts map[string]promotion.Discount `json:"discounts"`
+}
+
+// ClipEvent records an attempt to clip a deal.
+type ClipEvent struct {
+	Time     time.Time     `json:"time"`
+	Provider string        `json:"provider"`
+	Account  string        `json:"account"`
+	DealID   string        `json:"deal_id"`
+	Brand    string        `json:"brand"`
+	Success  bool          `json:"success"`
+	Error    string        `json:"error,omitempty"`
+	Latency  time.Duration `json:"latency"`
+}
+
+func dealKey(provider, id string) []byte { return []byte(provider + "/" + id) }
+
+// indexSnapshot updates the deal, UPC and category history with a snapshot.
+func indexSnapshot(tx *bolt.Tx, s *Snapshot) error {
+	deals, upcs, categories := tx.Bucket(dealsBucket), tx.Bucket(upcsBucket), tx.Bucket(categoriesBucket)
+	for _, cd := range s.Deals {
+		key := dealKey(s.Provider, cd.ID)
+		r := &DealRecord{}
+		if err := get(deals, key, r); err != nil {
+			return err
+		}
+		if r.FirstSeen.IsZero() || s.Time.Before(r.FirstSeen) {
+			r.FirstSeen = s.Time
+		}
+		if !s.Time.Before(r.LastSeen) {
+			r.LastSeen = s.Time
+			r.Provider, r.ID, r.Brand, r.Description = s.Provider, cd.ID, cd.Brand, cd.Description
+			r.Categories, r.Upcs = cd.Categories, cd.Upcs
+			r.Price, r.Discount, r.Percent = deref(cd.Price), discountAmount(cd.Discount), discountPercent(cd.Discount)
+			r.StartDate, r.EndDate = cd.StartDate, cd.EndDate
+		}
+		r.Clipped = r.Clipped || cd.IsClipped
+		r.Sightings++
+		if err := put(deals, key, r); err != nil {
+			return err
+		}
+
+		for _, upc := range cd.Upcs {
+			u := &UPCRecord{UPC: upc}
+			if err := get(upcs, []byte(upc), u); err != nil {
+				return err
+			}
+			if !slices.Contains(u.Deals, string(key)) {
+				u.Deals = append(u.Deals, string(key))
+			}
+			if u.FirstSeen.IsZero() || s.Time.Before(u.FirstSeen) {
+				u.FirstSeen = s.Time
+			}
+			u.LastSeen = later(u.LastSeen, s.Time)
+			if err := put(upcs, []byte(upc), u); err != nil {
+				return err
+			}
+		}
+
+		for _, c := range cd.Categories {
+			cr := &categoryRecord{Discounts: map[string]promotion.Discount{}}
+			if err := get(categories, []byte(c), cr); err != nil {
+				return err
+			}
+			cr.Discounts[string(key)] = promotion.Discount{Amount: r.Discount, Percent: r.Percent}
+			if err := put(categories, []byte(c), cr); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RecordClip appends a clip event to the history and marks the deal as clipped on success.
+func (d *DB) RecordClip(ev ClipEvent) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		key := append(timeKey(ev.Time), dealKey(ev.Provider, ev.DealID)...)
+		if err := put(tx.Bucket(clipsBucket), key, ev); err != nil {
+			return err
+		}
+		if !ev.Success {
+			return nil
+		}
+		deals := tx.Bucket(dealsBucket)
+		r := &DealRecord{}
+		if err := get(deals, dealKey(ev.Provider, ev.DealID), r); err != nil || r.ID == "" {
+			return err
+		}
+		r.Clipped = true
+		return put(deals, dealKey(ev.Provider, ev.DealID), r)
+	})
+}
+
+// Deals calls fn for every deal in the history until it returns false.
+func (d *DB) Deals(fn func(*DealRecord) bool) error {
+	return d.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(dealsBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			r := &DealRecord{}
+			if err := json.Unmarshal(v, r); err != nil {
+				return fmt.Errorf("storage: decode deal %q, error %w", k, err)
+			}
+			if !fn(r) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+// BrandHistory returns the deals of a brand, most recently seen first. Brands match case-insensitively.
+func (d *DB) BrandHistory(brand string) ([]DealRecord, error) {
+	var ret []DealRecord
+	err := d.Deals(func(r *DealRecord) bool {
+		if strings.EqualFold(r.Brand, brand) {
+			ret = append(ret, *r)
+		}
+		return true
+	})
+	sortByLastSeen(ret)
+	return ret, err
+}
+
+// UPCHistory returns the history of a product and its deals, most recently seen first.
+func (d *DB) UPCHistory(upc string) (*UPCRecord, []DealRecord, error) {
+	u := &UPCRecord{}
+	var ret []DealRecord
+	err := d.db.View(func(tx *bolt.Tx) error {
+		if err := get(tx.Bucket(upcsBucket), []byte(upc), u); err != nil {
+			return err
+		}
+		if u.UPC == "" {
+			return ErrNotFound
+		}
+		for _, key := range u.Deals {
+			r := &DealRecord{}
+			if err := get(tx.Bucket(dealsBucket), []byte(key), r); err != nil {
+				return err
+			}
+			ret = append(ret, *r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	sortByLastSeen(ret)
+	return u, ret, nil
+}
+
+// CategoryStats returns the number of deals and average discounts of every category, sorted by name.
+// Deals with only one kind of discount, e.g. 20% off, don't count towards the average of the other.
+func (d *DB) CategoryStats() ([]CategoryStats, error) {
+	var ret []CategoryStats
+	err := d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(categoriesBucket).ForEach(func(k, v []byte) error {
+			cr := &categoryRecord{}
+			if err := json.Unmarshal(v, cr); err != nil {
+				return fmt.Errorf("storage: decode category %q, error %w", k, err)
+			}
+			st := CategoryStats{Category: string(k), Deals: len(cr.Discounts)}
+			amounts, percents := 0, 0
+			for _, d := range cr.Discounts {
+				if d.Amount > 0 {
+					st.AverageDiscount += d.Amount
+					amounts++
+				}
+				if d.Percent > 0 {
+					st.AveragePercent += d.Percent
+					percents++
+				}
+			}
+			if amounts > 0 {
+				st.AverageDiscount /= float64(amounts)
+			}
+			if percents > 0 {
+				st.AveragePercent /= float64(percents)
+			}
+			ret = append(ret, st)
+			return nil
+		})
+	})
+	return ret, err
+}
+
+// ClipEvents returns the clip events recorded at or after since, oldest first.
+func (d *DB) ClipEvents(since time.Time) ([]ClipEvent, error) {
+	var ret []ClipEvent
+	err := d.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(clipsBucket).Cursor()
+		k, v := c.First()
+		if !since.IsZero() {
+			k, v = c.Seek(timeKey(since))
+		}
+		for ; k != nil; k, v = c.Next() {
+			ev := ClipEvent{}
+			if err := json.Unmarshal(v, &ev); err != nil {
+				return fmt.Errorf("storage: decode clip event %q, error %w", k, err)
+			}
+			ret = append(ret, ev)
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// QueryDeals returns the deals matching an expression compiled for DealRecord, most recently
+// seen first.
+func (d *DB) QueryDeals(p *expr.Program) ([]DealRecord, error) {
+	var ret []DealRecord
+	var qerr error
+	err := d.Deals(func(r *DealRecord) bool {
+		ok, err := p.Match(r)
+		if err != nil {
+			qerr = err
+			return false
+		}
+		if ok {
+			ret = append(ret, *r)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qerr != nil {
+		return nil, qerr
+	}
+	sortByLastSeen(ret)
+	return ret, nil
+}
+
+func sortByLastSeen(rs []DealRecord) {
+	slices.SortStableFunc(rs, func(a, b DealRecord) int { return b.LastSeen.Compare(a.LastSeen) })
+}
+
+// get decodes the JSON value of key into v, leaving v untouched if the key doesn't exist.
+func get(b *bolt.Bucket, key []byte, v any) error {
+	data := b.Get(key)
+	if data == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("storage: decode %q, error %w", key, err)
+	}
+	return nil
+}
+
+func put(b *bolt.Bucket, key []byte, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("storage: encode %q, error %w", key, err)
+	}
+	return b.Put(key, data)
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/csobrinho/supermarket-api/internal/logging"
+	bolt "go.etcd.io/bbolt"
+)
+
+var log = logging.For("storage")
+
+var (
+	metaBucket       = []byte("meta")
+	schemaVersionKey = []byte("schema_version")
+)
+
+// migration upgrades the database schema by one version.
+type migration struct {
+	name string
+	up   func(tx *bolt.Tx) error
+}
+
+// migrations are applied in order, the schema version is the number of applied migrations.
+// Never reorder or remove entries, only append.
+var migrations = []migration{
+	{
+		name: "create history buckets",
+		up: func(tx *bolt.Tx) error {
+			for _, b := range [][]byte{snapshotsBucket, dealsBucket, upcsBucket, categoriesBucket, clipsBucket} {
+				if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		name: "backfill history from snapshots",
+		up: func(tx *bolt.Tx) error {
+			return tx.Bucket(snapshotsBucket).ForEachBucket(func(name []byte) error {
+				return tx.Bucket(snapshotsBucket).Bucket(name).ForEach(func(_, v []byte) error {
+					s, err := decodeSnapshot(v)
+					if err != nil {
+						return err
+					}
+					return indexSnapshot(tx, s)
+				})
+			})
+		},
+	},
+}
+
+// migrate applies all pending migrations, each in its own transaction.
+func (d *DB) migrate() error {
+	for {
+		done, err := d.migrateOnce()
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+func (d *DB) migrateOnce() (bool, error) {
+	done := false
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		version := schemaVersion(meta)
+		if version > len(migrations) {
+			return fmt.Errorf("storage: schema version %d is newer than the supported version %d", version, len(migrations))
+		}
+		if version == len(migrations) {
+			done = true
+			return nil
+		}
+		m := migrations[version]
+		log.Info("migrating schema", "version", version+1, "migration", m.name)
+		if err := m.up(tx); err != nil {
+			return fmt.Errorf("storage: migration %d (%s), error %w", version+1, m.name, err)
+		}
+		return meta.Put(schemaVersionKey, binary.BigEndian.AppendUint32(nil, uint32(version+1)))
+	})
+	return done, err
+}
+
+func schemaVersion(meta *bolt.Bucket) int {
+	v := meta.Get(schemaVersionKey)
+	if len(v) != 4 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(v))
+}
+
+// SchemaVersion returns the current schema version of the database.
+func (d *DB) SchemaVersion() (int, error) {
+	version := 0
+	err := d.db.View(func(tx *bolt.Tx) error {
+		if meta := tx.Bucket(metaBucket); meta != nil {
+			version = schemaVersion(meta)
+		}
+		return nil
+	})
+	return version, err
+}
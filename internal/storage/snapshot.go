@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	bolt "go.etcd.io/bbolt"
+)
+
+var snapshotsBucket = []byte("snapshots")
+
+// ErrNotFound is returned when no snapshot matches a query.
+var ErrNotFound = errors.New("storage: snapshot not found")
+
+// Source identifies where deals were fetched from.
+type Source struct {
+	Provider string `json:"provider"`
+	Account  string `json:"account"`
+	Store    string `json:"store"`
+}
+
+func (s Source) String() string { return s.Provider + "/" + s.Account + "/" + s.Store }
+
+// Snapshot is the result of a single GetClipDeals call.
+type Snapshot struct {
+	Source
+	Time  time.Time            `json:"time"`
+	Deals []promotion.ClipDeal `json:"deals"`
+}
+
+// SaveSnapshot stores a snapshot and adds its deals to the history. A snapshot taken at the same
+// time for the same source is replaced without updating the history again.
+func (d *DB) SaveSnapshot(s *Snapshot) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(s); err != nil {
+		return fmt.Errorf("storage: encode snapshot %s, error %w", s.Source, err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("storage: compress snapshot %s, error %w", s.Source, err)
+	}
+	return d.db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists(snapshotsBucket)
+		if err != nil {
+			return err
+		}
+		b, err := root.CreateBucketIfNotExists([]byte(s.Source.String()))
+		if err != nil {
+			return err
+		}
+		key := timeKey(s.Time)
+		exists := b.Get(key) != nil
+		if err := b.Put(key, buf.Bytes()); err != nil || exists {
+			return err
+		}
+		return indexSnapshot(tx, s)
+	})
+}
+
+// SnapshotTimes returns the times of all snapshots of a source, oldest first.
+func (d *DB) SnapshotTimes(src Source) ([]time.Time, error) {
+	var ret []time.Time
+	err := d.db.View(func(tx *bolt.Tx) error {
+		b := snapshots(tx, src)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, _ []byte) error {
+			ret = append(ret, keyTime(k))
+			return nil
+		})
+	})
+	return ret, err
+}
+
+// SnapshotAt returns the latest snapshot of a source taken at or before t.
+func (d *DB) SnapshotAt(src Source, t time.Time) (*Snapshot, error) {
+	return d.seek(src, t)
+}
+
+// PreviousSnapshot returns the latest snapshot of a source taken strictly before t.
+func (d *DB) PreviousSnapshot(src Source, t time.Time) (*Snapshot, error) {
+	return d.seek(src, t.Add(-time.Nanosecond))
+}
+
+// LatestSnapshot returns the most recent snapshot of a source.
+func (d *DB) LatestSnapshot(src Source) (*Snapshot, error) {
+	return d.seek(src, time.Unix(0, 1<<63-1))
+}
+
+func (d *DB) seek(src Source, t time.Time) (*Snapshot, error) {
+	var ret *Snapshot
+	err := d.db.View(func(tx *bolt.Tx) error {
+		b := snapshots(tx, src)
+		if b == nil {
+			return ErrNotFound
+		}
+		c := b.Cursor()
+		want := timeKey(t)
+		k, v := c.Seek(want)
+		if k == nil || !bytes.Equal(k, want) {
+			// Seek lands on the first key after t, step back to the one before it.
+			if k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+		}
+		if k == nil {
+			return ErrNotFound
+		}
+		s, err := decodeSnapshot(v)
+		if err != nil {
+			return err
+		}
+		ret = s
+		return nil
+	})
+	return ret, err
+}
+
+func snapshots(tx *bolt.Tx, src Source) *bolt.Bucket {
+	root := tx.Bucket(snapshotsBucket)
+	if root == nil {
+		return nil
+	}
+	return root.Bucket([]byte(src.String()))
+}
+
+func decodeSnapshot(v []byte) (*Snapshot, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(v))
+	if err != nil {
+		return nil, fmt.Errorf("storage: decompress snapshot, error %w", err)
+	}
+	defer zr.Close()
+	s := &Snapshot{}
+	if err := json.NewDecoder(zr).Decode(s); err != nil {
+		return nil, fmt.Errorf("storage: decode snapshot, error %w", err)
+	}
+	return s, nil
+}
+
+// timeKey encodes a time as a big endian key so snapshots are sorted chronologically.
+func timeKey(t time.Time) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(t.UnixNano()))
+}
+
+func keyTime(k []byte) time.Time { return time.Unix(0, int64(binary.BigEndian.Uint64(k))) }
@@ -0,0 +1,31 @@
+// Package storage persists deal snapshots and their history in an embedded key/value file.
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// DB is a local database of deal snapshots and history.
+type DB struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the database at path.
+func Open(path string) (*DB, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("storage: open %q, error %w", path, err)
+	}
+	d := &DB{db: db}
+	if err := d.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// Close closes the database.
+func (d *DB) Close() error { return d.db.Close() }
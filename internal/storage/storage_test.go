@@ -0,0 +1,315 @@
+package storage_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/internal/storage"
+	"github.com/csobrinho/supermarket-api/pkg/expr"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	src = storage.Source{Provider: "safeway", Account: "me", Store: "1234"}
+	t0  = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func open(t *testing.T, path string) *storage.DB {
+	t.Helper()
+	db, err := storage.Open(path)
+	if err != nil {
+		t.Fatalf("Open(%q) failed: %v", path, err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func deal(id, brand string, amount float64, end time.Time) promotion.ClipDeal {
+	return promotion.ClipDeal{Promotion: promotion.Promotion{
+		ID:          id,
+		Brand:       brand,
+		Description: "$ off " + brand,
+		Upcs:        []string{"000" + id},
+		Categories:  []string{"Dairy"},
+		EndDate:     end,
+		IsClippable: true,
+		Discount:    &promotion.Discount{Amount: amount},
+	}}
+}
+
+func snapshot(at time.Time, deals ...promotion.ClipDeal) *storage.Snapshot {
+	return &storage.Snapshot{Source: src, Time: at, Deals: deals}
+}
+
+func TestSnapshotSeek(t *testing.T) {
+	db := open(t, filepath.Join(t.TempDir(), "deals.db"))
+	times := []time.Time{t0, t0.Add(time.Hour), t0.Add(2 * time.Hour)}
+	for i, at := range times {
+		if err := db.SaveSnapshot(snapshot(at, deal("1", "Lucerne", float64(i+1), t0.AddDate(0, 0, 7)))); err != nil {
+			t.Fatalf("SaveSnapshot(%v) failed: %v", at, err)
+		}
+	}
+
+	got, err := db.SnapshotTimes(src)
+	if err != nil || len(got) != len(times) {
+		t.Fatalf("SnapshotTimes() = %v, %v, want %v", got, err, times)
+	}
+	for i := range got {
+		if !got[i].Equal(times[i]) {
+			t.Errorf("SnapshotTimes()[%d] = %v, want %v", i, got[i], times[i])
+		}
+	}
+
+	tests := []struct {
+		name string
+		seek func() (*storage.Snapshot, error)
+		want time.Time // Zero if no snapshot is found.
+	}{
+		{"SnapshotAt(exact)", func() (*storage.Snapshot, error) { return db.SnapshotAt(src, times[1]) }, times[1]},
+		{"SnapshotAt(between)", func() (*storage.Snapshot, error) { return db.SnapshotAt(src, times[1].Add(time.Minute)) }, times[1]},
+		{"SnapshotAt(after)", func() (*storage.Snapshot, error) { return db.SnapshotAt(src, times[2].Add(time.Hour)) }, times[2]},
+		{"SnapshotAt(before)", func() (*storage.Snapshot, error) { return db.SnapshotAt(src, t0.Add(-time.Second)) }, time.Time{}},
+		{"PreviousSnapshot(exact)", func() (*storage.Snapshot, error) { return db.PreviousSnapshot(src, times[1]) }, times[0]},
+		{"PreviousSnapshot(first)", func() (*storage.Snapshot, error) { return db.PreviousSnapshot(src, times[0]) }, time.Time{}},
+		{"LatestSnapshot", func() (*storage.Snapshot, error) { return db.LatestSnapshot(src) }, times[2]},
+		{"LatestSnapshot(other source)", func() (*storage.Snapshot, error) {
+			return db.LatestSnapshot(storage.Source{Provider: "safeway", Account: "other", Store: "1234"})
+		}, time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := tt.seek()
+		if tt.want.IsZero() {
+			if !errors.Is(err, storage.ErrNotFound) {
+				t.Errorf("%s = %v, %v, want ErrNotFound", tt.name, s, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s failed: %v", tt.name, err)
+			continue
+		}
+		if !s.Time.Equal(tt.want) || s.Source != src || len(s.Deals) != 1 {
+			t.Errorf("%s = snapshot of %s at %v with %d deals, want the one at %v", tt.name, s.Source, s.Time, len(s.Deals), tt.want)
+		}
+	}
+}
+
+// Saving a snapshot again replaces it without counting its deals twice in the history.
+func TestSaveSnapshotReplace(t *testing.T) {
+	db := open(t, filepath.Join(t.TempDir(), "deals.db"))
+	for _, amount := range []float64{1, 2} {
+		if err := db.SaveSnapshot(snapshot(t0, deal("1", "Lucerne", amount, t0.AddDate(0, 0, 7)))); err != nil {
+			t.Fatalf("SaveSnapshot() failed: %v", err)
+		}
+	}
+	s, err := db.LatestSnapshot(src)
+	if err != nil {
+		t.Fatalf("LatestSnapshot() failed: %v", err)
+	}
+	if got := s.Deals[0].Discount.Amount; got != 2 {
+		t.Errorf("LatestSnapshot() discount = %v, want 2", got)
+	}
+	rs, err := db.BrandHistory("lucerne")
+	if err != nil || len(rs) != 1 || rs[0].Sightings != 1 {
+		t.Errorf("BrandHistory() = %+v, %v, want 1 deal seen once", rs, err)
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	from, to := t0, t0.AddDate(0, 0, 1)
+	later := t0.AddDate(0, 0, 7)
+	soon := t0.Add(6 * time.Hour) // Ends between the snapshots.
+
+	kept := deal("kept", "Lucerne", 1, later)
+	changed := deal("changed", "Tide", 1, later)
+	changedTo := changed
+	changedTo.Discount = &promotion.Discount{Amount: 2}
+	changedTo.IsClipped = true
+	changedTo.Price = ptr(3.5)
+	removed := deal("removed", "Dove", 1, later)
+	added := deal("added", "Barilla", 1, later)
+	expired := deal("expired", "Kellogg's", 1, soon)
+	expiredGone := deal("expired-gone", "Tillamook", 1, soon)
+
+	d := storage.DiffSnapshots(snapshot(from, kept, changed, removed, expired, expiredGone), snapshot(to, kept, changedTo, added, expired))
+	ids := func(cds []promotion.ClipDeal) string {
+		var ret []string
+		for _, cd := range cds {
+			ret = append(ret, cd.ID)
+		}
+		return strings.Join(ret, ",")
+	}
+	if !d.From.Equal(from) || !d.To.Equal(to) {
+		t.Errorf("DiffSnapshots() = from %v to %v, want from %v to %v", d.From, d.To, from, to)
+	}
+	if got := ids(d.New); got != "added" {
+		t.Errorf("DiffSnapshots() new = %q, want added", got)
+	}
+	if got := ids(d.Removed); got != "removed" {
+		t.Errorf("DiffSnapshots() removed = %q, want removed", got)
+	}
+	if got := ids(d.Expired); got != "expired,expired-gone" {
+		t.Errorf("DiffSnapshots() expired = %q, want expired,expired-gone", got)
+	}
+	if len(d.Changed) != 1 || d.Changed[0].Deal.ID != "changed" {
+		t.Fatalf("DiffSnapshots() changed = %+v, want the changed deal", d.Changed)
+	}
+	var fields []string
+	for _, c := range d.Changed[0].Changes {
+		fields = append(fields, c.Field)
+	}
+	if got, want := strings.Join(fields, ","), "price,discount,is_clipped"; got != want {
+		t.Errorf("DiffSnapshots() changed fields = %q, want %q", got, want)
+	}
+	if c := d.Changed[0].Changes[1]; c.Old != 1.0 || c.New != 2.0 {
+		t.Errorf("DiffSnapshots() discount change = %v to %v, want 1 to 2", c.Old, c.New)
+	}
+	if d.Empty() {
+		t.Error("Empty() = true, want false")
+	}
+	if d := storage.DiffSnapshots(snapshot(from, kept), snapshot(to, kept)); !d.Empty() {
+		t.Errorf("DiffSnapshots(same deals) = %+v, want empty", d)
+	}
+}
+
+// The history indexes the deals of the snapshots by brand, UPC and category, and keeps the clips.
+func TestHistory(t *testing.T) {
+	db := open(t, filepath.Join(t.TempDir(), "deals.db"))
+	later := t0.AddDate(0, 0, 7)
+	percent := deal("4", "Kraft", 0, later)
+	percent.Discount = &promotion.Discount{Percent: 20}
+	produce := deal("3", "Dole", 0.5, later)
+	produce.Categories = []string{"Produce"}
+	if err := db.SaveSnapshot(snapshot(t0, deal("1", "Lucerne", 1, later), deal("2", "Lucerne", 2, later), produce, percent)); err != nil {
+		t.Fatalf("SaveSnapshot() failed: %v", err)
+	}
+	if err := db.SaveSnapshot(snapshot(t0.Add(time.Hour), deal("2", "Lucerne", 3, later))); err != nil {
+		t.Fatalf("SaveSnapshot() failed: %v", err)
+	}
+
+	rs, err := db.BrandHistory("LUCERNE")
+	if err != nil || len(rs) != 2 || rs[0].ID != "2" || rs[0].Sightings != 2 || rs[0].Discount != 3 || rs[1].ID != "1" {
+		t.Errorf("BrandHistory() = %+v, %v, want deal 2 seen twice then deal 1", rs, err)
+	}
+	u, deals, err := db.UPCHistory("0002")
+	if err != nil || u == nil || len(deals) != 1 || deals[0].ID != "2" {
+		t.Errorf("UPCHistory() = %+v, %v, %v, want deal 2", u, deals, err)
+	}
+	stats, err := db.CategoryStats()
+	// The percentage off doesn't pull down the average savings in dollars, and re-indexing deal 2
+	// updates its discount instead of counting it twice.
+	want := []storage.CategoryStats{
+		{Category: "Dairy", Deals: 3, AverageDiscount: 2, AveragePercent: 20},
+		{Category: "Produce", Deals: 1, AverageDiscount: 0.5},
+	}
+	if err != nil || !slices.Equal(stats, want) {
+		t.Errorf("CategoryStats() = %+v, %v, want %+v", stats, err, want)
+	}
+	got, err := db.QueryDeals(expr.MustCompile(`discount >= 1 && brand == "Lucerne"`, expr.WithType(storage.DealRecord{})))
+	if err != nil || len(got) != 2 || got[0].ID != "2" {
+		t.Errorf("QueryDeals() = %+v, %v, want deals 2 and 1", got, err)
+	}
+
+	for i, ok := range []bool{true, false} {
+		if err := db.RecordClip(storage.ClipEvent{Time: t0.Add(time.Duration(i) * time.Hour), DealID: fmt.Sprint(i + 1), Success: ok}); err != nil {
+			t.Fatalf("RecordClip() failed: %v", err)
+		}
+	}
+	evs, err := db.ClipEvents(t0.Add(time.Minute))
+	if err != nil || len(evs) != 1 || evs[0].DealID != "2" || evs[0].Success {
+		t.Errorf("ClipEvents(since) = %+v, %v, want the failed clip of deal 2", evs, err)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	db := open(t, filepath.Join(t.TempDir(), "deals.db"))
+	version, err := db.SchemaVersion()
+	if err != nil || version != 2 {
+		t.Errorf("SchemaVersion() = %d, %v, want 2", version, err)
+	}
+}
+
+// A database created before the history, with only snapshots, is backfilled when opened.
+func TestMigrationsBackfill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deals.db")
+	bdb, err := bolt.Open(path, 0o600, nil)
+	if err != nil {
+		t.Fatalf("bolt.Open() failed: %v", err)
+	}
+	for i, at := range []time.Time{t0, t0.Add(time.Hour)} {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		s := snapshot(at, deal("1", "Lucerne", float64(i+1), t0.AddDate(0, 0, 7)))
+		if err := json.NewEncoder(zw).Encode(s); err != nil {
+			t.Fatal(err)
+		}
+		zw.Close()
+		err = bdb.Update(func(tx *bolt.Tx) error {
+			root, err := tx.CreateBucketIfNotExists([]byte("snapshots"))
+			if err != nil {
+				return err
+			}
+			b, err := root.CreateBucketIfNotExists([]byte(src.String()))
+			if err != nil {
+				return err
+			}
+			return b.Put(binary.BigEndian.AppendUint64(nil, uint64(at.UnixNano())), buf.Bytes())
+		})
+		if err != nil {
+			t.Fatalf("writing snapshot failed: %v", err)
+		}
+	}
+	bdb.Close()
+
+	db := open(t, path)
+	if version, err := db.SchemaVersion(); err != nil || version != 2 {
+		t.Errorf("SchemaVersion() = %d, %v, want 2", version, err)
+	}
+	rs, err := db.BrandHistory("Lucerne")
+	if err != nil || len(rs) != 1 {
+		t.Fatalf("BrandHistory() = %+v, %v, want 1 deal", rs, err)
+	}
+	if r := rs[0]; r.Sightings != 2 || !r.FirstSeen.Equal(t0) || !r.LastSeen.Equal(t0.Add(time.Hour)) || r.Discount != 2 {
+		t.Errorf("BrandHistory() = %+v, want 2 sightings with the last discount", r)
+	}
+	if _, deals, err := db.UPCHistory("0001"); err != nil || len(deals) != 1 {
+		t.Errorf("UPCHistory() = %v, %v, want 1 deal", deals, err)
+	}
+}
+
+func TestMigrationsNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deals.db")
+	bdb, err := bolt.Open(path, 0o600, nil)
+	if err != nil {
+		t.Fatalf("bolt.Open() failed: %v", err)
+	}
+	err = bdb.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists([]byte("meta"))
+		if err != nil {
+			return err
+		}
+		return meta.Put([]byte("schema_version"), binary.BigEndian.AppendUint32(nil, 99))
+	})
+	bdb.Close()
+	if err != nil {
+		t.Fatalf("writing schema version failed: %v", err)
+	}
+	if db, err := storage.Open(path); err == nil || !strings.Contains(err.Error(), "newer than the supported version") {
+		if db != nil {
+			db.Close()
+		}
+		t.Errorf("Open() = %v, want a newer version error", err)
+	}
+}
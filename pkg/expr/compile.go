@@ -0,0 +1,377 @@
+package expr
+
+import (
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// env is the evaluation environment of a single Match call.
+type env struct {
+	root reflect.Value
+	now  time.Time
+}
+
+type evalFunc func(e *env) (any, error)
+
+// compiled is a type checked node, ready for evaluation.
+type compiled struct {
+	kind kind
+	eval evalFunc
+	lit  *literal // Set when the node is a constant.
+}
+
+type compiler struct {
+	cfg *config
+}
+
+func (c *compiler) compile(n node) (compiled, error) {
+	switch n := n.(type) {
+	case *literal:
+		v := n.val
+		return compiled{kind: kindOf(v), eval: func(*env) (any, error) { return v, nil }, lit: n}, nil
+	case *list:
+		return c.compileList(n)
+	case *fieldRef:
+		return c.compileField(n)
+	case *call:
+		return c.compileCall(n)
+	case *unary:
+		return c.compileUnary(n)
+	case *binary:
+		return c.compileBinary(n)
+	}
+	return compiled{}, errorf(n.position(), "unsupported expression")
+}
+
+func (c *compiler) compileList(n *list) (compiled, error) {
+	elems := make([]evalFunc, len(n.elems))
+	for i, el := range n.elems {
+		ce, err := c.compile(el)
+		if err != nil {
+			return compiled{}, err
+		}
+		elems[i] = ce.eval
+	}
+	return compiled{kind: kindList, eval: func(e *env) (any, error) {
+		l := make([]any, len(elems))
+		for i, el := range elems {
+			v, err := el(e)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = v
+		}
+		return l, nil
+	}}, nil
+}
+
+// compileField resolves a field path against the root type. Fields of interface or map type
+// can't be checked statically and are resolved by name during evaluation, unless their type
+// was declared with WithFieldType.
+func (c *compiler) compileField(n *fieldRef) (compiled, error) {
+	t := c.cfg.root
+	var static [][]int
+	var dynamic []string
+	for i, name := range n.path {
+		prefix := joinPath(n.path[:i])
+		var f structField
+		found := false
+		if t != nil {
+			for t.Kind() == reflect.Pointer {
+				t = t.Elem()
+			}
+			switch {
+			case t.Kind() == reflect.Struct && kindOfType(t) == kindObject:
+				if f, found = lookupField(t, name); !found {
+					return compiled{}, unknownField(n.pos, name, prefix, t)
+				}
+			case t.Kind() == reflect.Map || t.Kind() == reflect.Interface:
+			default:
+				return compiled{}, errorf(n.pos, "%q is a %s and has no field %q", prefix, kindOfType(t), name)
+			}
+		}
+		if found && dynamic == nil {
+			static = append(static, f.index)
+		} else {
+			dynamic = append(dynamic, name)
+		}
+		switch {
+		case found:
+			t = f.typ
+		case t != nil && t.Kind() == reflect.Map:
+			t = t.Elem()
+		default:
+			t = nil
+		}
+		if override, ok := c.cfg.fieldTypes[joinPath(n.path[:i+1])]; ok {
+			// The declared type is only used for checking, the value is still resolved by name.
+			t = override
+			if dynamic == nil {
+				dynamic = []string{}
+			}
+		}
+	}
+	k := kindAny
+	if t != nil {
+		k = kindOfType(t)
+	}
+	return compiled{kind: k, eval: func(e *env) (any, error) {
+		v := e.root
+		for _, idx := range static {
+			if v = indirect(v); !v.IsValid() {
+				return nil, nil
+			}
+			v = v.FieldByIndex(idx)
+		}
+		for i, name := range dynamic {
+			prefix := joinPath(n.path[:len(n.path)-len(dynamic)+i])
+			if v = indirect(v); !v.IsValid() {
+				return nil, nil
+			}
+			switch v.Kind() {
+			case reflect.Struct:
+				f, ok := lookupField(v.Type(), name)
+				if !ok {
+					return nil, unknownField(n.pos, name, prefix, v.Type())
+				}
+				v = v.FieldByIndex(f.index)
+			case reflect.Map:
+				if v.Type().Key().Kind() != reflect.String {
+					return nil, errorf(n.pos, "%q has non-string keys", prefix)
+				}
+				v = v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+			default:
+				return nil, errorf(n.pos, "%q is a %s and has no field %q", prefix, kindOfType(v.Type()), name)
+			}
+		}
+		return value(v), nil
+	}}, nil
+}
+
+func unknownField(pos int, name, prefix string, t reflect.Type) error {
+	where := typeName(t)
+	if prefix != "" {
+		where = prefix + " (" + where + ")"
+	}
+	if s := suggest(name, fieldNames(t)); s != "" {
+		return errorf(pos, "unknown field %q on %s, did you mean %q?", name, where, s)
+	}
+	return errorf(pos, "unknown field %q on %s, valid fields are: %s", name, where, strings.Join(fieldNames(t), ", "))
+}
+
+// indirect follows pointers and interfaces, returning an invalid value for nil.
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func (c *compiler) compileCall(n *call) (compiled, error) {
+	fn, ok := functions[n.name]
+	if !ok {
+		names := sortedFunctionNames()
+		if s := suggest(n.name, names); s != "" {
+			return compiled{}, errorf(n.pos, "unknown function %q, did you mean %q?", n.name, s)
+		}
+		return compiled{}, errorf(n.pos, "unknown function %q, valid functions are: %s", n.name, strings.Join(names, ", "))
+	}
+	if len(n.args) != len(fn.args) {
+		return compiled{}, errorf(n.pos, "%s() expects %d argument(s), got %d", n.name, len(fn.args), len(n.args))
+	}
+	args := make([]evalFunc, len(n.args))
+	for i, a := range n.args {
+		ca, err := c.compile(a)
+		if err != nil {
+			return compiled{}, err
+		}
+		if !slices.Contains(fn.args[i], ca.kind) && ca.kind != kindAny && ca.kind != kindNull {
+			return compiled{}, errorf(a.position(), "%s() argument %d must be %s, got %s", n.name, i+1, kindsString(fn.args[i]), ca.kind)
+		}
+		// A null constant makes the call null at run time, there is nothing to validate.
+		if fn.constant && ca.lit != nil && ca.lit.val != nil {
+			if _, err := fn.call(nil, []any{ca.lit.val}); err != nil {
+				return compiled{}, errorf(a.position(), "%v", err)
+			}
+		}
+		args[i] = ca.eval
+	}
+	return compiled{kind: fn.result, eval: func(e *env) (any, error) {
+		vals := make([]any, len(args))
+		for i, a := range args {
+			v, err := a(e)
+			if err != nil {
+				return nil, err
+			}
+			if v == nil {
+				return nil, nil
+			}
+			if k := kindOf(v); !slices.Contains(fn.args[i], k) {
+				return nil, errorf(n.pos, "%s() argument %d must be %s, got %s", n.name, i+1, kindsString(fn.args[i]), k)
+			}
+			vals[i] = v
+		}
+		v, err := fn.call(e, vals)
+		if err != nil {
+			return nil, errorf(n.pos, "%v", err)
+		}
+		return v, nil
+	}}, nil
+}
+
+func (c *compiler) compileUnary(n *unary) (compiled, error) {
+	x, err := c.compile(n.x)
+	if err != nil {
+		return compiled{}, err
+	}
+	k, ok := unaryKind(n.op, x.kind)
+	if !ok {
+		return compiled{}, errorf(n.pos, "operator %q is not defined on %s", n.op, x.kind)
+	}
+	return compiled{kind: k, eval: func(e *env) (any, error) {
+		v, err := x.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		switch v := v.(type) {
+		case nil:
+			if n.op == "!" {
+				return true, nil
+			}
+			return nil, nil
+		case bool:
+			if n.op == "!" {
+				return !v, nil
+			}
+		case float64:
+			if n.op == "-" {
+				return -v, nil
+			}
+		case time.Duration:
+			if n.op == "-" {
+				return -v, nil
+			}
+		}
+		return nil, errorf(n.pos, "operator %q is not defined on %s", n.op, kindOf(v))
+	}}, nil
+}
+
+func (c *compiler) compileBinary(n *binary) (compiled, error) {
+	x, err := c.compile(n.x)
+	if err != nil {
+		return compiled{}, err
+	}
+	y, err := c.compile(n.y)
+	if err != nil {
+		return compiled{}, err
+	}
+	// Allow comparing times with date strings, e.g. end_date < "2025-06-01".
+	if x, y, err = coerceDate(x, y); err != nil {
+		return compiled{}, err
+	}
+	if y, x, err = coerceDate(y, x); err != nil {
+		return compiled{}, err
+	}
+	k, ok := binaryKind(n.op, x.kind, y.kind)
+	if !ok {
+		return compiled{}, errorf(n.pos, "operator %q is not defined on %s and %s", n.op, x.kind, y.kind)
+	}
+
+	switch n.op {
+	case "&&", "||":
+		return compiled{kind: k, eval: func(e *env) (any, error) {
+			a, err := truth(e, x.eval, n.op, n.x.position())
+			if err != nil || a == (n.op == "||") {
+				return a, err
+			}
+			return truth(e, y.eval, n.op, n.y.position())
+		}}, nil
+	case "=~", "!~":
+		var re *regexp.Regexp
+		if y.lit != nil {
+			if re, err = regexp.Compile(y.lit.val.(string)); err != nil {
+				return compiled{}, errorf(n.y.position(), "invalid regular expression, %v", err)
+			}
+		}
+		return compiled{kind: k, eval: func(e *env) (any, error) {
+			a, b, err := evalBoth(e, x.eval, y.eval)
+			if err != nil {
+				return nil, err
+			}
+			if a == nil || b == nil {
+				return nil, nil
+			}
+			s, _ := a.(string)
+			r := re
+			if r == nil {
+				p, ok := b.(string)
+				if !ok {
+					return nil, errorf(n.pos, "operator %q is not defined on %s and %s", n.op, kindOf(a), kindOf(b))
+				}
+				if r, err = regexp.Compile(p); err != nil {
+					return nil, errorf(n.y.position(), "invalid regular expression, %v", err)
+				}
+			}
+			return r.MatchString(s) == (n.op == "=~"), nil
+		}}, nil
+	}
+	return compiled{kind: k, eval: func(e *env) (any, error) {
+		a, b, err := evalBoth(e, x.eval, y.eval)
+		if err != nil {
+			return nil, err
+		}
+		return evalBinary(n.pos, n.op, a, b)
+	}}, nil
+}
+
+// coerceDate turns a string constant compared against a time into a time constant.
+func coerceDate(t, s compiled) (compiled, compiled, error) {
+	if t.kind != kindTime || s.lit == nil || s.kind != kindString {
+		return t, s, nil
+	}
+	d, err := parseDate(s.lit.val.(string))
+	if err != nil {
+		return t, s, errorf(s.lit.pos, "%v", err)
+	}
+	return t, compiled{kind: kindTime, eval: func(*env) (any, error) { return d, nil }, lit: &literal{pos: s.lit.pos, val: d}}, nil
+}
+
+func truth(e *env, f evalFunc, op string, pos int) (bool, error) {
+	v, err := f(e)
+	if err != nil {
+		return false, err
+	}
+	switch v := v.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	}
+	return false, errorf(pos, "operator %q expects bool operands, got %s", op, kindOf(v))
+}
+
+func evalBoth(e *env, x, y evalFunc) (any, any, error) {
+	a, err := x(e)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := y(e)
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, b, nil
+}
+
+func kindsString(ks []kind) string {
+	var s []string
+	for _, k := range ks {
+		s = append(s, k.String())
+	}
+	return strings.Join(s, " or ")
+}
@@ -0,0 +1,139 @@
+// Package expr implements a small expression language to filter deals, for example:
+//
+//	brand == "Lucerne" && end_date < now() + 3d && discount.amount >= 1
+//
+// Fields are addressed by their JSON names, nested fields with dots (item.offerPgm). Supported
+// values are numbers, strings, booleans, null, lists ([1, 2]), times and durations (90m, 1h30m,
+// 3d, 2w). Operators, from lowest to highest precedence:
+//
+//	|| or
+//	&& and
+//	! not
+//	== != < <= > >= =~ !~ in contains
+//	+ -
+//	* /
+//	- (negation)
+//
+// Builtin functions are now(), date("2025-06-01"), lower(s), upper(s), len(s|list) and
+// days(duration). Expressions are type checked against the fields of the target type when
+// compiled, so typos and invalid comparisons are reported before any deal is evaluated.
+package expr
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+)
+
+// Program is a compiled expression.
+type Program struct {
+	src  string
+	root reflect.Type
+	eval evalFunc
+	now  func() time.Time
+}
+
+type config struct {
+	root       reflect.Type
+	fieldTypes map[string]reflect.Type
+	now        func() time.Time
+}
+
+// Option configures how an expression is compiled.
+type Option func(*config)
+
+// WithType sets the type expressions are evaluated against. Defaults to promotion.ClipDeal.
+func WithType(sample any) Option {
+	return func(c *config) { c.root = reflect.TypeOf(sample) }
+}
+
+// WithFieldType declares the type held by an interface field (e.g. "item" for the original
+// provider item) so its nested fields are checked at compile time.
+func WithFieldType(path string, sample any) Option {
+	return func(c *config) { c.fieldTypes[path] = reflect.TypeOf(sample) }
+}
+
+// WithNow sets the clock used by now(). Defaults to time.Now.
+func WithNow(now func() time.Time) Option { return func(c *config) { c.now = now } }
+
+// Compile parses and type checks an expression. The expression must evaluate to a boolean.
+func Compile(src string, opts ...Option) (*Program, error) {
+	cfg := &config{
+		root:       reflect.TypeFor[promotion.ClipDeal](),
+		fieldTypes: map[string]reflect.Type{},
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	for cfg.root.Kind() == reflect.Pointer {
+		cfg.root = cfg.root.Elem()
+	}
+	if cfg.root.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expr: can't evaluate against %s, expected a struct", cfg.root)
+	}
+
+	n, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	c, err := (&compiler{cfg: cfg}).compile(n)
+	if err != nil {
+		return nil, err
+	}
+	if c.kind != kindBool && c.kind != kindAny {
+		return nil, errorf(n.position(), "expression must evaluate to a bool, got %s", c.kind)
+	}
+	return &Program{src: src, root: cfg.root, eval: c.eval, now: cfg.now}, nil
+}
+
+// MustCompile is like Compile but panics if the expression is invalid.
+func MustCompile(src string, opts ...Option) *Program {
+	p, err := Compile(src, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the source of the expression.
+func (p *Program) String() string { return p.src }
+
+// Match evaluates the expression against v, which must be of the compiled type or a pointer to it.
+func (p *Program) Match(v any) (bool, error) {
+	rv := reflect.ValueOf(v)
+	if !reflect.Indirect(rv).IsValid() {
+		return false, fmt.Errorf("expr: can't evaluate nil, expression was compiled for %s", p.root)
+	}
+	if t := reflect.Indirect(rv).Type(); t != p.root {
+		return false, fmt.Errorf("expr: can't evaluate %s, expression was compiled for %s", t, p.root)
+	}
+	res, err := p.eval(&env{root: rv, now: p.now()})
+	if err != nil {
+		return false, err
+	}
+	switch res := res.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return res, nil
+	}
+	return false, fmt.Errorf("expr: expression evaluated to %s, expected a bool", kindOf(res))
+}
+
+// Filter returns the items that match the expression.
+func Filter[T any](p *Program, items []T) ([]T, error) {
+	var ret []T
+	for _, item := range items {
+		ok, err := p.Match(item)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			ret = append(ret, item)
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,312 @@
+package expr_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/pkg/expr"
+)
+
+type item struct {
+	Code  string `json:"code"`
+	Index int    `json:"index"`
+}
+
+type record struct {
+	Brand    string          `json:"brand"`
+	Price    *float64        `json:"price,omitempty"`
+	Count    int             `json:"count"`
+	Tags     []string        `json:"tags"`
+	End      time.Time       `json:"end_date"`
+	TTL      time.Duration   `json:"ttl"`
+	Nested   struct{ A int } `json:"nested"`
+	Item     any             `json:"item"`
+	Attrs    map[string]any  `json:"attrs"`
+	internal string
+}
+
+var now = time.Date(2025, 6, 1, 12, 0, 0, 0, time.Local)
+
+func ptr[T any](v T) *T { return &v }
+
+func sample() record {
+	return record{
+		Brand:  "Lucerne",
+		Price:  ptr(3.5),
+		Count:  4,
+		Tags:   []string{"dairy", "organic"},
+		End:    now.Add(48 * time.Hour),
+		TTL:    90 * time.Minute,
+		Item:   item{Code: "A1", Index: 7},
+		Attrs:  map[string]any{"color": "red"},
+		Nested: struct{ A int }{A: 2},
+	}
+}
+
+func compile(t *testing.T, src string) (*expr.Program, error) {
+	t.Helper()
+	return expr.Compile(src, expr.WithType(record{}), expr.WithNow(func() time.Time { return now }))
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		// Comparisons.
+		{`brand == "Lucerne"`, true},
+		{`brand != "Lucerne"`, false},
+		{`count > 3 && count <= 4`, true},
+		{`count >= 5 || brand < "M"`, true},
+		{`!(count == 4)`, false},
+		{`nested.A == 2`, true},
+		// Arithmetic and precedence.
+		{`count * 2 + 1 == 9`, true},
+		{`(count + 2) * 2 == 12`, true},
+		{`-count == -4`, true},
+		{`price * 2 == 7`, true},
+		{`count / 8 == 0.5`, true},
+		{`"a" + "b" == "ab"`, true},
+		// Times and durations.
+		{`end_date > now()`, true},
+		{`end_date < now() + 3d`, true},
+		{`end_date < now() + 1d`, false},
+		{`end_date - now() == 2d`, true},
+		{`days(end_date - now()) == 2`, true},
+		{`ttl == 1h30m`, true},
+		{`ttl == 90m`, true},
+		{`ttl * 2 == 3h`, true},
+		{`ttl / 30m == 3`, true},
+		{`ttl / 3 == 30m`, true},
+		{`2w == 14d`, true},
+		{`-ttl < 0s`, true},
+		{`end_date > "2025-06-02"`, true},
+		{`end_date < date("2025-06-04")`, true},
+		{`now() == date("2025-06-01T12:00:00")`, true},
+		// Strings, lists and regexps.
+		{`brand =~ "^Luc"`, true},
+		{`brand !~ "(?i)LUC"`, false},
+		{`brand =~ lower("LUC")`, false},
+		{`"organic" in tags`, true},
+		{`tags contains "vegan"`, false},
+		{`"cer" in brand`, true},
+		{`brand contains "erne"`, true},
+		{`count in [1, 2, 4]`, true},
+		{`brand in ["A", "B"]`, false},
+		{`len(tags) == 2 && len(brand) == 7`, true},
+		{`upper(brand) == "LUCERNE"`, true},
+		// Dynamic fields, checked at evaluation.
+		{`item.code == "A1"`, true},
+		{`item.Index > 3`, true},
+		{`attrs.color == "red"`, true},
+		{`attrs.size == null`, true},
+		// Case insensitive field names.
+		{`Brand == "Lucerne"`, true},
+	}
+	for _, tt := range tests {
+		p, err := compile(t, tt.src)
+		if err != nil {
+			t.Errorf("Compile(%q) failed: %v", tt.src, err)
+			continue
+		}
+		got, err := p.Match(sample())
+		if err != nil {
+			t.Errorf("Match(%q) failed: %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+// Null operands, e.g. missing optional fields, make comparisons false and propagate through
+// arithmetic, so that "price < 5" doesn't match deals without a price, nor does its negation.
+func TestEvalNull(t *testing.T) {
+	r := sample()
+	r.Price = nil
+	r.Item = nil
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{`price == null`, true},
+		{`price != null`, false},
+		{`price < 5`, false},
+		{`price >= 5`, false},
+		{`price * 2 < 10`, false},
+		{`price * 2 == null`, true},
+		{`!(price < 5)`, true},
+		{`price < 5 || count == 4`, true},
+		{`price < 5 && count == 4`, false},
+		{`item.code == "A1"`, false},
+		{`item.code == null`, true},
+		{`lower(item.code) == null`, true},
+		{`item.code =~ "A"`, false},
+		{`item.code !~ "A"`, false},
+		{`"A1" =~ item.code`, false},
+		{`date(null) < now()`, false},
+		{`date(item.code) == null`, true},
+		{`null == null`, true},
+		{`price in [1, 2]`, false},
+	}
+	for _, tt := range tests {
+		p, err := compile(t, tt.src)
+		if err != nil {
+			t.Errorf("Compile(%q) failed: %v", tt.src, err)
+			continue
+		}
+		got, err := p.Match(r)
+		if err != nil {
+			t.Errorf("Match(%q) failed: %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		pos  int // Byte offset of the error.
+		want string
+	}{
+		// Parse errors.
+		{`brand ==`, 8, "unexpected end of expression"},
+		{`brand == "Lucerne`, 9, "unterminated string"},
+		{`(count > 1`, 10, `expected ")"`},
+		{`count > 1 count`, 10, "expected an operator or end of expression"},
+		{`count @ 1`, 6, `unexpected character '@'`},
+		{`[1, 2`, 5, "found end of expression"},
+		// Type errors.
+		{`brand > 1`, 6, `operator ">" is not defined on string and number`},
+		{`count + "a" == 1`, 6, `operator "+" is not defined on number and string`},
+		{`brand`, 0, "expression must evaluate to a bool, got string"},
+		{`count && true`, 6, `operator "&&" is not defined on number and bool`},
+		{`!count`, 0, `operator "!" is not defined on number`},
+		{`tags == tags`, 5, `operator "==" is not defined on list and list`},
+		{`end_date < 3`, 9, `operator "<" is not defined on time and number`},
+		{`len(1) == 1`, 4, "len() argument 1 must be list or string, got number"},
+		{`lower() == ""`, 0, "lower() expects 1 argument(s), got 0"},
+		{`nested.A.B == 1`, 0, `"nested.A" is a number and has no field "B"`},
+		// Constants are checked when compiled.
+		{`brand =~ "("`, 9, "invalid regular expression"},
+		{`end_date < date("June")`, 16, `invalid date "June"`},
+		{`end_date < "tomorrow"`, 11, `invalid date "tomorrow"`},
+		// Suggestions.
+		{`brnd == "x"`, 0, `unknown field "brnd" on record, did you mean "brand"?`},
+		{`nested.B == 1`, 0, `unknown field "B" on nested`},
+		{`zzzzzz == 1`, 0, "valid fields are: brand, price, count, tags, end_date, ttl, nested, item, attrs"},
+		{`lowr(brand) == ""`, 0, `unknown function "lowr", did you mean "lower"?`},
+		{`zzzz() == 1`, 0, "unknown function \"zzzz\", valid functions are: date, days, len, lower, now, upper"},
+	}
+	for _, tt := range tests {
+		_, err := compile(t, tt.src)
+		if err == nil {
+			t.Errorf("Compile(%q) succeeded, want error %q", tt.src, tt.want)
+			continue
+		}
+		var e *expr.Error
+		if !errors.As(err, &e) {
+			t.Errorf("Compile(%q) = %v, want an *expr.Error", tt.src, err)
+			continue
+		}
+		if e.Pos != tt.pos || !strings.Contains(e.Msg, tt.want) {
+			t.Errorf("Compile(%q) = %v (offset %d), want %q at offset %d", tt.src, err, e.Pos, tt.want, tt.pos)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`count / (count - 4) == 1`, "division by zero"},
+		{`ttl / 0 == 1s`, "division by zero"},
+		{`ttl / (ttl - ttl) == 1`, "division by zero"},
+		{`item.nope == 1`, `unknown field "nope" on item (item), did you mean "code"?`},
+		{`item.code > 1`, `operator ">" is not defined on string and number`},
+		{`attrs.color.x == 1`, `"attrs.color" is a string and has no field "x"`},
+		{`brand =~ attrs.color + "("`, "invalid regular expression"},
+	}
+	for _, tt := range tests {
+		p, err := compile(t, tt.src)
+		if err != nil {
+			t.Errorf("Compile(%q) failed: %v", tt.src, err)
+			continue
+		}
+		_, err = p.Match(sample())
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Match(%q) = %v, want error %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestWithFieldType(t *testing.T) {
+	opts := []expr.Option{expr.WithType(record{}), expr.WithFieldType("item", item{})}
+	if _, err := expr.Compile(`item.Index > 3`, opts...); err != nil {
+		t.Errorf("Compile() failed: %v", err)
+	}
+	_, err := expr.Compile(`item.Indx > 3`, opts...)
+	if err == nil || !strings.Contains(err.Error(), `did you mean "index"?`) {
+		t.Errorf("Compile() = %v, want a suggestion", err)
+	}
+	if _, err := expr.Compile(`item.code > 3`, opts...); err == nil {
+		t.Error("Compile() succeeded, want a type error")
+	}
+}
+
+func TestMatchType(t *testing.T) {
+	p := expr.MustCompile(`count > 1`, expr.WithType(record{}))
+	r := sample()
+	if ok, err := p.Match(&r); err != nil || !ok {
+		t.Errorf("Match(pointer) = %v, %v, want true", ok, err)
+	}
+	if _, err := p.Match(item{}); err == nil {
+		t.Error("Match(other type) succeeded, want an error")
+	}
+	if _, err := p.Match((*record)(nil)); err == nil {
+		t.Error("Match(nil) succeeded, want an error")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	p := expr.MustCompile(`count >= 2`, expr.WithType(record{}))
+	rs := []record{{Count: 1}, {Count: 2}, {Count: 3}}
+	got, err := expr.Filter(p, rs)
+	if err != nil {
+		t.Fatalf("Filter() failed: %v", err)
+	}
+	if len(got) != 2 || got[0].Count != 2 || got[1].Count != 3 {
+		t.Errorf("Filter() = %v, want the records with count 2 and 3", got)
+	}
+}
+
+// The examples of the README and of the package documentation compile against the deals.
+func TestExamples(t *testing.T) {
+	deal := promotion.ClipDeal{Promotion: promotion.Promotion{
+		Brand:    "Lucerne",
+		EndDate:  now.Add(24 * time.Hour),
+		Discount: &promotion.Discount{Amount: 1.5, Percent: 25},
+	}}
+	for _, src := range []string{
+		`brand == "Lucerne" && end_date < now() + 3d && discount.amount >= 1`,
+		`discount.percent >= 20`,
+		`brand == "Lucerne" && end_date < now() + 3d`,
+	} {
+		p, err := expr.Compile(src, expr.WithNow(func() time.Time { return now }))
+		if err != nil {
+			t.Errorf("Compile(%q) failed: %v", src, err)
+			continue
+		}
+		if ok, err := p.Match(deal); err != nil || !ok {
+			t.Errorf("Match(%q) = %v, %v, want true", src, ok, err)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokDuration
+	tokString
+	tokOp
+)
+
+// token is a single lexical element of an expression.
+type token struct {
+	kind tokenKind
+	text string // Raw text, or the operator for tokOp.
+	pos  int    // Byte offset in the source.
+	num  float64
+	dur  time.Duration
+	str  string
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.str)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// Operators sorted so that longer ones are matched first.
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "+", "-", "*", "/", "(", ")", "[", "]", ",", "."}
+
+var durationUnits = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case isIdentStart(c):
+			j := i + 1
+			for j < len(src) && isIdentPart(rune(src[j])) {
+				j++
+			}
+			toks = append(toks, token{kind: tokIdent, text: src[i:j], pos: i})
+			i = j
+		case c >= '0' && c <= '9':
+			t, n, err := lexNumber(src, i)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, t)
+			i = n
+		case c == '"' || c == '\'':
+			t, n, err := lexString(src, i)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, t)
+			i = n
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, errorf(i, "unexpected character %q", c)
+			}
+			toks = append(toks, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+// lexNumber scans a number or a duration such as 3d, 1.5h or 1h30m.
+func lexNumber(src string, i int) (token, int, error) {
+	start := i
+	var dur time.Duration
+	isDur := false
+	for {
+		j := i
+		for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+			j++
+		}
+		num, err := strconv.ParseFloat(src[i:j], 64)
+		if err != nil {
+			return token{}, 0, errorf(i, "invalid number %q", src[i:j])
+		}
+		k := j
+		for k < len(src) && unicode.IsLetter(rune(src[k])) {
+			k++
+		}
+		if k == j {
+			if isDur {
+				return token{}, 0, errorf(j, "missing unit after %q in duration", src[i:j])
+			}
+			return token{kind: tokNumber, text: src[start:j], pos: start, num: num}, j, nil
+		}
+		unit, ok := durationUnits[src[j:k]]
+		if !ok {
+			return token{}, 0, errorf(j, "unknown duration unit %q (valid units: ms, s, m, h, d, w)", src[j:k])
+		}
+		dur += time.Duration(num * float64(unit))
+		isDur = true
+		if k == len(src) || src[k] < '0' || src[k] > '9' {
+			return token{kind: tokDuration, text: src[start:k], pos: start, dur: dur}, k, nil
+		}
+		i = k
+	}
+}
+
+func lexString(src string, i int) (token, int, error) {
+	quote := src[i]
+	var sb strings.Builder
+	for j := i + 1; j < len(src); j++ {
+		c := src[j]
+		switch {
+		case c == quote:
+			return token{kind: tokString, text: src[i : j+1], pos: i, str: sb.String()}, j + 1, nil
+		case c == '\\' && j+1 < len(src):
+			j++
+			switch src[j] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			default:
+				sb.WriteByte(src[j])
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return token{}, 0, errorf(i, "unterminated string")
+}
+
+func isIdentStart(c rune) bool { return c == '_' || unicode.IsLetter(c) }
+func isIdentPart(c rune) bool  { return isIdentStart(c) || unicode.IsDigit(c) }
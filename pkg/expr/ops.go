@@ -0,0 +1,275 @@
+package expr
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+func unaryKind(op string, x kind) (kind, bool) {
+	switch {
+	case x == kindAny:
+		return kindAny, true
+	case op == "!":
+		return kindBool, x == kindBool
+	case op == "-":
+		return x, x == kindNumber || x == kindDuration
+	}
+	return kindAny, false
+}
+
+// binaryKind returns the result kind of applying op to operands of kind x and y, and
+// whether the operation is valid. Operands of unknown kind are accepted and checked again
+// during evaluation.
+func binaryKind(op string, x, y kind) (kind, bool) {
+	dynamic := x == kindAny || y == kindAny
+	either := func(k kind) bool { return x == k || y == k }
+	ordered := func(k kind) bool {
+		return k == kindNumber || k == kindString || k == kindTime || k == kindDuration
+	}
+	switch op {
+	case "&&", "||":
+		return kindBool, (x == kindBool || x == kindAny || x == kindNull) && (y == kindBool || y == kindAny || y == kindNull)
+	case "==", "!=":
+		return kindBool, dynamic || either(kindNull) || x == y && x != kindObject && x != kindList
+	case "<", "<=", ">", ">=":
+		return kindBool, dynamic || x == y && ordered(x)
+	case "=~", "!~":
+		return kindBool, (x == kindString || x == kindAny) && (y == kindString || y == kindAny)
+	case "in":
+		return kindBool, y == kindAny || y == kindList || y == kindString && (x == kindString || x == kindAny)
+	case "contains":
+		return kindBool, x == kindAny || x == kindList || x == kindString && (y == kindString || y == kindAny)
+	}
+	if dynamic {
+		return kindAny, true
+	}
+	switch {
+	case op == "+" && x == y && (x == kindNumber || x == kindString || x == kindDuration):
+		return x, true
+	case op == "+" && (x == kindTime && y == kindDuration || x == kindDuration && y == kindTime):
+		return kindTime, true
+	case op == "-" && x == y && (x == kindNumber || x == kindDuration):
+		return x, true
+	case op == "-" && x == kindTime && y == kindDuration:
+		return kindTime, true
+	case op == "-" && x == kindTime && y == kindTime:
+		return kindDuration, true
+	case op == "*" && x == kindNumber && y == kindNumber:
+		return kindNumber, true
+	case op == "*" && (x == kindDuration && y == kindNumber || x == kindNumber && y == kindDuration):
+		return kindDuration, true
+	case op == "/" && x == kindNumber && y == kindNumber:
+		return kindNumber, true
+	case op == "/" && x == kindDuration && y == kindNumber:
+		return kindDuration, true
+	case op == "/" && x == kindDuration && y == kindDuration:
+		return kindNumber, true
+	}
+	return kindAny, false
+}
+
+// evalBinary applies a comparison or arithmetic operator to evaluated operands.
+func evalBinary(pos int, op string, a, b any) (any, error) {
+	if _, ok := binaryKind(op, kindOf(a), kindOf(b)); !ok && a != nil && b != nil {
+		return nil, errorf(pos, "operator %q is not defined on %s and %s", op, kindOf(a), kindOf(b))
+	}
+	switch op {
+	case "==":
+		return equal(a, b), nil
+	case "!=":
+		return !equal(a, b), nil
+	case "<", "<=", ">", ">=":
+		if a == nil || b == nil {
+			return false, nil
+		}
+		c := compare(a, b)
+		switch op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	case "in":
+		a, b = b, a
+		fallthrough
+	case "contains":
+		switch a := a.(type) {
+		case []any:
+			return slices.ContainsFunc(a, func(v any) bool { return equal(v, b) }), nil
+		case string:
+			s, ok := b.(string)
+			return ok && strings.Contains(a, s), nil
+		}
+		return false, nil
+	}
+	if a == nil || b == nil {
+		return nil, nil
+	}
+	switch a := a.(type) {
+	case float64:
+		switch b := b.(type) {
+		case float64:
+			switch op {
+			case "+":
+				return a + b, nil
+			case "-":
+				return a - b, nil
+			case "*":
+				return a * b, nil
+			case "/":
+				if b == 0 {
+					return nil, errorf(pos, "division by zero")
+				}
+				return a / b, nil
+			}
+		case time.Duration:
+			return time.Duration(a * float64(b)), nil
+		}
+	case string:
+		return a + b.(string), nil
+	case time.Time:
+		switch b := b.(type) {
+		case time.Duration:
+			if op == "-" {
+				b = -b
+			}
+			return a.Add(b), nil
+		case time.Time:
+			return a.Sub(b), nil
+		}
+	case time.Duration:
+		switch b := b.(type) {
+		case time.Duration:
+			switch op {
+			case "+":
+				return a + b, nil
+			case "-":
+				return a - b, nil
+			case "/":
+				if b == 0 {
+					return nil, errorf(pos, "division by zero")
+				}
+				return float64(a) / float64(b), nil
+			}
+		case time.Time:
+			return b.Add(a), nil
+		case float64:
+			if op == "/" {
+				if b == 0 {
+					return nil, errorf(pos, "division by zero")
+				}
+				return time.Duration(float64(a) / b), nil
+			}
+			return time.Duration(float64(a) * b), nil
+		}
+	}
+	return nil, errorf(pos, "operator %q is not defined on %s and %s", op, kindOf(a), kindOf(b))
+}
+
+func equal(a, b any) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if kindOf(a) != kindOf(b) {
+		return false
+	}
+	switch a := a.(type) {
+	case bool, float64, string, time.Duration:
+		return a == b
+	case time.Time:
+		return a.Equal(b.(time.Time))
+	}
+	return false
+}
+
+// compare orders two values of the same ordered kind.
+func compare(a, b any) int {
+	switch a := a.(type) {
+	case float64:
+		return cmpOrdered(a, b.(float64))
+	case string:
+		return strings.Compare(a, b.(string))
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	case time.Duration:
+		return cmpOrdered(a, b.(time.Duration))
+	}
+	return 0
+}
+
+func cmpOrdered[T float64 | time.Duration](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// function is a builtin function callable from expressions.
+type function struct {
+	args     [][]kind // Accepted kinds for each argument.
+	result   kind
+	constant bool // Validate constant arguments at compile time.
+	call     func(e *env, args []any) (any, error)
+}
+
+var functions = map[string]function{
+	"now": {
+		result: kindTime,
+		call:   func(e *env, _ []any) (any, error) { return e.now, nil },
+	},
+	"date": {
+		args:     [][]kind{{kindString}},
+		result:   kindTime,
+		constant: true,
+		call:     func(_ *env, args []any) (any, error) { return parseDate(args[0].(string)) },
+	},
+	"lower": {
+		args:   [][]kind{{kindString}},
+		result: kindString,
+		call:   func(_ *env, args []any) (any, error) { return strings.ToLower(args[0].(string)), nil },
+	},
+	"upper": {
+		args:   [][]kind{{kindString}},
+		result: kindString,
+		call:   func(_ *env, args []any) (any, error) { return strings.ToUpper(args[0].(string)), nil },
+	},
+	"len": {
+		args:   [][]kind{{kindList, kindString}},
+		result: kindNumber,
+		call: func(_ *env, args []any) (any, error) {
+			if l, ok := args[0].([]any); ok {
+				return float64(len(l)), nil
+			}
+			return float64(len(args[0].(string))), nil
+		},
+	},
+	"days": {
+		args:   [][]kind{{kindDuration}},
+		result: kindNumber,
+		call: func(_ *env, args []any) (any, error) {
+			return args[0].(time.Duration).Hours() / 24, nil
+		},
+	},
+}
+
+func sortedFunctionNames() []string { return slices.Sorted(maps.Keys(functions)) }
+
+var dateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"}
+
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or RFC 3339", s)
+}
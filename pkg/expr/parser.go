@@ -0,0 +1,293 @@
+package expr
+
+// node is an element of the parsed expression tree.
+type node interface{ position() int }
+
+type literal struct {
+	pos int
+	val any
+}
+
+type fieldRef struct {
+	pos  int
+	path []string
+}
+
+type call struct {
+	pos  int
+	name string
+	args []node
+}
+
+type unary struct {
+	pos int
+	op  string
+	x   node
+}
+
+type binary struct {
+	pos  int
+	op   string
+	x, y node
+}
+
+type list struct {
+	pos   int
+	elems []node
+}
+
+func (n *literal) position() int  { return n.pos }
+func (n *fieldRef) position() int { return n.pos }
+func (n *call) position() int     { return n.pos }
+func (n *unary) position() int    { return n.pos }
+func (n *binary) position() int   { return n.pos }
+func (n *list) position() int     { return n.pos }
+
+// parser is a recursive descent parser. Precedence from lowest to highest:
+//
+//	||  &&  !  comparisons (== != < <= > >= =~ !~ in contains)  + -  * /  unary -
+type parser struct {
+	toks []token
+	i    int
+}
+
+func parse(src string) (node, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, errorf(t.pos, "unexpected %s, expected an operator or end of expression", t)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of the given operators or keywords.
+func (p *parser) accept(ops ...string) (token, bool) {
+	t := p.peek()
+	if t.kind != tokOp && t.kind != tokIdent {
+		return t, false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return p.next(), true
+		}
+	}
+	return t, false
+}
+
+func (p *parser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		t := p.peek()
+		return errorf(t.pos, "expected %q, found %s", op, t)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	x, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.accept("||", "or")
+		if !ok {
+			return x, nil
+		}
+		y, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		x = &binary{pos: t.pos, op: "||", x: x, y: y}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	x, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.accept("&&", "and")
+		if !ok {
+			return x, nil
+		}
+		y, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		x = &binary{pos: t.pos, op: "&&", x: x, y: y}
+	}
+}
+
+func (p *parser) parseNot() (node, error) {
+	if t, ok := p.accept("!", "not"); ok {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unary{pos: t.pos, op: "!", x: x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	x, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	t, ok := p.accept("==", "!=", "<", "<=", ">", ">=", "=~", "!~", "in", "contains")
+	if !ok {
+		return x, nil
+	}
+	y, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	return &binary{pos: t.pos, op: t.text, x: x, y: y}, nil
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	x, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.accept("+", "-")
+		if !ok {
+			return x, nil
+		}
+		y, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		x = &binary{pos: t.pos, op: t.text, x: x, y: y}
+	}
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.accept("*", "/")
+		if !ok {
+			return x, nil
+		}
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		x = &binary{pos: t.pos, op: t.text, x: x, y: y}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if t, ok := p.accept("-"); ok {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unary{pos: t.pos, op: "-", x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return &literal{pos: t.pos, val: t.num}, nil
+	case tokDuration:
+		return &literal{pos: t.pos, val: t.dur}, nil
+	case tokString:
+		return &literal{pos: t.pos, val: t.str}, nil
+	case tokIdent:
+		switch t.text {
+		case "true", "false":
+			return &literal{pos: t.pos, val: t.text == "true"}, nil
+		case "null":
+			return &literal{pos: t.pos, val: nil}, nil
+		}
+		if _, ok := p.accept("("); ok {
+			return p.parseCall(t)
+		}
+		ref := &fieldRef{pos: t.pos, path: []string{t.text}}
+		for {
+			if _, ok := p.accept("."); !ok {
+				return ref, nil
+			}
+			f := p.next()
+			if f.kind != tokIdent {
+				return nil, errorf(f.pos, "expected a field name after %q, found %s", joinPath(ref.path)+".", f)
+			}
+			ref.path = append(ref.path, f.text)
+		}
+	case tokOp:
+		switch t.text {
+		case "(":
+			x, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		case "[":
+			l := &list{pos: t.pos}
+			if _, ok := p.accept("]"); ok {
+				return l, nil
+			}
+			for {
+				x, err := p.parseAdditive()
+				if err != nil {
+					return nil, err
+				}
+				l.elems = append(l.elems, x)
+				if _, ok := p.accept("]"); ok {
+					return l, nil
+				}
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return nil, errorf(t.pos, "unexpected %s, expected a value, field or function call", t)
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	c := &call{pos: name.pos, name: name.text}
+	if _, ok := p.accept(")"); ok {
+		return c, nil
+	}
+	for {
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, x)
+		if _, ok := p.accept(")"); ok {
+			return c, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
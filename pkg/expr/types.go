@@ -0,0 +1,266 @@
+package expr
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// kind is the static type of an expression.
+type kind int
+
+const (
+	kindAny kind = iota // Only known at evaluation time.
+	kindNull
+	kindBool
+	kindNumber
+	kindString
+	kindTime
+	kindDuration
+	kindList
+	kindObject
+)
+
+var kindNames = map[kind]string{
+	kindAny:      "any",
+	kindNull:     "null",
+	kindBool:     "bool",
+	kindNumber:   "number",
+	kindString:   "string",
+	kindTime:     "time",
+	kindDuration: "duration",
+	kindList:     "list",
+	kindObject:   "object",
+}
+
+func (k kind) String() string { return kindNames[k] }
+
+var (
+	timeType     = reflect.TypeFor[time.Time]()
+	durationType = reflect.TypeFor[time.Duration]()
+)
+
+// kindOfType returns the static kind of values of a Go type.
+func kindOfType(t reflect.Type) kind {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType || t.Kind() == reflect.Struct && t.ConvertibleTo(timeType):
+		return kindTime
+	case t == durationType:
+		return kindDuration
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return kindBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return kindNumber
+	case reflect.String:
+		return kindString
+	case reflect.Slice, reflect.Array:
+		return kindList
+	case reflect.Struct:
+		return kindObject
+	}
+	return kindAny
+}
+
+// kindOf returns the kind of an evaluated value.
+func kindOf(v any) kind {
+	switch v.(type) {
+	case nil:
+		return kindNull
+	case bool:
+		return kindBool
+	case float64:
+		return kindNumber
+	case string:
+		return kindString
+	case time.Time:
+		return kindTime
+	case time.Duration:
+		return kindDuration
+	case []any:
+		return kindList
+	}
+	return kindObject
+}
+
+// value converts a reflected Go value into an evaluated value: nil, bool, float64, string,
+// time.Time, time.Duration, []any or, for structs and maps, the reflect.Value itself.
+func value(v reflect.Value) any {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	t := v.Type()
+	switch {
+	case t == timeType:
+		return v.Interface()
+	case t.Kind() == reflect.Struct && t.ConvertibleTo(timeType):
+		return v.Convert(timeType).Interface()
+	case t == durationType:
+		return time.Duration(v.Int())
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return []any(nil)
+		}
+		l := make([]any, v.Len())
+		for i := range l {
+			l[i] = value(v.Index(i))
+		}
+		return l
+	}
+	return v
+}
+
+// structField is a field reachable by name from a struct, possibly through embedded structs.
+type structField struct {
+	name  string
+	index []int
+	typ   reflect.Type
+}
+
+var structFieldsCache sync.Map // map[reflect.Type][]structField
+
+// structFields returns the fields of a struct addressed by their JSON names, flattening
+// embedded structs the same way encoding/json does. Fields without a JSON tag use their Go name.
+func structFields(t reflect.Type) []structField {
+	if fs, ok := structFieldsCache.Load(t); ok {
+		return fs.([]structField)
+	}
+	var fs []structField
+	seen := map[string]bool{}
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := range t.NumField() {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			name, _, _ := strings.Cut(tag, ",")
+			if name == "-" {
+				continue
+			}
+			idx := append(append([]int(nil), index...), i)
+			if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+				walk(f.Type, idx)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			fs = append(fs, structField{name: name, index: idx, typ: f.Type})
+		}
+	}
+	walk(t, nil)
+	structFieldsCache.Store(t, fs)
+	return fs
+}
+
+// lookupField finds a struct field by name. Exact matches win over case-insensitive ones.
+func lookupField(t reflect.Type, name string) (structField, bool) {
+	fs := structFields(t)
+	for _, f := range fs {
+		if f.name == name {
+			return f, true
+		}
+	}
+	for _, f := range fs {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+	return structField{}, false
+}
+
+// fieldNames returns the names of all fields of a struct, used for suggestions.
+func fieldNames(t reflect.Type) []string {
+	var names []string
+	for _, f := range structFields(t) {
+		names = append(names, f.name)
+	}
+	return names
+}
+
+// suggest returns the candidate closest to name, if any is close enough to be a likely typo.
+func suggest(name string, candidates []string) string {
+	best, bestDist := "", 3
+	for _, c := range candidates {
+		if d := levenshtein(strings.ToLower(name), strings.ToLower(c)); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func typeName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Name() != "" {
+		return t.Name()
+	}
+	return t.String()
+}
+
+func joinPath(path []string) string { return strings.Join(path, ".") }
+
+// Error is a compile or evaluation error, with the position in the expression that caused it.
+type Error struct {
+	Pos int // Byte offset in the expression.
+	Msg string
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("expr: column %d: %s", e.Pos+1, e.Msg) }
+
+func errorf(pos int, format string, args ...any) error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,240 @@
+// Package plugin serves a provider as a plugin of the CLI, for integrations that can't live in
+// this module. A plugin is an executable calling Serve from main:
+//
+//	func main() {
+//		flag.Parse()
+//		if err := plugin.Serve("acme", acme.Creator, supermarket.CapabilityClip); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+//
+// and registered with --plugins=acme=/path/to/acme-plugin. The CLI talks to the plugin over its
+// stdin and stdout, so the plugin must log to stderr and never write to stdout.
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/csobrinho/supermarket-api/internal/pluginrpc"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+)
+
+// Serve serves the provider over stdin and stdout until the CLI shuts it down or closes stdin.
+// Without capabilities, the provider has the supermarket.DefaultCapabilities. Logs are written to
+// stderr, which the CLI logs at debug level in its plugin subsystem, e.g. with
+// --log_level=info,plugin=debug.
+func Serve(name string, creator supermarket.Creator, capabilities ...supermarket.Capability) error {
+	return ServeConn(context.Background(), os.Stdin, os.Stdout, name, creator, capabilities...)
+}
+
+// ServeConn serves the provider over the reader and writer, e.g. pipes in tests.
+func ServeConn(ctx context.Context, r io.Reader, w io.Writer, name string, creator supermarket.Creator, capabilities ...supermarket.Capability) error {
+	if len(capabilities) == 0 {
+		capabilities = supermarket.DefaultCapabilities
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s := &server{
+		name:    name,
+		creator: creator,
+		caps:    capabilities,
+		conn:    pluginrpc.NewConn(r, w),
+		cancels: map[int64]context.CancelFunc{},
+	}
+	defer s.wg.Wait()
+	for {
+		m, err := s.conn.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("plugin: read message, error %w", err)
+		}
+		switch {
+		case m.Method == pluginrpc.MethodCancel:
+			p := pluginrpc.CancelParams{}
+			if json.Unmarshal(m.Params, &p) == nil {
+				s.cancel(p.ID)
+			}
+		case m.ID == nil:
+			// Unknown notifications are ignored.
+		case m.Method == pluginrpc.MethodShutdown:
+			s.wg.Wait()
+			return s.conn.Write(pluginrpc.Response(m.ID, struct{}{}, nil))
+		case m.Method == pluginrpc.MethodHandshake || m.Method == pluginrpc.MethodConfigure:
+			// Handled in order, before any other request.
+			s.reply(m, s.handle(ctx, m))
+		default:
+			rctx, rcancel := context.WithCancel(ctx)
+			s.mu.Lock()
+			s.cancels[*m.ID] = rcancel
+			s.mu.Unlock()
+			s.wg.Go(func() {
+				defer s.cancel(*m.ID)
+				s.reply(m, s.handle(rctx, m))
+			})
+		}
+	}
+}
+
+type server struct {
+	name    string
+	creator supermarket.Creator
+	caps    supermarket.Capabilities
+	conn    *pluginrpc.Conn
+	wg      sync.WaitGroup
+
+	mu      sync.Mutex
+	cancels map[int64]context.CancelFunc
+	as      supermarket.AuthService
+	ps      supermarket.PromotionService
+}
+
+type result struct {
+	v   any
+	err *pluginrpc.Error
+}
+
+func (s *server) cancel(id int64) {
+	s.mu.Lock()
+	cancel, ok := s.cancels[id]
+	delete(s.cancels, id)
+	s.mu.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+func (s *server) reply(m *pluginrpc.Message, r result) {
+	// The CLI is gone if this fails, the next read returns EOF.
+	_ = s.conn.Write(pluginrpc.Response(m.ID, r.v, r.err))
+}
+
+func (s *server) handle(ctx context.Context, m *pluginrpc.Message) result {
+	switch m.Method {
+	case pluginrpc.MethodHandshake:
+		p := pluginrpc.HandshakeParams{}
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return invalidParams(err)
+		}
+		caps := make([]string, 0, len(s.caps))
+		for _, c := range s.caps {
+			caps = append(caps, string(c))
+		}
+		// The CLI checks the version, so it can report the mismatch.
+		return result{v: pluginrpc.HandshakeResult{ProtocolVersion: pluginrpc.Version, Name: s.name, Capabilities: caps}}
+
+	case pluginrpc.MethodConfigure:
+		p := pluginrpc.ConfigureParams{}
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return invalidParams(err)
+		}
+		return s.configure(ctx, p.Config)
+	}
+
+	s.mu.Lock()
+	as, ps := s.as, s.ps
+	s.mu.Unlock()
+	if as == nil || ps == nil {
+		return result{err: &pluginrpc.Error{Code: pluginrpc.CodeNotConfigured, Message: "plugin: provider not configured"}}
+	}
+
+	switch m.Method {
+	case pluginrpc.MethodAuthToken:
+		t, err := as.TokenSource().Token()
+		return response(pluginrpc.TokenResult{Token: t}, err)
+
+	case pluginrpc.MethodAuthRefreshToken:
+		t, err := as.RefreshToken(ctx)
+		return response(pluginrpc.TokenResult{Token: t}, err)
+
+	case pluginrpc.MethodAuthIsAuthenticated:
+		return result{v: pluginrpc.IsAuthenticatedResult{Authenticated: as.IsAuthenticated(ctx)}}
+
+	case pluginrpc.MethodPromotionGetClipDeals:
+		p := pluginrpc.GetClipDealsParams{}
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return invalidParams(err)
+		}
+		cds, err := ps.GetClipDeals(ctx, p.Options)
+		return response(pluginrpc.GetClipDealsResult{Deals: cds}, err)
+
+	case pluginrpc.MethodPromotionClipDeal, pluginrpc.MethodPromotionUnclipDeal:
+		p := pluginrpc.ClipDealParams{}
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return invalidParams(err)
+		}
+		if m.Method == pluginrpc.MethodPromotionClipDeal {
+			return response(struct{}{}, ps.ClipDeal(ctx, p.Deal))
+		}
+		u, ok := ps.(supermarket.Unclipper)
+		if !ok {
+			return result{err: &pluginrpc.Error{Code: pluginrpc.CodeUnsupported, Message: fmt.Sprintf("plugin: %q doesn't support %s", s.name, supermarket.CapabilityUnclip)}}
+		}
+		return response(struct{}{}, u.UnclipDeal(ctx, p.Deal))
+	}
+	return result{err: &pluginrpc.Error{Code: pluginrpc.CodeMethodNotFound, Message: fmt.Sprintf("plugin: unknown method %q", m.Method)}}
+}
+
+func (s *server) configure(ctx context.Context, c pluginrpc.Config) result {
+	cfg := &supermarket.Config{
+		UserAgent:    c.UserAgent,
+		AppVersion:   c.AppVersion,
+		RefreshToken: c.RefreshToken,
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		RedirectURL:  c.RedirectURL,
+		Username:     c.Username,
+		Password:     c.Password,
+		LoyaltyCard:  c.LoyaltyCard,
+		ApiKey:       c.ApiKey,
+		Timeout:      c.Timeout,
+		Debug:        c.Debug,
+		StoreID:      c.StoreID,
+		Banner:       c.Banner,
+		BaseURL:      c.BaseURL,
+	}
+	sm, err := s.creator(ctx, cfg)
+	if err != nil {
+		return response(nil, err)
+	}
+	as, err := sm.Authenticator()
+	if err != nil {
+		return response(nil, err)
+	}
+	ps, err := sm.Promotion()
+	if err != nil {
+		return response(nil, err)
+	}
+	s.mu.Lock()
+	s.as, s.ps = as, ps
+	s.mu.Unlock()
+	return result{v: struct{}{}}
+}
+
+// response returns the result, or the error mapped to the codes of the protocol.
+func response(v any, err error) result {
+	if err == nil {
+		return result{v: v}
+	}
+	code := pluginrpc.CodeInternalError
+	switch {
+	case errors.Is(err, supermarket.ErrClipLimitReached):
+		code = pluginrpc.CodeClipLimitReached
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		code = pluginrpc.CodeCanceled
+	case errors.Is(err, supermarket.ErrUnsupported):
+		code = pluginrpc.CodeUnsupported
+	}
+	return result{err: &pluginrpc.Error{Code: code, Message: err.Error()}}
+}
+
+func invalidParams(err error) result {
+	return result{err: &pluginrpc.Error{Code: pluginrpc.CodeInvalidParams, Message: fmt.Sprintf("plugin: invalid params, error %v", err)}}
+}
@@ -0,0 +1,73 @@
+package supermarket
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrUnsupported is returned when a provider lacks the capability an operation needs.
+var ErrUnsupported = errors.New("supermarket: unsupported")
+
+// Capability is an optional feature of a provider.
+type Capability string
+
+const (
+	CapabilityClip            Capability = "clip"             // Clips deals, every provider does.
+	CapabilityUnclip          Capability = "unclip"           // Removes clipped deals, see Unclipper.
+	CapabilityBatchClip       Capability = "batch_clip"       // Clips several deals in one request.
+	CapabilityStoreLookup     Capability = "store_lookup"     // Searches for stores.
+	CapabilityPurchaseHistory Capability = "purchase_history" // Lists the purchases of the account.
+)
+
+// DefaultCapabilities are the capabilities of providers that don't declare any.
+var DefaultCapabilities = Capabilities{CapabilityClip}
+
+// Capabilities is a set of capabilities.
+type Capabilities []Capability
+
+// Has reports whether the capability is in the set.
+func (c Capabilities) Has(capability Capability) bool { return slices.Contains(c, capability) }
+
+// Require returns an error wrapping ErrUnsupported if the provider lacks the capability.
+func (c Capabilities) Require(provider string, capability Capability) error {
+	if c.Has(capability) {
+		return nil
+	}
+	return fmt.Errorf("supermarket: %q doesn't support %s (supported: %s), %w", provider, capability, c, ErrUnsupported)
+}
+
+func (c Capabilities) String() string {
+	s := make([]string, 0, len(c))
+	for _, capability := range c {
+		s = append(s, string(capability))
+	}
+	return strings.Join(s, ", ")
+}
+
+// Capable is implemented by supermarkets that declare their capabilities.
+type Capable interface {
+	Capabilities() Capabilities
+}
+
+// CapabilitiesOf returns the capabilities declared by the supermarket or, if it doesn't declare
+// any, the ones detected from the optional interfaces of its promotion service.
+func CapabilitiesOf(sm Supermarket) Capabilities {
+	if c, ok := sm.(Capable); ok {
+		return c.Capabilities()
+	}
+	ret := slices.Clone(DefaultCapabilities)
+	if ps, err := sm.Promotion(); err == nil {
+		if _, ok := ps.(Unclipper); ok {
+			ret = append(ret, CapabilityUnclip)
+		}
+	}
+	return ret
+}
+
+// ProviderInfo describes a registered provider.
+type ProviderInfo struct {
+	Name         string       `json:"provider"`
+	Capabilities Capabilities `json:"capabilities"`
+}
@@ -0,0 +1,84 @@
+package supermarket_test
+
+import (
+	"errors"
+	"flag"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"github.com/csobrinho/supermarket-api/providers/fake"
+)
+
+func TestCapabilities(t *testing.T) {
+	c := supermarket.Capabilities{supermarket.CapabilityClip, supermarket.CapabilityStoreLookup}
+	tests := []struct {
+		capability supermarket.Capability
+		want       bool
+	}{
+		{supermarket.CapabilityClip, true},
+		{supermarket.CapabilityStoreLookup, true},
+		{supermarket.CapabilityUnclip, false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := c.Has(tt.capability); got != tt.want {
+			t.Errorf("Has(%q) = %v, want %v", tt.capability, got, tt.want)
+		}
+		err := c.Require("kroger", tt.capability)
+		if tt.want && err != nil {
+			t.Errorf("Require(%q) = %v, want nil", tt.capability, err)
+		}
+		if !tt.want && (!errors.Is(err, supermarket.ErrUnsupported) || !strings.Contains(err.Error(), "supported: clip, store_lookup")) {
+			t.Errorf("Require(%q) = %v, want %v listing the supported capabilities", tt.capability, err, supermarket.ErrUnsupported)
+		}
+	}
+	if got := (supermarket.Capabilities(nil)).Has(supermarket.CapabilityClip); got {
+		t.Error("Has() of no capabilities = true, want false")
+	}
+}
+
+func TestAvailable(t *testing.T) {
+	f := supermarket.NewFactory()
+	f.Register("walgreens", fake.Creator)
+	f.Register("fake", fake.Creator, fake.Capabilities...)
+	f.Register("kroger", fake.Creator, supermarket.CapabilityClip, supermarket.CapabilityStoreLookup)
+	got := f.Available()
+	want := []supermarket.ProviderInfo{
+		{Name: "fake", Capabilities: fake.Capabilities},
+		{Name: "kroger", Capabilities: supermarket.Capabilities{supermarket.CapabilityClip, supermarket.CapabilityStoreLookup}},
+		// Providers registered without capabilities have the defaults.
+		{Name: "walgreens", Capabilities: supermarket.DefaultCapabilities},
+	}
+	if !slices.EqualFunc(got, want, func(a, b supermarket.ProviderInfo) bool {
+		return a.Name == b.Name && slices.Equal(a.Capabilities, b.Capabilities)
+	}) {
+		t.Errorf("Available() = %v, want %v", got, want)
+	}
+	// The capabilities are copies, changing them doesn't change the factory.
+	got[0].Capabilities[0] = supermarket.CapabilityBatchClip
+	if info, err := f.Lookup("fake"); err != nil || !slices.Equal(info.Capabilities, fake.Capabilities) {
+		t.Errorf("Lookup() = %v, %v, want the capabilities %v", info, err, fake.Capabilities)
+	}
+	if _, err := f.Lookup("missing"); err == nil {
+		t.Error("Lookup(missing) succeeded, want an error")
+	}
+}
+
+func TestConfigSetFlags(t *testing.T) {
+	var catalog string
+	var limit int
+	fs := flag.NewFlagSet("fake", flag.ContinueOnError)
+	fs.StringVar(&catalog, "fake_catalog", "default.json", "")
+	fs.IntVar(&limit, "fake_clip_limit", 0, "")
+	cfg := &supermarket.Config{Flags: map[string]string{"fake_clip_limit": "3", "safeway_token_url": "http://token"}}
+	// The flags of other providers are ignored.
+	if err := cfg.SetFlags(fs); err != nil || catalog != "default.json" || limit != 3 {
+		t.Errorf("SetFlags() = %v, catalog %q, limit %d, want only the limit set", err, catalog, limit)
+	}
+	cfg.Flags["fake_clip_limit"] = "many"
+	if err := cfg.SetFlags(fs); err == nil || !strings.Contains(err.Error(), "invalid flag fake_clip_limit") {
+		t.Errorf("SetFlags() with an invalid value = %v, want an error", err)
+	}
+}
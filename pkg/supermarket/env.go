@@ -4,25 +4,33 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/google/logger"
+	"github.com/csobrinho/supermarket-api/internal/logging"
 )
 
+var log = logging.For("supermarket")
+
+// LookupEnv returns the value of the environment variable key, or def if it is unset or empty.
 func LookupEnv(key string, def string) string {
 	if v, ok := os.LookupEnv(key); ok && v != "" {
 		return v
 	}
 	return def
 }
+
+// LookupEnvInt is like LookupEnv for an int, def is also returned if the value isn't valid.
 func LookupEnvInt(key string, def int) int {
 	if v, ok := os.LookupEnv(key); ok && v != "" {
 		if vi, err := strconv.Atoi(v); err == nil {
 			return vi
 		}
-		logger.Warningf("supermarket: %q is not a valid int (%q), using default value %d", key, v, def)
+		log.Warn("invalid int env, using the default value", "env", key, "value", v, "default", def)
 	}
 	return def
 }
+
+// LookupEnvBool is like LookupEnv for a bool, accepting true/false, 1/0, yes/no and on/off.
 func LookupEnvBool(key string, def bool) bool {
 	if v, ok := os.LookupEnv(key); ok && v != "" {
 		switch strings.ToLower(v) {
@@ -31,8 +39,31 @@ func LookupEnvBool(key string, def bool) bool {
 		case "false", "0", "no", "off":
 			return false
 		default:
-			logger.Warningf("supermarket: %q is not a valid bool (%q), using default value %t", key, v, def)
+			log.Warn("invalid bool env, using the default value", "env", key, "value", v, "default", def)
+		}
+	}
+	return def
+}
+
+// LookupEnvFloat is like LookupEnv for a float, def is also returned if the value isn't valid.
+func LookupEnvFloat(key string, def float64) float64 {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		if vf, err := strconv.ParseFloat(v, 64); err == nil {
+			return vf
+		}
+		log.Warn("invalid float env, using the default value", "env", key, "value", v, "default", def)
+	}
+	return def
+}
+
+// LookupEnvDuration is like LookupEnv for a time.Duration such as "1h30m", def is also returned
+// if the value isn't valid.
+func LookupEnvDuration(key string, def time.Duration) time.Duration {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		if vd, err := time.ParseDuration(v); err == nil {
+			return vd
 		}
+		log.Warn("invalid duration env, using the default value", "env", key, "value", v, "default", def)
 	}
 	return def
 }
@@ -0,0 +1,4 @@
+package supermarket
+
+// KillPlugin kills the process of a provider created from a plugin.
+func KillPlugin(sm Supermarket) { sm.(*pluginSupermarket).c.kill() }
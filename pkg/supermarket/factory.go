@@ -3,21 +3,29 @@ package supermarket
 import (
 	"context"
 	"fmt"
+	"slices"
 	"sort"
 	"sync"
 	"time"
 
-	"github.com/google/logger"
+	"github.com/csobrinho/supermarket-api/internal/logging"
 	"golang.org/x/exp/maps"
 )
 
 type Factory interface {
 	// CreateSupermarket creates a new supermarket instance.
 	Create(ctx context.Context, name string, opts ...Option) (Supermarket, error)
-	// RegisterSupermarket registers a new supermarket creator function.
-	Register(name string, creator Creator)
-	// Available returns a list of registered supermarkets.
-	Available() []string
+	// RegisterSupermarket registers a new supermarket creator function, with the capabilities of
+	// the provider. Without any, the provider has the DefaultCapabilities.
+	Register(name string, creator Creator, capabilities ...Capability)
+	// RegisterPlugin registers an executable speaking the plugin protocol as a provider. It isn't
+	// started until the provider is created or looked up.
+	RegisterPlugin(name, path string, args ...string) error
+	// Available returns the registered supermarkets, sorted by name, without starting plugins.
+	Available() []ProviderInfo
+	// Lookup returns the registered supermarket with the given name, starting a plugin for its
+	// handshake the first time.
+	Lookup(name string) (ProviderInfo, error)
 }
 
 // Creator is a function that creates a supermarket instance.
@@ -26,22 +34,31 @@ type Creator func(ctx context.Context, cfg *Config) (Supermarket, error)
 type factory struct {
 	mu        sync.RWMutex
 	factories map[string]Creator
+	infos     map[string]ProviderInfo
+	plugins   map[string]*plugin
 }
 
 // NewFactory creates a new factory instance.
 func NewFactory() Factory {
 	return &factory{
 		factories: make(map[string]Creator),
+		infos:     make(map[string]ProviderInfo),
+		plugins:   make(map[string]*plugin),
 	}
 }
 
 // Register registers a new supermarket creator function.
-func (f *factory) Register(name string, creator Creator) {
+func (f *factory) Register(name string, creator Creator, capabilities ...Capability) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
+	if len(capabilities) == 0 {
+		capabilities = DefaultCapabilities
+	}
 	f.factories[name] = creator
-	logger.Infof("supermarket: registered %q provider", name)
+	f.infos[name] = ProviderInfo{Name: name, Capabilities: slices.Clone(capabilities)}
+	delete(f.plugins, name)
+	log.Debug("registered provider", logging.KeyProvider, name)
 }
 
 // Create creates a new supermarket instance.
@@ -60,12 +77,44 @@ func (f *factory) Create(ctx context.Context, name string, opts ...Option) (Supe
 	return creator(ctx, cfg)
 }
 
-// AvailableSupermarkets returns a list of registered supermarkets.
-func (f *factory) Available() []string {
+// Available returns the registered supermarkets, sorted by name. Plugins aren't started, those
+// that haven't been yet have no capabilities.
+func (f *factory) Available() []ProviderInfo {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
 
-	names := maps.Keys(f.factories)
+	names := maps.Keys(f.infos)
 	sort.Strings(names)
-	return names
+	ret := make([]ProviderInfo, 0, len(names))
+	for _, name := range names {
+		info := f.infos[name]
+		info.Capabilities = slices.Clone(info.Capabilities)
+		if p, ok := f.plugins[name]; ok {
+			info.Capabilities = p.known()
+		}
+		ret = append(ret, info)
+	}
+	return ret
+}
+
+// Lookup returns the registered supermarket with the given name. A plugin is started for its
+// handshake, unless it already was.
+func (f *factory) Lookup(name string) (ProviderInfo, error) {
+	f.mu.RLock()
+	info, exists := f.infos[name]
+	p := f.plugins[name]
+	f.mu.RUnlock()
+
+	if !exists {
+		return ProviderInfo{}, fmt.Errorf("supermarket: %q is not registered", name)
+	}
+	info.Capabilities = slices.Clone(info.Capabilities)
+	if p != nil {
+		caps, err := p.capabilities()
+		if err != nil {
+			return ProviderInfo{}, err
+		}
+		info.Capabilities = caps
+	}
+	return info, nil
 }
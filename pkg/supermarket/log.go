@@ -0,0 +1,27 @@
+package supermarket
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/csobrinho/supermarket-api/internal/logging"
+)
+
+// SetLogHandler sends the logs of the library and its providers to the handler, e.g. the one of the
+// application's logger, instead of stderr. Records have a "subsystem" attribute naming their
+// origin, e.g. "clipper", "http" or the provider, and the ones about a deal or a request have
+// "provider", "account", "deal_id", "http_status" and "duration" attributes where known.
+func SetLogHandler(h slog.Handler) { logging.SetHandler(h) }
+
+// SetLogLevel sets the minimum level of the logs of the subsystem, or of the subsystems without
+// their own level when the subsystem is empty. The default is slog.LevelInfo.
+func SetLogLevel(subsystem string, level slog.Level) { logging.SetLevel(subsystem, level) }
+
+// Logger returns the logger of the subsystem, e.g. for providers outside this module.
+func Logger(subsystem string) *slog.Logger { return logging.For(subsystem) }
+
+// WithLogAttrs returns a context whose logs have the attributes, e.g. the account of a request.
+// The arguments are key-value pairs or slog.Attr, as in slog.Logger.With.
+func WithLogAttrs(ctx context.Context, args ...any) context.Context {
+	return logging.WithAttrs(ctx, args...)
+}
@@ -0,0 +1,28 @@
+package supermarket_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+)
+
+func TestSetLogHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	supermarket.SetLogHandler(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	t.Cleanup(func() { supermarket.SetLogHandler(nil) })
+	supermarket.SetLogLevel("test-lib", slog.LevelDebug)
+
+	ctx := supermarket.WithLogAttrs(context.Background(), "account", "me")
+	log := supermarket.Logger("test-lib")
+	// The level of the application's handler applies too.
+	log.DebugContext(ctx, "dropped")
+	log.InfoContext(ctx, "hello", "deal_id", "1")
+	got := buf.String()
+	if want := `"msg":"hello","subsystem":"test-lib","account":"me","deal_id":"1"}`; !strings.Contains(got, want) || strings.Contains(got, "dropped") {
+		t.Errorf("Logger() wrote %q, want only %q", got, want)
+	}
+}
@@ -1,16 +1,46 @@
 package supermarket
 
-import "time"
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+)
 
 type Config struct {
 	UserAgent    string
 	AppVersion   string
 	RefreshToken string
 	ClientID     string
+	ClientSecret string
+	RedirectURL  string // OAuth2 redirect URL for the authorization code flow.
+	Username     string // Login of providers authenticating with a password.
+	Password     string
+	LoyaltyCard  string // Loyalty card number, e.g. the CVS ExtraCare card.
 	ApiKey       string
 	Timeout      time.Duration
 	Debug        bool
 	StoreID      string
+	Banner       string            // Store banner for providers serving several, e.g. "vons".
+	BaseURL      string            // Overrides the API base URL of the provider, e.g. to use a fake server.
+	Transport    http.RoundTripper // If set, sends the requests of the provider, e.g. to record them.
+	// Flags override the flags of the providers for this client, by name, e.g. fake_catalog for
+	// one account of a process clipping several.
+	Flags map[string]string
+}
+
+// SetFlags sets the flags of fs to their value in Flags. Flags that fs doesn't define, e.g. the ones
+// of other providers, are ignored.
+func (c *Config) SetFlags(fs *flag.FlagSet) error {
+	for name, v := range c.Flags {
+		if fs.Lookup(name) == nil {
+			continue
+		}
+		if err := fs.Set(name, v); err != nil {
+			return fmt.Errorf("supermarket: invalid flag %s, error %w", name, err)
+		}
+	}
+	return nil
 }
 
 type Option func(*Config)
@@ -23,6 +53,30 @@ func WithCredentials(clientId, refreshToken string) Option {
 	}
 }
 
+// WithClientSecret sets the OAuth2 client secret.
+func WithClientSecret(clientSecret string) Option {
+	return func(c *Config) { c.ClientSecret = clientSecret }
+}
+
+// WithRedirectURL sets the OAuth2 redirect URL for the authorization code flow.
+func WithRedirectURL(redirectURL string) Option {
+	return func(c *Config) { c.RedirectURL = redirectURL }
+}
+
+// WithBaseURL overrides the API base URL of the provider.
+func WithBaseURL(baseURL string) Option { return func(c *Config) { c.BaseURL = baseURL } }
+
+// WithLogin sets the username and password, for providers that log in with them.
+func WithLogin(username, password string) Option {
+	return func(c *Config) {
+		c.Username = username
+		c.Password = password
+	}
+}
+
+// WithLoyaltyCard sets the loyalty card number.
+func WithLoyaltyCard(card string) Option { return func(c *Config) { c.LoyaltyCard = card } }
+
 // WithApiKey sets the API key.
 func WithApiKey(apiKey string) Option { return func(c *Config) { c.ApiKey = apiKey } }
 
@@ -40,3 +94,12 @@ func WithTimeout(timeout time.Duration) Option { return func(c *Config) { c.Time
 
 // WithDebug enables debug logging.
 func WithDebug(debug bool) Option { return func(c *Config) { c.Debug = debug } }
+
+// WithBanner sets the store banner, for providers that serve several.
+func WithBanner(banner string) Option { return func(c *Config) { c.Banner = banner } }
+
+// WithTransport sets the transport that sends the requests of the provider.
+func WithTransport(rt http.RoundTripper) Option { return func(c *Config) { c.Transport = rt } }
+
+// WithFlags overrides the flags of the provider, by name, for the client.
+func WithFlags(flags map[string]string) Option { return func(c *Config) { c.Flags = flags } }
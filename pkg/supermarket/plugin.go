@@ -0,0 +1,450 @@
+package supermarket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/auth"
+	"github.com/csobrinho/supermarket-api/internal/logging"
+	"github.com/csobrinho/supermarket-api/internal/pluginrpc"
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"golang.org/x/oauth2"
+)
+
+var _ Supermarket = (*pluginSupermarket)(nil)
+var _ Capable = (*pluginSupermarket)(nil)
+var _ io.Closer = (*pluginSupermarket)(nil)
+var _ Unclipper = (*pluginUnclipper)(nil)
+
+// ErrPluginExited is returned by the calls to a plugin whose process exited.
+var ErrPluginExited = errors.New("supermarket: plugin exited")
+
+var pluginLog = logging.For("plugin")
+
+const (
+	pluginHandshakeTimeout = 10 * time.Second
+	pluginShutdownTimeout  = 5 * time.Second
+	pluginStderrTail       = 4096 // Bytes of the stderr of a plugin kept to explain crashes.
+)
+
+// RegisterPlugin registers the executable as a provider. The executable isn't started until the
+// provider is created or looked up, which performs the handshake to check it speaks the plugin
+// protocol and learn its capabilities. It is started again every time the provider is created. See
+// pkg/plugin to write plugins.
+func (f *factory) RegisterPlugin(name, path string, args ...string) error {
+	if _, err := exec.LookPath(path); err != nil {
+		return fmt.Errorf("supermarket: register plugin %q, error %w", name, err)
+	}
+	p := &plugin{name: name, path: path, args: args}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.factories[name] = p.create
+	f.infos[name] = ProviderInfo{Name: name}
+	f.plugins[name] = p
+	log.Debug("registered plugin", logging.KeyProvider, name, "path", path)
+	return nil
+}
+
+// plugin is a registered plugin, whose capabilities are learned from its first handshake.
+type plugin struct {
+	name string
+	path string
+	args []string
+
+	mu   sync.Mutex
+	caps Capabilities // Nil until the first handshake.
+}
+
+// capabilities returns the capabilities of the plugin, starting it for the handshake if it hasn't
+// been started yet.
+func (p *plugin) capabilities() (Capabilities, error) {
+	if caps := p.known(); caps != nil {
+		return caps, nil
+	}
+	c, caps, err := p.start()
+	if err != nil {
+		return nil, err
+	}
+	_ = c.Close()
+	return caps, nil
+}
+
+// known returns the capabilities learned from the last handshake, or nil if there wasn't any.
+func (p *plugin) known() Capabilities {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.caps)
+}
+
+// start starts the plugin process and caches the capabilities of its handshake.
+func (p *plugin) start() (*pluginClient, Capabilities, error) {
+	c, hs, err := startPlugin(p.name, p.path, p.args)
+	if err != nil {
+		return nil, nil, err
+	}
+	caps := make(Capabilities, 0, len(hs.Capabilities))
+	for _, capability := range hs.Capabilities {
+		caps = append(caps, Capability(capability))
+	}
+	p.mu.Lock()
+	if p.caps == nil {
+		pluginLog.Info("plugin handshake", "plugin", p.name, "path", p.path, logging.KeyProvider, hs.Name, "protocol_version", hs.ProtocolVersion)
+	}
+	p.caps = caps
+	p.mu.Unlock()
+	return c, slices.Clone(caps), nil
+}
+
+func (p *plugin) create(ctx context.Context, cfg *Config) (Supermarket, error) {
+	c, caps, err := p.start()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Timeout > 0 {
+		c.timeout = cfg.Timeout
+	}
+	if cfg.Transport != nil {
+		pluginLog.Warn("plugin can't use the configured transport, it sends its own requests", "plugin", p.name)
+	}
+	params := pluginrpc.ConfigureParams{Config: pluginrpc.Config{
+		UserAgent:    cfg.UserAgent,
+		AppVersion:   cfg.AppVersion,
+		RefreshToken: cfg.RefreshToken,
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		Username:     cfg.Username,
+		Password:     cfg.Password,
+		LoyaltyCard:  cfg.LoyaltyCard,
+		ApiKey:       cfg.ApiKey,
+		Timeout:      cfg.Timeout,
+		Debug:        cfg.Debug,
+		StoreID:      cfg.StoreID,
+		Banner:       cfg.Banner,
+		BaseURL:      cfg.BaseURL,
+	}}
+	if err := c.call(ctx, pluginrpc.MethodConfigure, params, nil); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return &pluginSupermarket{c: c, caps: caps}, nil
+}
+
+// pluginSupermarket is a provider served by a plugin process. Close stops the process.
+type pluginSupermarket struct {
+	c    *pluginClient
+	caps Capabilities
+}
+
+func (s *pluginSupermarket) Authenticator() (auth.Service, error) { return pluginAuth{s.c}, nil }
+func (s *pluginSupermarket) Promotion() (promotion.Service, error) {
+	if s.caps.Has(CapabilityUnclip) {
+		return pluginUnclipper{pluginPromotion{s.c}}, nil
+	}
+	return pluginPromotion{s.c}, nil
+}
+func (s *pluginSupermarket) Capabilities() Capabilities { return slices.Clone(s.caps) }
+func (s *pluginSupermarket) Close() error               { return s.c.Close() }
+
+type pluginAuth struct{ c *pluginClient }
+
+func (a pluginAuth) TokenSource() oauth2.TokenSource { return a }
+func (a pluginAuth) Token() (*oauth2.Token, error) {
+	res := pluginrpc.TokenResult{}
+	if err := a.c.call(context.Background(), pluginrpc.MethodAuthToken, nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Token, nil
+}
+func (a pluginAuth) RefreshToken(ctx context.Context) (*oauth2.Token, error) {
+	res := pluginrpc.TokenResult{}
+	if err := a.c.call(ctx, pluginrpc.MethodAuthRefreshToken, nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Token, nil
+}
+func (a pluginAuth) IsAuthenticated(ctx context.Context) bool {
+	res := pluginrpc.IsAuthenticatedResult{}
+	if err := a.c.call(ctx, pluginrpc.MethodAuthIsAuthenticated, nil, &res); err != nil {
+		pluginLog.WarnContext(ctx, "plugin authentication check failed", "plugin", a.c.name, logging.KeyError, err)
+		return false
+	}
+	return res.Authenticated
+}
+
+type pluginPromotion struct{ c *pluginClient }
+
+func (p pluginPromotion) GetClipDeals(ctx context.Context, opts PromotionSearchOptions) ([]ClipDeal, error) {
+	res := pluginrpc.GetClipDealsResult{}
+	if err := p.c.call(ctx, pluginrpc.MethodPromotionGetClipDeals, pluginrpc.GetClipDealsParams{Options: opts}, &res); err != nil {
+		return nil, err
+	}
+	return res.Deals, nil
+}
+func (p pluginPromotion) ClipDeal(ctx context.Context, cd ClipDeal) error {
+	return p.c.call(ctx, pluginrpc.MethodPromotionClipDeal, pluginrpc.ClipDealParams{Deal: cd}, nil)
+}
+
+type pluginUnclipper struct{ pluginPromotion }
+
+func (p pluginUnclipper) UnclipDeal(ctx context.Context, cd ClipDeal) error {
+	return p.c.call(ctx, pluginrpc.MethodPromotionUnclipDeal, pluginrpc.ClipDealParams{Deal: cd}, nil)
+}
+
+// pluginClient is the connection to a plugin process.
+type pluginClient struct {
+	name    string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stdout  io.ReadCloser
+	conn    *pluginrpc.Conn
+	stderr  *tailWriter
+	timeout time.Duration // Of every call.
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan *pluginrpc.Message
+
+	killed  atomic.Bool
+	done    chan struct{} // Closed once the process exited.
+	exitErr error
+}
+
+// startPlugin starts the plugin process and performs the handshake.
+func startPlugin(name, path string, args []string) (*pluginClient, *pluginrpc.HandshakeResult, error) {
+	cmd := exec.Command(path, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("supermarket: plugin %q stdin, error %w", name, err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("supermarket: plugin %q stdout, error %w", name, err)
+	}
+	c := &pluginClient{
+		name:    name,
+		cmd:     cmd,
+		stdin:   stdin,
+		stdout:  stdout,
+		conn:    pluginrpc.NewConn(stdout, stdin),
+		stderr:  &tailWriter{name: name},
+		timeout: 30 * time.Second,
+		pending: map[int64]chan *pluginrpc.Message{},
+		done:    make(chan struct{}),
+	}
+	cmd.Stderr = c.stderr
+	// Children of the plugin may keep stderr open after it is killed.
+	cmd.WaitDelay = time.Second
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("supermarket: start plugin %q, error %w", name, err)
+	}
+	go c.readLoop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), pluginHandshakeTimeout)
+	defer cancel()
+	hs := &pluginrpc.HandshakeResult{}
+	if err := c.call(ctx, pluginrpc.MethodHandshake, pluginrpc.HandshakeParams{ProtocolVersion: pluginrpc.Version}, hs); err != nil {
+		c.kill()
+		return nil, nil, err
+	}
+	if hs.ProtocolVersion != pluginrpc.Version {
+		_ = c.Close()
+		return nil, nil, fmt.Errorf("supermarket: plugin %q speaks protocol v%d, want v%d", name, hs.ProtocolVersion, pluginrpc.Version)
+	}
+	return c, hs, nil
+}
+
+// readLoop routes the responses to the pending calls until the process closes its stdout, then
+// waits for it to exit.
+func (c *pluginClient) readLoop() {
+	var err error
+	for {
+		var m *pluginrpc.Message
+		if m, err = c.conn.Read(); err != nil {
+			break
+		}
+		if m.ID == nil {
+			pluginLog.Warn("plugin sent an unexpected notification", "plugin", c.name, "method", m.Method)
+			continue
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[*m.ID]
+		delete(c.pending, *m.ID)
+		c.mu.Unlock()
+		if ok {
+			ch <- m
+		}
+	}
+	reason := ""
+	if !errors.Is(err, io.EOF) && !c.killed.Load() {
+		// The plugin wrote something else than the protocol to stdout, it can't be trusted anymore.
+		reason = fmt.Sprintf("protocol error %v", err)
+		pluginLog.Error("plugin protocol error", "plugin", c.name, logging.KeyError, err)
+		c.kill()
+	}
+	werr := c.cmd.Wait()
+	switch {
+	case reason != "":
+	case werr != nil:
+		reason = werr.Error()
+	default:
+		reason = "exit status 0"
+	}
+	c.exitErr = fmt.Errorf("supermarket: plugin %q %s%s, %w", c.name, reason, c.stderr.Tail(), ErrPluginExited)
+	close(c.done)
+}
+
+// kill kills the process, and stops reading its stdout, which its children may keep open.
+func (c *pluginClient) kill() {
+	c.killed.Store(true)
+	_ = c.cmd.Process.Kill()
+	_ = c.stdout.Close()
+}
+
+// call sends the request and decodes the result of its response, if result isn't nil.
+func (c *pluginClient) call(ctx context.Context, method string, params, result any) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	ch := make(chan *pluginrpc.Message, 1)
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	req, err := pluginrpc.Request(&id, method, params)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-c.done:
+		return c.exitErr
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("supermarket: plugin %q %s, error %w", c.name, method, err)
+	}
+	if err := c.conn.Write(req); err != nil {
+		// Most likely the process exited, prefer its exit status and stderr.
+		select {
+		case <-c.done:
+			return c.exitErr
+		case <-time.After(time.Second):
+			return fmt.Errorf("supermarket: plugin %q %s, error %w", c.name, method, err)
+		}
+	}
+
+	select {
+	case m := <-ch:
+		if m.Error != nil {
+			return fmt.Errorf("supermarket: plugin %q %s, error %w", c.name, method, pluginError(m.Error))
+		}
+		if result != nil {
+			if err := json.Unmarshal(m.Result, result); err != nil {
+				return fmt.Errorf("supermarket: plugin %q %s, error decoding %w", c.name, method, err)
+			}
+		}
+		return nil
+	case <-ctx.Done():
+		if n, err := pluginrpc.Request(nil, pluginrpc.MethodCancel, pluginrpc.CancelParams{ID: id}); err == nil {
+			_ = c.conn.Write(n)
+		}
+		return fmt.Errorf("supermarket: plugin %q %s, error %w", c.name, method, ctx.Err())
+	case <-c.done:
+		return c.exitErr
+	}
+}
+
+// pluginError maps the error codes of the protocol to the errors of this package.
+func pluginError(e *pluginrpc.Error) error {
+	switch e.Code {
+	case pluginrpc.CodeClipLimitReached:
+		return codeError{e.Message, ErrClipLimitReached}
+	case pluginrpc.CodeCanceled:
+		return codeError{e.Message, context.Canceled}
+	case pluginrpc.CodeUnsupported:
+		return codeError{e.Message, ErrUnsupported}
+	}
+	return e
+}
+
+// codeError is the message of a plugin error, which already describes the error it unwraps to.
+type codeError struct {
+	msg string
+	err error
+}
+
+func (e codeError) Error() string { return e.msg }
+func (e codeError) Unwrap() error { return e.err }
+
+// Close asks the plugin to shut down, and kills it if it doesn't exit in time.
+func (c *pluginClient) Close() error {
+	select {
+	case <-c.done:
+		return nil
+	default:
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pluginShutdownTimeout)
+	defer cancel()
+	_ = c.call(ctx, pluginrpc.MethodShutdown, nil, nil)
+	_ = c.stdin.Close()
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		pluginLog.Warn("plugin didn't exit, killing it", "plugin", c.name)
+		c.kill()
+		<-c.done
+	}
+	return nil
+}
+
+// tailWriter logs the stderr of a plugin and keeps its tail.
+type tailWriter struct {
+	name string
+	mu   sync.Mutex
+	buf  []byte
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > pluginStderrTail {
+		w.buf = w.buf[len(w.buf)-pluginStderrTail:]
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		pluginLog.Debug(line, "plugin", w.name)
+	}
+	return len(p), nil
+}
+
+// Tail returns the last line of stderr, prefixed to be appended to an error.
+func (w *tailWriter) Tail() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	b := bytes.TrimSpace(w.buf)
+	if i := bytes.LastIndexByte(b, '\n'); i >= 0 {
+		b = b[i+1:]
+	}
+	if len(b) == 0 {
+		return ""
+	}
+	return ", stderr: " + string(b)
+}
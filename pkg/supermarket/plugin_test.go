@@ -0,0 +1,131 @@
+package supermarket_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/pluginrpc/pluginrpctest"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"github.com/csobrinho/supermarket-api/providers/fake"
+)
+
+func TestRegisterPlugin(t *testing.T) {
+	path := pluginrpctest.FakePlugin(t)
+	f := supermarket.NewFactory()
+	if err := f.RegisterPlugin("missing", filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("RegisterPlugin() of a missing executable succeeded, want an error")
+	}
+	// The plugins aren't started when registered, even one failing its handshake.
+	if err := f.RegisterPlugin("fp", path); err != nil {
+		t.Fatalf("RegisterPlugin() failed: %v", err)
+	}
+	if err := f.RegisterPlugin("broken", path, "--no_such_flag"); err != nil {
+		t.Fatalf("RegisterPlugin() of a broken plugin failed: %v", err)
+	}
+	want := []supermarket.ProviderInfo{{Name: "broken"}, {Name: "fp"}}
+	if got := f.Available(); !slices.EqualFunc(got, want, func(a, b supermarket.ProviderInfo) bool {
+		return a.Name == b.Name && a.Capabilities == nil
+	}) {
+		t.Errorf("Available() = %v, want %v without capabilities", got, want)
+	}
+
+	info, err := f.Lookup("fp")
+	if err != nil {
+		t.Fatalf("Lookup() failed: %v", err)
+	}
+	if !slices.Equal(info.Capabilities, fake.Capabilities) {
+		t.Errorf("Lookup() capabilities = %v, want %v", info.Capabilities, fake.Capabilities)
+	}
+	if got := f.Available()[1]; !slices.Equal(got.Capabilities, fake.Capabilities) {
+		t.Errorf("Available() after the handshake = %v, want the capabilities %v", got, fake.Capabilities)
+	}
+	if _, err := f.Lookup("broken"); !errors.Is(err, supermarket.ErrPluginExited) || !strings.Contains(err.Error(), "exit status 2, stderr:") {
+		t.Errorf("Lookup() of a broken plugin = %v, want %v with its exit status and stderr", err, supermarket.ErrPluginExited)
+	}
+
+	// A provider registered with the same name replaces the plugin.
+	f.Register("fp", fake.Creator)
+	if info, err := f.Lookup("fp"); err != nil || !slices.Equal(info.Capabilities, supermarket.DefaultCapabilities) {
+		t.Errorf("Lookup() of the replaced plugin = %v, %v, want the %v", info, err, supermarket.DefaultCapabilities)
+	}
+}
+
+func TestPlugin(t *testing.T) {
+	catalog := filepath.Join(t.TempDir(), "catalog.json")
+	if err := os.WriteFile(catalog, []byte(`[{"id":"a","is_clippable":true},{"id":"b","is_clippable":true}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f := supermarket.NewFactory()
+	if err := f.RegisterPlugin("fp", pluginrpctest.FakePlugin(t), "--fake_catalog="+catalog, "--fake_clip_limit=1"); err != nil {
+		t.Fatalf("RegisterPlugin() failed: %v", err)
+	}
+	sm, err := f.Create(t.Context(), "fp")
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	t.Cleanup(func() { _ = sm.(io.Closer).Close() })
+	if got := supermarket.CapabilitiesOf(sm); !slices.Equal(got, fake.Capabilities) {
+		t.Errorf("CapabilitiesOf() = %v, want %v", got, fake.Capabilities)
+	}
+	ps, err := sm.Promotion()
+	if err != nil {
+		t.Fatalf("Promotion() failed: %v", err)
+	}
+	cds, err := ps.GetClipDeals(t.Context(), supermarket.PromotionSearchOptions{})
+	if err != nil || len(cds) != 2 {
+		t.Fatalf("GetClipDeals() = %d deals, %v, want 2", len(cds), err)
+	}
+	if err := ps.ClipDeal(t.Context(), cds[0]); err != nil {
+		t.Fatalf("ClipDeal() failed: %v", err)
+	}
+	// The error codes of the protocol unwrap to the errors of the package.
+	if err := ps.ClipDeal(t.Context(), cds[1]); !errors.Is(err, supermarket.ErrClipLimitReached) {
+		t.Errorf("ClipDeal() over the limit = %v, want %v", err, supermarket.ErrClipLimitReached)
+	}
+	u, ok := ps.(supermarket.Unclipper)
+	if !ok {
+		t.Fatal("Promotion() isn't an Unclipper, want it for a plugin declaring unclip")
+	}
+	if err := u.UnclipDeal(t.Context(), cds[0]); err != nil {
+		t.Errorf("UnclipDeal() failed: %v", err)
+	}
+
+	supermarket.KillPlugin(sm)
+	if _, err := ps.GetClipDeals(t.Context(), supermarket.PromotionSearchOptions{}); !errors.Is(err, supermarket.ErrPluginExited) {
+		t.Errorf("GetClipDeals() of a killed plugin = %v, want %v", err, supermarket.ErrPluginExited)
+	}
+}
+
+func TestPluginCancel(t *testing.T) {
+	f := supermarket.NewFactory()
+	if err := f.RegisterPlugin("fp", pluginrpctest.FakePlugin(t), "--fake_latency=1m"); err != nil {
+		t.Fatalf("RegisterPlugin() failed: %v", err)
+	}
+	sm, err := f.Create(t.Context(), "fp", supermarket.WithTimeout(200*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	ps, err := sm.Promotion()
+	if err != nil {
+		t.Fatalf("Promotion() failed: %v", err)
+	}
+	if _, err := ps.GetClipDeals(t.Context(), supermarket.PromotionSearchOptions{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetClipDeals() slower than the timeout = %v, want %v", err, context.DeadlineExceeded)
+	}
+	// The plugin waits for its pending calls before shutting down, so it only exits before being
+	// killed if the timed out call was canceled.
+	start := time.Now()
+	if err := sm.(io.Closer).Close(); err != nil {
+		t.Errorf("Close() failed: %v", err)
+	}
+	if d := time.Since(start); d > 4*time.Second {
+		t.Errorf("Close() took %v, want the timed out call canceled in the plugin", d)
+	}
+}
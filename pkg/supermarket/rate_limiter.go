@@ -1,6 +1,7 @@
 package supermarket
 
 import (
+	"context"
 	"math/rand/v2"
 	"time"
 )
@@ -21,7 +22,26 @@ func (r *RateLimiter) Wait() {
 	if r.base <= 0 {
 		return
 	}
+	time.Sleep(r.delay())
+}
+
+// WaitContext is like Wait but returns early with the context error when ctx is done.
+func (r *RateLimiter) WaitContext(ctx context.Context) error {
+	if r.base <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(r.delay())
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func (r *RateLimiter) delay() time.Duration {
 	jitterRange := float64(r.base) * r.jitter
 	jitterDuration := time.Duration(rand.Float64()*jitterRange*2 - jitterRange)
-	time.Sleep(r.base + jitterDuration)
+	return r.base + jitterDuration
 }
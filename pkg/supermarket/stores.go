@@ -0,0 +1,26 @@
+package supermarket
+
+import "context"
+
+// Store is a physical store of a provider. Its ID is the store id of the other calls.
+type Store struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Chain   string `json:"chain,omitempty"`
+	Address string `json:"address,omitempty"`
+	City    string `json:"city,omitempty"`
+	State   string `json:"state,omitempty"`
+	ZipCode string `json:"zip_code,omitempty"`
+}
+
+// StoreSearchOptions selects the stores to search for.
+type StoreSearchOptions struct {
+	ZipCode string // Stores near this zip code.
+	Limit   int    // Maximum number of stores, zero means the default of the provider.
+}
+
+// StoreLocator is implemented by supermarkets with the CapabilityStoreLookup capability.
+type StoreLocator interface {
+	// SearchStores returns the stores matching the options, nearest first.
+	SearchStores(ctx context.Context, opts StoreSearchOptions) ([]Store, error)
+}
@@ -0,0 +1,209 @@
+// Package supermarkettest provides a conformance suite that every provider, including providers
+// outside of this module, can run against its fake server to check it behaves like the others.
+//
+//	func TestConformance(t *testing.T) {
+//		supermarkettest.RunConformance(t, kroger.Creator, krogertest.Fixture)
+//	}
+package supermarkettest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+)
+
+// Fixture starts a fresh fake server for a test, closing it with t.Cleanup, and returns the
+// options to create a provider against it. Every subtest calls it, so clips don't leak between
+// them.
+//
+// The server must hold at least one clippable and unclipped deal, with categories and UPCs, and
+// must not have a clip limit.
+type Fixture func(t testing.TB) []supermarket.Option
+
+// RunConformance runs the conformance suite of the provider created by creator.
+func RunConformance(t *testing.T, creator supermarket.Creator, fixture Fixture) {
+	t.Run("NotAuthenticatedBeforeRefresh", func(t *testing.T) {
+		as := authenticator(t, create(t, creator, fixture))
+		if as.IsAuthenticated(t.Context()) {
+			t.Fatal("IsAuthenticated() = true before RefreshToken()")
+		}
+		if _, err := as.RefreshToken(t.Context()); err != nil {
+			t.Fatalf("RefreshToken() error %v", err)
+		}
+		if !as.IsAuthenticated(t.Context()) {
+			t.Fatal("IsAuthenticated() = false after RefreshToken()")
+		}
+	})
+
+	t.Run("Capabilities", func(t *testing.T) {
+		sm := create(t, creator, fixture)
+		caps := supermarket.CapabilitiesOf(sm)
+		if !caps.Has(supermarket.CapabilityClip) {
+			t.Errorf("Capabilities() = [%s], missing %s", caps, supermarket.CapabilityClip)
+		}
+		ps, err := sm.Promotion()
+		if err != nil {
+			t.Fatalf("Promotion() error %v", err)
+		}
+		if _, ok := ps.(supermarket.Unclipper); caps.Has(supermarket.CapabilityUnclip) != ok {
+			t.Errorf("Capabilities() = [%s], but the promotion service implements Unclipper = %t", caps, ok)
+		}
+	})
+
+	t.Run("GetClipDeals", func(t *testing.T) {
+		ps := promotions(t, create(t, creator, fixture))
+		cds := getClipDeals(t, t.Context(), ps, supermarket.PromotionSearchOptions{})
+		if len(cds) == 0 {
+			t.Fatal("GetClipDeals() returned no deals")
+		}
+		seen := map[string]bool{}
+		for _, cd := range cds {
+			if cd.ID == "" {
+				t.Errorf("GetClipDeals() returned a deal without id: %+v", cd.Promotion)
+			}
+			if seen[cd.ID] {
+				t.Errorf("GetClipDeals() returned deal %q twice", cd.ID)
+			}
+			seen[cd.ID] = true
+			if cd.Type == "" {
+				t.Errorf("GetClipDeals() returned deal %q without type", cd.ID)
+			}
+		}
+	})
+
+	t.Run("GetClipDealsFilters", func(t *testing.T) {
+		ps := promotions(t, create(t, creator, fixture))
+		all := getClipDeals(t, t.Context(), ps, supermarket.PromotionSearchOptions{})
+		for name, opts := range searchOptions(all) {
+			t.Run(name, func(t *testing.T) {
+				got := ids(getClipDeals(t, t.Context(), ps, opts))
+				want := ids(supermarket.FilterDeals(slices.Clone(all), opts))
+				if !slices.Equal(got, want) {
+					t.Errorf("GetClipDeals(%s) = %v, want %v", name, got, want)
+				}
+			})
+		}
+	})
+
+	t.Run("ClipAlreadyClipped", func(t *testing.T) {
+		ps := promotions(t, create(t, creator, fixture))
+		cd := clippable(t, getClipDeals(t, t.Context(), ps, supermarket.PromotionSearchOptions{}))
+		if err := ps.ClipDeal(t.Context(), cd); err != nil {
+			t.Fatalf("ClipDeal(%q) error %v", cd.ID, err)
+		}
+		cds := getClipDeals(t, t.Context(), ps, supermarket.PromotionSearchOptions{})
+		i := slices.IndexFunc(cds, func(c supermarket.ClipDeal) bool { return c.ID == cd.ID })
+		if i < 0 {
+			t.Fatalf("GetClipDeals() is missing the clipped deal %q", cd.ID)
+		}
+		if !cds[i].IsClipped {
+			t.Errorf("GetClipDeals() returned deal %q unclipped after ClipDeal()", cd.ID)
+		}
+		if err := ps.ClipDeal(t.Context(), cds[i]); err == nil {
+			t.Errorf("ClipDeal(%q) of a clipped deal succeeded", cd.ID)
+		}
+		// A stale copy must be rejected by the server too.
+		if err := ps.ClipDeal(t.Context(), cd); err == nil {
+			t.Errorf("ClipDeal(%q) of a stale copy of a clipped deal succeeded", cd.ID)
+		}
+	})
+
+	t.Run("ContextCanceled", func(t *testing.T) {
+		ps := promotions(t, create(t, creator, fixture))
+		cd := clippable(t, getClipDeals(t, t.Context(), ps, supermarket.PromotionSearchOptions{}))
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		if _, err := ps.GetClipDeals(ctx, supermarket.PromotionSearchOptions{}); !errors.Is(err, context.Canceled) {
+			t.Errorf("GetClipDeals() with a canceled context error %v, want %v", err, context.Canceled)
+		}
+		if err := ps.ClipDeal(ctx, cd); !errors.Is(err, context.Canceled) {
+			t.Errorf("ClipDeal(%q) with a canceled context error %v, want %v", cd.ID, err, context.Canceled)
+		}
+		cds := getClipDeals(t, t.Context(), ps, supermarket.PromotionSearchOptions{})
+		if i := slices.IndexFunc(cds, func(c supermarket.ClipDeal) bool { return c.ID == cd.ID }); i >= 0 && cds[i].IsClipped {
+			t.Errorf("ClipDeal(%q) with a canceled context clipped the deal", cd.ID)
+		}
+	})
+}
+
+func create(t *testing.T, creator supermarket.Creator, fixture Fixture) supermarket.Supermarket {
+	t.Helper()
+	f := supermarket.NewFactory()
+	f.Register("conformance", creator)
+	sm, err := f.Create(t.Context(), "conformance", fixture(t)...)
+	if err != nil {
+		t.Fatalf("create provider, error %v", err)
+	}
+	return sm
+}
+
+func authenticator(t *testing.T, sm supermarket.Supermarket) supermarket.AuthService {
+	t.Helper()
+	as, err := sm.Authenticator()
+	if err != nil {
+		t.Fatalf("Authenticator() error %v", err)
+	}
+	return as
+}
+
+// promotions returns the promotion service of an authenticated provider.
+func promotions(t *testing.T, sm supermarket.Supermarket) supermarket.PromotionService {
+	t.Helper()
+	if _, err := authenticator(t, sm).RefreshToken(t.Context()); err != nil {
+		t.Fatalf("RefreshToken() error %v", err)
+	}
+	ps, err := sm.Promotion()
+	if err != nil {
+		t.Fatalf("Promotion() error %v", err)
+	}
+	return ps
+}
+
+func getClipDeals(t *testing.T, ctx context.Context, ps supermarket.PromotionService, opts supermarket.PromotionSearchOptions) []supermarket.ClipDeal {
+	t.Helper()
+	cds, err := ps.GetClipDeals(ctx, opts)
+	if err != nil {
+		t.Fatalf("GetClipDeals() error %v", err)
+	}
+	return cds
+}
+
+func clippable(t *testing.T, cds []supermarket.ClipDeal) supermarket.ClipDeal {
+	t.Helper()
+	i := slices.IndexFunc(cds, func(cd supermarket.ClipDeal) bool { return cd.IsClippable && !cd.IsClipped && !cd.IsDeleted })
+	if i < 0 {
+		t.Fatal("fixture has no clippable deal")
+	}
+	return cds[i]
+}
+
+// searchOptions returns a search option per filter, with values taken from the deals.
+func searchOptions(cds []supermarket.ClipDeal) map[string]supermarket.PromotionSearchOptions {
+	clipped := true
+	ret := map[string]supermarket.PromotionSearchOptions{
+		"ClippedOnly": {ClippedOnly: &clipped},
+	}
+	for _, cd := range cds {
+		if _, ok := ret["Type"]; !ok && cd.Type != "" {
+			ret["Type"] = supermarket.PromotionSearchOptions{Type: &cd.Type}
+		}
+		if _, ok := ret["Category"]; !ok && len(cd.Categories) > 0 {
+			ret["Category"] = supermarket.PromotionSearchOptions{Category: &cd.Categories[0]}
+		}
+		if _, ok := ret["ProductID"]; !ok && len(cd.Upcs) > 0 {
+			ret["ProductID"] = supermarket.PromotionSearchOptions{ProductID: &cd.Upcs[0]}
+		}
+	}
+	return ret
+}
+
+func ids(cds []supermarket.ClipDeal) []string {
+	ret := make([]string, 0, len(cds))
+	for _, cd := range cds {
+		ret = append(ret, cd.ID)
+	}
+	return ret
+}
@@ -0,0 +1,36 @@
+package supermarket
+
+import (
+	"github.com/csobrinho/supermarket-api/internal/auth"
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+)
+
+// Aliases of the internal types, so providers outside of this module can implement Supermarket.
+type (
+	AuthService            = auth.Service
+	PromotionService       = promotion.Service
+	Unclipper              = promotion.Unclipper
+	Promotion              = promotion.Promotion
+	PromotionType          = promotion.PromotionType
+	Discount               = promotion.Discount
+	ClipDeal               = promotion.ClipDeal
+	PromotionSearchOptions = promotion.PromotionSearchOptions
+)
+
+const (
+	PromotionTypeClipDeal      = promotion.PromotionTypeClipDeal
+	PromotionTypeCoupon        = promotion.PromotionTypeCoupon
+	PromotionTypeWeeklySale    = promotion.PromotionTypeWeeklySale
+	PromotionTypeClearance     = promotion.PromotionTypeClearance
+	PromotionTypeBOGO          = promotion.PromotionTypeBOGO
+	PromotionTypeMixAndMatch   = promotion.PromotionTypeMixAndMatch
+	PromotionTypeLoyaltyReward = promotion.PromotionTypeLoyaltyReward
+)
+
+// ErrClipLimitReached is returned when the account can't hold more clipped offers.
+var ErrClipLimitReached = promotion.ErrClipLimitReached
+
+// FilterDeals returns the deals that pass the search options, for providers whose APIs can't filter.
+func FilterDeals(cds []ClipDeal, opts PromotionSearchOptions) []ClipDeal {
+	return promotion.Filter(cds, opts)
+}
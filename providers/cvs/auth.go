@@ -0,0 +1,135 @@
+package cvs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/auth"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"golang.org/x/oauth2"
+)
+
+var _ auth.Service = (*authenticatorService)(nil)
+
+const AUTH_PATH = "/extracare/v1/auth"
+
+// AuthRequest is the body of the login request. The card number selects the ExtraCare card when
+// several are linked to the account.
+type AuthRequest struct {
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	CardNumber string `json:"cardNumber,omitempty"`
+}
+
+// AuthResponse is the session returned by a successful login.
+type AuthResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"` // Seconds.
+	CardNumber  string `json:"extracareCardNumber"`
+}
+
+// authenticatorService logs in with the email and password of the CVS account and binds the session
+// to its ExtraCare card. The session is renewed by logging in again when it expires.
+type authenticatorService struct {
+	client  *http.Client
+	authURL string
+	req     AuthRequest
+	ts      oauth2.TokenSource
+
+	mu            sync.Mutex
+	card          string
+	authenticated bool
+}
+
+func NewAuthenticator(ctx context.Context, cfg *supermarket.Config) (*authenticatorService, error) {
+	if cfg.Username == "" || cfg.Password == "" {
+		return nil, fmt.Errorf("authenticator: missing username or password")
+	}
+	client, err := newClient(cfg, nil)
+	if err != nil {
+		return nil, fmt.Errorf("authenticator: new http client, error %w", err)
+	}
+	as := &authenticatorService{
+		client:  client,
+		authURL: baseURL(cfg) + AUTH_PATH,
+		req:     AuthRequest{Email: cfg.Username, Password: cfg.Password, CardNumber: cfg.LoyaltyCard},
+		card:    cfg.LoyaltyCard,
+	}
+	as.ts = oauth2.ReuseTokenSource(nil, loginTokenSource{ctx: ctx, as: as})
+	return as, nil
+}
+
+type loginTokenSource struct {
+	ctx context.Context
+	as  *authenticatorService
+}
+
+func (l loginTokenSource) Token() (*oauth2.Token, error) { return l.as.login(l.ctx) }
+
+func (as *authenticatorService) login(ctx context.Context) (*oauth2.Token, error) {
+	body, err := json.Marshal(as.req)
+	if err != nil {
+		return nil, fmt.Errorf("authenticator: login failed to marshal, error %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, as.authURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("authenticator: login request, error %w", err)
+	}
+	res, err := as.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("authenticator: login response, error %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("authenticator: login response, error status %s", res.Status)
+	}
+	ar := AuthResponse{}
+	if err := json.NewDecoder(res.Body).Decode(&ar); err != nil {
+		return nil, fmt.Errorf("authenticator: login response, error decoding %w", err)
+	}
+	if ar.CardNumber == "" {
+		return nil, fmt.Errorf("authenticator: login response, no ExtraCare card linked to the account")
+	}
+	as.mu.Lock()
+	as.card = ar.CardNumber
+	as.mu.Unlock()
+	return &oauth2.Token{
+		AccessToken: ar.AccessToken,
+		TokenType:   "Bearer",
+		Expiry:      time.Now().Add(time.Duration(ar.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// CardNumber returns the ExtraCare card of the session, logging in if needed.
+func (as *authenticatorService) CardNumber() (string, error) {
+	if _, err := as.ts.Token(); err != nil {
+		return "", err
+	}
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	return as.card, nil
+}
+
+func (as *authenticatorService) RefreshToken(ctx context.Context) (*oauth2.Token, error) {
+	t, err := as.ts.Token()
+	as.mu.Lock()
+	as.authenticated = err == nil
+	as.mu.Unlock()
+	return t, err
+}
+func (as *authenticatorService) TokenSource() oauth2.TokenSource { return as.ts }
+func (as *authenticatorService) IsAuthenticated(ctx context.Context) bool {
+	as.mu.Lock()
+	authenticated := as.authenticated
+	as.mu.Unlock()
+	if !authenticated {
+		return false
+	}
+	_, err := as.RefreshToken(ctx)
+	return err == nil
+}
@@ -0,0 +1,13 @@
+package cvs_test
+
+import (
+	"testing"
+
+	"github.com/csobrinho/supermarket-api/pkg/supermarket/supermarkettest"
+	"github.com/csobrinho/supermarket-api/providers/cvs"
+	"github.com/csobrinho/supermarket-api/providers/cvs/cvstest"
+)
+
+func TestConformance(t *testing.T) {
+	supermarkettest.RunConformance(t, cvs.Creator, cvstest.Fixture)
+}
@@ -0,0 +1,58 @@
+// Package cvs implements CVS ExtraCare coupons, sent to the ExtraCare loyalty card.
+//
+// The endpoints follow the ones used by the CVS app and can be pointed elsewhere with
+// supermarket.WithBaseURL.
+package cvs
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/csobrinho/supermarket-api/internal/auth"
+	ihttp "github.com/csobrinho/supermarket-api/internal/http"
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"golang.org/x/oauth2"
+)
+
+var _ supermarket.Supermarket = (*cvs)(nil)
+var _ promotion.Service = (*promotionService)(nil)
+
+// DefaultBaseURL is the base URL of the CVS API.
+const DefaultBaseURL = "https://api.cvshealth.com"
+
+func Creator(ctx context.Context, cfg *supermarket.Config) (supermarket.Supermarket, error) {
+	a, err := NewAuthenticator(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	ps, err := NewPromotion(ctx, cfg, a)
+	if err != nil {
+		return nil, err
+	}
+	return &cvs{as: a, ps: ps}, nil
+}
+
+type cvs struct {
+	as *authenticatorService
+	ps *promotionService
+}
+
+func (c *cvs) Authenticator() (auth.Service, error)  { return c.as, nil }
+func (c *cvs) Promotion() (promotion.Service, error) { return c.ps, nil }
+
+func baseURL(cfg *supermarket.Config) string {
+	if cfg.BaseURL != "" {
+		return strings.TrimSuffix(cfg.BaseURL, "/")
+	}
+	return DefaultBaseURL
+}
+
+func newClient(cfg *supermarket.Config, ts oauth2.TokenSource) (*http.Client, error) {
+	headers := map[string]string{"accept": "application/json", "content-type": "application/json"}
+	if cfg.ApiKey != "" {
+		headers["x-api-key"] = cfg.ApiKey
+	}
+	return ihttp.New(true, cfg.Debug, cfg.UserAgent, headers, cfg.Timeout, ts, cfg.Transport)
+}
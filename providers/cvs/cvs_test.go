@@ -0,0 +1,243 @@
+package cvs_test
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"github.com/csobrinho/supermarket-api/providers/cvs"
+	"github.com/csobrinho/supermarket-api/providers/cvs/cvstest"
+)
+
+func newSupermarket(t *testing.T, s *cvstest.Server, opts ...supermarket.Option) supermarket.Supermarket {
+	t.Helper()
+	f := supermarket.NewFactory()
+	f.Register("cvs", cvs.Creator)
+	sm, err := f.Create(t.Context(), "cvs", append(s.Options(), opts...)...)
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	return sm
+}
+
+func newPromotion(t *testing.T, s *cvstest.Server, opts ...supermarket.Option) supermarket.PromotionService {
+	t.Helper()
+	ps, err := newSupermarket(t, s, opts...).Promotion()
+	if err != nil {
+		t.Fatalf("Promotion() failed: %v", err)
+	}
+	return ps
+}
+
+func getClipDeals(t *testing.T, ps supermarket.PromotionService) map[string]promotion.ClipDeal {
+	t.Helper()
+	cds, err := ps.GetClipDeals(t.Context(), promotion.PromotionSearchOptions{})
+	if err != nil {
+		t.Fatalf("GetClipDeals() failed: %v", err)
+	}
+	ret := make(map[string]promotion.ClipDeal, len(cds))
+	for _, cd := range cds {
+		ret[cd.ID] = cd
+	}
+	return ret
+}
+
+func TestLogin(t *testing.T) {
+	s := cvstest.NewServer()
+	defer s.Close()
+	as, err := newSupermarket(t, s).Authenticator()
+	if err != nil {
+		t.Fatalf("Authenticator() failed: %v", err)
+	}
+	if as.IsAuthenticated(t.Context()) {
+		t.Error("IsAuthenticated() before logging in = true, want false")
+	}
+	tok, err := as.RefreshToken(t.Context())
+	if err != nil {
+		t.Fatalf("RefreshToken() failed: %v", err)
+	}
+	if tok.AccessToken == "" || tok.Expiry.Before(time.Now().Add(14*time.Minute)) {
+		t.Errorf("RefreshToken() = %+v, want a session of 15 minutes", tok)
+	}
+	if !as.IsAuthenticated(t.Context()) {
+		t.Error("IsAuthenticated() = false, want true")
+	}
+	// The session is reused until it expires.
+	if got := s.Logins(); got != 1 {
+		t.Errorf("Logins() = %d, want 1", got)
+	}
+}
+
+func TestLoginErrors(t *testing.T) {
+	s := cvstest.NewServer()
+	defer s.Close()
+	tests := []struct {
+		name string
+		opt  supermarket.Option
+		want string
+	}{
+		{"bad credentials", supermarket.WithLogin(cvstest.Email, "wrong"), "401"},
+		{"card not linked", supermarket.WithLoyaltyCard("4000999999999"), "403"},
+	}
+	for _, tt := range tests {
+		as, err := newSupermarket(t, s, tt.opt).Authenticator()
+		if err != nil {
+			t.Fatalf("Authenticator(%s) failed: %v", tt.name, err)
+		}
+		if _, err := as.RefreshToken(t.Context()); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("RefreshToken(%s) = %v, want %s", tt.name, err, tt.want)
+		}
+		if as.IsAuthenticated(t.Context()) {
+			t.Errorf("IsAuthenticated(%s) = true, want false", tt.name)
+		}
+	}
+	if got := s.Logins(); got != 0 {
+		t.Errorf("Logins() = %d, want 0", got)
+	}
+
+	f := supermarket.NewFactory()
+	f.Register("cvs", cvs.Creator)
+	if _, err := f.Create(t.Context(), "cvs", supermarket.WithBaseURL(s.URL), supermarket.WithLogin(cvstest.Email, "")); err == nil {
+		t.Error("Create() without a password succeeded, want an error")
+	}
+}
+
+// A session shorter than the expiry delta of the token source is renewed on every request.
+func TestLoginRefresh(t *testing.T) {
+	s := cvstest.NewServer()
+	defer s.Close()
+	s.ExpiresIn = 5
+	ps := newPromotion(t, s)
+	for range 3 {
+		getClipDeals(t, ps)
+	}
+	if got := s.Logins(); got < 3 {
+		t.Errorf("Logins() = %d, want a login per request", got)
+	}
+}
+
+// Without a card the one linked to the account, returned by the login, is used.
+func TestLoyaltyCard(t *testing.T) {
+	s := cvstest.NewServer()
+	defer s.Close()
+	s.CardNumber = "4000987654321"
+	ps := newPromotion(t, s, supermarket.WithLoyaltyCard(""))
+	if got := getClipDeals(t, ps); len(got) != 5 {
+		t.Errorf("GetClipDeals() returned %d coupons, want 5", len(got))
+	}
+	if err := ps.ClipDeal(t.Context(), getClipDeals(t, ps)["73550012"]); err != nil {
+		t.Errorf("ClipDeal() failed: %v", err)
+	}
+	if got := s.Sent(); !slices.Equal(got, []string{"73550012"}) {
+		t.Errorf("Sent() = %v, want the coupon", got)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	s := cvstest.NewServer()
+	defer s.Close()
+	cds := getClipDeals(t, newPromotion(t, s))
+	if len(cds) != 5 {
+		t.Fatalf("GetClipDeals() returned %d coupons, want 5", len(cds))
+	}
+
+	dollar := cds["73550012"]
+	if dollar.Brand != "CVS Health" || *dollar.PromoCode != "56123" || dollar.Type != promotion.PromotionTypeCoupon {
+		t.Errorf("coupon = %+v, want the CVS Health coupon 56123", dollar.Promotion)
+	}
+	if dollar.Discount == nil || dollar.Discount.Amount != 3 || dollar.Discount.Percent != 0 {
+		t.Errorf("dollar coupon discount = %+v, want $3 off", dollar.Discount)
+	}
+	if !slices.Equal(dollar.Categories, []string{"Vitamins"}) || !slices.Equal(dollar.Upcs, []string{"429351", "429352"}) {
+		t.Errorf("dollar coupon = categories %v, upcs %v, want Vitamins and its 2 skus", dollar.Categories, dollar.Upcs)
+	}
+	if want := time.Date(2025, 5, 11, 0, 0, 0, 0, time.UTC); !dollar.StartDate.Equal(want) {
+		t.Errorf("dollar coupon start date = %v, want %v", dollar.StartDate, want)
+	}
+	if want := time.Date(2025, 5, 25, 0, 0, 0, 0, time.UTC); !dollar.EndDate.Equal(want) {
+		t.Errorf("dollar coupon end date = %v, want %v", dollar.EndDate, want)
+	}
+	if !dollar.IsClippable || dollar.IsClipped || dollar.IsDeleted || dollar.Status != cvs.COUPON_STATUS_AVAILABLE || !dollar.PreviouslyPurchased {
+		t.Errorf("dollar coupon = %+v, want a personalized coupon to send", dollar.Promotion)
+	}
+
+	if percent := cds["73550047"]; percent.Discount == nil || percent.Discount.Percent != 40 || percent.Discount.Amount != 0 {
+		t.Errorf("percent coupon discount = %+v, want 40%% off", percent.Discount)
+	}
+	if onCard := cds["73550091"]; !onCard.IsClipped || onCard.IsClippable {
+		t.Errorf("coupon on card = %+v, want clipped", onCard.Promotion)
+	}
+	if expired := cds["73550120"]; !expired.IsDeleted || expired.IsClippable {
+		t.Errorf("expired coupon = %+v, want deleted", expired.Promotion)
+	}
+	multi := cds["73550166"]
+	if multi.Discount == nil || multi.Discount.Amount != 1.5 || multi.MinPurchaseQuantity == nil || *multi.MinPurchaseQuantity != 2 {
+		t.Errorf("coupon = discount %+v, min quantity %v, want $1.50 off 2", multi.Discount, multi.MinPurchaseQuantity)
+	}
+}
+
+func TestGetClipDealsPagination(t *testing.T) {
+	var coupons []cvs.Coupon
+	for i := range 60 {
+		coupons = append(coupons, cvs.Coupon{SeqNumber: fmt.Sprint(i), Type: cvs.COUPON_TYPE_DOLLAR, Amount: 1, Status: cvs.COUPON_STATUS_AVAILABLE})
+	}
+	s := cvstest.NewServerWithCoupons(coupons)
+	defer s.Close()
+	if got := getClipDeals(t, newPromotion(t, s)); len(got) != len(coupons) {
+		t.Errorf("GetClipDeals() returned %d coupons, want %d", len(got), len(coupons))
+	}
+}
+
+func TestClipDeal(t *testing.T) {
+	s := cvstest.NewServer()
+	defer s.Close()
+	ps := newPromotion(t, s)
+	cds := getClipDeals(t, ps)
+	cd := cds["73550012"]
+	if err := ps.ClipDeal(t.Context(), cd); err != nil {
+		t.Fatalf("ClipDeal() failed: %v", err)
+	}
+	if got := getClipDeals(t, ps)["73550012"]; !got.IsClipped || got.Status != cvs.COUPON_STATUS_ON_CARD {
+		t.Errorf("GetClipDeals() after ClipDeal() = %+v, want on card", got.Promotion)
+	}
+
+	// A stale copy is rejected by the server, a fresh one before the request.
+	if err := ps.ClipDeal(t.Context(), cd); err == nil || !strings.Contains(err.Error(), "coupon already on card") {
+		t.Errorf("ClipDeal(stale copy) = %v, want the server error", err)
+	}
+	if err := ps.ClipDeal(t.Context(), cds["73550091"]); err == nil || !strings.Contains(err.Error(), "already clipped") {
+		t.Errorf("ClipDeal(on card) = %v, want already clipped", err)
+	}
+	if err := ps.ClipDeal(t.Context(), cds["73550120"]); err == nil {
+		t.Error("ClipDeal(expired) succeeded")
+	}
+	if got := s.Sent(); !slices.Equal(got, []string{"73550012"}) {
+		t.Errorf("Sent() = %v, want only the first coupon", got)
+	}
+}
+
+// The fixture has one coupon on the card, a maximum of 2 allows a single clip.
+func TestClipDealLimit(t *testing.T) {
+	s := cvstest.NewServer()
+	defer s.Close()
+	s.MaxOnCard = 2
+	ps := newPromotion(t, s)
+	cds := getClipDeals(t, ps)
+	if err := ps.ClipDeal(t.Context(), cds["73550012"]); err != nil {
+		t.Fatalf("ClipDeal() failed: %v", err)
+	}
+	err := ps.ClipDeal(t.Context(), cds["73550047"])
+	if !errors.Is(err, promotion.ErrClipLimitReached) {
+		t.Errorf("ClipDeal() over the limit = %v, want %v", err, promotion.ErrClipLimitReached)
+	}
+	// Other errors of the server aren't the clip limit.
+	unknown := promotion.ClipDeal{Promotion: promotion.Promotion{ID: "nope", IsClippable: true}}
+	if err := ps.ClipDeal(t.Context(), unknown); err == nil || errors.Is(err, promotion.ErrClipLimitReached) {
+		t.Errorf("ClipDeal(unknown) = %v, want an error other than the clip limit", err)
+	}
+}
@@ -0,0 +1,218 @@
+// Package cvstest provides a fake CVS ExtraCare server, seeded with recorded fixtures, to exercise
+// the cvs provider without network access.
+package cvstest
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"github.com/csobrinho/supermarket-api/providers/cvs"
+)
+
+//go:embed fixtures/coupons.json
+var couponsFixture []byte
+
+// Default account accepted by the server.
+const (
+	Email      = "shopper@example.com"
+	Password   = "hunter2"
+	CardNumber = "4000123456789"
+)
+
+// pageSize is the number of coupons per page.
+const pageSize = 25
+
+// Server is a fake CVS API. Its exported fields can be changed before the first request.
+type Server struct {
+	*httptest.Server
+
+	Email      string
+	Password   string
+	CardNumber string
+	MaxOnCard  int // Maximum number of coupons on the card, zero means unlimited.
+	ExpiresIn  int // Lifetime of the sessions in seconds.
+
+	mu      sync.Mutex
+	coupons []cvs.Coupon
+	tokens  map[string]bool
+	logins  int
+	sent    []string
+}
+
+// NewServer starts a server seeded with the recorded coupons. Call Close when done.
+func NewServer() *Server {
+	res := cvs.CouponsResponse{}
+	if err := json.Unmarshal(couponsFixture, &res); err != nil {
+		panic(fmt.Sprintf("cvstest: decode fixture, error %v", err))
+	}
+	return NewServerWithCoupons(res.Coupons)
+}
+
+// NewServerWithCoupons starts a server seeded with the coupons. Call Close when done.
+func NewServerWithCoupons(coupons []cvs.Coupon) *Server {
+	s := &Server{
+		Email:      Email,
+		Password:   Password,
+		CardNumber: CardNumber,
+		ExpiresIn:  900,
+		coupons:    slices.Clone(coupons),
+		tokens:     map[string]bool{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+cvs.AUTH_PATH, s.auth)
+	mux.HandleFunc("GET /extracare/v1/cards/{card}/coupons", s.listCoupons)
+	mux.HandleFunc("PUT /extracare/v1/cards/{card}/coupons/{id}/send-to-card", s.sendToCard)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Fixture starts a server for the test, closed when it ends, and returns the options to create a
+// cvs client against it. It is a supermarkettest.Fixture.
+func Fixture(t testing.TB) []supermarket.Option {
+	s := NewServer()
+	t.Cleanup(s.Close)
+	return s.Options()
+}
+
+// Options returns the options to create a cvs client against the server.
+func (s *Server) Options() []supermarket.Option {
+	return []supermarket.Option{
+		supermarket.WithBaseURL(s.URL),
+		supermarket.WithLogin(s.Email, s.Password),
+		supermarket.WithLoyaltyCard(s.CardNumber),
+	}
+}
+
+// Coupons returns the current state of the coupons.
+func (s *Server) Coupons() []cvs.Coupon {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.coupons)
+}
+
+// Sent returns the ids of the coupons sent to the card through the server, in order.
+func (s *Server) Sent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.sent)
+}
+
+// Logins returns the number of successful logins.
+func (s *Server) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+func (s *Server) auth(w http.ResponseWriter, r *http.Request) {
+	req := cvs.AuthRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+	switch {
+	case req.Email != s.Email || req.Password != s.Password:
+		writeError(w, http.StatusUnauthorized, "INVALID_CREDENTIALS", "the email or password is incorrect")
+		return
+	case req.CardNumber != "" && req.CardNumber != s.CardNumber:
+		writeError(w, http.StatusForbidden, "CARD_NOT_LINKED", "the ExtraCare card is not linked to the account")
+		return
+	}
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	token := hex.EncodeToString(b)
+	s.mu.Lock()
+	s.tokens[token] = true
+	s.logins++
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, cvs.AuthResponse{AccessToken: token, ExpiresIn: s.ExpiresIn, CardNumber: s.CardNumber})
+}
+
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) bool {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	ok := s.tokens[token]
+	s.mu.Unlock()
+	switch {
+	case !found || !ok:
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid or missing access token")
+		return false
+	case r.PathValue("card") != s.CardNumber:
+		writeError(w, http.StatusForbidden, "CARD_NOT_LINKED", "the ExtraCare card is not linked to the account")
+		return false
+	}
+	return true
+}
+
+func (s *Server) listCoupons(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticate(w, r) {
+		return
+	}
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	s.mu.Lock()
+	coupons := slices.Clone(s.coupons)
+	s.mu.Unlock()
+
+	res := cvs.CouponsResponse{Coupons: []cvs.Coupon{}, Page: page, TotalPages: (len(coupons) + pageSize - 1) / pageSize}
+	if start := (page - 1) * pageSize; start < len(coupons) {
+		res.Coupons = coupons[start:min(start+pageSize, len(coupons))]
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) sendToCard(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticate(w, r) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.coupons, func(c cvs.Coupon) bool { return c.SeqNumber == r.PathValue("id") })
+	switch {
+	case i < 0:
+		writeError(w, http.StatusNotFound, "COUPON_NOT_FOUND", "coupon not found")
+		return
+	case s.coupons[i].Status == cvs.COUPON_STATUS_ON_CARD:
+		writeError(w, http.StatusConflict, "COUPON_ON_CARD", "coupon already on card")
+		return
+	case s.coupons[i].Status != cvs.COUPON_STATUS_AVAILABLE:
+		writeError(w, http.StatusUnprocessableEntity, "COUPON_UNAVAILABLE", "coupon is no longer available")
+		return
+	}
+	onCard := 0
+	for _, c := range s.coupons {
+		if c.Status == cvs.COUPON_STATUS_ON_CARD {
+			onCard++
+		}
+	}
+	if s.MaxOnCard > 0 && onCard >= s.MaxOnCard {
+		writeError(w, http.StatusConflict, cvs.ERROR_CODE_MAX_COUPONS, "the card holds the maximum number of coupons")
+		return
+	}
+	s.coupons[i].Status = cvs.COUPON_STATUS_ON_CARD
+	s.sent = append(s.sent, s.coupons[i].SeqNumber)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, cvs.ErrorResponse{ErrorCode: code, ErrorMessage: message})
+}
@@ -0,0 +1,129 @@
+package cvs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/csobrinho/supermarket-api/internal/logging"
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+)
+
+var log = logging.For("cvs")
+
+const (
+	COUPONS_PATH     = "/extracare/v1/cards/%s/coupons"
+	COUPON_SEND_PATH = "/extracare/v1/cards/%s/coupons/%s/send-to-card"
+
+	// ERROR_CODE_MAX_COUPONS is returned when the card can't hold more coupons.
+	ERROR_CODE_MAX_COUPONS = "MAX_COUPONS_ON_CARD"
+)
+
+type promotionService struct {
+	client  *http.Client
+	baseURL string
+	as      *authenticatorService
+}
+
+func NewPromotion(ctx context.Context, cfg *supermarket.Config, as *authenticatorService) (*promotionService, error) {
+	client, err := newClient(cfg, as.ts)
+	if err != nil {
+		return nil, fmt.Errorf("promotion: new http client, error %w", err)
+	}
+	return &promotionService{client: client, baseURL: baseURL(cfg), as: as}, nil
+}
+
+// GetClipDeals retrieves the coupons of the ExtraCare card, following the pagination.
+func (ps *promotionService) GetClipDeals(ctx context.Context, opts promotion.PromotionSearchOptions) ([]promotion.ClipDeal, error) {
+	card, err := ps.as.CardNumber()
+	if err != nil {
+		return nil, fmt.Errorf("promotion: get coupons, error %w", err)
+	}
+	var ret []promotion.ClipDeal
+	for page := 1; ; page++ {
+		res, err := ps.getCoupons(ctx, card, page)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range res.Coupons {
+			ret = append(ret, c.convert())
+		}
+		if len(res.Coupons) == 0 || page >= res.TotalPages {
+			break
+		}
+	}
+	log.InfoContext(ctx, "found ExtraCare coupons", "count", len(ret))
+	return promotion.Filter(ret, opts), nil
+}
+
+func (ps *promotionService) getCoupons(ctx context.Context, card string, page int) (*CouponsResponse, error) {
+	q := url.Values{}
+	q.Set("page", strconv.Itoa(page))
+	u := ps.baseURL + fmt.Sprintf(COUPONS_PATH, url.PathEscape(card)) + "?" + q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("promotion: get coupons request, error %w", err)
+	}
+	res, err := ps.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("promotion: get coupons response, error %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("promotion: get coupons response, error status %s", res.Status)
+	}
+	ret := &CouponsResponse{}
+	if err := json.NewDecoder(res.Body).Decode(ret); err != nil {
+		return nil, fmt.Errorf("promotion: get coupons response, error decoding %w", err)
+	}
+	return ret, nil
+}
+
+// ClipDeal sends the coupon to the ExtraCare card.
+func (ps *promotionService) ClipDeal(ctx context.Context, cd promotion.ClipDeal) error {
+	if cd.ID == "" {
+		return fmt.Errorf("promotion[%s]: clip deal missing id", cd.ID)
+	}
+	if cd.IsClipped {
+		return fmt.Errorf("promotion[%s]: clip deal already clipped", cd.ID)
+	}
+	if !cd.IsClippable {
+		return fmt.Errorf("promotion[%s]: clip deal is not clippable", cd.ID)
+	}
+	if cd.IsDeleted {
+		return fmt.Errorf("promotion[%s]: clip deal is deleted", cd.ID)
+	}
+	card, err := ps.as.CardNumber()
+	if err != nil {
+		return fmt.Errorf("promotion[%s]: clip deal, error %w", cd.ID, err)
+	}
+
+	u := ps.baseURL + fmt.Sprintf(COUPON_SEND_PATH, url.PathEscape(card), url.PathEscape(cd.ID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, nil)
+	if err != nil {
+		return fmt.Errorf("promotion[%s]: clip deal request, error %w", cd.ID, err)
+	}
+	res, err := ps.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("promotion[%s]: clip deal response, error %w", cd.ID, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusOK || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	b, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	er := ErrorResponse{}
+	_ = json.Unmarshal(b, &er)
+	if er.ErrorCode == ERROR_CODE_MAX_COUPONS {
+		return fmt.Errorf("promotion[%s]: clip deal response, error status %s, %w", cd.ID, res.Status, promotion.ErrClipLimitReached)
+	}
+	if er.ErrorMessage != "" {
+		return fmt.Errorf("promotion[%s]: clip deal response, error status %s, %s", cd.ID, res.Status, er.ErrorMessage)
+	}
+	return fmt.Errorf("promotion[%s]: clip deal response, error status %s", cd.ID, res.Status)
+}
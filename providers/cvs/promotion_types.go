@@ -0,0 +1,125 @@
+package cvs
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+)
+
+// Statuses of a coupon.
+const (
+	COUPON_STATUS_AVAILABLE = "AVAILABLE"
+	COUPON_STATUS_ON_CARD   = "ON_CARD"
+	COUPON_STATUS_REDEEMED  = "REDEEMED"
+	COUPON_STATUS_EXPIRED   = "EXPIRED"
+)
+
+// Discount types of a coupon.
+const (
+	COUPON_TYPE_DOLLAR  = "$"
+	COUPON_TYPE_PERCENT = "%"
+)
+
+// Date is a calendar date formatted as YYYY-MM-DD.
+type Date time.Time
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (d *Date) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil || s == "" {
+		return nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return fmt.Errorf("error parsing date '%s': %w", s, err)
+	}
+	*d = Date(t)
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (d Date) MarshalJSON() ([]byte, error) {
+	if time.Time(d).IsZero() {
+		return []byte(`""`), nil
+	}
+	return []byte(strconv.Quote(time.Time(d).Format(time.DateOnly))), nil
+}
+
+// String returns the date as YYYY-MM-DD.
+func (d Date) String() string { return time.Time(d).Format(time.DateOnly) }
+
+// CouponsResponse is a page of the coupons of an ExtraCare card.
+type CouponsResponse struct {
+	Coupons    []Coupon `json:"cpns"`
+	Page       int      `json:"page"`
+	TotalPages int      `json:"totalPages"`
+}
+
+// ErrorResponse is the body of an unsuccessful response.
+type ErrorResponse struct {
+	ErrorCode    string `json:"errorCode"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+// Coupon represents an ExtraCare coupon.
+type Coupon struct {
+	SeqNumber   string   `json:"cpnSeqNbr"`    // Maps to: ID
+	Number      string   `json:"cpnNbr"`       // Maps to: PromoCode
+	Description string   `json:"cpnDsc"`       // Maps to: Description
+	Terms       string   `json:"cpnTerms"`     // Maps to: Disclaimer
+	Brand       string   `json:"brandNm"`      // Maps to: Brand
+	Category    string   `json:"catNm"`        // Maps to: Categories
+	Type        string   `json:"cpnTypCd"`     // Maps to: Discount
+	Amount      float64  `json:"amtOff"`       // Maps to: Discount
+	Percent     float64  `json:"pctOff"`       // Maps to: Discount
+	MinQuantity int      `json:"minQty"`       // Maps to: MinPurchaseQuantity
+	ImageURL    string   `json:"imgUrl"`       // Maps to: ImageID
+	Skus        []string `json:"skuNbrs"`      // Maps to: Upcs
+	LoadDate    Date     `json:"loadDt"`       // Maps to: StartDate
+	ExpiryDate  Date     `json:"expirDt"`      // Maps to: EndDate
+	Status      string   `json:"cpnStatus"`    // Maps to: Status, IsClipped, IsClippable
+	Personal    bool     `json:"personalized"` // Maps to: PreviouslyPurchased
+}
+
+func (c Coupon) convert() promotion.ClipDeal {
+	promoCode, promoType := c.Number, c.Type
+	ret := promotion.ClipDeal{
+		Promotion: promotion.Promotion{
+			Brand:               c.Brand,
+			ID:                  c.SeqNumber,
+			Description:         c.Description,
+			Disclaimer:          c.Terms,
+			Type:                promotion.PromotionTypeCoupon,
+			ImageID:             c.ImageURL,
+			Upcs:                c.Skus,
+			PromoCode:           &promoCode,
+			PromoType:           &promoType,
+			Status:              c.Status,
+			StartDate:           time.Time(c.LoadDate),
+			EndDate:             time.Time(c.ExpiryDate),
+			PreviouslyPurchased: c.Personal,
+			IsDeleted:           c.Status == COUPON_STATUS_REDEEMED || c.Status == COUPON_STATUS_EXPIRED,
+			IsClippable:         c.Status == COUPON_STATUS_AVAILABLE,
+			IsDisplayable:       true,
+			IsClipped:           c.Status == COUPON_STATUS_ON_CARD,
+			Item:                c,
+		},
+		ExpiresAfterClip: true,
+	}
+	if c.Category != "" {
+		ret.Categories = []string{c.Category}
+	}
+	switch c.Type {
+	case COUPON_TYPE_DOLLAR:
+		ret.Discount = &promotion.Discount{Amount: c.Amount}
+	case COUPON_TYPE_PERCENT:
+		ret.Discount = &promotion.Discount{Percent: c.Percent}
+	}
+	if c.MinQuantity > 0 {
+		q := float64(c.MinQuantity)
+		ret.MinPurchaseQuantity = &q
+	}
+	return ret
+}
@@ -0,0 +1,112 @@
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+)
+
+// Item is the original item of the fake deals.
+type Item struct {
+	Source string `json:"source"` // "seed:<n>" or the path of the catalog file.
+	Index  int    `json:"index"`  // Position of the deal in the catalog.
+}
+
+var (
+	brands     = []string{"Lucerne", "Signature Select", "O Organics", "Open Nature", "Tide", "Coca-Cola", "Kellogg's", "Tillamook", "Barilla", "Dove"}
+	categories = []string{"Dairy", "Beverages", "Breakfast & Cereal", "Frozen Foods", "Meat & Seafood", "Produce", "Bread & Bakery", "Cleaning", "Personal Care", "Pasta & Rice"}
+	products   = []string{"Milk", "Soda 12 pack", "Cereal", "Ice Cream", "Chicken Breast", "Salad Mix", "Sandwich Bread", "Detergent", "Body Wash", "Spaghetti"}
+)
+
+// Generate returns a deterministic catalog of n deals for the seed. Dates are relative to the day of
+// now so the catalog stays current.
+func Generate(seed uint64, n int, now time.Time) []promotion.ClipDeal {
+	r := rand.New(rand.NewPCG(seed, seed^0x5eed))
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	source := "seed:" + strconv.FormatUint(seed, 10)
+	ret := make([]promotion.ClipDeal, 0, n)
+	for i := range n {
+		brand := brands[r.IntN(len(brands))]
+		category := categories[r.IntN(len(categories))]
+		product := products[r.IntN(len(products))]
+		price := float64(99+r.IntN(1200)) / 100
+		promoCode := fmt.Sprintf("FAKE%06d", i)
+		promoType := "CC"
+
+		cd := promotion.ClipDeal{
+			Promotion: promotion.Promotion{
+				Brand:         brand,
+				Categories:    []string{category},
+				ID:            fmt.Sprintf("fake-%d-%04d", seed, i),
+				Type:          promotion.PromotionTypeClipDeal,
+				Upcs:          []string{fmt.Sprintf("%012d", r.Int64N(1e12))},
+				PromoCode:     &promoCode,
+				PromoType:     &promoType,
+				StartDate:     day.AddDate(0, 0, -r.IntN(14)),
+				EndDate:       day.AddDate(0, 0, 1+r.IntN(28)).Add(-time.Second),
+				IsDisplayable: true,
+				IsClippable:   true,
+				Item:          Item{Source: source, Index: i},
+			},
+			ExpiresAfterClip: true,
+		}
+		if r.IntN(3) == 0 {
+			pct := float64(5 * (1 + r.IntN(8)))
+			cd.Description = fmt.Sprintf("%.0f%% off %s %s", pct, brand, product)
+			cd.Price = &price
+			cd.Discount = &promotion.Discount{Percent: pct}
+		} else {
+			amount := float64(25*(1+r.IntN(16))) / 100
+			cd.Description = fmt.Sprintf("$%.2f off %s %s", amount, brand, product)
+			// The regular price, which is more than the savings.
+			if price <= amount {
+				price += amount
+			}
+			cd.Price = &price
+			cd.Discount = &promotion.Discount{Amount: amount}
+		}
+		switch r.IntN(10) {
+		case 0:
+			cd.IsClipped = true
+		case 1:
+			cd.IsClippable = false
+		}
+		if r.IntN(4) == 0 {
+			rank := 1 + r.IntN(20)
+			cd.PurchaseRank = &rank
+			cd.PreviouslyPurchased = true
+		}
+		cd.Status = status(cd.IsClipped)
+		ret = append(ret, cd)
+	}
+	return ret
+}
+
+// LoadCatalog reads a catalog from a JSON file holding an array of promotion.ClipDeal, e.g. the
+// deals of a stored snapshot.
+func LoadCatalog(path string) ([]promotion.ClipDeal, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("fake: read catalog %q, error %w", path, err)
+	}
+	var ret []promotion.ClipDeal
+	if err := json.Unmarshal(b, &ret); err != nil {
+		return nil, fmt.Errorf("fake: decode catalog %q, error %w", path, err)
+	}
+	for i := range ret {
+		ret[i].Item = Item{Source: path, Index: i}
+	}
+	return ret, nil
+}
+
+func status(clipped bool) string {
+	if clipped {
+		return "clipped"
+	}
+	return "unclipped"
+}
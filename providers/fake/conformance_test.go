@@ -0,0 +1,13 @@
+package fake_test
+
+import (
+	"testing"
+
+	"github.com/csobrinho/supermarket-api/pkg/supermarket/supermarkettest"
+	"github.com/csobrinho/supermarket-api/providers/fake"
+	"github.com/csobrinho/supermarket-api/providers/fake/faketest"
+)
+
+func TestConformance(t *testing.T) {
+	supermarkettest.RunConformance(t, fake.Creator, faketest.Fixture)
+}
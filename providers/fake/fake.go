@@ -0,0 +1,126 @@
+// Package fake implements an in-memory supermarket with a deterministic catalog, to exercise the
+// CLI and integrations end to end without real credentials.
+//
+// Clipping and unclipping can simulate failures, latency, rate limits and the account clip limit.
+// The clipped state is kept across calls and, with a state file, across runs.
+package fake
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"sync/atomic"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/auth"
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"golang.org/x/oauth2"
+)
+
+var _ supermarket.Supermarket = (*Fake)(nil)
+var _ supermarket.Capable = (*Fake)(nil)
+var _ auth.Service = (*Fake)(nil)
+var _ promotion.Service = (*promotionService)(nil)
+var _ promotion.Unclipper = (*promotionService)(nil)
+
+var (
+	// ErrSimulated is returned by simulated failures.
+	ErrSimulated = errors.New("fake: simulated failure")
+	// ErrRateLimited is returned when clips exceed the simulated rate limit.
+	ErrRateLimited = errors.New("fake: rate limited")
+)
+
+var (
+	catalogFile = flag.String("fake_catalog", supermarket.LookupEnv("FAKE_CATALOG", ""), "If provided, JSON file with the deals of the fake provider. Can also be provided via 'FAKE_CATALOG' env.")
+	seed        = flag.Int("fake_seed", supermarket.LookupEnvInt("FAKE_SEED", 1), "Seed of the generated catalog of the fake provider. Can also be provided via 'FAKE_SEED' env.")
+	deals       = flag.Int("fake_deals", supermarket.LookupEnvInt("FAKE_DEALS", 50), "Number of deals of the generated catalog of the fake provider. Can also be provided via 'FAKE_DEALS' env.")
+	failureRate = flag.Float64("fake_failure_rate", supermarket.LookupEnvFloat("FAKE_FAILURE_RATE", 0), "Fraction [0-1] of clips and unclips of the fake provider that fail. Can also be provided via 'FAKE_FAILURE_RATE' env.")
+	latency     = flag.Duration("fake_latency", supermarket.LookupEnvDuration("FAKE_LATENCY", 0), "Latency of every call of the fake provider. Can also be provided via 'FAKE_LATENCY' env.")
+	rateLimit   = flag.Int("fake_rate_limit", supermarket.LookupEnvInt("FAKE_RATE_LIMIT", 0), "If provided, maximum clips and unclips per second of the fake provider. Can also be provided via 'FAKE_RATE_LIMIT' env.")
+	clipLimit   = flag.Int("fake_clip_limit", supermarket.LookupEnvInt("FAKE_CLIP_LIMIT", 0), "If provided, maximum number of clipped deals of the fake provider. Can also be provided via 'FAKE_CLIP_LIMIT' env.")
+	stateFile   = flag.String("fake_state_file", supermarket.LookupEnv("FAKE_STATE_FILE", ""), "If provided, file where the fake provider keeps the clipped deals across runs. Can also be provided via 'FAKE_STATE_FILE' env.")
+)
+
+// Capabilities are the capabilities of the fake supermarket.
+var Capabilities = supermarket.Capabilities{supermarket.CapabilityClip, supermarket.CapabilityUnclip}
+
+// Options configures the fake supermarket.
+type Options struct {
+	Catalog     []promotion.ClipDeal // If nil, a catalog is generated from Seed.
+	Seed        uint64
+	Deals       int           // Number of generated deals.
+	FailureRate float64       // Fraction [0-1] of clips and unclips that fail with ErrSimulated.
+	Latency     time.Duration // Added to every call.
+	RateLimit   int           // Maximum clips and unclips per second, zero means unlimited.
+	ClipLimit   int           // Maximum number of clipped deals, zero means unlimited.
+	StateFile   string        // If set, the clipped deals are persisted to this file.
+	Now         func() time.Time
+}
+
+// Creator creates a fake supermarket configured from the fake_* flags, overridden by the flags of
+// the config.
+func Creator(ctx context.Context, cfg *supermarket.Config) (supermarket.Supermarket, error) {
+	var (
+		opts    Options
+		seedV   int
+		catalog string
+	)
+	fs := flag.NewFlagSet("fake", flag.ContinueOnError)
+	fs.StringVar(&catalog, "fake_catalog", *catalogFile, "")
+	fs.IntVar(&seedV, "fake_seed", *seed, "")
+	fs.IntVar(&opts.Deals, "fake_deals", *deals, "")
+	fs.Float64Var(&opts.FailureRate, "fake_failure_rate", *failureRate, "")
+	fs.DurationVar(&opts.Latency, "fake_latency", *latency, "")
+	fs.IntVar(&opts.RateLimit, "fake_rate_limit", *rateLimit, "")
+	fs.IntVar(&opts.ClipLimit, "fake_clip_limit", *clipLimit, "")
+	fs.StringVar(&opts.StateFile, "fake_state_file", *stateFile, "")
+	if err := cfg.SetFlags(fs); err != nil {
+		return nil, err
+	}
+	opts.Seed = uint64(seedV)
+	if catalog != "" {
+		var err error
+		if opts.Catalog, err = LoadCatalog(catalog); err != nil {
+			return nil, err
+		}
+	}
+	return New(opts)
+}
+
+// Fake is an in-memory supermarket. It is its own authenticator, which always succeeds.
+type Fake struct {
+	ps            *promotionService
+	authenticated atomic.Bool
+}
+
+// New creates a fake supermarket.
+func New(opts Options) (*Fake, error) {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	if opts.Catalog == nil {
+		opts.Catalog = Generate(opts.Seed, opts.Deals, opts.Now())
+	}
+	ps, err := newPromotion(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Fake{ps: ps}, nil
+}
+
+func (f *Fake) Authenticator() (auth.Service, error)   { return f, nil }
+func (f *Fake) Promotion() (promotion.Service, error)  { return f.ps, nil }
+func (f *Fake) Capabilities() supermarket.Capabilities { return Capabilities }
+
+func (f *Fake) RefreshToken(ctx context.Context) (*oauth2.Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.authenticated.Store(true)
+	return f.TokenSource().Token()
+}
+func (f *Fake) TokenSource() oauth2.TokenSource {
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "fake", TokenType: "Bearer"})
+}
+func (f *Fake) IsAuthenticated(ctx context.Context) bool { return f.authenticated.Load() }
@@ -0,0 +1,316 @@
+package fake_test
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"github.com/csobrinho/supermarket-api/providers/fake"
+)
+
+var t0 = time.Date(2025, 5, 15, 13, 43, 55, 0, time.UTC)
+
+func catalog() []promotion.ClipDeal {
+	deal := func(id string, clippable, clipped bool) promotion.ClipDeal {
+		return promotion.ClipDeal{Promotion: promotion.Promotion{ID: id, Brand: "Lucerne", IsClippable: clippable, IsClipped: clipped}}
+	}
+	return []promotion.ClipDeal{deal("1", true, false), deal("2", true, false), deal("3", true, false), deal("4", true, true), deal("5", false, false)}
+}
+
+// newPromotion creates the fake through a factory, the same way the CLI does.
+func newPromotion(t *testing.T, opts fake.Options) supermarket.PromotionService {
+	t.Helper()
+	if opts.Catalog == nil {
+		opts.Catalog = catalog()
+	}
+	opts.Now = func() time.Time { return t0 }
+	f := supermarket.NewFactory()
+	f.Register("fake", func(ctx context.Context, cfg *supermarket.Config) (supermarket.Supermarket, error) {
+		return fake.New(opts)
+	}, fake.Capabilities...)
+	sm, err := f.Create(t.Context(), "fake")
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	if _, err := sm.Authenticator(); err != nil {
+		t.Fatalf("Authenticator() failed: %v", err)
+	}
+	ps, err := sm.Promotion()
+	if err != nil {
+		t.Fatalf("Promotion() failed: %v", err)
+	}
+	return ps
+}
+
+func getClipDeals(t *testing.T, ps supermarket.PromotionService) map[string]promotion.ClipDeal {
+	t.Helper()
+	cds, err := ps.GetClipDeals(t.Context(), promotion.PromotionSearchOptions{})
+	if err != nil {
+		t.Fatalf("GetClipDeals() failed: %v", err)
+	}
+	ret := make(map[string]promotion.ClipDeal, len(cds))
+	for _, cd := range cds {
+		ret[cd.ID] = cd
+	}
+	return ret
+}
+
+func unclipper(t *testing.T, ps supermarket.PromotionService) promotion.Unclipper {
+	t.Helper()
+	u, ok := ps.(promotion.Unclipper)
+	if !ok {
+		t.Fatalf("%T doesn't implement promotion.Unclipper", ps)
+	}
+	return u
+}
+
+func TestGenerate(t *testing.T) {
+	a, b := fake.Generate(7, 20, t0), fake.Generate(7, 20, t0.Add(time.Hour))
+	if len(a) != 20 {
+		t.Fatalf("Generate() returned %d deals, want 20", len(a))
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID || a[i].Description != b[i].Description || !a[i].EndDate.Equal(b[i].EndDate) {
+			t.Errorf("Generate()[%d] = %s %q, want the same deal on the same day, got %s %q", i, a[i].ID, a[i].Description, b[i].ID, b[i].Description)
+		}
+		if !a[i].EndDate.After(t0) {
+			t.Errorf("Generate()[%d] ends %v, want after %v", i, a[i].EndDate, t0)
+		}
+		if p, d := a[i].Price, a[i].Discount; p == nil || d == nil || *p <= d.Amount {
+			t.Errorf("Generate()[%d] price = %v, discount = %+v, want a regular price above the savings", i, p, d)
+		}
+	}
+	if c := fake.Generate(8, 20, t0); c[0].ID == a[0].ID {
+		t.Errorf("Generate(other seed)[0] = %s, want another catalog", c[0].ID)
+	}
+}
+
+func TestClipUnclip(t *testing.T) {
+	ps := newPromotion(t, fake.Options{})
+	cds := getClipDeals(t, ps)
+	if err := ps.ClipDeal(t.Context(), cds["1"]); err != nil {
+		t.Fatalf("ClipDeal() failed: %v", err)
+	}
+	got := getClipDeals(t, ps)["1"]
+	if !got.IsClipped || got.Status != "clipped" || got.ClippedAt == nil || !got.ClippedAt.Equal(t0) {
+		t.Errorf("GetClipDeals() after ClipDeal() = %+v, want clipped at %v", got.Promotion, t0)
+	}
+	if err := ps.ClipDeal(t.Context(), cds["1"]); err == nil {
+		t.Error("ClipDeal(clipped) succeeded")
+	}
+	if err := ps.ClipDeal(t.Context(), cds["5"]); err == nil {
+		t.Error("ClipDeal(not clippable) succeeded")
+	}
+	if err := ps.ClipDeal(t.Context(), promotion.ClipDeal{Promotion: promotion.Promotion{ID: "nope"}}); err == nil {
+		t.Error("ClipDeal(unknown) succeeded")
+	}
+
+	u := unclipper(t, ps)
+	if err := u.UnclipDeal(t.Context(), cds["4"]); err != nil {
+		t.Fatalf("UnclipDeal() failed: %v", err)
+	}
+	if got := getClipDeals(t, ps)["4"]; got.IsClipped || got.Status != "unclipped" || got.ClippedAt != nil {
+		t.Errorf("GetClipDeals() after UnclipDeal() = %+v, want unclipped", got.Promotion)
+	}
+	if err := u.UnclipDeal(t.Context(), cds["2"]); err == nil {
+		t.Error("UnclipDeal(not clipped) succeeded")
+	}
+}
+
+// The catalog has one clipped deal, a limit of 2 allows a single clip until a deal is unclipped.
+func TestClipLimit(t *testing.T) {
+	ps := newPromotion(t, fake.Options{ClipLimit: 2})
+	cds := getClipDeals(t, ps)
+	if err := ps.ClipDeal(t.Context(), cds["1"]); err != nil {
+		t.Fatalf("ClipDeal() failed: %v", err)
+	}
+	if err := ps.ClipDeal(t.Context(), cds["2"]); !errors.Is(err, promotion.ErrClipLimitReached) {
+		t.Errorf("ClipDeal() over the limit = %v, want %v", err, promotion.ErrClipLimitReached)
+	}
+	if err := unclipper(t, ps).UnclipDeal(t.Context(), cds["4"]); err != nil {
+		t.Fatalf("UnclipDeal() failed: %v", err)
+	}
+	if err := ps.ClipDeal(t.Context(), cds["2"]); err != nil {
+		t.Errorf("ClipDeal() after UnclipDeal() failed: %v", err)
+	}
+}
+
+func TestFailureRate(t *testing.T) {
+	ps := newPromotion(t, fake.Options{FailureRate: 1})
+	cds := getClipDeals(t, ps)
+	if err := ps.ClipDeal(t.Context(), cds["1"]); !errors.Is(err, fake.ErrSimulated) {
+		t.Errorf("ClipDeal() = %v, want %v", err, fake.ErrSimulated)
+	}
+	if err := unclipper(t, ps).UnclipDeal(t.Context(), cds["4"]); !errors.Is(err, fake.ErrSimulated) {
+		t.Errorf("UnclipDeal() = %v, want %v", err, fake.ErrSimulated)
+	}
+	// A failed clip doesn't change the deal.
+	if got := getClipDeals(t, ps)["1"]; got.IsClipped {
+		t.Errorf("GetClipDeals() after a failed ClipDeal() = %+v, want unclipped", got.Promotion)
+	}
+
+	// Part of the clips fail, the same ones for the same seed.
+	failures := func() []string {
+		deals := fake.Generate(1, 100, t0)
+		for i := range deals {
+			deals[i].IsClipped, deals[i].IsClippable = false, true
+		}
+		ps := newPromotion(t, fake.Options{Catalog: deals, Seed: 1, FailureRate: 0.3})
+		var ret []string
+		for _, cd := range deals {
+			if err := ps.ClipDeal(t.Context(), cd); errors.Is(err, fake.ErrSimulated) {
+				ret = append(ret, cd.ID)
+			} else if err != nil {
+				t.Fatalf("ClipDeal() failed: %v", err)
+			}
+		}
+		return ret
+	}
+	got := failures()
+	if len(got) < 10 || len(got) > 50 {
+		t.Errorf("ClipDeal() failed %d times out of 100, want about 30", len(got))
+	}
+	if again := failures(); !slices.Equal(again, got) {
+		t.Errorf("ClipDeal() failures = %v, want the same as %v", again, got)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	ps := newPromotion(t, fake.Options{RateLimit: 2})
+	cds := getClipDeals(t, ps)
+	for _, id := range []string{"1", "2"} {
+		if err := ps.ClipDeal(t.Context(), cds[id]); err != nil {
+			t.Fatalf("ClipDeal(%s) failed: %v", id, err)
+		}
+	}
+	if err := ps.ClipDeal(t.Context(), cds["3"]); !errors.Is(err, fake.ErrRateLimited) {
+		t.Errorf("ClipDeal() over the rate limit = %v, want %v", err, fake.ErrRateLimited)
+	}
+	if err := unclipper(t, ps).UnclipDeal(t.Context(), cds["4"]); !errors.Is(err, fake.ErrRateLimited) {
+		t.Errorf("UnclipDeal() over the rate limit = %v, want %v", err, fake.ErrRateLimited)
+	}
+	// Listing isn't rate limited.
+	getClipDeals(t, ps)
+}
+
+func TestLatency(t *testing.T) {
+	ps := newPromotion(t, fake.Options{Latency: time.Minute})
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := ps.GetClipDeals(ctx, promotion.PromotionSearchOptions{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetClipDeals() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if err := ps.ClipDeal(ctx, catalog()[0]); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ClipDeal() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	ps := newPromotion(t, fake.Options{StateFile: path})
+	cds := getClipDeals(t, ps)
+	if err := ps.ClipDeal(t.Context(), cds["1"]); err != nil {
+		t.Fatalf("ClipDeal() failed: %v", err)
+	}
+	if err := unclipper(t, ps).UnclipDeal(t.Context(), cds["4"]); err != nil {
+		t.Fatalf("UnclipDeal() failed: %v", err)
+	}
+
+	// A new run starts from the state of the previous one, including the clip limit.
+	ps = newPromotion(t, fake.Options{StateFile: path, ClipLimit: 2})
+	got := getClipDeals(t, ps)
+	if cd := got["1"]; !cd.IsClipped || cd.ClippedAt == nil || !cd.ClippedAt.Equal(t0) {
+		t.Errorf("GetClipDeals()[1] = %+v, want clipped at %v", cd.Promotion, t0)
+	}
+	if cd := got["4"]; cd.IsClipped {
+		t.Errorf("GetClipDeals()[4] = %+v, want unclipped", cd.Promotion)
+	}
+	if err := ps.ClipDeal(t.Context(), got["2"]); err != nil {
+		t.Fatalf("ClipDeal() failed: %v", err)
+	}
+	if err := ps.ClipDeal(t.Context(), got["3"]); !errors.Is(err, promotion.ErrClipLimitReached) {
+		t.Errorf("ClipDeal() over the limit = %v, want %v", err, promotion.ErrClipLimitReached)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fake.New(fake.Options{Catalog: catalog(), StateFile: path}); err == nil {
+		t.Error("New() with a corrupted state succeeded, want an error")
+	}
+}
+
+func TestLoadCatalog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	if err := os.WriteFile(path, []byte(`[{"id":"a","is_clippable":true},{"id":"b"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	deals, err := fake.LoadCatalog(path)
+	if err != nil {
+		t.Fatalf("LoadCatalog() failed: %v", err)
+	}
+	if len(deals) != 2 || deals[1].ID != "b" || deals[1].Item != (fake.Item{Source: path, Index: 1}) {
+		t.Errorf("LoadCatalog() = %+v, want deals a and b from the file", deals)
+	}
+	if _, err := fake.LoadCatalog(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadCatalog(missing) succeeded, want an error")
+	}
+}
+
+// The CLI configures the fake with the fake_* flags.
+func TestCreator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	for name, value := range map[string]string{"fake_seed": "3", "fake_deals": "7", "fake_clip_limit": "1", "fake_state_file": path} {
+		f := flag.Lookup(name)
+		old := f.Value.String()
+		if err := f.Value.Set(value); err != nil {
+			t.Fatalf("flag %s: Set(%q) failed: %v", name, value, err)
+		}
+		t.Cleanup(func() { f.Value.Set(old) })
+	}
+	f := supermarket.NewFactory()
+	f.Register("fake", fake.Creator, fake.Capabilities...)
+	sm, err := f.Create(t.Context(), "fake")
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	if got := supermarket.CapabilitiesOf(sm); !got.Has(supermarket.CapabilityUnclip) {
+		t.Errorf("CapabilitiesOf() = %v, want unclip", got)
+	}
+	ps, err := sm.Promotion()
+	if err != nil {
+		t.Fatalf("Promotion() failed: %v", err)
+	}
+	cds, err := ps.GetClipDeals(t.Context(), promotion.PromotionSearchOptions{})
+	if err != nil || len(cds) != 7 || cds[0].ID != "fake-3-0000" {
+		t.Fatalf("GetClipDeals() = %d deals, %v, want 7 of seed 3", len(cds), err)
+	}
+	var clipped int
+	for _, cd := range cds {
+		if cd.IsClipped {
+			clipped++
+			continue
+		}
+		if !cd.IsClippable || cd.IsDeleted {
+			continue
+		}
+		if err := ps.ClipDeal(t.Context(), cd); err != nil && !errors.Is(err, promotion.ErrClipLimitReached) {
+			t.Fatalf("ClipDeal() failed: %v", err)
+		} else if err == nil {
+			clipped++
+		}
+	}
+	if clipped != 1 {
+		t.Errorf("clipped %d deals, want the clip limit of 1", clipped)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("state file: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+// Package faketest provides the fixture to run the conformance suite against the fake provider.
+package faketest
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	_ "github.com/csobrinho/supermarket-api/providers/fake" // Defines the fake_* flags.
+)
+
+// Fixture configures the fake_* flags for the test, restored when it ends, and returns the options
+// to create a fake client. The fake has no server, fake.Creator reads its configuration from the
+// flags: a generated catalog without failures, latency or limits, and a new state file so clips
+// don't leak between tests. It is a supermarkettest.Fixture.
+func Fixture(t testing.TB) []supermarket.Option {
+	for name, value := range map[string]string{
+		"fake_catalog":      "",
+		"fake_seed":         "1",
+		"fake_deals":        "50",
+		"fake_failure_rate": "0",
+		"fake_latency":      "0s",
+		"fake_rate_limit":   "0",
+		"fake_clip_limit":   "0",
+		"fake_state_file":   filepath.Join(t.TempDir(), "state.json"),
+	} {
+		setFlag(t, name, value)
+	}
+	return nil
+}
+
+func setFlag(t testing.TB, name, value string) {
+	t.Helper()
+	f := flag.Lookup(name)
+	if f == nil {
+		panic(fmt.Sprintf("faketest: flag %s isn't defined", name))
+	}
+	old := f.Value.String()
+	if err := f.Value.Set(value); err != nil {
+		t.Fatalf("faketest: set flag %s to %q, error %v", name, value, err)
+	}
+	t.Cleanup(func() { _ = f.Value.Set(old) })
+}
@@ -0,0 +1,168 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/logging"
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+)
+
+var log = logging.For("fake")
+
+type promotionService struct {
+	opts Options
+
+	mu      sync.Mutex
+	deals   []promotion.ClipDeal
+	index   map[string]int
+	rand    *rand.Rand
+	calls   []time.Time // Times of the clips and unclips of the last second.
+	clipped int
+}
+
+func newPromotion(opts Options) (*promotionService, error) {
+	ps := &promotionService{
+		opts:  opts,
+		deals: slices.Clone(opts.Catalog),
+		index: make(map[string]int, len(opts.Catalog)),
+		rand:  rand.New(rand.NewPCG(opts.Seed, 0xfa11)),
+	}
+	for i, cd := range ps.deals {
+		ps.index[cd.ID] = i
+	}
+	if opts.StateFile != "" {
+		st, err := loadState(opts.StateFile)
+		if err != nil {
+			return nil, err
+		}
+		for id, at := range st.Clipped {
+			if i, ok := ps.index[id]; ok {
+				ps.setClipped(i, true, at)
+			}
+		}
+		for _, id := range st.Unclipped {
+			if i, ok := ps.index[id]; ok {
+				ps.setClipped(i, false, time.Time{})
+			}
+		}
+	}
+	for _, cd := range ps.deals {
+		if cd.IsClipped {
+			ps.clipped++
+		}
+	}
+	return ps, nil
+}
+
+// GetClipDeals returns the catalog with the current clipped state.
+func (ps *promotionService) GetClipDeals(ctx context.Context, opts promotion.PromotionSearchOptions) ([]promotion.ClipDeal, error) {
+	if err := ps.wait(ctx); err != nil {
+		return nil, err
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	log.InfoContext(ctx, "found fake deals", "count", len(ps.deals), "clipped", ps.clipped)
+	return promotion.Filter(slices.Clone(ps.deals), opts), nil
+}
+
+// ClipDeal clips a deal, subject to the simulated failures, rate limit and clip limit.
+func (ps *promotionService) ClipDeal(ctx context.Context, cd promotion.ClipDeal) error {
+	return ps.update(ctx, cd, true)
+}
+
+// UnclipDeal removes a clipped deal, subject to the simulated failures and rate limit.
+func (ps *promotionService) UnclipDeal(ctx context.Context, cd promotion.ClipDeal) error {
+	return ps.update(ctx, cd, false)
+}
+
+func (ps *promotionService) update(ctx context.Context, cd promotion.ClipDeal, clip bool) error {
+	action := "unclip"
+	if clip {
+		action = "clip"
+	}
+	if err := ps.wait(ctx); err != nil {
+		return fmt.Errorf("promotion[%s]: %s deal, error %w", cd.ID, action, err)
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	i, ok := ps.index[cd.ID]
+	if !ok {
+		return fmt.Errorf("promotion[%s]: %s deal not found", cd.ID, action)
+	}
+	if err := ps.limit(); err != nil {
+		return fmt.Errorf("promotion[%s]: %s deal, error %w", cd.ID, action, err)
+	}
+	if ps.opts.FailureRate > 0 && ps.rand.Float64() < ps.opts.FailureRate {
+		return fmt.Errorf("promotion[%s]: %s deal, error %w", cd.ID, action, ErrSimulated)
+	}
+	cur := ps.deals[i]
+	switch {
+	case clip && cur.IsClipped:
+		return fmt.Errorf("promotion[%s]: clip deal already clipped", cd.ID)
+	case clip && (!cur.IsClippable || cur.IsDeleted):
+		return fmt.Errorf("promotion[%s]: clip deal is not clippable", cd.ID)
+	case clip && ps.opts.ClipLimit > 0 && ps.clipped >= ps.opts.ClipLimit:
+		return fmt.Errorf("promotion[%s]: clip deal, error %w", cd.ID, promotion.ErrClipLimitReached)
+	case !clip && !cur.IsClipped:
+		return fmt.Errorf("promotion[%s]: unclip deal is not clipped", cd.ID)
+	}
+	now := ps.opts.Now()
+	ps.setClipped(i, clip, now)
+	if clip {
+		ps.clipped++
+	} else {
+		ps.clipped--
+	}
+	if ps.opts.StateFile != "" {
+		if err := ps.saveState(); err != nil {
+			return fmt.Errorf("promotion[%s]: %s deal, error %w", cd.ID, action, err)
+		}
+	}
+	return nil
+}
+
+func (ps *promotionService) setClipped(i int, clipped bool, at time.Time) {
+	cd := &ps.deals[i]
+	cd.IsClipped = clipped
+	cd.Status = status(clipped)
+	cd.ClippedAt = nil
+	if clipped && !at.IsZero() {
+		cd.ClippedAt = &at
+	}
+}
+
+// wait simulates the latency of a call.
+func (ps *promotionService) wait(ctx context.Context) error {
+	if ps.opts.Latency <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(ps.opts.Latency)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// limit enforces the rate limit over a sliding window of one second. It must be called with the
+// lock held.
+func (ps *promotionService) limit() error {
+	if ps.opts.RateLimit <= 0 {
+		return nil
+	}
+	now := time.Now()
+	ps.calls = slices.DeleteFunc(ps.calls, func(t time.Time) bool { return now.Sub(t) >= time.Second })
+	if len(ps.calls) >= ps.opts.RateLimit {
+		return ErrRateLimited
+	}
+	ps.calls = append(ps.calls, now)
+	return nil
+}
@@ -0,0 +1,64 @@
+package fake
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/fileutil"
+)
+
+// state is the clipped state of the deals that changed from the catalog.
+type state struct {
+	Clipped   map[string]time.Time `json:"clipped"`   // Deal id to the time it was clipped.
+	Unclipped []string             `json:"unclipped"` // Deals clipped in the catalog that were unclipped.
+}
+
+func loadState(path string) (*state, error) {
+	st := &state{Clipped: map[string]time.Time{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fake: read state %q, error %w", path, err)
+	}
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, fmt.Errorf("fake: decode state %q, error %w", path, err)
+	}
+	if st.Clipped == nil {
+		st.Clipped = map[string]time.Time{}
+	}
+	return st, nil
+}
+
+// saveState atomically writes the deals whose clipped state differs from the catalog. It must be
+// called with the lock held.
+func (ps *promotionService) saveState() error {
+	st := &state{Clipped: map[string]time.Time{}}
+	for i, cd := range ps.deals {
+		orig := ps.opts.Catalog[i]
+		switch {
+		case cd.IsClipped && !orig.IsClipped:
+			var at time.Time
+			if cd.ClippedAt != nil {
+				at = *cd.ClippedAt
+			}
+			st.Clipped[cd.ID] = at
+		case !cd.IsClipped && orig.IsClipped:
+			st.Unclipped = append(st.Unclipped, cd.ID)
+		}
+	}
+	slices.Sort(st.Unclipped)
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("fake: encode state, error %w", err)
+	}
+	if err := fileutil.WriteAtomic(ps.opts.StateFile, b); err != nil {
+		return fmt.Errorf("fake: save state, error %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package kroger
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/csobrinho/supermarket-api/internal/auth"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+var _ auth.Service = (*authenticatorService)(nil)
+var _ oauth2.TokenSource = (*authenticatorService)(nil)
+
+const (
+	AUTHORIZE_PATH = "/v1/connect/oauth2/authorize"
+	TOKEN_PATH     = "/v1/connect/oauth2/token"
+)
+
+var (
+	// clientScopes are granted to client credentials tokens, which can only browse.
+	clientScopes = []string{"product.compact"}
+	// userScopes are needed to act on behalf of the customer, e.g. to clip coupons.
+	userScopes = []string{"profile.compact", "cart.basic:write", "coupon.basic:write"}
+)
+
+// authenticatorService authenticates with the client credentials of the application, or with the
+// refresh token of a customer obtained through the authorization code flow.
+type authenticatorService struct {
+	config        *oauth2.Config
+	client        *http.Client
+	ctx           context.Context
+	mu            sync.Mutex
+	ts            oauth2.TokenSource
+	authenticated bool
+}
+
+func NewAuthenticator(ctx context.Context, cfg *supermarket.Config) (*authenticatorService, error) {
+	if cfg.ClientID == "" || cfg.ClientSecret == "" {
+		return nil, fmt.Errorf("authenticator: missing client id or client secret")
+	}
+	base := baseURL(cfg)
+	config := &oauth2.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   base + AUTHORIZE_PATH,
+			TokenURL:  base + TOKEN_PATH,
+			AuthStyle: oauth2.AuthStyleInHeader,
+		},
+		RedirectURL: cfg.RedirectURL,
+		Scopes:      userScopes,
+	}
+	client, err := newClient(cfg, nil)
+	if err != nil {
+		return nil, fmt.Errorf("authenticator: new http client, error %w", err)
+	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, client)
+
+	as := &authenticatorService{config: config, client: client, ctx: ctx}
+	if cfg.RefreshToken != "" {
+		as.ts = config.TokenSource(ctx, &oauth2.Token{RefreshToken: cfg.RefreshToken, TokenType: "Bearer"})
+	} else {
+		cc := &clientcredentials.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			TokenURL:     config.Endpoint.TokenURL,
+			Scopes:       clientScopes,
+			AuthStyle:    oauth2.AuthStyleInHeader,
+		}
+		as.ts = cc.TokenSource(ctx)
+	}
+	return as, nil
+}
+
+// AuthCodeURL returns the URL where the customer authorizes the application. The customer is then
+// redirected to the redirect URL with a code to pass to Exchange.
+func (as *authenticatorService) AuthCodeURL(state string) string {
+	return as.config.AuthCodeURL(state)
+}
+
+// Exchange converts an authorization code into a token and uses it from now on. The refresh token
+// of the result can be persisted and passed back with supermarket.WithCredentials.
+func (as *authenticatorService) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	t, err := as.config.Exchange(context.WithValue(ctx, oauth2.HTTPClient, as.client), code)
+	if err != nil {
+		return nil, fmt.Errorf("authenticator: exchange code, error %w", err)
+	}
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.ts = as.config.TokenSource(as.ctx, t)
+	as.authenticated = true
+	return t, nil
+}
+
+// Token implements oauth2.TokenSource with the current token source, so the services created
+// before Exchange use the customer token.
+func (as *authenticatorService) Token() (*oauth2.Token, error) {
+	as.mu.Lock()
+	ts := as.ts
+	as.mu.Unlock()
+	return ts.Token()
+}
+
+func (as *authenticatorService) RefreshToken(ctx context.Context) (*oauth2.Token, error) {
+	t, err := as.Token()
+	as.mu.Lock()
+	as.authenticated = err == nil
+	as.mu.Unlock()
+	return t, err
+}
+func (as *authenticatorService) TokenSource() oauth2.TokenSource { return as }
+func (as *authenticatorService) IsAuthenticated(ctx context.Context) bool {
+	as.mu.Lock()
+	authenticated := as.authenticated
+	as.mu.Unlock()
+	if !authenticated {
+		return false
+	}
+	_, err := as.RefreshToken(ctx)
+	return err == nil
+}
@@ -0,0 +1,13 @@
+package kroger_test
+
+import (
+	"testing"
+
+	"github.com/csobrinho/supermarket-api/pkg/supermarket/supermarkettest"
+	"github.com/csobrinho/supermarket-api/providers/kroger"
+	"github.com/csobrinho/supermarket-api/providers/kroger/krogertest"
+)
+
+func TestConformance(t *testing.T) {
+	supermarkettest.RunConformance(t, kroger.Creator, krogertest.Fixture)
+}
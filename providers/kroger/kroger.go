@@ -0,0 +1,73 @@
+// Package kroger implements the Kroger family of stores (Kroger, Ralphs, Fred Meyer, King Soopers,
+// ...) on top of the Kroger API.
+//
+// Digital coupons are not part of the documented public API. The coupon endpoints follow its
+// conventions (filter.* query parameters, data and meta envelopes) and can be pointed elsewhere
+// with supermarket.WithBaseURL.
+package kroger
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/csobrinho/supermarket-api/internal/auth"
+	ihttp "github.com/csobrinho/supermarket-api/internal/http"
+	"github.com/csobrinho/supermarket-api/internal/logging"
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"golang.org/x/oauth2"
+)
+
+var _ supermarket.Supermarket = (*kroger)(nil)
+var _ supermarket.Capable = (*kroger)(nil)
+var _ supermarket.StoreLocator = (*kroger)(nil)
+var _ promotion.Service = (*promotionService)(nil)
+
+var log = logging.For("kroger")
+
+// DefaultBaseURL is the base URL of the Kroger API.
+const DefaultBaseURL = "https://api.kroger.com"
+
+// Capabilities are the capabilities of the kroger supermarket.
+var Capabilities = supermarket.Capabilities{supermarket.CapabilityClip, supermarket.CapabilityStoreLookup}
+
+func Creator(ctx context.Context, cfg *supermarket.Config) (supermarket.Supermarket, error) {
+	a, err := NewAuthenticator(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	ps, err := NewPromotion(ctx, cfg, a)
+	if err != nil {
+		return nil, err
+	}
+	ls, err := NewLocation(ctx, cfg, a)
+	if err != nil {
+		return nil, err
+	}
+	return &kroger{as: a, ps: ps, ls: ls}, nil
+}
+
+type kroger struct {
+	as *authenticatorService
+	ps *promotionService
+	ls *locationService
+}
+
+func (k *kroger) Authenticator() (auth.Service, error)   { return k.as, nil }
+func (k *kroger) Promotion() (promotion.Service, error)  { return k.ps, nil }
+func (k *kroger) Capabilities() supermarket.Capabilities { return Capabilities }
+func (k *kroger) SearchStores(ctx context.Context, opts supermarket.StoreSearchOptions) ([]supermarket.Store, error) {
+	return k.ls.SearchStores(ctx, opts)
+}
+
+func baseURL(cfg *supermarket.Config) string {
+	if cfg.BaseURL != "" {
+		return strings.TrimSuffix(cfg.BaseURL, "/")
+	}
+	return DefaultBaseURL
+}
+
+func newClient(cfg *supermarket.Config, ts oauth2.TokenSource) (*http.Client, error) {
+	return ihttp.New(true, cfg.Debug, cfg.UserAgent, map[string]string{"accept": "application/json"}, cfg.Timeout, ts, cfg.Transport)
+}
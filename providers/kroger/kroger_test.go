@@ -0,0 +1,289 @@
+package kroger_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"github.com/csobrinho/supermarket-api/providers/kroger"
+	"github.com/csobrinho/supermarket-api/providers/kroger/krogertest"
+	"golang.org/x/oauth2"
+)
+
+// authCoder is implemented by the kroger authenticator for the authorization code flow.
+type authCoder interface {
+	AuthCodeURL(state string) string
+	Exchange(ctx context.Context, code string) (*oauth2.Token, error)
+}
+
+func newKroger(t *testing.T, opts ...supermarket.Option) supermarket.Supermarket {
+	t.Helper()
+	f := supermarket.NewFactory()
+	f.Register("kroger", kroger.Creator)
+	sm, err := f.Create(t.Context(), "kroger", opts...)
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	return sm
+}
+
+func services(t *testing.T, sm supermarket.Supermarket) (supermarket.AuthService, supermarket.PromotionService) {
+	t.Helper()
+	as, err := sm.Authenticator()
+	if err != nil {
+		t.Fatalf("Authenticator() failed: %v", err)
+	}
+	ps, err := sm.Promotion()
+	if err != nil {
+		t.Fatalf("Promotion() failed: %v", err)
+	}
+	return as, ps
+}
+
+func find(t *testing.T, cds []promotion.ClipDeal, id string) promotion.ClipDeal {
+	t.Helper()
+	i := slices.IndexFunc(cds, func(cd promotion.ClipDeal) bool { return cd.ID == id })
+	if i < 0 {
+		t.Fatalf("deal %q not found", id)
+	}
+	return cds[i]
+}
+
+func TestGetClipDealsPagination(t *testing.T) {
+	var coupons []kroger.Coupon
+	for i := range 120 {
+		coupons = append(coupons, kroger.Coupon{ID: fmt.Sprintf("c%03d", i), CanBeAdded: true, DiscountType: kroger.DISCOUNT_TYPE_AMOUNT_OFF, Value: 1})
+	}
+	s := krogertest.NewServerWithCoupons(coupons)
+	defer s.Close()
+	var pages atomic.Int32
+	h := s.Config.Handler
+	s.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == kroger.COUPONS_PATH {
+			pages.Add(1)
+			if got := r.URL.Query().Get("filter.locationId"); got != krogertest.LocationID {
+				t.Errorf("GET %s filter.locationId = %q, want %q", r.URL.Path, got, krogertest.LocationID)
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+
+	_, ps := services(t, newKroger(t, s.Options()...))
+	cds, err := ps.GetClipDeals(t.Context(), promotion.PromotionSearchOptions{})
+	if err != nil {
+		t.Fatalf("GetClipDeals() failed: %v", err)
+	}
+	if len(cds) != len(coupons) {
+		t.Fatalf("GetClipDeals() returned %d deals, want %d", len(cds), len(coupons))
+	}
+	for i, cd := range cds {
+		if cd.ID != coupons[i].ID {
+			t.Fatalf("GetClipDeals()[%d] = %q, want %q", i, cd.ID, coupons[i].ID)
+		}
+	}
+	if got := pages.Load(); got != 3 {
+		t.Errorf("GetClipDeals() fetched %d pages, want 3 of 50 coupons", got)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	s := krogertest.NewServer()
+	defer s.Close()
+	_, ps := services(t, newKroger(t, s.Options()...))
+	cds, err := ps.GetClipDeals(t.Context(), promotion.PromotionSearchOptions{})
+	if err != nil {
+		t.Fatalf("GetClipDeals() failed: %v", err)
+	}
+
+	cd := find(t, cds, "2200013457")
+	if cd.Brand != "Kroger" || cd.Type != promotion.PromotionTypeCoupon || *cd.PromoCode != "500013457" || len(cd.Upcs) != 2 {
+		t.Errorf("deal = %+v, want the Kroger coupon 500013457 with 2 UPCs", cd.Promotion)
+	}
+	if cd.Discount == nil || cd.Discount.Amount != 1 || cd.Discount.Percent != 0 {
+		t.Errorf("deal discount = %+v, want $1 off", cd.Discount)
+	}
+	if cd.MinPurchaseQuantity == nil || *cd.MinPurchaseQuantity != 1 || cd.MaxPurchaseQuantity == nil || *cd.MaxPurchaseQuantity != 1 {
+		t.Errorf("deal quantities = %v to %v, want 1 to 1", cd.MinPurchaseQuantity, cd.MaxPurchaseQuantity)
+	}
+	if want := time.Date(2025, 6, 8, 23, 59, 59, 0, time.UTC); !cd.EndDate.Equal(want) {
+		t.Errorf("deal end date = %v, want %v", cd.EndDate, want)
+	}
+	if cd.PurchaseRank == nil || *cd.PurchaseRank != 3 || !cd.PreviouslyPurchased {
+		t.Errorf("deal purchase rank = %v, want 3", cd.PurchaseRank)
+	}
+	if !cd.IsClippable || cd.IsClipped || cd.Status != "unclipped" {
+		t.Errorf("deal = clippable %v, clipped %v, status %q, want clippable and unclipped", cd.IsClippable, cd.IsClipped, cd.Status)
+	}
+
+	if cd := find(t, cds, "2200013512"); cd.Discount == nil || cd.Discount.Percent != 20 {
+		t.Errorf("percent deal discount = %+v, want 20%% off", cd.Discount)
+	}
+	if cd := find(t, cds, "2200013655"); cd.Discount != nil {
+		t.Errorf("free item deal discount = %+v, want none", cd.Discount)
+	}
+	if cd := find(t, cds, "2200013600"); !cd.IsClipped || cd.Status != "clipped" {
+		t.Errorf("added deal = clipped %v, status %q, want clipped", cd.IsClipped, cd.Status)
+	}
+	if cd := find(t, cds, "2200013701"); !cd.IsDeleted || cd.IsClippable {
+		t.Errorf("redeemed deal = deleted %v, clippable %v, want deleted and not clippable", cd.IsDeleted, cd.IsClippable)
+	}
+}
+
+// The fixture has one coupon on the card, a limit of 2 allows a single clip.
+func TestClipDealLimit(t *testing.T) {
+	s := krogertest.NewServer()
+	defer s.Close()
+	s.ClipLimit = 2
+	_, ps := services(t, newKroger(t, s.Options()...))
+	cds, err := ps.GetClipDeals(t.Context(), promotion.PromotionSearchOptions{})
+	if err != nil {
+		t.Fatalf("GetClipDeals() failed: %v", err)
+	}
+	if err := ps.ClipDeal(t.Context(), find(t, cds, "2200013457")); err != nil {
+		t.Fatalf("ClipDeal() failed: %v", err)
+	}
+	err = ps.ClipDeal(t.Context(), find(t, cds, "2200013512"))
+	if !errors.Is(err, promotion.ErrClipLimitReached) {
+		t.Errorf("ClipDeal() over the limit = %v, want %v", err, promotion.ErrClipLimitReached)
+	}
+	if got := s.Clips(); !slices.Equal(got, []string{"2200013457"}) {
+		t.Errorf("Clips() = %v, want only the first coupon", got)
+	}
+}
+
+func TestClipDealErrors(t *testing.T) {
+	s := krogertest.NewServer()
+	defer s.Close()
+	_, ps := services(t, newKroger(t, s.Options()...))
+	unknown := promotion.ClipDeal{Promotion: promotion.Promotion{ID: "nope", IsClippable: true}}
+	err := ps.ClipDeal(t.Context(), unknown)
+	if err == nil || errors.Is(err, promotion.ErrClipLimitReached) || !strings.Contains(err.Error(), "coupon not found") {
+		t.Errorf("ClipDeal(unknown) = %v, want the reason of the server", err)
+	}
+	if err := ps.ClipDeal(t.Context(), promotion.ClipDeal{}); err == nil {
+		t.Error("ClipDeal() without id succeeded")
+	}
+	if len(s.Clips()) != 0 {
+		t.Errorf("Clips() = %v, want none", s.Clips())
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	s := krogertest.NewServer()
+	defer s.Close()
+	as, ps := services(t, newKroger(t, s.Options()...))
+	tok, err := as.RefreshToken(t.Context())
+	if err != nil {
+		t.Fatalf("RefreshToken() failed: %v", err)
+	}
+	if tok.RefreshToken != krogertest.RefreshToken || !as.IsAuthenticated(t.Context()) {
+		t.Errorf("RefreshToken() = %+v, want an authenticated customer token", tok)
+	}
+	// A customer token clips.
+	cd := promotion.ClipDeal{Promotion: promotion.Promotion{ID: "2200013457", IsClippable: true}}
+	if err := ps.ClipDeal(t.Context(), cd); err != nil {
+		t.Errorf("ClipDeal() failed: %v", err)
+	}
+
+	opts := append(s.Options(), supermarket.WithCredentials(krogertest.ClientID, "stale"))
+	as, _ = services(t, newKroger(t, opts...))
+	if _, err := as.RefreshToken(t.Context()); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("RefreshToken() with a stale refresh token = %v, want invalid_grant", err)
+	}
+	if as.IsAuthenticated(t.Context()) {
+		t.Error("IsAuthenticated() = true after a failed refresh")
+	}
+}
+
+// Without a refresh token the client credentials can browse the coupons but not clip them.
+func TestClientCredentials(t *testing.T) {
+	s := krogertest.NewServer()
+	defer s.Close()
+	opts := append(s.Options(), supermarket.WithCredentials(krogertest.ClientID, ""))
+	as, ps := services(t, newKroger(t, opts...))
+	tok, err := as.RefreshToken(t.Context())
+	if err != nil {
+		t.Fatalf("RefreshToken() failed: %v", err)
+	}
+	if tok.RefreshToken != "" {
+		t.Errorf("RefreshToken() = %+v, want a client token without refresh token", tok)
+	}
+	cds, err := ps.GetClipDeals(t.Context(), promotion.PromotionSearchOptions{})
+	if err != nil || len(cds) == 0 {
+		t.Fatalf("GetClipDeals() = %d deals, %v, want the coupons", len(cds), err)
+	}
+	if err := ps.ClipDeal(t.Context(), find(t, cds, "2200013457")); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("ClipDeal() with a client token = %v, want 403", err)
+	}
+
+	opts = append(s.Options(), supermarket.WithCredentials(krogertest.ClientID, ""), supermarket.WithClientSecret("wrong"))
+	as, _ = services(t, newKroger(t, opts...))
+	if _, err := as.RefreshToken(t.Context()); err == nil || !strings.Contains(err.Error(), "invalid_client") {
+		t.Errorf("RefreshToken() with a wrong secret = %v, want invalid_client", err)
+	}
+
+	f := supermarket.NewFactory()
+	f.Register("kroger", kroger.Creator)
+	if _, err := f.Create(t.Context(), "kroger", supermarket.WithBaseURL(s.URL), supermarket.WithCredentials(krogertest.ClientID, "")); err == nil {
+		t.Error("Create() without client secret succeeded")
+	}
+}
+
+func TestAuthCodeExchange(t *testing.T) {
+	s := krogertest.NewServer()
+	defer s.Close()
+	const redirect = "http://localhost:8080/callback"
+	opts := append(s.Options(), supermarket.WithCredentials(krogertest.ClientID, ""), supermarket.WithRedirectURL(redirect))
+	as, ps := services(t, newKroger(t, opts...))
+	ac, ok := as.(authCoder)
+	if !ok {
+		t.Fatalf("Authenticator() = %T, want AuthCodeURL and Exchange", as)
+	}
+
+	u, err := url.Parse(ac.AuthCodeURL("xyz"))
+	if err != nil {
+		t.Fatalf("AuthCodeURL() failed: %v", err)
+	}
+	q := u.Query()
+	if u.Path != kroger.AUTHORIZE_PATH || q.Get("client_id") != krogertest.ClientID || q.Get("redirect_uri") != redirect ||
+		q.Get("state") != "xyz" || !strings.Contains(q.Get("scope"), "coupon.basic:write") {
+		t.Errorf("AuthCodeURL() = %s, want the authorize endpoint with the client, redirect, state and coupon scope", u)
+	}
+
+	// The customer authorizes and is redirected with the code.
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := client.Get(u.String())
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", u, err)
+	}
+	res.Body.Close()
+	loc, err := url.Parse(res.Header.Get("Location"))
+	if err != nil || res.StatusCode != http.StatusFound || !strings.HasPrefix(loc.String(), redirect) || loc.Query().Get("state") != "xyz" {
+		t.Fatalf("GET %s = %s to %q, want a redirect to %s", u, res.Status, res.Header.Get("Location"), redirect)
+	}
+
+	if _, err := ac.Exchange(t.Context(), "wrong"); err == nil {
+		t.Error("Exchange(wrong code) succeeded")
+	}
+	tok, err := ac.Exchange(t.Context(), loc.Query().Get("code"))
+	if err != nil {
+		t.Fatalf("Exchange() failed: %v", err)
+	}
+	if tok.RefreshToken != krogertest.RefreshToken || !as.IsAuthenticated(t.Context()) {
+		t.Errorf("Exchange() = %+v, want an authenticated customer token", tok)
+	}
+	// The promotion service created before the exchange now clips with the customer token.
+	cd := promotion.ClipDeal{Promotion: promotion.Promotion{ID: "2200013457", IsClippable: true}}
+	if err := ps.ClipDeal(t.Context(), cd); err != nil {
+		t.Errorf("ClipDeal() after Exchange() failed: %v", err)
+	}
+}
@@ -0,0 +1,303 @@
+// Package krogertest provides a fake Kroger API server, seeded with recorded fixtures, to exercise
+// the kroger provider without network access.
+package krogertest
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"github.com/csobrinho/supermarket-api/providers/kroger"
+)
+
+//go:embed fixtures/coupons.json
+var couponsFixture []byte
+
+//go:embed fixtures/locations.json
+var locationsFixture []byte
+
+// Default credentials accepted by the server.
+const (
+	ClientID     = "test-client"
+	ClientSecret = "test-secret"
+	RefreshToken = "test-refresh-token"
+	AuthCode     = "test-auth-code"
+	LocationID   = "01400943"
+)
+
+// Server is a fake Kroger API. Its exported fields can be changed before the first request.
+type Server struct {
+	*httptest.Server
+
+	ClientID     string
+	ClientSecret string
+	RefreshToken string // Refresh token accepted by the refresh_token grant.
+	AuthCode     string // Code returned by the authorize endpoint and accepted by the exchange.
+	ClipLimit    int    // Maximum number of coupons on the card, zero means unlimited.
+
+	mu        sync.Mutex
+	coupons   []kroger.Coupon
+	locations []kroger.Location
+	tokens    map[string]bool // Access token to whether it was issued to a customer.
+	clips     []string
+}
+
+// NewServer starts a server seeded with the recorded coupons. Call Close when done.
+func NewServer() *Server {
+	res := kroger.CouponsResponse{}
+	if err := json.Unmarshal(couponsFixture, &res); err != nil {
+		panic(fmt.Sprintf("krogertest: decode fixture, error %v", err))
+	}
+	return NewServerWithCoupons(res.Data)
+}
+
+// NewServerWithCoupons starts a server seeded with the coupons. Call Close when done.
+func NewServerWithCoupons(coupons []kroger.Coupon) *Server {
+	res := kroger.LocationsResponse{}
+	if err := json.Unmarshal(locationsFixture, &res); err != nil {
+		panic(fmt.Sprintf("krogertest: decode fixture, error %v", err))
+	}
+	return NewServerWithData(coupons, res.Data)
+}
+
+// NewServerWithData starts a server seeded with the coupons and the locations, which are listed in
+// order for every zip code. Call Close when done.
+func NewServerWithData(coupons []kroger.Coupon, locations []kroger.Location) *Server {
+	s := &Server{
+		ClientID:     ClientID,
+		ClientSecret: ClientSecret,
+		RefreshToken: RefreshToken,
+		AuthCode:     AuthCode,
+		coupons:      slices.Clone(coupons),
+		locations:    slices.Clone(locations),
+		tokens:       map[string]bool{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+kroger.AUTHORIZE_PATH, s.authorize)
+	mux.HandleFunc("POST "+kroger.TOKEN_PATH, s.token)
+	mux.HandleFunc("GET "+kroger.COUPONS_PATH, s.listCoupons)
+	mux.HandleFunc("POST /v1/coupons/{id}/clip", s.clipCoupon)
+	mux.HandleFunc("GET "+kroger.LOCATIONS_PATH, s.listLocations)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Fixture starts a server for the test, closed when it ends, and returns the options to create a
+// kroger client against it. It is a supermarkettest.Fixture.
+func Fixture(t testing.TB) []supermarket.Option {
+	s := NewServer()
+	t.Cleanup(s.Close)
+	return s.Options()
+}
+
+// Options returns the options to create a kroger client against the server.
+func (s *Server) Options() []supermarket.Option {
+	return []supermarket.Option{
+		supermarket.WithBaseURL(s.URL),
+		supermarket.WithCredentials(s.ClientID, s.RefreshToken),
+		supermarket.WithClientSecret(s.ClientSecret),
+		supermarket.WithStoreID(LocationID),
+	}
+}
+
+// Coupons returns the current state of the coupons.
+func (s *Server) Coupons() []kroger.Coupon {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.coupons)
+}
+
+// Clips returns the ids of the coupons clipped through the server, in order.
+func (s *Server) Clips() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.clips)
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != s.ClientID || q.Get("response_type") != "code" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "unknown client or response type")
+		return
+	}
+	u, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || u.Scheme == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid redirect_uri")
+		return
+	}
+	v := u.Query()
+	v.Set("code", s.AuthCode)
+	v.Set("state", q.Get("state"))
+	u.RawQuery = v.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != s.ClientID || secret != s.ClientSecret {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "invalid client credentials")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	var customer bool
+	switch r.PostForm.Get("grant_type") {
+	case "client_credentials":
+	case "authorization_code":
+		if r.PostForm.Get("code") != s.AuthCode {
+			writeError(w, http.StatusBadRequest, "invalid_grant", "invalid authorization code")
+			return
+		}
+		customer = true
+	case "refresh_token":
+		if r.PostForm.Get("refresh_token") != s.RefreshToken {
+			writeError(w, http.StatusBadRequest, "invalid_grant", "invalid refresh token")
+			return
+		}
+		customer = true
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type", "unsupported grant type")
+		return
+	}
+
+	token := randomToken()
+	s.mu.Lock()
+	s.tokens[token] = customer
+	s.mu.Unlock()
+	res := map[string]any{
+		"access_token": token,
+		"token_type":   "bearer",
+		"expires_in":   1800,
+		"scope":        r.PostForm.Get("scope"),
+	}
+	if customer {
+		res["refresh_token"] = s.RefreshToken
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// authenticate returns whether the request has a valid token and if it belongs to a customer.
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) (customer, ok bool) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	customer, ok = s.tokens[token]
+	s.mu.Unlock()
+	if !found || !ok {
+		writeError(w, http.StatusUnauthorized, "API-401", "invalid or missing access token")
+		return false, false
+	}
+	return customer, true
+}
+
+func (s *Server) listCoupons(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.authenticate(w, r); !ok {
+		return
+	}
+	q := r.URL.Query()
+	start, _ := strconv.Atoi(q.Get("filter.start"))
+	limit, err := strconv.Atoi(q.Get("filter.limit"))
+	if err != nil || limit <= 0 || limit > 50 {
+		limit = 10
+	}
+	s.mu.Lock()
+	coupons := slices.Clone(s.coupons)
+	s.mu.Unlock()
+
+	res := kroger.CouponsResponse{Data: []kroger.Coupon{}}
+	if start < len(coupons) {
+		res.Data = coupons[start:min(start+limit, len(coupons))]
+	}
+	res.Meta.Pagination = kroger.Pagination{Start: start, Limit: limit, Total: len(coupons)}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) clipCoupon(w http.ResponseWriter, r *http.Request) {
+	customer, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if !customer {
+		writeError(w, http.StatusForbidden, "API-403", "insufficient scope, a customer token is required")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.coupons, func(c kroger.Coupon) bool { return c.ID == r.PathValue("id") })
+	switch {
+	case i < 0:
+		writeError(w, http.StatusNotFound, "COUPON-404", "coupon not found")
+		return
+	case s.coupons[i].AddedToCard:
+		writeError(w, http.StatusConflict, "COUPON-CLIPPED", "coupon already added to card")
+		return
+	case !s.coupons[i].CanBeAdded || s.coupons[i].Redeemed:
+		writeError(w, http.StatusUnprocessableEntity, "COUPON-UNAVAILABLE", "coupon can't be added to card")
+		return
+	}
+	clipped := 0
+	for _, c := range s.coupons {
+		if c.AddedToCard {
+			clipped++
+		}
+	}
+	if s.ClipLimit > 0 && clipped >= s.ClipLimit {
+		writeError(w, http.StatusConflict, kroger.ERROR_CODE_CLIP_LIMIT, "maximum number of coupons on card reached")
+		return
+	}
+	s.coupons[i].AddedToCard = true
+	s.clips = append(s.clips, s.coupons[i].ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listLocations(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.authenticate(w, r); !ok {
+		return
+	}
+	q := r.URL.Query()
+	if q.Get("filter.zipCode.near") == "" {
+		writeError(w, http.StatusBadRequest, "LOCATION-400", "a location filter is required")
+		return
+	}
+	limit, err := strconv.Atoi(q.Get("filter.limit"))
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 10
+	}
+	s.mu.Lock()
+	locations := slices.Clone(s.locations[:min(limit, len(s.locations))])
+	s.mu.Unlock()
+
+	res := kroger.LocationsResponse{Data: locations}
+	res.Meta.Pagination = kroger.Pagination{Limit: limit, Total: len(locations)}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, reason string) {
+	res := kroger.ErrorResponse{}
+	res.Errors.Code, res.Errors.Reason = code, reason
+	writeJSON(w, status, res)
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
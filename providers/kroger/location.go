@@ -0,0 +1,68 @@
+package kroger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"golang.org/x/oauth2"
+)
+
+const (
+	LOCATIONS_PATH = "/v1/locations"
+
+	// locationsMaxLimit is the maximum number of locations returned by the API.
+	locationsMaxLimit = 200
+)
+
+// locationService searches for stores with the Locations API, which any token can use.
+type locationService struct {
+	client  *http.Client
+	baseURL string
+}
+
+func NewLocation(ctx context.Context, cfg *supermarket.Config, ts oauth2.TokenSource) (*locationService, error) {
+	client, err := newClient(cfg, ts)
+	if err != nil {
+		return nil, fmt.Errorf("location: new http client, error %w", err)
+	}
+	return &locationService{client: client, baseURL: baseURL(cfg)}, nil
+}
+
+// SearchStores returns the stores near the zip code, nearest first.
+func (ls *locationService) SearchStores(ctx context.Context, opts supermarket.StoreSearchOptions) ([]supermarket.Store, error) {
+	if opts.ZipCode == "" {
+		return nil, fmt.Errorf("location: search stores missing zip code")
+	}
+	q := url.Values{}
+	q.Set("filter.zipCode.near", opts.ZipCode)
+	if opts.Limit > 0 {
+		q.Set("filter.limit", strconv.Itoa(min(opts.Limit, locationsMaxLimit)))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ls.baseURL+LOCATIONS_PATH+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("location: search stores request, error %w", err)
+	}
+	res, err := ls.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("location: search stores response, error %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("location: search stores response, error status %s", res.Status)
+	}
+	lr := LocationsResponse{}
+	if err := json.NewDecoder(res.Body).Decode(&lr); err != nil {
+		return nil, fmt.Errorf("location: search stores response, error decoding %w", err)
+	}
+	ret := make([]supermarket.Store, 0, len(lr.Data))
+	for _, l := range lr.Data {
+		ret = append(ret, l.convert())
+	}
+	log.InfoContext(ctx, "found stores", "count", len(ret), "zip_code", opts.ZipCode)
+	return ret, nil
+}
@@ -0,0 +1,125 @@
+package kroger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"golang.org/x/oauth2"
+)
+
+const (
+	COUPONS_PATH     = "/v1/coupons"
+	COUPON_CLIP_PATH = "/v1/coupons/%s/clip"
+
+	// couponsPageSize is the maximum page size accepted by the API.
+	couponsPageSize = 50
+	// ERROR_CODE_CLIP_LIMIT is returned when the card can't hold more coupons.
+	ERROR_CODE_CLIP_LIMIT = "COUPON-LIMIT"
+)
+
+type promotionService struct {
+	client     *http.Client
+	baseURL    string
+	locationID string
+}
+
+func NewPromotion(ctx context.Context, cfg *supermarket.Config, ts oauth2.TokenSource) (*promotionService, error) {
+	client, err := newClient(cfg, ts)
+	if err != nil {
+		return nil, fmt.Errorf("promotion: new http client, error %w", err)
+	}
+	return &promotionService{client: client, baseURL: baseURL(cfg), locationID: cfg.StoreID}, nil
+}
+
+// GetClipDeals retrieves available clip deals, following the pagination.
+func (ps *promotionService) GetClipDeals(ctx context.Context, opts promotion.PromotionSearchOptions) ([]promotion.ClipDeal, error) {
+	var ret []promotion.ClipDeal
+	for start := 0; ; {
+		page, err := ps.getCoupons(ctx, start)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range page.Data {
+			ret = append(ret, c.convert())
+		}
+		start += len(page.Data)
+		if len(page.Data) == 0 || start >= page.Meta.Pagination.Total {
+			break
+		}
+	}
+	log.InfoContext(ctx, "found coupons", "count", len(ret))
+	return promotion.Filter(ret, opts), nil
+}
+
+func (ps *promotionService) getCoupons(ctx context.Context, start int) (*CouponsResponse, error) {
+	q := url.Values{}
+	if ps.locationID != "" {
+		q.Set("filter.locationId", ps.locationID)
+	}
+	q.Set("filter.start", strconv.Itoa(start))
+	q.Set("filter.limit", strconv.Itoa(couponsPageSize))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ps.baseURL+COUPONS_PATH+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("promotion: get coupons request, error %w", err)
+	}
+	res, err := ps.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("promotion: get coupons response, error %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("promotion: get coupons response, error status %s", res.Status)
+	}
+	page := &CouponsResponse{}
+	if err := json.NewDecoder(res.Body).Decode(page); err != nil {
+		return nil, fmt.Errorf("promotion: get coupons response, error decoding %w", err)
+	}
+	return page, nil
+}
+
+// ClipDeal adds a coupon to the loyalty card of the customer.
+func (ps *promotionService) ClipDeal(ctx context.Context, cd promotion.ClipDeal) error {
+	if cd.ID == "" {
+		return fmt.Errorf("promotion[%s]: clip deal missing id", cd.ID)
+	}
+	if cd.IsClipped {
+		return fmt.Errorf("promotion[%s]: clip deal already clipped", cd.ID)
+	}
+	if !cd.IsClippable {
+		return fmt.Errorf("promotion[%s]: clip deal is not clippable", cd.ID)
+	}
+	if cd.IsDeleted {
+		return fmt.Errorf("promotion[%s]: clip deal is deleted", cd.ID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ps.baseURL+fmt.Sprintf(COUPON_CLIP_PATH, url.PathEscape(cd.ID)), nil)
+	if err != nil {
+		return fmt.Errorf("promotion[%s]: clip deal request, error %w", cd.ID, err)
+	}
+	res, err := ps.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("promotion[%s]: clip deal response, error %w", cd.ID, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusOK || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	er := ErrorResponse{}
+	_ = json.Unmarshal(body, &er)
+	if er.Errors.Code == ERROR_CODE_CLIP_LIMIT {
+		return fmt.Errorf("promotion[%s]: clip deal response, error status %s, %w", cd.ID, res.Status, promotion.ErrClipLimitReached)
+	}
+	if er.Errors.Reason != "" {
+		return fmt.Errorf("promotion[%s]: clip deal response, error status %s, %s", cd.ID, res.Status, strings.TrimSpace(er.Errors.Reason))
+	}
+	return fmt.Errorf("promotion[%s]: clip deal response, error status %s", cd.ID, res.Status)
+}
@@ -0,0 +1,150 @@
+package kroger
+
+import (
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+)
+
+// Discount types of a coupon.
+const (
+	DISCOUNT_TYPE_AMOUNT_OFF  = "AMOUNT_OFF"
+	DISCOUNT_TYPE_PERCENT_OFF = "PERCENT_OFF"
+	DISCOUNT_TYPE_FREE_ITEM   = "FREE_ITEM"
+)
+
+// CouponsResponse is the top-level structure for the coupons response.
+type CouponsResponse struct {
+	Data []Coupon `json:"data"`
+	Meta Meta     `json:"meta"`
+}
+
+// Meta describes the page of a paginated response.
+type Meta struct {
+	Pagination Pagination `json:"pagination"`
+}
+
+// Pagination is the position of a page in the full result.
+type Pagination struct {
+	Start int `json:"start"`
+	Limit int `json:"limit"`
+	Total int `json:"total"`
+}
+
+// ErrorResponse is the body of an unsuccessful response.
+type ErrorResponse struct {
+	Errors struct {
+		Code   string `json:"code"`
+		Reason string `json:"reason"`
+	} `json:"errors"`
+}
+
+// Coupon represents a digital coupon.
+type Coupon struct {
+	ID               string    `json:"id"`                     // Maps to: ID
+	CouponNumber     string    `json:"krogerCouponNumber"`     // Maps to: PromoCode
+	Brand            string    `json:"brand"`                  // Maps to: Brand
+	Categories       []string  `json:"categories"`             // Maps to: Categories
+	Description      string    `json:"description"`            // Maps to: Description
+	ShortDescription string    `json:"shortDescription"`       //
+	Disclaimer       string    `json:"requirementDescription"` // Maps to: Disclaimer
+	ImageURL         string    `json:"imageUrl"`               // Maps to: ImageID
+	Upcs             []string  `json:"upcs"`                   // Maps to: Upcs
+	DiscountType     string    `json:"discountType"`           // Maps to: Discount
+	Value            float64   `json:"value"`                  // Maps to: Discount
+	MinQuantity      int       `json:"requirementQuantity"`    // Maps to: MinPurchaseQuantity
+	RedemptionsLimit int       `json:"redemptionsAllowed"`     // Maps to: MaxPurchaseQuantity
+	StartDate        time.Time `json:"displayStartDate"`       // Maps to: StartDate
+	ExpirationDate   time.Time `json:"expirationDate"`         // Maps to: EndDate
+	CanBeAdded       bool      `json:"canBeAddedToCard"`       // Maps to: IsClippable
+	AddedToCard      bool      `json:"addedToCard"`            // Maps to: IsClipped
+	Displayable      bool      `json:"displayable"`            // Maps to: IsDisplayable
+	Redeemed         bool      `json:"redeemed"`               // Maps to: IsDeleted
+	PurchaseRank     int       `json:"purchaseRank,omitempty"` // Maps to: PurchaseRank
+}
+
+func (c Coupon) convert() promotion.ClipDeal {
+	promoCode, promoType := c.CouponNumber, c.DiscountType
+	ret := promotion.ClipDeal{
+		Promotion: promotion.Promotion{
+			Brand:         c.Brand,
+			Categories:    c.Categories,
+			ID:            c.ID,
+			Description:   c.Description,
+			Disclaimer:    c.Disclaimer,
+			Type:          promotion.PromotionTypeCoupon,
+			ImageID:       c.ImageURL,
+			Upcs:          c.Upcs,
+			PromoCode:     &promoCode,
+			PromoType:     &promoType,
+			StartDate:     c.StartDate,
+			EndDate:       c.ExpirationDate,
+			IsDeleted:     c.Redeemed,
+			IsClippable:   c.CanBeAdded,
+			IsDisplayable: c.Displayable,
+			IsClipped:     c.AddedToCard,
+			Item:          c,
+		},
+		ExpiresAfterClip: true,
+	}
+	if c.AddedToCard {
+		ret.Status = "clipped"
+	} else {
+		ret.Status = "unclipped"
+	}
+	if c.MinQuantity > 0 {
+		q := float64(c.MinQuantity)
+		ret.MinPurchaseQuantity = &q
+	}
+	if c.RedemptionsLimit > 0 {
+		q := float64(c.RedemptionsLimit)
+		ret.MaxPurchaseQuantity = &q
+	}
+	switch c.DiscountType {
+	case DISCOUNT_TYPE_AMOUNT_OFF:
+		ret.Discount = &promotion.Discount{Amount: c.Value}
+	case DISCOUNT_TYPE_PERCENT_OFF:
+		ret.Discount = &promotion.Discount{Percent: c.Value}
+	}
+	if c.PurchaseRank > 0 {
+		rank := c.PurchaseRank
+		ret.PurchaseRank = &rank
+		ret.PreviouslyPurchased = true
+	}
+	return ret
+}
+
+// LocationsResponse is the top-level structure for the locations response.
+type LocationsResponse struct {
+	Data []Location `json:"data"`
+	Meta Meta       `json:"meta"`
+}
+
+// Location is a store of the Kroger family.
+type Location struct {
+	LocationID string          `json:"locationId"` // Maps to: ID
+	Chain      string          `json:"chain"`      // Maps to: Chain
+	Name       string          `json:"name"`       // Maps to: Name
+	Address    LocationAddress `json:"address"`
+}
+
+// LocationAddress is the address of a store.
+type LocationAddress struct {
+	AddressLine1 string `json:"addressLine1"` // Maps to: Address
+	City         string `json:"city"`         // Maps to: City
+	State        string `json:"state"`        // Maps to: State
+	ZipCode      string `json:"zipCode"`      // Maps to: ZipCode
+}
+
+func (l Location) convert() supermarket.Store {
+	return supermarket.Store{
+		ID:      l.LocationID,
+		Name:    l.Name,
+		Chain:   l.Chain,
+		Address: l.Address.AddressLine1,
+		City:    l.Address.City,
+		State:   l.Address.State,
+		ZipCode: l.Address.ZipCode,
+	}
+}
@@ -23,17 +23,27 @@ type authenticatorService struct {
 var (
 	tokenUrl = flag.String(
 		"safeway_token_url",
-		supermarket.LookupEnv("SAFEWAY_TOKEN_URL", "https://albertsons.okta.com/oauth2/ausp6soxrIyPrm8rS2p6/v1/token"),
-		"Safeway token url. Can also be provided via 'SAFEWAY_TOKEN_URL' env.")
+		supermarket.LookupEnv("SAFEWAY_TOKEN_URL", ""),
+		"If provided, overrides the token url of the Safeway banners. Can also be provided via 'SAFEWAY_TOKEN_URL' env.")
 
 	oauthScopes = []string{"openid", "profile", "offline_access", "partner"}
 )
 
-func NewAuthenticator(ctx context.Context, cfg *supermarket.Config) (*authenticatorService, error) {
+func NewAuthenticator(ctx context.Context, cfg *supermarket.Config, b Banner) (*authenticatorService, error) {
+	override := *tokenUrl
+	fs := flag.NewFlagSet("safeway", flag.ContinueOnError)
+	fs.StringVar(&override, "safeway_token_url", override, "")
+	if err := cfg.SetFlags(fs); err != nil {
+		return nil, err
+	}
+	tu := b.tokenURL(cfg)
+	if override != "" {
+		tu = override
+	}
 	config := &oauth2.Config{
 		ClientID: cfg.ClientID,
 		Endpoint: oauth2.Endpoint{
-			TokenURL:  *tokenUrl,
+			TokenURL:  tu,
 			AuthStyle: oauth2.AuthStyleInParams,
 		},
 		Scopes: oauthScopes,
@@ -42,15 +52,15 @@ func NewAuthenticator(ctx context.Context, cfg *supermarket.Config) (*authentica
 		RefreshToken: cfg.RefreshToken,
 		TokenType:    "Bearer",
 	}
-	// Note: The original request also sends the scopes in the refresh token request.
-	ts := config.TokenSource(ctx, token)
-
-	client, err := ihttp.New(true, cfg.Debug, cfg.UserAgent, nil, cfg.Timeout, nil)
+	client, err := ihttp.New(true, cfg.Debug, cfg.UserAgent, nil, cfg.Timeout, nil, cfg.Transport)
 	if err != nil {
 		return nil, fmt.Errorf("authenticator: new http client, error %w", err)
 	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, client)
+	// Note: The original request also sends the scopes in the refresh token request.
+	ts := config.TokenSource(ctx, token)
 	return &authenticatorService{
-		client: oauth2.NewClient(context.WithValue(ctx, oauth2.HTTPClient, client), ts),
+		client: oauth2.NewClient(ctx, ts),
 		ts:     ts,
 	}, nil
 }
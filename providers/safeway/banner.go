@@ -0,0 +1,86 @@
+package safeway
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+)
+
+const (
+	// TOKEN_PATH is the path of the Okta token endpoint shared by all the Albertsons banners.
+	TOKEN_PATH      = "/oauth2/ausp6soxrIyPrm8rS2p6/v1/token"
+	defaultTokenURL = "https://albertsons.okta.com" + TOKEN_PATH
+)
+
+// Banner is one of the Albertsons Companies stores served by the same J4U API.
+type Banner struct {
+	Name     string // Value of the x-swy_banner header, also used as the provider name.
+	Host     string // Host of the J4U API, e.g. www.vons.com.
+	TokenURL string // OAuth2 token endpoint.
+}
+
+// Banners are the supported banners, in alphabetical order.
+var Banners = []Banner{
+	{Name: "acmemarkets", Host: "www.acmemarkets.com", TokenURL: defaultTokenURL},
+	{Name: "albertsons", Host: "www.albertsons.com", TokenURL: defaultTokenURL},
+	{Name: "jewelosco", Host: "www.jewelosco.com", TokenURL: defaultTokenURL},
+	{Name: "pavilions", Host: "www.pavilions.com", TokenURL: defaultTokenURL},
+	{Name: "randalls", Host: "www.randalls.com", TokenURL: defaultTokenURL},
+	{Name: "safeway", Host: "www.safeway.com", TokenURL: defaultTokenURL},
+	{Name: "shaws", Host: "www.shaws.com", TokenURL: defaultTokenURL},
+	{Name: "starmarket", Host: "www.starmarket.com", TokenURL: defaultTokenURL},
+	{Name: "tomthumb", Host: "www.tomthumb.com", TokenURL: defaultTokenURL},
+	{Name: "vons", Host: "www.vons.com", TokenURL: defaultTokenURL},
+}
+
+// LookupBanner returns the banner with the given name. An empty name is the Safeway banner.
+func LookupBanner(name string) (Banner, error) {
+	if name == "" {
+		name = "safeway"
+	}
+	for _, b := range Banners {
+		if b.Name == name {
+			return b, nil
+		}
+	}
+	return Banner{}, fmt.Errorf("safeway: unknown banner %q", name)
+}
+
+// Creator returns a creator bound to the banner, ignoring the banner of the config.
+func (b Banner) Creator() supermarket.Creator {
+	return func(ctx context.Context, cfg *supermarket.Config) (supermarket.Supermarket, error) {
+		cfg.Banner = b.Name
+		return newSafeway(ctx, cfg, b)
+	}
+}
+
+// Register registers every banner in the factory under its name.
+func Register(f supermarket.Factory) {
+	for _, b := range Banners {
+		f.Register(b.Name, b.Creator())
+	}
+}
+
+// baseURL returns the base URL of the J4U API of the banner, or the override of the config.
+func (b Banner) baseURL(cfg *supermarket.Config) string {
+	if cfg.BaseURL != "" {
+		return strings.TrimSuffix(cfg.BaseURL, "/")
+	}
+	return "https://" + b.Host
+}
+
+// tokenURL returns the token endpoint of the banner. With a base URL override, the endpoint keeps
+// its path but is served by the base URL too.
+func (b Banner) tokenURL(cfg *supermarket.Config) string {
+	if cfg.BaseURL == "" {
+		return b.TokenURL
+	}
+	u, err := url.Parse(b.TokenURL)
+	if err != nil {
+		return b.TokenURL
+	}
+	return b.baseURL(cfg) + u.Path
+}
@@ -0,0 +1,13 @@
+package safeway_test
+
+import (
+	"testing"
+
+	"github.com/csobrinho/supermarket-api/pkg/supermarket/supermarkettest"
+	"github.com/csobrinho/supermarket-api/providers/safeway"
+	"github.com/csobrinho/supermarket-api/providers/safeway/safewaytest"
+)
+
+func TestConformance(t *testing.T) {
+	supermarkettest.RunConformance(t, safeway.Creator, safewaytest.Fixture)
+}
@@ -0,0 +1,3 @@
+package safeway
+
+var IsClipLimitError = isClipLimitError
@@ -5,27 +5,28 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
-	"slices"
 
 	ihttp "github.com/csobrinho/supermarket-api/internal/http"
+	"github.com/csobrinho/supermarket-api/internal/logging"
 	"github.com/csobrinho/supermarket-api/internal/promotion"
 	"github.com/csobrinho/supermarket-api/pkg/supermarket"
-	"github.com/google/logger"
 	"golang.org/x/exp/maps"
 	"golang.org/x/oauth2"
 )
 
+var log = logging.For("safeway")
+
 const (
-	PROMOTIONS_GET_CLIP_DEALS_URL = "https://www.safeway.com/abs/pub/mobile/j4u/api/ecomgallery?storeId=%s&offerPgm=PD-CC&includeRedeemedBonusOffers=y"
-	PROMOTIONS_CLIP_DEALS_URL     = "https://www.safeway.com/abs/pub/mobile/j4u/api/offers/clip?storeId=%s"
+	PROMOTIONS_GET_CLIP_DEALS_PATH = "/abs/pub/mobile/j4u/api/ecomgallery?storeId=%s&offerPgm=PD-CC&includeRedeemedBonusOffers=y"
+	PROMOTIONS_CLIP_DEALS_PATH     = "/abs/pub/mobile/j4u/api/offers/clip?storeId=%s"
 )
 
 var promotionsExtraHeaders = map[string]string{
 	"accept":        "application/json",
 	"content-type":  "application/json",
 	"platform":      "android",
-	"x-swy_banner":  "safeway",
 	"x-swy_version": "2.1",
 	// "appversion": "2025.\d+.\d+",
 	// "storeid": "\d+",
@@ -35,24 +36,27 @@ var promotionsExtraHeaders = map[string]string{
 
 type promotionService struct {
 	client  *http.Client
+	banner  Banner
+	baseURL string
 	storeID string
 }
 
-func NewPromotion(ctx context.Context, cfg *supermarket.Config, ts oauth2.TokenSource) (*promotionService, error) {
+func NewPromotion(ctx context.Context, cfg *supermarket.Config, b Banner, ts oauth2.TokenSource) (*promotionService, error) {
 	headers := maps.Clone(promotionsExtraHeaders)
+	headers["x-swy_banner"] = b.Name
 	headers["storeid"] = cfg.StoreID
 	headers["x-swy_api_key"] = cfg.ApiKey
 	headers["appversion"] = cfg.AppVersion
-	client, err := ihttp.New(true, cfg.Debug, cfg.UserAgent, headers, cfg.Timeout, ts)
+	client, err := ihttp.New(true, cfg.Debug, cfg.UserAgent, headers, cfg.Timeout, ts, cfg.Transport)
 	if err != nil {
 		return nil, fmt.Errorf("promotion: new http client, error %w", err)
 	}
-	return &promotionService{client: client, storeID: cfg.StoreID}, nil
+	return &promotionService{client: client, banner: b, baseURL: b.baseURL(cfg), storeID: cfg.StoreID}, nil
 }
 
 // GetClipDeals retrieves available clip deals.
 func (ps *promotionService) GetClipDeals(ctx context.Context, opts promotion.PromotionSearchOptions) ([]promotion.ClipDeal, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(PROMOTIONS_GET_CLIP_DEALS_URL, ps.storeID), nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ps.baseURL+fmt.Sprintf(PROMOTIONS_GET_CLIP_DEALS_PATH, ps.storeID), nil)
 	if err != nil {
 		return nil, fmt.Errorf("promotion: get clip deals request, error %w", err)
 	}
@@ -70,8 +74,6 @@ func (ps *promotionService) GetClipDeals(ctx context.Context, opts promotion.Pro
 		return nil, fmt.Errorf("promotion: get clip deals response, error decoding %w", err)
 	}
 
-	logger.Infof("promotion: found %d deals", len(root.Coupons))
-	logger.Infof("promotion: found %d personalized clip deals", len(root.PersonalizedDeals))
 	ret := make([]promotion.ClipDeal, 0, len(root.Coupons)+len(root.PersonalizedDeals))
 
 	status := map[string]int{
@@ -91,12 +93,9 @@ func (ps *promotionService) GetClipDeals(ctx context.Context, opts promotion.Pro
 		}
 	}
 
-	keys := maps.Keys(status)
-	slices.Sort(keys)
-	for _, key := range keys {
-		logger.Infof("promotion:  `- %-11s: %d", key, status[key])
-	}
-	return ret, nil
+	log.InfoContext(ctx, "found deals", "coupons", len(root.Coupons), "personalized", len(root.PersonalizedDeals),
+		"clipped", status["clipped"], "unclipped", status["unclipped"], "unclippable", status["unclippable"])
+	return promotion.Filter(ret, opts), nil
 }
 
 // ClipDeal clips a deal for the current user.
@@ -122,7 +121,7 @@ func (ps *promotionService) ClipDeal(ctx context.Context, cd promotion.ClipDeal)
 		return fmt.Errorf("promotion[%s]: clip deal failed to marshal, error %w", cd.ID, err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf(PROMOTIONS_CLIP_DEALS_URL, ps.storeID), bytes.NewBuffer(body))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ps.baseURL+fmt.Sprintf(PROMOTIONS_CLIP_DEALS_PATH, ps.storeID), bytes.NewBuffer(body))
 	if err != nil {
 		return fmt.Errorf("promotion[%s]: clip deal request, error %w", cd.ID, err)
 	}
@@ -130,6 +129,7 @@ func (ps *promotionService) ClipDeal(ctx context.Context, cd promotion.ClipDeal)
 	for k, v := range promotionsExtraHeaders {
 		req.Header.Set(k, v)
 	}
+	req.Header.Set("x-swy_banner", ps.banner.Name)
 	req.Header.Set("storeid", ps.storeID)
 	req.Header.Set("x-swy_api_key", "appandroid")
 
@@ -139,6 +139,10 @@ func (ps *promotionService) ClipDeal(ctx context.Context, cd promotion.ClipDeal)
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		if isClipLimitError(res.StatusCode, body) {
+			return fmt.Errorf("promotion[%s]: clip deal response, error status %s, %w", cd.ID, res.Status, promotion.ErrClipLimitReached)
+		}
 		return fmt.Errorf("promotion[%s]: clip deal response, error status %s", cd.ID, res.Status)
 	}
 
@@ -147,7 +151,25 @@ func (ps *promotionService) ClipDeal(ctx context.Context, cd promotion.ClipDeal)
 		return fmt.Errorf("promotion[%s]: clip deal response, error decoding %w", cd.ID, err)
 	}
 
-	logger.Infof("promotion[%s]: clipped deal", cd.ID)
-	logger.V(1).Infof("promotion[%s]: clipped deal response %+v", cd.ID, cdres)
+	log.InfoContext(ctx, "clipped deal", logging.KeyDealID, cd.ID)
+	log.DebugContext(ctx, "clipped deal response", logging.KeyDealID, cd.ID, "response", fmt.Sprintf("%+v", cdres))
 	return nil
 }
+
+// isClipLimitError reports whether a failed clip response was caused by the account clip limit,
+// from the J4U error code of its body.
+func isClipLimitError(status int, body []byte) bool {
+	if status < 400 || status >= 500 {
+		return false
+	}
+	res := ErrorResponse{}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return false
+	}
+	for _, e := range res.Errors {
+		if e.Code == ERROR_CODE_CLIP_LIMIT {
+			return true
+		}
+	}
+	return false
+}
@@ -38,6 +38,16 @@ func (emt *EpochMillisTime) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// MarshalJSON implements the json.Marshaler interface and formats the time as a JSON string of
+// Unix time in milliseconds, the same format it is parsed from.
+func (emt EpochMillisTime) MarshalJSON() ([]byte, error) {
+	t := time.Time(emt)
+	if t.IsZero() {
+		return []byte(`""`), nil
+	}
+	return []byte(strconv.Quote(strconv.FormatInt(t.UnixMilli(), 10))), nil
+}
+
 // String returns the time in a human-readable format.
 func (emt EpochMillisTime) String() string {
 	return time.Time(emt).Format(time.RFC3339)
@@ -73,8 +83,8 @@ type Promotion struct {
 	ProgramType         string             `json:"programType,omitempty"`  //
 	OfferProtoType      string             `json:"offerProtoType"`         //
 	OfferSubPgm         string             `json:"offerSubPgm,omitempty"`  //
-	PurchaseIndex       string             `json:"purchaseInd"`            //
-	PurchaseRank        string             `json:"purchaseRank"`           //
+	PurchaseIndex       string             `json:"purchaseInd"`            // Maps to: PreviouslyPurchased
+	PurchaseRank        string             `json:"purchaseRank"`           // Maps to: PurchaseRank
 	Status              clipStatusType     `json:"status"`                 // Maps to: Status
 	UsageType           string             `json:"usageType"`              // Maps to: UsageType
 	StartDate           EpochMillisTime    `json:"startDate"`              // Maps to: StartDate
@@ -102,6 +112,15 @@ func (p Promotion) convert() promotion.ClipDeal {
 		}
 		return &tt
 	}
+	var rank *int
+	if r, err := strconv.Atoi(p.PurchaseRank); err == nil && r > 0 {
+		rank = &r
+	}
+	var discount *promotion.Discount
+	if p.Price > 0 {
+		// J4U reports the savings of the offer in price, e.g. 1.5 for "$1.50 OFF".
+		discount = &promotion.Discount{Amount: p.Price}
+	}
 	id := p.ClipID
 	if id == "" {
 		id = p.ExternalOfferID
@@ -109,17 +128,18 @@ func (p Promotion) convert() promotion.ClipDeal {
 	return promotion.ClipDeal{
 		ClippedAt: pt(p.ClippedAt),
 		Promotion: promotion.Promotion{
-			Brand:       p.Brand,
-			Categories:  p.Hierarchies.Categories,
-			ID:          id,
-			Description: p.Description,
-			Disclaimer:  p.Disclaimer,
-			// Type
+			Brand:               p.Brand,
+			Categories:          p.Hierarchies.Categories,
+			ID:                  id,
+			Description:         p.Description,
+			Disclaimer:          p.Disclaimer,
+			Type:                promotion.PromotionTypeClipDeal,
 			ImageID:             p.ImageID,
 			Upcs:                p.Upcs,
 			MinPurchaseQuantity: pf(p.MinPurchaseQuantity),
 			MaxPurchaseQuantity: pf(p.MaxPurchaseQuantity),
 			Price:               &p.Price,
+			Discount:            discount,
 			PromoCode:           &p.OfferID,
 			PromoType:           &p.OfferPgm,
 			ProgramType:         &p.OfferProgramType,
@@ -127,6 +147,8 @@ func (p Promotion) convert() promotion.ClipDeal {
 			UsageType:           p.UsageType,
 			StartDate:           time.Time(p.StartDate),
 			EndDate:             time.Time(p.EndDate),
+			PurchaseRank:        rank,
+			PreviouslyPurchased: p.PurchaseIndex != "" && p.PurchaseIndex != "N",
 			IsDeleted:           p.IsDeleted,
 			IsClippable:         p.IsClippable,
 			IsClipped:           p.Status == "C",
@@ -212,3 +234,18 @@ const (
 	CLIP_STATUS_TYPE_CLIPPED   clipStatusType = "C"
 	CLIP_STATUS_TYPE_UNCLIPPED clipStatusType = "U"
 )
+
+// ErrorResponse is the body of the J4U error responses.
+type ErrorResponse struct {
+	Errors []ErrorItem `json:"errors"`
+}
+
+type ErrorItem struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+const (
+	// ERROR_CODE_CLIP_LIMIT is returned when clipping an offer once the account reached its clip limit.
+	ERROR_CODE_CLIP_LIMIT = "OCCLIPLMT"
+)
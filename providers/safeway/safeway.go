@@ -2,6 +2,7 @@ package safeway
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/csobrinho/supermarket-api/internal/auth"
 	"github.com/csobrinho/supermarket-api/internal/promotion"
@@ -11,12 +12,24 @@ import (
 var _ supermarket.Supermarket = (*safeway)(nil)
 var _ promotion.Service = (*promotionService)(nil)
 
+// Creator creates a client of the banner of the config, Safeway by default.
 func Creator(ctx context.Context, cfg *supermarket.Config) (supermarket.Supermarket, error) {
-	a, err := NewAuthenticator(ctx, cfg)
+	b, err := LookupBanner(cfg.Banner)
 	if err != nil {
 		return nil, err
 	}
-	ps, err := NewPromotion(ctx, cfg, a.ts)
+	return newSafeway(ctx, cfg, b)
+}
+
+func newSafeway(ctx context.Context, cfg *supermarket.Config, b Banner) (supermarket.Supermarket, error) {
+	if cfg.ClientID == "" || cfg.RefreshToken == "" || cfg.ApiKey == "" || cfg.StoreID == "" {
+		return nil, fmt.Errorf("safeway: missing required configuration: client id, refresh token, api key and store id are required")
+	}
+	a, err := NewAuthenticator(ctx, cfg, b)
+	if err != nil {
+		return nil, err
+	}
+	ps, err := NewPromotion(ctx, cfg, b, a.ts)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,285 @@
+package safeway_test
+
+import (
+	"errors"
+	"flag"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"github.com/csobrinho/supermarket-api/providers/safeway"
+	"github.com/csobrinho/supermarket-api/providers/safeway/safewaytest"
+)
+
+// recorder records the requests and sends them to the server, whatever their host.
+type recorder struct {
+	server *url.URL
+
+	mu   sync.Mutex
+	reqs []*http.Request
+}
+
+func newRecorder(t *testing.T, s *safewaytest.Server) *recorder {
+	t.Helper()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &recorder{server: u}
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	r.reqs = append(r.reqs, req.Clone(req.Context()))
+	r.mu.Unlock()
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host, req.Host = r.server.Scheme, r.server.Host, ""
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// requests returns the recorded requests whose path has the prefix.
+func (r *recorder) requests(prefix string) []*http.Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ret []*http.Request
+	for _, req := range r.reqs {
+		if strings.HasPrefix(req.URL.Path, prefix) {
+			ret = append(ret, req)
+		}
+	}
+	return ret
+}
+
+func newPromotion(t *testing.T, name string, creator supermarket.Creator, opts ...supermarket.Option) supermarket.PromotionService {
+	t.Helper()
+	f := supermarket.NewFactory()
+	f.Register(name, creator)
+	sm, err := f.Create(t.Context(), name, opts...)
+	if err != nil {
+		t.Fatalf("Create(%s) failed: %v", name, err)
+	}
+	ps, err := sm.Promotion()
+	if err != nil {
+		t.Fatalf("Promotion() failed: %v", err)
+	}
+	return ps
+}
+
+// getClipDeals returns the deals by offer id.
+func getClipDeals(t *testing.T, ps supermarket.PromotionService) map[string]promotion.ClipDeal {
+	t.Helper()
+	cds, err := ps.GetClipDeals(t.Context(), promotion.PromotionSearchOptions{})
+	if err != nil {
+		t.Fatalf("GetClipDeals() failed: %v", err)
+	}
+	ret := make(map[string]promotion.ClipDeal, len(cds))
+	for _, cd := range cds {
+		ret[*cd.PromoCode] = cd
+	}
+	return ret
+}
+
+func TestHeaders(t *testing.T) {
+	s := safewaytest.NewServer()
+	defer s.Close()
+	rec := newRecorder(t, s)
+	ps := newPromotion(t, "safeway", safeway.Creator, append(s.Options(),
+		supermarket.WithTransport(rec), supermarket.WithUserAgent("okhttp/4.12.0"), supermarket.WithAppVersion("2025.20.0"))...)
+	cds := getClipDeals(t, ps)
+	if len(cds) != 6 {
+		t.Fatalf("GetClipDeals() returned %d deals, want 6", len(cds))
+	}
+	if err := ps.ClipDeal(t.Context(), cds["1234567"]); err != nil {
+		t.Fatalf("ClipDeal() failed: %v", err)
+	}
+
+	reqs := rec.requests("/abs/pub/mobile/j4u/api/")
+	if len(reqs) != 2 {
+		t.Fatalf("recorded %d J4U requests, want 2", len(reqs))
+	}
+	want := map[string]string{
+		"accept":        "application/json",
+		"content-type":  "application/json",
+		"platform":      "android",
+		"x-swy_version": "2.1",
+		"x-swy_banner":  safewaytest.Banner,
+		"x-swy_api_key": safewaytest.ApiKey,
+		"storeid":       safewaytest.StoreID,
+		"appversion":    "2025.20.0",
+		"user-agent":    "okhttp/4.12.0",
+	}
+	for _, req := range reqs {
+		for k, v := range want {
+			if got := req.Header.Get(k); got != v {
+				t.Errorf("%s %s header %s = %q, want %q", req.Method, req.URL.Path, k, got, v)
+			}
+		}
+		if got := req.Header.Get("Authorization"); !strings.HasPrefix(got, "Bearer ") {
+			t.Errorf("%s %s header Authorization = %q, want a bearer token", req.Method, req.URL.Path, got)
+		}
+		if got := req.URL.Query().Get("storeId"); got != safewaytest.StoreID {
+			t.Errorf("%s %s storeId = %q, want %q", req.Method, req.URL.Path, got, safewaytest.StoreID)
+		}
+	}
+
+	// Every required configuration is checked before any request.
+	for _, opt := range []supermarket.Option{
+		supermarket.WithCredentials("", safewaytest.RefreshToken),
+		supermarket.WithCredentials(safewaytest.ClientID, ""),
+		supermarket.WithApiKey(""),
+		supermarket.WithStoreID(""),
+	} {
+		f := supermarket.NewFactory()
+		f.Register("safeway", safeway.Creator)
+		if _, err := f.Create(t.Context(), "safeway", append(s.Options(), opt)...); err == nil || !strings.Contains(err.Error(), "missing required configuration") {
+			t.Errorf("Create() = %v, want a missing configuration error", err)
+		}
+	}
+}
+
+// Each banner sends its J4U requests to its own host and shares the token endpoint, unless the base
+// URL overrides both.
+func TestBanners(t *testing.T) {
+	for _, b := range safeway.Banners {
+		t.Run(b.Name, func(t *testing.T) {
+			s := safewaytest.NewServer()
+			defer s.Close()
+			s.Banner = b.Name
+
+			rec := newRecorder(t, s)
+			opts := []supermarket.Option{
+				supermarket.WithCredentials(s.ClientID, s.RefreshToken),
+				supermarket.WithApiKey(s.ApiKey),
+				supermarket.WithStoreID(s.StoreID),
+				supermarket.WithTransport(rec),
+			}
+			getClipDeals(t, newPromotion(t, b.Name, b.Creator(), opts...))
+			if got := rec.requests(safeway.TOKEN_PATH); len(got) != 1 || got[0].URL.String() != b.TokenURL {
+				t.Errorf("token requests = %v, want 1 to %s", got, b.TokenURL)
+			}
+			if got := rec.requests("/abs/"); len(got) != 1 || got[0].URL.Host != b.Host || got[0].URL.Scheme != "https" {
+				t.Errorf("J4U requests = %v, want 1 to https://%s", got, b.Host)
+			}
+
+			rec = newRecorder(t, s)
+			getClipDeals(t, newPromotion(t, b.Name, b.Creator(), append(opts[:3:3], supermarket.WithBaseURL(s.URL+"/"), supermarket.WithTransport(rec))...))
+			if got := rec.requests(safeway.TOKEN_PATH); len(got) != 1 || got[0].URL.String() != s.URL+safeway.TOKEN_PATH {
+				t.Errorf("token requests with a base URL = %v, want 1 to %s", got, s.URL+safeway.TOKEN_PATH)
+			}
+			if got := rec.requests("/abs/"); len(got) != 1 || got[0].URL.Host != strings.TrimPrefix(s.URL, "http://") {
+				t.Errorf("J4U requests with a base URL = %v, want 1 to %s", got, s.URL)
+			}
+		})
+	}
+
+	// The banner of the config selects the banner of the generic creator.
+	s := safewaytest.NewServer()
+	defer s.Close()
+	s.Banner = "vons"
+	getClipDeals(t, newPromotion(t, "safeway", safeway.Creator, append(s.Options(), supermarket.WithBanner("vons"))...))
+	if _, err := safeway.LookupBanner("kroger"); err == nil {
+		t.Error("LookupBanner(kroger) succeeded, want an error")
+	}
+}
+
+func TestTokenURLFlag(t *testing.T) {
+	s := safewaytest.NewServer()
+	defer s.Close()
+	f := flag.Lookup("safeway_token_url")
+	old := f.Value.String()
+	if err := f.Value.Set(s.URL + safeway.TOKEN_PATH); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Value.Set(old)
+
+	rec := newRecorder(t, s)
+	getClipDeals(t, newPromotion(t, "safeway", safeway.Creator,
+		supermarket.WithCredentials(s.ClientID, s.RefreshToken),
+		supermarket.WithApiKey(s.ApiKey),
+		supermarket.WithStoreID(s.StoreID),
+		supermarket.WithTransport(rec)))
+	if got := rec.requests(safeway.TOKEN_PATH); len(got) != 1 || got[0].URL.String() != s.URL+safeway.TOKEN_PATH {
+		t.Errorf("token requests = %v, want 1 to the flag", got)
+	}
+}
+
+func TestFailures(t *testing.T) {
+	tests := []struct {
+		failure safewaytest.Failure
+		want    string
+	}{
+		{safewaytest.FailureUnauthorized, "401"},
+		{safewaytest.FailureServerError, "500"},
+		{safewaytest.FailureRateLimited, "429"},
+		{safewaytest.FailureMalformed, "error decoding"},
+	}
+	for _, tt := range tests {
+		s := safewaytest.NewServer()
+		defer s.Close()
+		ps := newPromotion(t, "safeway", safeway.Creator, s.Options()...)
+		cds := getClipDeals(t, ps)
+		s.Failure = tt.failure
+
+		if _, err := ps.GetClipDeals(t.Context(), promotion.PromotionSearchOptions{}); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("GetClipDeals() with failure %d = %v, want %s", tt.failure, err, tt.want)
+		}
+		err := ps.ClipDeal(t.Context(), cds["1234567"])
+		if err == nil || !strings.Contains(err.Error(), tt.want) || errors.Is(err, promotion.ErrClipLimitReached) {
+			t.Errorf("ClipDeal() with failure %d = %v, want %s", tt.failure, err, tt.want)
+		}
+	}
+}
+
+func TestBadRefreshToken(t *testing.T) {
+	s := safewaytest.NewServer()
+	defer s.Close()
+	ps := newPromotion(t, "safeway", safeway.Creator, append(s.Options(), supermarket.WithCredentials(safewaytest.ClientID, "stale"))...)
+	if _, err := ps.GetClipDeals(t.Context(), promotion.PromotionSearchOptions{}); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("GetClipDeals() with a stale refresh token = %v, want invalid_grant", err)
+	}
+}
+
+// The fixture has one clipped offer, a limit of 2 allows a single clip.
+func TestClipDealLimit(t *testing.T) {
+	s := safewaytest.NewServer()
+	defer s.Close()
+	s.ClipLimit = 2
+	ps := newPromotion(t, "safeway", safeway.Creator, s.Options()...)
+	cds := getClipDeals(t, ps)
+	if err := ps.ClipDeal(t.Context(), cds["1234567"]); err != nil {
+		t.Fatalf("ClipDeal() failed: %v", err)
+	}
+	if err := ps.ClipDeal(t.Context(), cds["7654321"]); !errors.Is(err, promotion.ErrClipLimitReached) {
+		t.Errorf("ClipDeal() over the limit = %v, want %v", err, promotion.ErrClipLimitReached)
+	}
+	// Other errors of the server aren't the clip limit.
+	if err := ps.ClipDeal(t.Context(), cds["1234567"]); err == nil || errors.Is(err, promotion.ErrClipLimitReached) {
+		t.Errorf("ClipDeal(stale copy) = %v, want an error other than the clip limit", err)
+	}
+}
+
+func TestIsClipLimitError(t *testing.T) {
+	limit := `{"errors":[{"code":"` + safeway.ERROR_CODE_CLIP_LIMIT + `","message":"limit"}]}`
+	tests := []struct {
+		status int
+		body   string
+		want   bool
+	}{
+		{http.StatusBadRequest, limit, true},
+		{http.StatusConflict, `{"errors":[{"code":"OTHER"},{"code":"` + safeway.ERROR_CODE_CLIP_LIMIT + `"}]}`, true},
+		{http.StatusInternalServerError, limit, false},
+		{http.StatusOK, limit, false},
+		{http.StatusBadRequest, `{"errors":[{"code":"CLIP-409","message":"clip limit"}]}`, false},
+		{http.StatusBadRequest, `{"errors":`, false},
+		{http.StatusBadRequest, ``, false},
+	}
+	for _, tt := range tests {
+		if got := safeway.IsClipLimitError(tt.status, []byte(tt.body)); got != tt.want {
+			t.Errorf("isClipLimitError(%d, %s) = %t, want %t", tt.status, tt.body, got, tt.want)
+		}
+	}
+}
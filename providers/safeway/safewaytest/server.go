@@ -0,0 +1,282 @@
+// Package safewaytest provides a fake J4U API server, with the Okta token endpoint, seeded with
+// recorded fixtures, to exercise the safeway provider without network access.
+package safewaytest
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"github.com/csobrinho/supermarket-api/providers/safeway"
+)
+
+//go:embed fixtures/ecomgallery.json
+var ecomgalleryFixture []byte
+
+//go:embed fixtures/clip_limit.json
+var clipLimitFixture []byte
+
+// Default credentials accepted by the server.
+const (
+	ClientID     = "test-client"
+	RefreshToken = "test-refresh-token"
+	ApiKey       = "test-api-key"
+	StoreID      = "1234"
+	Banner       = "safeway"
+)
+
+// Failure is an error mode of the J4U endpoints.
+type Failure int
+
+const (
+	FailureNone         Failure = iota
+	FailureUnauthorized         // Rejects every access token with 401.
+	FailureServerError          // Fails with 500.
+	FailureRateLimited          // Fails with 429.
+	FailureMalformed            // Succeeds with a truncated JSON body.
+)
+
+// Server is a fake J4U API. Its exported fields can be changed before the first request.
+type Server struct {
+	*httptest.Server
+
+	ClientID     string
+	RefreshToken string // Refresh token accepted by the refresh_token grant.
+	ApiKey       string // Expected x-swy_api_key header.
+	StoreID      string // Expected storeid header and storeId query.
+	Banner       string // Expected x-swy_banner header.
+	ClipLimit    int    // Maximum number of clipped offers, zero means unlimited.
+	Failure      Failure
+
+	mu         sync.Mutex
+	promotions safeway.GetClipDealsResponse
+	tokens     map[string]bool
+	clips      []string
+}
+
+// NewServer starts a server seeded with the recorded offers. Call Close when done.
+func NewServer() *Server {
+	res := safeway.GetClipDealsResponse{}
+	if err := json.Unmarshal(ecomgalleryFixture, &res); err != nil {
+		panic(fmt.Sprintf("safewaytest: decode fixture, error %v", err))
+	}
+	return NewServerWithPromotions(res)
+}
+
+// NewServerWithPromotions starts a server seeded with the offers. Call Close when done.
+func NewServerWithPromotions(res safeway.GetClipDealsResponse) *Server {
+	s := &Server{
+		ClientID:     ClientID,
+		RefreshToken: RefreshToken,
+		ApiKey:       ApiKey,
+		StoreID:      StoreID,
+		Banner:       Banner,
+		promotions: safeway.GetClipDealsResponse{
+			Coupons:           slices.Clone(res.Coupons),
+			PersonalizedDeals: slices.Clone(res.PersonalizedDeals),
+		},
+		tokens: map[string]bool{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+safeway.TOKEN_PATH, s.token)
+	mux.HandleFunc("GET /abs/pub/mobile/j4u/api/ecomgallery", s.ecomgallery)
+	mux.HandleFunc("POST /abs/pub/mobile/j4u/api/offers/clip", s.clip)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Fixture starts a server for the test, closed when it ends, and returns the options to create a
+// safeway client against it. It is a supermarkettest.Fixture.
+func Fixture(t testing.TB) []supermarket.Option {
+	s := NewServer()
+	t.Cleanup(s.Close)
+	return s.Options()
+}
+
+// Options returns the options to create a safeway client against the server.
+func (s *Server) Options() []supermarket.Option {
+	return []supermarket.Option{
+		supermarket.WithBaseURL(s.URL),
+		supermarket.WithCredentials(s.ClientID, s.RefreshToken),
+		supermarket.WithApiKey(s.ApiKey),
+		supermarket.WithStoreID(s.StoreID),
+		supermarket.WithBanner(s.Banner),
+	}
+}
+
+// Promotions returns the current state of the offers.
+func (s *Server) Promotions() safeway.GetClipDealsResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return safeway.GetClipDealsResponse{
+		Coupons:           slices.Clone(s.promotions.Coupons),
+		PersonalizedDeals: slices.Clone(s.promotions.PersonalizedDeals),
+	}
+}
+
+// Clips returns the offer ids clipped through the server, in order.
+func (s *Server) Clips() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.clips)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request", "error_description": err.Error()})
+		return
+	}
+	if r.PostForm.Get("client_id") != s.ClientID {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client", "error_description": "Invalid value for 'client_id' parameter."})
+		return
+	}
+	if r.PostForm.Get("grant_type") != "refresh_token" || r.PostForm.Get("refresh_token") != s.RefreshToken {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "The refresh token is invalid or expired."})
+		return
+	}
+	token := randomToken()
+	s.mu.Lock()
+	s.tokens[token] = true
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token":  token,
+		"token_type":    "Bearer",
+		"expires_in":    1800,
+		"scope":         r.PostForm.Get("scope"),
+		"refresh_token": s.RefreshToken,
+	})
+}
+
+// check validates the access token and the J4U headers, and applies the failure mode. It returns
+// false if it already wrote an error response.
+func (s *Server) check(w http.ResponseWriter, r *http.Request) bool {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	ok := s.tokens[token]
+	s.mu.Unlock()
+	switch {
+	case !found || !ok || s.Failure == FailureUnauthorized:
+		writeError(w, http.StatusUnauthorized, "AUTH-401", "invalid or missing access token")
+	case r.Header.Get("x-swy_api_key") != s.ApiKey:
+		writeError(w, http.StatusForbidden, "APIKEY-403", "invalid or missing x-swy_api_key")
+	case r.Header.Get("x-swy_banner") != s.Banner:
+		writeError(w, http.StatusBadRequest, "BANNER-400", "invalid or missing x-swy_banner")
+	case r.Header.Get("storeid") != s.StoreID || r.URL.Query().Get("storeId") != s.StoreID:
+		writeError(w, http.StatusBadRequest, "STORE-400", "invalid or missing store id")
+	case s.Failure == FailureServerError:
+		writeError(w, http.StatusInternalServerError, "SERVER-500", "internal server error")
+	case s.Failure == FailureRateLimited:
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusTooManyRequests, "RATE-429", "too many requests")
+	case s.Failure == FailureMalformed:
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"cc":[{"offerId":`))
+	default:
+		return true
+	}
+	return false
+}
+
+func (s *Server) ecomgallery(w http.ResponseWriter, r *http.Request) {
+	if !s.check(w, r) {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Promotions())
+}
+
+func (s *Server) clip(w http.ResponseWriter, r *http.Request) {
+	if !s.check(w, r) {
+		return
+	}
+	req := safeway.ClipDealRoot{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Items) == 0 {
+		writeError(w, http.StatusBadRequest, "CLIP-400", "invalid clip request")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := req.Items[0].ItemID
+	p := s.find(id)
+	switch {
+	case p == nil:
+		writeError(w, http.StatusNotFound, "CLIP-404", "offer not found")
+		return
+	case p.Status == safeway.CLIP_STATUS_TYPE_CLIPPED:
+		writeError(w, http.StatusConflict, "CLIP-409", "offer already clipped")
+		return
+	case !p.IsClippable || p.IsDeleted:
+		writeError(w, http.StatusUnprocessableEntity, "CLIP-422", "offer can't be clipped")
+		return
+	case s.ClipLimit > 0 && s.clipped() >= s.ClipLimit:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(clipLimitFixture)
+		return
+	}
+	now := time.Now()
+	p.Status = safeway.CLIP_STATUS_TYPE_CLIPPED
+	p.ClippedAt = safeway.EpochMillisTime(now)
+	s.clips = append(s.clips, id)
+
+	res := safeway.ClipDealRoot{Items: make([]safeway.ClipDeal, 0, len(req.Items))}
+	for _, it := range req.Items {
+		it.Status = 1
+		it.ClipID = p.ClipID
+		it.ClipTs = strconv.FormatInt(now.UnixMilli(), 10)
+		it.Checked = true
+		res.Items = append(res.Items, it)
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// find returns the offer with the offer id. It must be called with the lock held.
+func (s *Server) find(offerID string) *safeway.Promotion {
+	for _, all := range [2][]safeway.Promotion{s.promotions.Coupons, s.promotions.PersonalizedDeals} {
+		if i := slices.IndexFunc(all, func(p safeway.Promotion) bool { return p.OfferID == offerID }); i >= 0 {
+			return &all[i]
+		}
+	}
+	return nil
+}
+
+// clipped returns the number of clipped offers. It must be called with the lock held.
+func (s *Server) clipped() int {
+	n := 0
+	for _, all := range [2][]safeway.Promotion{s.promotions.Coupons, s.promotions.PersonalizedDeals} {
+		for _, p := range all {
+			if p.Status == safeway.CLIP_STATUS_TYPE_CLIPPED {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]any{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
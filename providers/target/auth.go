@@ -0,0 +1,57 @@
+package target
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/csobrinho/supermarket-api/internal/auth"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"golang.org/x/oauth2"
+)
+
+var _ auth.Service = (*authenticatorService)(nil)
+
+const TOKEN_PATH = "/guest_auth/v1/token"
+
+type authenticatorService struct {
+	client        *http.Client
+	ts            oauth2.TokenSource
+	authenticated atomic.Bool
+}
+
+// NewAuthenticator authenticates the guest with the refresh token of a signed in Target app.
+func NewAuthenticator(ctx context.Context, cfg *supermarket.Config) (*authenticatorService, error) {
+	if cfg.ClientID == "" || cfg.RefreshToken == "" {
+		return nil, fmt.Errorf("authenticator: missing client id or refresh token")
+	}
+	config := &oauth2.Config{
+		ClientID: cfg.ClientID,
+		Endpoint: oauth2.Endpoint{
+			TokenURL:  baseURL(cfg) + TOKEN_PATH,
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+	client, err := newClient(cfg, nil)
+	if err != nil {
+		return nil, fmt.Errorf("authenticator: new http client, error %w", err)
+	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, client)
+	ts := config.TokenSource(ctx, &oauth2.Token{RefreshToken: cfg.RefreshToken, TokenType: "Bearer"})
+	return &authenticatorService{client: oauth2.NewClient(ctx, ts), ts: ts}, nil
+}
+
+func (as *authenticatorService) RefreshToken(ctx context.Context) (*oauth2.Token, error) {
+	t, err := as.ts.Token()
+	as.authenticated.Store(err == nil)
+	return t, err
+}
+func (as *authenticatorService) TokenSource() oauth2.TokenSource { return as.ts }
+func (as *authenticatorService) IsAuthenticated(ctx context.Context) bool {
+	if !as.authenticated.Load() {
+		return false
+	}
+	_, _ = as.RefreshToken(ctx)
+	return as.authenticated.Load()
+}
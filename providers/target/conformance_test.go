@@ -0,0 +1,13 @@
+package target_test
+
+import (
+	"testing"
+
+	"github.com/csobrinho/supermarket-api/pkg/supermarket/supermarkettest"
+	"github.com/csobrinho/supermarket-api/providers/target"
+	"github.com/csobrinho/supermarket-api/providers/target/targettest"
+)
+
+func TestConformance(t *testing.T) {
+	supermarkettest.RunConformance(t, target.Creator, targettest.Fixture)
+}
@@ -0,0 +1,125 @@
+package target
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/csobrinho/supermarket-api/internal/logging"
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"golang.org/x/oauth2"
+)
+
+var log = logging.For("target")
+
+const (
+	OFFERS_PATH    = "/circle_offers/v1/offers"
+	OFFER_ADD_PATH = "/circle_offers/v1/offers/%s/add"
+
+	offersPageSize = 100
+	// ERROR_CODE_MAX_OFFERS is returned when the wallet can't hold more offers.
+	ERROR_CODE_MAX_OFFERS = "MAX_OFFERS_ADDED"
+)
+
+type promotionService struct {
+	client  *http.Client
+	baseURL string
+	storeID string
+}
+
+func NewPromotion(ctx context.Context, cfg *supermarket.Config, ts oauth2.TokenSource) (*promotionService, error) {
+	client, err := newClient(cfg, ts)
+	if err != nil {
+		return nil, fmt.Errorf("promotion: new http client, error %w", err)
+	}
+	return &promotionService{client: client, baseURL: baseURL(cfg), storeID: cfg.StoreID}, nil
+}
+
+// GetClipDeals retrieves the Circle offers, following the pagination.
+func (ps *promotionService) GetClipDeals(ctx context.Context, opts promotion.PromotionSearchOptions) ([]promotion.ClipDeal, error) {
+	var ret []promotion.ClipDeal
+	for page := 1; ; page++ {
+		res, err := ps.getOffers(ctx, page)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range res.Offers {
+			ret = append(ret, o.convert())
+		}
+		if len(res.Offers) == 0 || page >= res.TotalPages {
+			break
+		}
+	}
+	log.InfoContext(ctx, "found circle offers", "count", len(ret))
+	return promotion.Filter(ret, opts), nil
+}
+
+func (ps *promotionService) getOffers(ctx context.Context, page int) (*OffersResponse, error) {
+	q := url.Values{}
+	if ps.storeID != "" {
+		q.Set("store_id", ps.storeID)
+	}
+	q.Set("page", strconv.Itoa(page))
+	q.Set("count", strconv.Itoa(offersPageSize))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ps.baseURL+OFFERS_PATH+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("promotion: get offers request, error %w", err)
+	}
+	res, err := ps.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("promotion: get offers response, error %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("promotion: get offers response, error status %s", res.Status)
+	}
+	ret := &OffersResponse{}
+	if err := json.NewDecoder(res.Body).Decode(ret); err != nil {
+		return nil, fmt.Errorf("promotion: get offers response, error decoding %w", err)
+	}
+	return ret, nil
+}
+
+// ClipDeal adds the offer to the Target Circle wallet.
+func (ps *promotionService) ClipDeal(ctx context.Context, cd promotion.ClipDeal) error {
+	if cd.ID == "" {
+		return fmt.Errorf("promotion[%s]: clip deal missing id", cd.ID)
+	}
+	if cd.IsClipped {
+		return fmt.Errorf("promotion[%s]: clip deal already clipped", cd.ID)
+	}
+	if !cd.IsClippable {
+		return fmt.Errorf("promotion[%s]: clip deal is not clippable", cd.ID)
+	}
+	if cd.IsDeleted {
+		return fmt.Errorf("promotion[%s]: clip deal is deleted", cd.ID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ps.baseURL+fmt.Sprintf(OFFER_ADD_PATH, url.PathEscape(cd.ID)), nil)
+	if err != nil {
+		return fmt.Errorf("promotion[%s]: clip deal request, error %w", cd.ID, err)
+	}
+	res, err := ps.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("promotion[%s]: clip deal response, error %w", cd.ID, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusOK || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	er := ErrorResponse{}
+	_ = json.Unmarshal(body, &er)
+	if er.Error.Code == ERROR_CODE_MAX_OFFERS {
+		return fmt.Errorf("promotion[%s]: clip deal response, error status %s, %w", cd.ID, res.Status, promotion.ErrClipLimitReached)
+	}
+	if er.Error.Message != "" {
+		return fmt.Errorf("promotion[%s]: clip deal response, error status %s, %s", cd.ID, res.Status, er.Error.Message)
+	}
+	return fmt.Errorf("promotion[%s]: clip deal response, error status %s", cd.ID, res.Status)
+}
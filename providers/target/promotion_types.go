@@ -0,0 +1,92 @@
+package target
+
+import (
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+)
+
+// Statuses of an offer.
+const (
+	OFFER_STATUS_AVAILABLE = "AVAILABLE"
+	OFFER_STATUS_ADDED     = "ADDED"
+	OFFER_STATUS_REDEEMED  = "REDEEMED"
+	OFFER_STATUS_EXPIRED   = "EXPIRED"
+)
+
+// OffersResponse is a page of Circle offers.
+type OffersResponse struct {
+	Offers     []Offer `json:"offers"`
+	Page       int     `json:"page"`
+	TotalPages int     `json:"total_pages"`
+	TotalCount int     `json:"total_count"`
+}
+
+// ErrorResponse is the body of an unsuccessful response.
+type ErrorResponse struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Offer represents a Target Circle offer.
+type Offer struct {
+	ID                   string    `json:"id"`                    // Maps to: ID
+	OfferCode            string    `json:"offer_code"`            // Maps to: PromoCode
+	Title                string    `json:"title"`                 // Maps to: Description
+	Subtitle             string    `json:"subtitle"`              //
+	Brand                string    `json:"brand_name"`            // Maps to: Brand
+	Category             string    `json:"category"`              // Maps to: Categories
+	DiscountPercent      float64   `json:"discount_percent"`      // Maps to: Discount.Percent
+	DiscountAmount       float64   `json:"discount_amount"`       // Maps to: Discount.Amount
+	MinPurchaseAmount    float64   `json:"min_purchase_amount"`   //
+	Terms                string    `json:"terms"`                 // Maps to: Disclaimer
+	ImageURL             string    `json:"image_url"`             // Maps to: ImageID
+	Tcins                []string  `json:"tcins"`                 // Maps to: Upcs
+	Channel              string    `json:"channel"`               // IN_STORE, ONLINE or BOTH.
+	StartDate            time.Time `json:"start_date"`            // Maps to: StartDate
+	ExpirationDate       time.Time `json:"expiration_date"`       // Maps to: EndDate
+	RedemptionLimit      int       `json:"redemption_limit"`      // Maps to: MaxPurchaseQuantity
+	RedemptionsRemaining int       `json:"redemptions_remaining"` //
+	Status               string    `json:"status"`                // Maps to: Status, IsClipped, IsClippable
+	Personalized         bool      `json:"personalized"`          // Maps to: PreviouslyPurchased
+}
+
+func (o Offer) convert() promotion.ClipDeal {
+	promoCode := o.OfferCode
+	ret := promotion.ClipDeal{
+		Promotion: promotion.Promotion{
+			Brand:               o.Brand,
+			ID:                  o.ID,
+			Description:         o.Title,
+			Disclaimer:          o.Terms,
+			Type:                promotion.PromotionTypeClipDeal,
+			ImageID:             o.ImageURL,
+			Upcs:                o.Tcins,
+			PromoCode:           &promoCode,
+			Status:              o.Status,
+			UsageType:           o.Channel,
+			StartDate:           o.StartDate,
+			EndDate:             o.ExpirationDate,
+			PreviouslyPurchased: o.Personalized,
+			IsDeleted:           o.Status == OFFER_STATUS_REDEEMED || o.Status == OFFER_STATUS_EXPIRED,
+			IsClippable:         o.Status == OFFER_STATUS_AVAILABLE,
+			IsDisplayable:       true,
+			IsClipped:           o.Status == OFFER_STATUS_ADDED,
+			Item:                o,
+		},
+		ExpiresAfterClip: false,
+	}
+	if o.Category != "" {
+		ret.Categories = []string{o.Category}
+	}
+	if o.DiscountPercent > 0 || o.DiscountAmount > 0 {
+		ret.Discount = &promotion.Discount{Amount: o.DiscountAmount, Percent: o.DiscountPercent}
+	}
+	if o.RedemptionLimit > 0 {
+		q := float64(o.RedemptionLimit)
+		ret.MaxPurchaseQuantity = &q
+	}
+	return ret
+}
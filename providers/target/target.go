@@ -0,0 +1,58 @@
+// Package target implements Target Circle offers.
+//
+// The endpoints follow the ones used by the Target app and can be pointed elsewhere with
+// supermarket.WithBaseURL.
+package target
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/csobrinho/supermarket-api/internal/auth"
+	ihttp "github.com/csobrinho/supermarket-api/internal/http"
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"golang.org/x/oauth2"
+)
+
+var _ supermarket.Supermarket = (*target)(nil)
+var _ promotion.Service = (*promotionService)(nil)
+
+// DefaultBaseURL is the base URL of the Target API.
+const DefaultBaseURL = "https://api.target.com"
+
+func Creator(ctx context.Context, cfg *supermarket.Config) (supermarket.Supermarket, error) {
+	a, err := NewAuthenticator(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	ps, err := NewPromotion(ctx, cfg, a.ts)
+	if err != nil {
+		return nil, err
+	}
+	return &target{as: a, ps: ps}, nil
+}
+
+type target struct {
+	as *authenticatorService
+	ps *promotionService
+}
+
+func (t *target) Authenticator() (auth.Service, error)  { return t.as, nil }
+func (t *target) Promotion() (promotion.Service, error) { return t.ps, nil }
+
+func baseURL(cfg *supermarket.Config) string {
+	if cfg.BaseURL != "" {
+		return strings.TrimSuffix(cfg.BaseURL, "/")
+	}
+	return DefaultBaseURL
+}
+
+func newClient(cfg *supermarket.Config, ts oauth2.TokenSource) (*http.Client, error) {
+	headers := map[string]string{"accept": "application/json"}
+	if cfg.ApiKey != "" {
+		headers["x-api-key"] = cfg.ApiKey
+	}
+	return ihttp.New(true, cfg.Debug, cfg.UserAgent, headers, cfg.Timeout, ts, cfg.Transport)
+}
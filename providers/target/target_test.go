@@ -0,0 +1,159 @@
+package target_test
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"github.com/csobrinho/supermarket-api/providers/target"
+	"github.com/csobrinho/supermarket-api/providers/target/targettest"
+)
+
+func newPromotion(t *testing.T, s *targettest.Server, opts ...supermarket.Option) supermarket.PromotionService {
+	t.Helper()
+	f := supermarket.NewFactory()
+	f.Register("target", target.Creator)
+	sm, err := f.Create(t.Context(), "target", append(s.Options(), opts...)...)
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	ps, err := sm.Promotion()
+	if err != nil {
+		t.Fatalf("Promotion() failed: %v", err)
+	}
+	return ps
+}
+
+func getClipDeals(t *testing.T, ps supermarket.PromotionService) map[string]promotion.ClipDeal {
+	t.Helper()
+	cds, err := ps.GetClipDeals(t.Context(), promotion.PromotionSearchOptions{})
+	if err != nil {
+		t.Fatalf("GetClipDeals() failed: %v", err)
+	}
+	ret := make(map[string]promotion.ClipDeal, len(cds))
+	for _, cd := range cds {
+		ret[cd.ID] = cd
+	}
+	return ret
+}
+
+func TestConvert(t *testing.T) {
+	s := targettest.NewServer()
+	defer s.Close()
+	cds := getClipDeals(t, newPromotion(t, s))
+	if len(cds) != 5 {
+		t.Fatalf("GetClipDeals() returned %d deals, want 5", len(cds))
+	}
+
+	percent := cds["3301234"]
+	if percent.Brand != "Good & Gather" || *percent.PromoCode != "CIRCLE-3301234" || percent.Type != promotion.PromotionTypeClipDeal {
+		t.Errorf("deal = %+v, want the Good & Gather offer CIRCLE-3301234", percent.Promotion)
+	}
+	if percent.Discount == nil || percent.Discount.Percent != 20 || percent.Discount.Amount != 0 {
+		t.Errorf("percent deal discount = %+v, want 20%% off", percent.Discount)
+	}
+	if !slices.Equal(percent.Categories, []string{"Grocery"}) || !slices.Equal(percent.Upcs, []string{"54518532", "54518533"}) {
+		t.Errorf("percent deal = categories %v, upcs %v, want Grocery and its 2 tcins", percent.Categories, percent.Upcs)
+	}
+	if want := time.Date(2025, 5, 25, 6, 59, 59, 0, time.UTC); !percent.EndDate.Equal(want) {
+		t.Errorf("percent deal end date = %v, want %v", percent.EndDate, want)
+	}
+	if percent.MaxPurchaseQuantity == nil || *percent.MaxPurchaseQuantity != 1 {
+		t.Errorf("percent deal redemption limit = %v, want 1", percent.MaxPurchaseQuantity)
+	}
+	if !percent.PreviouslyPurchased || percent.UsageType != "BOTH" {
+		t.Errorf("percent deal = personalized %v, channel %q, want personalized for BOTH", percent.PreviouslyPurchased, percent.UsageType)
+	}
+	if !percent.IsClippable || percent.IsClipped || percent.IsDeleted || percent.Status != target.OFFER_STATUS_AVAILABLE {
+		t.Errorf("percent deal = %+v, want an available offer", percent.Promotion)
+	}
+
+	if cd := cds["3301290"]; cd.MaxPurchaseQuantity == nil || *cd.MaxPurchaseQuantity != 4 {
+		t.Errorf("deal redemption limit = %v, want 4", cd.MaxPurchaseQuantity)
+	}
+	amount := cds["3301355"]
+	if amount.Discount == nil || amount.Discount.Amount != 5 || amount.Discount.Percent != 0 {
+		t.Errorf("amount deal discount = %+v, want $5 off", amount.Discount)
+	}
+	if !amount.IsClipped || amount.IsClippable || amount.IsDeleted {
+		t.Errorf("added deal = %+v, want clipped", amount.Promotion)
+	}
+	if redeemed := cds["3301401"]; !redeemed.IsDeleted || redeemed.IsClippable || redeemed.IsClipped {
+		t.Errorf("redeemed deal = %+v, want deleted", redeemed.Promotion)
+	}
+}
+
+// Offers without a category, discount or redemption limit leave them unset.
+func TestConvertEmpty(t *testing.T) {
+	s := targettest.NewServerWithOffers([]target.Offer{{ID: "1", Status: target.OFFER_STATUS_EXPIRED}})
+	defer s.Close()
+	cd := getClipDeals(t, newPromotion(t, s))["1"]
+	if cd.Categories != nil || cd.Discount != nil || cd.MaxPurchaseQuantity != nil {
+		t.Errorf("deal = categories %v, discount %v, limit %v, want them unset", cd.Categories, cd.Discount, cd.MaxPurchaseQuantity)
+	}
+	if !cd.IsDeleted || cd.IsClippable {
+		t.Errorf("expired deal = %+v, want deleted", cd.Promotion)
+	}
+}
+
+func TestClipDeal(t *testing.T) {
+	s := targettest.NewServer()
+	defer s.Close()
+	ps := newPromotion(t, s)
+	cds := getClipDeals(t, ps)
+	cd := cds["3301234"]
+	if err := ps.ClipDeal(t.Context(), cd); err != nil {
+		t.Fatalf("ClipDeal() failed: %v", err)
+	}
+	if got := getClipDeals(t, ps)["3301234"]; !got.IsClipped {
+		t.Errorf("GetClipDeals() after ClipDeal() = %+v, want clipped", got.Promotion)
+	}
+
+	// A stale copy is rejected by the server, a fresh one before the request.
+	if err := ps.ClipDeal(t.Context(), cd); err == nil || !strings.Contains(err.Error(), "offer already added") {
+		t.Errorf("ClipDeal(stale copy) = %v, want the server error", err)
+	}
+	if err := ps.ClipDeal(t.Context(), cds["3301355"]); err == nil || !strings.Contains(err.Error(), "already clipped") {
+		t.Errorf("ClipDeal(added) = %v, want already clipped", err)
+	}
+	if err := ps.ClipDeal(t.Context(), cds["3301401"]); err == nil {
+		t.Error("ClipDeal(redeemed) succeeded")
+	}
+	if got := s.Adds(); !slices.Equal(got, []string{"3301234"}) {
+		t.Errorf("Adds() = %v, want only the first offer", got)
+	}
+}
+
+// The fixture has one offer in the wallet, a maximum of 2 allows a single clip.
+func TestClipDealLimit(t *testing.T) {
+	s := targettest.NewServer()
+	defer s.Close()
+	s.MaxOffers = 2
+	ps := newPromotion(t, s)
+	cds := getClipDeals(t, ps)
+	if err := ps.ClipDeal(t.Context(), cds["3301234"]); err != nil {
+		t.Fatalf("ClipDeal() failed: %v", err)
+	}
+	err := ps.ClipDeal(t.Context(), cds["3301290"])
+	if !errors.Is(err, promotion.ErrClipLimitReached) {
+		t.Errorf("ClipDeal() over the limit = %v, want %v", err, promotion.ErrClipLimitReached)
+	}
+	// Other errors of the server aren't the clip limit.
+	unknown := promotion.ClipDeal{Promotion: promotion.Promotion{ID: "nope", IsClippable: true}}
+	if err := ps.ClipDeal(t.Context(), unknown); err == nil || errors.Is(err, promotion.ErrClipLimitReached) {
+		t.Errorf("ClipDeal(unknown) = %v, want an error other than the clip limit", err)
+	}
+}
+
+func TestBadRefreshToken(t *testing.T) {
+	s := targettest.NewServer()
+	defer s.Close()
+	ps := newPromotion(t, s, supermarket.WithCredentials(targettest.ClientID, "stale"))
+	if _, err := ps.GetClipDeals(t.Context(), promotion.PromotionSearchOptions{}); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("GetClipDeals() with a stale refresh token = %v, want invalid_grant", err)
+	}
+}
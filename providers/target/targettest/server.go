@@ -0,0 +1,210 @@
+// Package targettest provides a fake Target Circle offers server, seeded with recorded fixtures, to
+// exercise the target provider without network access.
+package targettest
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"github.com/csobrinho/supermarket-api/providers/target"
+)
+
+//go:embed fixtures/offers.json
+var offersFixture []byte
+
+// Default credentials accepted by the server.
+const (
+	ClientID     = "ecom-app-test"
+	RefreshToken = "test-refresh-token"
+	StoreID      = "1426"
+)
+
+// Server is a fake Target API. Its exported fields can be changed before the first request.
+type Server struct {
+	*httptest.Server
+
+	ClientID     string
+	RefreshToken string
+	MaxOffers    int // Maximum number of offers in the wallet, zero means unlimited.
+
+	mu     sync.Mutex
+	offers []target.Offer
+	tokens map[string]bool
+	adds   []string
+}
+
+// NewServer starts a server seeded with the recorded offers. Call Close when done.
+func NewServer() *Server {
+	res := target.OffersResponse{}
+	if err := json.Unmarshal(offersFixture, &res); err != nil {
+		panic(fmt.Sprintf("targettest: decode fixture, error %v", err))
+	}
+	return NewServerWithOffers(res.Offers)
+}
+
+// NewServerWithOffers starts a server seeded with the offers. Call Close when done.
+func NewServerWithOffers(offers []target.Offer) *Server {
+	s := &Server{
+		ClientID:     ClientID,
+		RefreshToken: RefreshToken,
+		offers:       slices.Clone(offers),
+		tokens:       map[string]bool{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+target.TOKEN_PATH, s.token)
+	mux.HandleFunc("GET "+target.OFFERS_PATH, s.listOffers)
+	mux.HandleFunc("POST "+target.OFFERS_PATH+"/{id}/add", s.addOffer)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Fixture starts a server for the test, closed when it ends, and returns the options to create a
+// target client against it. It is a supermarkettest.Fixture.
+func Fixture(t testing.TB) []supermarket.Option {
+	s := NewServer()
+	t.Cleanup(s.Close)
+	return s.Options()
+}
+
+// Options returns the options to create a target client against the server.
+func (s *Server) Options() []supermarket.Option {
+	return []supermarket.Option{
+		supermarket.WithBaseURL(s.URL),
+		supermarket.WithCredentials(s.ClientID, s.RefreshToken),
+		supermarket.WithStoreID(StoreID),
+	}
+}
+
+// Offers returns the current state of the offers.
+func (s *Server) Offers() []target.Offer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.offers)
+}
+
+// Adds returns the ids of the offers added through the server, in order.
+func (s *Server) Adds() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.adds)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	switch {
+	case r.PostForm.Get("client_id") != s.ClientID:
+		writeError(w, http.StatusUnauthorized, "invalid_client", "unknown client")
+		return
+	case r.PostForm.Get("grant_type") != "refresh_token" || r.PostForm.Get("refresh_token") != s.RefreshToken:
+		writeError(w, http.StatusBadRequest, "invalid_grant", "invalid refresh token")
+		return
+	}
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	token := hex.EncodeToString(b)
+	s.mu.Lock()
+	s.tokens[token] = true
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token":  token,
+		"token_type":    "Bearer",
+		"expires_in":    3600,
+		"refresh_token": s.RefreshToken,
+	})
+}
+
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) bool {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	ok := s.tokens[token]
+	s.mu.Unlock()
+	if !found || !ok {
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid or missing access token")
+		return false
+	}
+	return true
+}
+
+func (s *Server) listOffers(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticate(w, r) {
+		return
+	}
+	q := r.URL.Query()
+	page, err := strconv.Atoi(q.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	count, err := strconv.Atoi(q.Get("count"))
+	if err != nil || count <= 0 || count > 100 {
+		count = 24
+	}
+	s.mu.Lock()
+	offers := slices.Clone(s.offers)
+	s.mu.Unlock()
+
+	res := target.OffersResponse{Offers: []target.Offer{}, Page: page, TotalCount: len(offers)}
+	res.TotalPages = (len(offers) + count - 1) / count
+	if start := (page - 1) * count; start < len(offers) {
+		res.Offers = offers[start:min(start+count, len(offers))]
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) addOffer(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticate(w, r) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.offers, func(o target.Offer) bool { return o.ID == r.PathValue("id") })
+	switch {
+	case i < 0:
+		writeError(w, http.StatusNotFound, "OFFER_NOT_FOUND", "offer not found")
+		return
+	case s.offers[i].Status == target.OFFER_STATUS_ADDED:
+		writeError(w, http.StatusConflict, "OFFER_ALREADY_ADDED", "offer already added")
+		return
+	case s.offers[i].Status != target.OFFER_STATUS_AVAILABLE:
+		writeError(w, http.StatusUnprocessableEntity, "OFFER_UNAVAILABLE", "offer is no longer available")
+		return
+	}
+	added := 0
+	for _, o := range s.offers {
+		if o.Status == target.OFFER_STATUS_ADDED {
+			added++
+		}
+	}
+	if s.MaxOffers > 0 && added >= s.MaxOffers {
+		writeError(w, http.StatusBadRequest, target.ERROR_CODE_MAX_OFFERS, "you have reached the maximum number of offers")
+		return
+	}
+	s.offers[i].Status = target.OFFER_STATUS_ADDED
+	s.adds = append(s.adds, s.offers[i].ID)
+	writeJSON(w, http.StatusOK, map[string]string{"status": target.OFFER_STATUS_ADDED})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	res := target.ErrorResponse{}
+	res.Error.Code, res.Error.Message = code, message
+	writeJSON(w, status, res)
+}
@@ -0,0 +1,135 @@
+package walgreens
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/auth"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"golang.org/x/oauth2"
+)
+
+var _ auth.Service = (*authenticatorService)(nil)
+var _ oauth2.TokenSource = (*authenticatorService)(nil)
+
+const LOGIN_PATH = "/api/v1/login"
+
+// LoginRequest is the body of the login request.
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// LoginResponse is the session returned by a successful login.
+type LoginResponse struct {
+	AccessToken string `json:"accessToken"`
+	ExpiresIn   int    `json:"expiresIn"` // Seconds.
+	LoyaltyID   string `json:"loyaltyId"` // myWalgreens member id.
+}
+
+// authenticatorService logs in with the username and password of the myWalgreens account. There
+// is no refresh token, the session is renewed by logging in again when it expires.
+type authenticatorService struct {
+	client   *http.Client
+	loginURL string
+	req      LoginRequest
+	ts       oauth2.TokenSource
+
+	mu            sync.Mutex
+	loyaltyID     string
+	authenticated bool
+}
+
+func NewAuthenticator(ctx context.Context, cfg *supermarket.Config) (*authenticatorService, error) {
+	if cfg.Username == "" || cfg.Password == "" {
+		return nil, fmt.Errorf("authenticator: missing username or password")
+	}
+	client, err := newClient(cfg, nil)
+	if err != nil {
+		return nil, fmt.Errorf("authenticator: new http client, error %w", err)
+	}
+	as := &authenticatorService{
+		client:    client,
+		loginURL:  baseURL(cfg) + LOGIN_PATH,
+		req:       LoginRequest{Username: cfg.Username, Password: cfg.Password},
+		loyaltyID: cfg.LoyaltyCard,
+	}
+	as.ts = oauth2.ReuseTokenSource(nil, loginTokenSource{ctx: ctx, as: as})
+	return as, nil
+}
+
+type loginTokenSource struct {
+	ctx context.Context
+	as  *authenticatorService
+}
+
+func (l loginTokenSource) Token() (*oauth2.Token, error) { return l.as.login(l.ctx) }
+
+func (as *authenticatorService) login(ctx context.Context) (*oauth2.Token, error) {
+	body, err := json.Marshal(as.req)
+	if err != nil {
+		return nil, fmt.Errorf("authenticator: login failed to marshal, error %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, as.loginURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("authenticator: login request, error %w", err)
+	}
+	res, err := as.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("authenticator: login response, error %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("authenticator: login response, error status %s", res.Status)
+	}
+	lr := LoginResponse{}
+	if err := json.NewDecoder(res.Body).Decode(&lr); err != nil {
+		return nil, fmt.Errorf("authenticator: login response, error decoding %w", err)
+	}
+	as.mu.Lock()
+	if as.loyaltyID == "" {
+		as.loyaltyID = lr.LoyaltyID
+	}
+	as.mu.Unlock()
+	return &oauth2.Token{
+		AccessToken: lr.AccessToken,
+		TokenType:   "Bearer",
+		Expiry:      time.Now().Add(time.Duration(lr.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// LoyaltyID returns the member id of the account, logging in if needed.
+func (as *authenticatorService) LoyaltyID() (string, error) {
+	if _, err := as.Token(); err != nil {
+		return "", err
+	}
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	return as.loyaltyID, nil
+}
+
+func (as *authenticatorService) Token() (*oauth2.Token, error) { return as.ts.Token() }
+
+func (as *authenticatorService) RefreshToken(ctx context.Context) (*oauth2.Token, error) {
+	t, err := as.ts.Token()
+	as.mu.Lock()
+	as.authenticated = err == nil
+	as.mu.Unlock()
+	return t, err
+}
+func (as *authenticatorService) TokenSource() oauth2.TokenSource { return as.ts }
+func (as *authenticatorService) IsAuthenticated(ctx context.Context) bool {
+	as.mu.Lock()
+	authenticated := as.authenticated
+	as.mu.Unlock()
+	if !authenticated {
+		return false
+	}
+	_, err := as.RefreshToken(ctx)
+	return err == nil
+}
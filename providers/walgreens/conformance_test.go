@@ -0,0 +1,13 @@
+package walgreens_test
+
+import (
+	"testing"
+
+	"github.com/csobrinho/supermarket-api/pkg/supermarket/supermarkettest"
+	"github.com/csobrinho/supermarket-api/providers/walgreens"
+	"github.com/csobrinho/supermarket-api/providers/walgreens/walgreenstest"
+)
+
+func TestConformance(t *testing.T) {
+	supermarkettest.RunConformance(t, walgreens.Creator, walgreenstest.Fixture)
+}
@@ -0,0 +1,136 @@
+package walgreens
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/csobrinho/supermarket-api/internal/logging"
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+)
+
+var log = logging.For("walgreens")
+
+const (
+	COUPONS_PATH     = "/api/v1/coupons"
+	COUPON_CLIP_PATH = "/api/v1/coupons/clip"
+
+	couponsPageSize = 100
+	// ERROR_CODE_CLIP_LIMIT is returned when the account can't hold more clipped coupons.
+	ERROR_CODE_CLIP_LIMIT = "CLIP_LIMIT_EXCEEDED"
+)
+
+type promotionService struct {
+	client  *http.Client
+	baseURL string
+	as      *authenticatorService
+}
+
+func NewPromotion(ctx context.Context, cfg *supermarket.Config, as *authenticatorService) (*promotionService, error) {
+	client, err := newClient(cfg, as.ts)
+	if err != nil {
+		return nil, fmt.Errorf("promotion: new http client, error %w", err)
+	}
+	return &promotionService{client: client, baseURL: baseURL(cfg), as: as}, nil
+}
+
+// GetClipDeals retrieves the coupons of the account, following the pagination.
+func (ps *promotionService) GetClipDeals(ctx context.Context, opts promotion.PromotionSearchOptions) ([]promotion.ClipDeal, error) {
+	loyaltyID, err := ps.as.LoyaltyID()
+	if err != nil {
+		return nil, fmt.Errorf("promotion: get coupons, error %w", err)
+	}
+	var ret []promotion.ClipDeal
+	for offset := 0; ; {
+		page, err := ps.getCoupons(ctx, loyaltyID, offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range page.Coupons {
+			ret = append(ret, c.convert())
+		}
+		offset += len(page.Coupons)
+		if len(page.Coupons) == 0 || offset >= page.Total {
+			break
+		}
+	}
+	log.InfoContext(ctx, "found coupons", "count", len(ret))
+	return promotion.Filter(ret, opts), nil
+}
+
+func (ps *promotionService) getCoupons(ctx context.Context, loyaltyID string, offset int) (*CouponsResponse, error) {
+	q := url.Values{}
+	q.Set("loyaltyId", loyaltyID)
+	q.Set("offset", strconv.Itoa(offset))
+	q.Set("limit", strconv.Itoa(couponsPageSize))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ps.baseURL+COUPONS_PATH+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("promotion: get coupons request, error %w", err)
+	}
+	res, err := ps.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("promotion: get coupons response, error %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("promotion: get coupons response, error status %s", res.Status)
+	}
+	page := &CouponsResponse{}
+	if err := json.NewDecoder(res.Body).Decode(page); err != nil {
+		return nil, fmt.Errorf("promotion: get coupons response, error decoding %w", err)
+	}
+	return page, nil
+}
+
+// ClipDeal clips the coupon to the myWalgreens account.
+func (ps *promotionService) ClipDeal(ctx context.Context, cd promotion.ClipDeal) error {
+	if cd.ID == "" {
+		return fmt.Errorf("promotion[%s]: clip deal missing id", cd.ID)
+	}
+	if cd.IsClipped {
+		return fmt.Errorf("promotion[%s]: clip deal already clipped", cd.ID)
+	}
+	if !cd.IsClippable {
+		return fmt.Errorf("promotion[%s]: clip deal is not clippable", cd.ID)
+	}
+	if cd.IsDeleted {
+		return fmt.Errorf("promotion[%s]: clip deal is deleted", cd.ID)
+	}
+	loyaltyID, err := ps.as.LoyaltyID()
+	if err != nil {
+		return fmt.Errorf("promotion[%s]: clip deal, error %w", cd.ID, err)
+	}
+
+	body, err := json.Marshal(ClipRequest{LoyaltyID: loyaltyID, CouponID: cd.ID})
+	if err != nil {
+		return fmt.Errorf("promotion[%s]: clip deal failed to marshal, error %w", cd.ID, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ps.baseURL+COUPON_CLIP_PATH, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("promotion[%s]: clip deal request, error %w", cd.ID, err)
+	}
+	res, err := ps.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("promotion[%s]: clip deal response, error %w", cd.ID, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+	b, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	er := ErrorResponse{}
+	_ = json.Unmarshal(b, &er)
+	if er.Code == ERROR_CODE_CLIP_LIMIT {
+		return fmt.Errorf("promotion[%s]: clip deal response, error status %s, %w", cd.ID, res.Status, promotion.ErrClipLimitReached)
+	}
+	if er.Message != "" {
+		return fmt.Errorf("promotion[%s]: clip deal response, error status %s, %s", cd.ID, res.Status, er.Message)
+	}
+	return fmt.Errorf("promotion[%s]: clip deal response, error status %s", cd.ID, res.Status)
+}
@@ -0,0 +1,103 @@
+package walgreens
+
+import (
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+)
+
+// Discount types of a coupon.
+const (
+	COUPON_TYPE_DOLLAR  = "dollar"
+	COUPON_TYPE_PERCENT = "percent"
+)
+
+// CouponsResponse is a page of coupons.
+type CouponsResponse struct {
+	Coupons []Coupon `json:"coupons"`
+	Offset  int      `json:"offset"`
+	Total   int      `json:"total"`
+}
+
+// ClipRequest is the body of the clip request.
+type ClipRequest struct {
+	LoyaltyID string `json:"loyaltyId"`
+	CouponID  string `json:"couponId"`
+}
+
+// ErrorResponse is the body of an unsuccessful response.
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Coupon represents a Walgreens digital coupon.
+type Coupon struct {
+	ID           string    `json:"id"`           // Maps to: ID
+	Code         string    `json:"code"`         // Maps to: PromoCode
+	Brand        string    `json:"brand"`        // Maps to: Brand
+	Category     string    `json:"category"`     // Maps to: Categories
+	Summary      string    `json:"summary"`      // Maps to: Description
+	Details      string    `json:"details"`      // Maps to: Disclaimer
+	Type         string    `json:"type"`         // Maps to: Discount
+	Amount       float64   `json:"amount"`       // Maps to: Discount
+	MinQuantity  int       `json:"minQty"`       // Maps to: MinPurchaseQuantity
+	LimitPerTrip int       `json:"limitPerTrip"` // Maps to: MaxPurchaseQuantity
+	ImageURL     string    `json:"imageUrl"`     // Maps to: ImageID
+	Upcs         []string  `json:"upcs"`         // Maps to: Upcs
+	StartDate    time.Time `json:"startDate"`    // Maps to: StartDate
+	ExpiryDate   time.Time `json:"expiryDate"`   // Maps to: EndDate
+	Clipped      bool      `json:"clipped"`      // Maps to: IsClipped
+	Clippable    bool      `json:"clippable"`    // Maps to: IsClippable
+	Redeemed     bool      `json:"redeemed"`     // Maps to: IsDeleted
+	Recommended  bool      `json:"recommended"`  // Maps to: PreviouslyPurchased
+}
+
+func (c Coupon) convert() promotion.ClipDeal {
+	promoCode, promoType := c.Code, c.Type
+	ret := promotion.ClipDeal{
+		Promotion: promotion.Promotion{
+			Brand:               c.Brand,
+			ID:                  c.ID,
+			Description:         c.Summary,
+			Disclaimer:          c.Details,
+			Type:                promotion.PromotionTypeCoupon,
+			ImageID:             c.ImageURL,
+			Upcs:                c.Upcs,
+			PromoCode:           &promoCode,
+			PromoType:           &promoType,
+			StartDate:           c.StartDate,
+			EndDate:             c.ExpiryDate,
+			PreviouslyPurchased: c.Recommended,
+			IsDeleted:           c.Redeemed,
+			IsClippable:         c.Clippable,
+			IsDisplayable:       true,
+			IsClipped:           c.Clipped,
+			Item:                c,
+		},
+		ExpiresAfterClip: true,
+	}
+	if c.Clipped {
+		ret.Status = "clipped"
+	} else {
+		ret.Status = "unclipped"
+	}
+	if c.Category != "" {
+		ret.Categories = []string{c.Category}
+	}
+	switch c.Type {
+	case COUPON_TYPE_DOLLAR:
+		ret.Discount = &promotion.Discount{Amount: c.Amount}
+	case COUPON_TYPE_PERCENT:
+		ret.Discount = &promotion.Discount{Percent: c.Amount}
+	}
+	if c.MinQuantity > 0 {
+		q := float64(c.MinQuantity)
+		ret.MinPurchaseQuantity = &q
+	}
+	if c.LimitPerTrip > 0 {
+		q := float64(c.LimitPerTrip)
+		ret.MaxPurchaseQuantity = &q
+	}
+	return ret
+}
@@ -0,0 +1,59 @@
+// Package walgreens implements Walgreens digital coupons, clipped to the myWalgreens loyalty
+// account.
+//
+// The endpoints follow the ones used by the Walgreens app and can be pointed elsewhere with
+// supermarket.WithBaseURL.
+package walgreens
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/csobrinho/supermarket-api/internal/auth"
+	ihttp "github.com/csobrinho/supermarket-api/internal/http"
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"golang.org/x/oauth2"
+)
+
+var _ supermarket.Supermarket = (*walgreens)(nil)
+var _ promotion.Service = (*promotionService)(nil)
+
+// DefaultBaseURL is the base URL of the Walgreens API.
+const DefaultBaseURL = "https://services.walgreens.com"
+
+func Creator(ctx context.Context, cfg *supermarket.Config) (supermarket.Supermarket, error) {
+	a, err := NewAuthenticator(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	ps, err := NewPromotion(ctx, cfg, a)
+	if err != nil {
+		return nil, err
+	}
+	return &walgreens{as: a, ps: ps}, nil
+}
+
+type walgreens struct {
+	as *authenticatorService
+	ps *promotionService
+}
+
+func (w *walgreens) Authenticator() (auth.Service, error)  { return w.as, nil }
+func (w *walgreens) Promotion() (promotion.Service, error) { return w.ps, nil }
+
+func baseURL(cfg *supermarket.Config) string {
+	if cfg.BaseURL != "" {
+		return strings.TrimSuffix(cfg.BaseURL, "/")
+	}
+	return DefaultBaseURL
+}
+
+func newClient(cfg *supermarket.Config, ts oauth2.TokenSource) (*http.Client, error) {
+	headers := map[string]string{"accept": "application/json", "content-type": "application/json"}
+	if cfg.ApiKey != "" {
+		headers["x-api-key"] = cfg.ApiKey
+	}
+	return ihttp.New(true, cfg.Debug, cfg.UserAgent, headers, cfg.Timeout, ts, cfg.Transport)
+}
@@ -0,0 +1,229 @@
+package walgreens_test
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/csobrinho/supermarket-api/internal/promotion"
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"github.com/csobrinho/supermarket-api/providers/walgreens"
+	"github.com/csobrinho/supermarket-api/providers/walgreens/walgreenstest"
+)
+
+func newSupermarket(t *testing.T, s *walgreenstest.Server, opts ...supermarket.Option) supermarket.Supermarket {
+	t.Helper()
+	f := supermarket.NewFactory()
+	f.Register("walgreens", walgreens.Creator)
+	sm, err := f.Create(t.Context(), "walgreens", append(s.Options(), opts...)...)
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	return sm
+}
+
+func newPromotion(t *testing.T, s *walgreenstest.Server, opts ...supermarket.Option) supermarket.PromotionService {
+	t.Helper()
+	ps, err := newSupermarket(t, s, opts...).Promotion()
+	if err != nil {
+		t.Fatalf("Promotion() failed: %v", err)
+	}
+	return ps
+}
+
+func getClipDeals(t *testing.T, ps supermarket.PromotionService) map[string]promotion.ClipDeal {
+	t.Helper()
+	cds, err := ps.GetClipDeals(t.Context(), promotion.PromotionSearchOptions{})
+	if err != nil {
+		t.Fatalf("GetClipDeals() failed: %v", err)
+	}
+	ret := make(map[string]promotion.ClipDeal, len(cds))
+	for _, cd := range cds {
+		ret[cd.ID] = cd
+	}
+	return ret
+}
+
+func TestLogin(t *testing.T) {
+	s := walgreenstest.NewServer()
+	defer s.Close()
+	as, err := newSupermarket(t, s).Authenticator()
+	if err != nil {
+		t.Fatalf("Authenticator() failed: %v", err)
+	}
+	if as.IsAuthenticated(t.Context()) {
+		t.Error("IsAuthenticated() before logging in = true, want false")
+	}
+	tok, err := as.RefreshToken(t.Context())
+	if err != nil {
+		t.Fatalf("RefreshToken() failed: %v", err)
+	}
+	if tok.AccessToken == "" || tok.Expiry.Before(time.Now().Add(19*time.Minute)) {
+		t.Errorf("RefreshToken() = %+v, want a session of 20 minutes", tok)
+	}
+	if !as.IsAuthenticated(t.Context()) {
+		t.Error("IsAuthenticated() = false, want true")
+	}
+	// The session is reused until it expires.
+	if got := s.Logins(); got != 1 {
+		t.Errorf("Logins() = %d, want 1", got)
+	}
+}
+
+func TestLoginErrors(t *testing.T) {
+	s := walgreenstest.NewServer()
+	defer s.Close()
+	as, err := newSupermarket(t, s, supermarket.WithLogin(walgreenstest.Username, "wrong")).Authenticator()
+	if err != nil {
+		t.Fatalf("Authenticator() failed: %v", err)
+	}
+	if _, err := as.RefreshToken(t.Context()); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("RefreshToken() with bad credentials = %v, want 401", err)
+	}
+	if as.IsAuthenticated(t.Context()) {
+		t.Error("IsAuthenticated() with bad credentials = true, want false")
+	}
+
+	f := supermarket.NewFactory()
+	f.Register("walgreens", walgreens.Creator)
+	if _, err := f.Create(t.Context(), "walgreens", supermarket.WithBaseURL(s.URL), supermarket.WithLogin("", walgreenstest.Password)); err == nil {
+		t.Error("Create() without a username succeeded, want an error")
+	}
+}
+
+// A session shorter than the expiry delta of the token source is renewed on every request.
+func TestLoginRefresh(t *testing.T) {
+	s := walgreenstest.NewServer()
+	defer s.Close()
+	s.ExpiresIn = 5
+	ps := newPromotion(t, s)
+	for range 3 {
+		getClipDeals(t, ps)
+	}
+	if got := s.Logins(); got < 3 {
+		t.Errorf("Logins() = %d, want a login per request", got)
+	}
+}
+
+func TestLoyaltyCard(t *testing.T) {
+	s := walgreenstest.NewServer()
+	defer s.Close()
+	s.LoyaltyID = "9100000999999"
+
+	// Without a card the member id of the login is used.
+	if got := getClipDeals(t, newPromotion(t, s)); len(got) != 4 {
+		t.Errorf("GetClipDeals() returned %d coupons, want 4", len(got))
+	}
+	ps := newPromotion(t, s, supermarket.WithLoyaltyCard(s.LoyaltyID))
+	if got := getClipDeals(t, ps); len(got) != 4 {
+		t.Errorf("GetClipDeals() with the card returned %d coupons, want 4", len(got))
+	}
+	ps = newPromotion(t, s, supermarket.WithLoyaltyCard(walgreenstest.LoyaltyID))
+	if _, err := ps.GetClipDeals(t.Context(), promotion.PromotionSearchOptions{}); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("GetClipDeals() with another card = %v, want 403", err)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	s := walgreenstest.NewServer()
+	defer s.Close()
+	cds := getClipDeals(t, newPromotion(t, s))
+	if len(cds) != 4 {
+		t.Fatalf("GetClipDeals() returned %d coupons, want 4", len(cds))
+	}
+
+	dollar := cds["WAG-100231"]
+	if dollar.Brand != "Nature Made" || *dollar.PromoCode != "100231" || dollar.Type != promotion.PromotionTypeCoupon {
+		t.Errorf("coupon = %+v, want the Nature Made coupon 100231", dollar.Promotion)
+	}
+	if dollar.Discount == nil || dollar.Discount.Amount != 4 || dollar.Discount.Percent != 0 {
+		t.Errorf("dollar coupon discount = %+v, want $4 off", dollar.Discount)
+	}
+	if !slices.Equal(dollar.Categories, []string{"Vitamins"}) || !slices.Equal(dollar.Upcs, []string{"031604014582", "031604026165"}) {
+		t.Errorf("dollar coupon = categories %v, upcs %v, want Vitamins and its 2 upcs", dollar.Categories, dollar.Upcs)
+	}
+	if want := time.Date(2025, 5, 25, 4, 59, 59, 0, time.UTC); !dollar.EndDate.Equal(want) {
+		t.Errorf("dollar coupon end date = %v, want %v", dollar.EndDate, want)
+	}
+	if !dollar.IsClippable || dollar.IsClipped || dollar.IsDeleted || dollar.Status != "unclipped" || !dollar.PreviouslyPurchased || !dollar.ExpiresAfterClip {
+		t.Errorf("dollar coupon = %+v, want a recommended coupon to clip", dollar)
+	}
+
+	if percent := cds["WAG-100245"]; percent.Discount == nil || percent.Discount.Percent != 25 || percent.Discount.Amount != 0 {
+		t.Errorf("percent coupon discount = %+v, want 25%% off", percent.Discount)
+	}
+	clipped := cds["WAG-100260"]
+	if clipped.MinPurchaseQuantity == nil || *clipped.MinPurchaseQuantity != 2 || clipped.MaxPurchaseQuantity == nil || *clipped.MaxPurchaseQuantity != 1 {
+		t.Errorf("clipped coupon quantities = %v to %v, want 2 to 1", clipped.MinPurchaseQuantity, clipped.MaxPurchaseQuantity)
+	}
+	if !clipped.IsClipped || clipped.Status != "clipped" {
+		t.Errorf("clipped coupon = %+v, want clipped", clipped.Promotion)
+	}
+	if redeemed := cds["WAG-100288"]; !redeemed.IsDeleted || redeemed.IsClippable {
+		t.Errorf("redeemed coupon = %+v, want deleted", redeemed.Promotion)
+	}
+}
+
+func TestGetClipDealsPagination(t *testing.T) {
+	var coupons []walgreens.Coupon
+	for i := range 230 {
+		coupons = append(coupons, walgreens.Coupon{ID: fmt.Sprint(i), Type: walgreens.COUPON_TYPE_DOLLAR, Amount: 1, Clippable: true})
+	}
+	s := walgreenstest.NewServerWithCoupons(coupons)
+	defer s.Close()
+	if got := getClipDeals(t, newPromotion(t, s)); len(got) != len(coupons) {
+		t.Errorf("GetClipDeals() returned %d coupons, want %d", len(got), len(coupons))
+	}
+}
+
+func TestClipDeal(t *testing.T) {
+	s := walgreenstest.NewServer()
+	defer s.Close()
+	ps := newPromotion(t, s)
+	cds := getClipDeals(t, ps)
+	cd := cds["WAG-100231"]
+	if err := ps.ClipDeal(t.Context(), cd); err != nil {
+		t.Fatalf("ClipDeal() failed: %v", err)
+	}
+	if got := getClipDeals(t, ps)["WAG-100231"]; !got.IsClipped {
+		t.Errorf("GetClipDeals() after ClipDeal() = %+v, want clipped", got.Promotion)
+	}
+
+	// A stale copy is rejected by the server, a fresh one before the request.
+	if err := ps.ClipDeal(t.Context(), cd); err == nil || !strings.Contains(err.Error(), "coupon already clipped") {
+		t.Errorf("ClipDeal(stale copy) = %v, want the server error", err)
+	}
+	if err := ps.ClipDeal(t.Context(), cds["WAG-100260"]); err == nil || !strings.Contains(err.Error(), "already clipped") {
+		t.Errorf("ClipDeal(clipped) = %v, want already clipped", err)
+	}
+	if err := ps.ClipDeal(t.Context(), cds["WAG-100288"]); err == nil {
+		t.Error("ClipDeal(redeemed) succeeded")
+	}
+	if got := s.Clips(); !slices.Equal(got, []string{"WAG-100231"}) {
+		t.Errorf("Clips() = %v, want only the first coupon", got)
+	}
+}
+
+// The fixture has one clipped coupon, a limit of 2 allows a single clip.
+func TestClipDealLimit(t *testing.T) {
+	s := walgreenstest.NewServer()
+	defer s.Close()
+	s.ClipLimit = 2
+	ps := newPromotion(t, s)
+	cds := getClipDeals(t, ps)
+	if err := ps.ClipDeal(t.Context(), cds["WAG-100231"]); err != nil {
+		t.Fatalf("ClipDeal() failed: %v", err)
+	}
+	err := ps.ClipDeal(t.Context(), cds["WAG-100245"])
+	if !errors.Is(err, promotion.ErrClipLimitReached) {
+		t.Errorf("ClipDeal() over the limit = %v, want %v", err, promotion.ErrClipLimitReached)
+	}
+	// Other errors of the server aren't the clip limit.
+	unknown := promotion.ClipDeal{Promotion: promotion.Promotion{ID: "nope", IsClippable: true}}
+	if err := ps.ClipDeal(t.Context(), unknown); err == nil || errors.Is(err, promotion.ErrClipLimitReached) {
+		t.Errorf("ClipDeal(unknown) = %v, want an error other than the clip limit", err)
+	}
+}
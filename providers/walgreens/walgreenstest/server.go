@@ -0,0 +1,221 @@
+// Package walgreenstest provides a fake Walgreens coupons server, seeded with recorded fixtures, to
+// exercise the walgreens provider without network access.
+package walgreenstest
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/csobrinho/supermarket-api/pkg/supermarket"
+	"github.com/csobrinho/supermarket-api/providers/walgreens"
+)
+
+//go:embed fixtures/coupons.json
+var couponsFixture []byte
+
+// Default account accepted by the server.
+const (
+	Username  = "shopper@example.com"
+	Password  = "hunter2"
+	LoyaltyID = "9100000123456"
+)
+
+// Server is a fake Walgreens API. Its exported fields can be changed before the first request.
+type Server struct {
+	*httptest.Server
+
+	Username  string
+	Password  string
+	LoyaltyID string
+	ClipLimit int // Maximum number of clipped coupons, zero means unlimited.
+	ExpiresIn int // Lifetime of the sessions in seconds.
+
+	mu      sync.Mutex
+	coupons []walgreens.Coupon
+	tokens  map[string]bool
+	logins  int
+	clips   []string
+}
+
+// NewServer starts a server seeded with the recorded coupons. Call Close when done.
+func NewServer() *Server {
+	res := walgreens.CouponsResponse{}
+	if err := json.Unmarshal(couponsFixture, &res); err != nil {
+		panic(fmt.Sprintf("walgreenstest: decode fixture, error %v", err))
+	}
+	return NewServerWithCoupons(res.Coupons)
+}
+
+// NewServerWithCoupons starts a server seeded with the coupons. Call Close when done.
+func NewServerWithCoupons(coupons []walgreens.Coupon) *Server {
+	s := &Server{
+		Username:  Username,
+		Password:  Password,
+		LoyaltyID: LoyaltyID,
+		ExpiresIn: 1200,
+		coupons:   slices.Clone(coupons),
+		tokens:    map[string]bool{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+walgreens.LOGIN_PATH, s.login)
+	mux.HandleFunc("GET "+walgreens.COUPONS_PATH, s.listCoupons)
+	mux.HandleFunc("POST "+walgreens.COUPON_CLIP_PATH, s.clipCoupon)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Fixture starts a server for the test, closed when it ends, and returns the options to create a
+// walgreens client against it. It is a supermarkettest.Fixture.
+func Fixture(t testing.TB) []supermarket.Option {
+	s := NewServer()
+	t.Cleanup(s.Close)
+	return s.Options()
+}
+
+// Options returns the options to create a walgreens client against the server.
+func (s *Server) Options() []supermarket.Option {
+	return []supermarket.Option{
+		supermarket.WithBaseURL(s.URL),
+		supermarket.WithLogin(s.Username, s.Password),
+	}
+}
+
+// Coupons returns the current state of the coupons.
+func (s *Server) Coupons() []walgreens.Coupon {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.coupons)
+}
+
+// Clips returns the ids of the coupons clipped through the server, in order.
+func (s *Server) Clips() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.clips)
+}
+
+// Logins returns the number of successful logins.
+func (s *Server) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	req := walgreens.LoginRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+	if req.Username != s.Username || req.Password != s.Password {
+		writeError(w, http.StatusUnauthorized, "INVALID_CREDENTIALS", "the username or password is incorrect")
+		return
+	}
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	token := hex.EncodeToString(b)
+	s.mu.Lock()
+	s.tokens[token] = true
+	s.logins++
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, walgreens.LoginResponse{AccessToken: token, ExpiresIn: s.ExpiresIn, LoyaltyID: s.LoyaltyID})
+}
+
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) bool {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	ok := s.tokens[token]
+	s.mu.Unlock()
+	if !found || !ok {
+		writeError(w, http.StatusUnauthorized, "SESSION_EXPIRED", "please log in again")
+		return false
+	}
+	return true
+}
+
+func (s *Server) listCoupons(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticate(w, r) {
+		return
+	}
+	q := r.URL.Query()
+	if q.Get("loyaltyId") != s.LoyaltyID {
+		writeError(w, http.StatusForbidden, "INVALID_LOYALTY_ID", "unknown loyalty id")
+		return
+	}
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	s.mu.Lock()
+	coupons := slices.Clone(s.coupons)
+	s.mu.Unlock()
+
+	res := walgreens.CouponsResponse{Coupons: []walgreens.Coupon{}, Offset: offset, Total: len(coupons)}
+	if offset < len(coupons) {
+		res.Coupons = coupons[offset:min(offset+limit, len(coupons))]
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) clipCoupon(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticate(w, r) {
+		return
+	}
+	req := walgreens.ClipRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+	if req.LoyaltyID != s.LoyaltyID {
+		writeError(w, http.StatusForbidden, "INVALID_LOYALTY_ID", "unknown loyalty id")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.coupons, func(c walgreens.Coupon) bool { return c.ID == req.CouponID })
+	switch {
+	case i < 0:
+		writeError(w, http.StatusNotFound, "COUPON_NOT_FOUND", "coupon not found")
+		return
+	case s.coupons[i].Clipped:
+		writeError(w, http.StatusConflict, "COUPON_ALREADY_CLIPPED", "coupon already clipped")
+		return
+	case !s.coupons[i].Clippable || s.coupons[i].Redeemed:
+		writeError(w, http.StatusUnprocessableEntity, "COUPON_UNAVAILABLE", "coupon can't be clipped")
+		return
+	}
+	clipped := 0
+	for _, c := range s.coupons {
+		if c.Clipped {
+			clipped++
+		}
+	}
+	if s.ClipLimit > 0 && clipped >= s.ClipLimit {
+		writeError(w, http.StatusBadRequest, walgreens.ERROR_CODE_CLIP_LIMIT, "you have reached the maximum number of clipped coupons")
+		return
+	}
+	s.coupons[i].Clipped = true
+	s.clips = append(s.clips, s.coupons[i].ID)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "clipped"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, walgreens.ErrorResponse{Code: code, Message: message})
+}